@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+
+	"pkg.aiocean.dev/polvoservice/internal/gateway"
+	"pkg.aiocean.dev/polvoservice/internal/server"
+	"pkg.aiocean.dev/serviceutil/handler"
+)
+
+type App struct {
+	Handler           *handler.Handler
+	Purger            *server.Purger
+	RolloutScheduler  *server.RolloutScheduler
+	WebhookDispatcher *server.WebhookDispatcher
+	OutboxRelay       *server.OutboxRelay
+	ChangeFeed        *server.ChangeFeed
+	Gateway           *gateway.Gateway
+}
+
+// Run starts the background workers and the HTTP gateway, and serves gRPC
+// until the handler stops.
+func (a *App) Run(ctx context.Context) {
+	go a.Purger.Run(ctx)
+	go a.RolloutScheduler.Run(ctx)
+	go a.WebhookDispatcher.Run(ctx)
+	go a.OutboxRelay.Run(ctx)
+	go a.ChangeFeed.Run(ctx)
+	go a.Gateway.Run(ctx)
+
+	a.Handler.Serve()
+}
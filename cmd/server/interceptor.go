@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+	"pkg.aiocean.dev/serviceutil/interceptor"
+)
+
+// NewStreamServerInterceptor runs the serviceutil interceptor, then the
+// authentication, so rejected calls are still logged, and passes the caller
+// to the repository.
+func NewStreamServerInterceptor(logger *zap.Logger, authenticator *auth.Authenticator) interceptor.StreamServerInterceptor {
+	return interceptor.StreamServerInterceptor(auth.ChainStreamServerInterceptors(
+		grpc.StreamServerInterceptor(interceptor.NewStreamServerInterceptor(logger)),
+		auth.ChainStreamServerInterceptors(authenticator.StreamServerInterceptor(), actorStreamServerInterceptor),
+	))
+}
+
+// NewUnaryServerInterceptor runs the serviceutil interceptor, then the
+// authentication, so rejected calls are still logged, and passes the caller
+// to the repository.
+func NewUnaryServerInterceptor(logger *zap.Logger, authenticator *auth.Authenticator) interceptor.UnaryServerInterceptor {
+	return interceptor.UnaryServerInterceptor(auth.ChainUnaryServerInterceptors(
+		grpc.UnaryServerInterceptor(interceptor.NewUnaryServerInterceptor(logger)),
+		auth.ChainUnaryServerInterceptors(authenticator.UnaryServerInterceptor(), actorUnaryServerInterceptor),
+	))
+}
+
+// withActor records the changes of the call as made by the authenticated
+// caller, the repository does not depend on auth.
+func withActor(ctx context.Context) context.Context {
+	if principal, ok := auth.FromContext(ctx); ok {
+		return repository.WithActor(ctx, principal.Subject)
+	}
+
+	return ctx
+}
+
+func actorUnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(withActor(ctx), req)
+}
+
+func actorStreamServerInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &actorStream{ServerStream: stream, ctx: withActor(stream.Context())})
+}
+
+type actorStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *actorStream) Context() context.Context {
+	return s.ctx
+}
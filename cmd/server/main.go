@@ -9,10 +9,10 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*10)
 	defer cancel()
 
-	handler, err := InitializeHandler(ctx)
+	app, err := InitializeApp(ctx)
 	if err != nil {
 		panic(err)
 	}
 
-	handler.Serve()
+	app.Run(context.Background())
 }
@@ -6,17 +6,36 @@ import (
 	"context"
 
 	"github.com/google/wire"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/gateway"
+	"pkg.aiocean.dev/polvoservice/internal/manifest"
 	"pkg.aiocean.dev/polvoservice/internal/repository"
 	"pkg.aiocean.dev/polvoservice/internal/server"
 	"pkg.aiocean.dev/serviceutil/handler"
-	"pkg.aiocean.dev/serviceutil/wireset"
+	"pkg.aiocean.dev/serviceutil/healthserver"
+	"pkg.aiocean.dev/serviceutil/logger"
 )
 
-func InitializeHandler(ctx context.Context) (*handler.Handler, error) {
+func InitializeApp(ctx context.Context) (*App, error) {
 	wire.Build(
-		repository.DgraphWireSet,
-		wireset.Default,
+		repository.WireSet,
+		auth.WireSet,
+		manifest.WireSet,
+		// wireset.Default without its interceptors, which are wrapped by
+		// NewStreamServerInterceptor and NewUnaryServerInterceptor.
+		logger.NewLogger,
+		healthserver.NewHealthServer,
+		handler.NewHandler,
+		NewStreamServerInterceptor,
+		NewUnaryServerInterceptor,
 		server.WireSet,
+		server.NewPurger,
+		server.NewRolloutScheduler,
+		server.NewWebhookDispatcher,
+		server.NewOutboxRelay,
+		server.NewChangeFeed,
+		gateway.WireSet,
+		wire.Struct(new(App), "*"),
 	)
 
 	return nil, nil
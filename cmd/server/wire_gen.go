@@ -7,29 +7,72 @@ package main
 
 import (
 	"context"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/gateway"
+	"pkg.aiocean.dev/polvoservice/internal/manifest"
 	"pkg.aiocean.dev/polvoservice/internal/repository"
 	"pkg.aiocean.dev/polvoservice/internal/server"
 	"pkg.aiocean.dev/serviceutil/handler"
 	"pkg.aiocean.dev/serviceutil/healthserver"
-	"pkg.aiocean.dev/serviceutil/interceptor"
 	"pkg.aiocean.dev/serviceutil/logger"
 )
 
 // Injectors from wire.go:
 
-func InitializeHandler(ctx context.Context) (*handler.Handler, error) {
+func InitializeApp(ctx context.Context) (*App, error) {
 	zapLogger, err := logger.NewLogger(ctx)
 	if err != nil {
 		return nil, err
 	}
-	dgraphRepository, err := repository.NewDgraphRepository()
+	repositoryRepository, err := repository.NewRepository()
 	if err != nil {
 		return nil, err
 	}
-	serverServer := server.NewServer(zapLogger, dgraphRepository)
-	streamServerInterceptor := interceptor.NewStreamServerInterceptor(zapLogger)
-	unaryServerInterceptor := interceptor.NewUnaryServerInterceptor(zapLogger)
+	authenticator, err := auth.NewAuthenticator()
+	if err != nil {
+		return nil, err
+	}
+	validator, err := manifest.NewValidator()
+	if err != nil {
+		return nil, err
+	}
+	serverServer := server.NewServer(zapLogger, repositoryRepository, authenticator, validator)
+	streamServerInterceptor := NewStreamServerInterceptor(zapLogger, authenticator)
+	unaryServerInterceptor := NewUnaryServerInterceptor(zapLogger, authenticator)
 	healthserverServer := healthserver.NewHealthServer()
 	handlerHandler := handler.NewHandler(ctx, zapLogger, serverServer, streamServerInterceptor, unaryServerInterceptor, healthserverServer)
-	return handlerHandler, nil
+	purger, err := server.NewPurger(zapLogger, serverServer)
+	if err != nil {
+		return nil, err
+	}
+	rolloutScheduler, err := server.NewRolloutScheduler(zapLogger, serverServer)
+	if err != nil {
+		return nil, err
+	}
+	webhookDispatcher, err := server.NewWebhookDispatcher(zapLogger, serverServer)
+	if err != nil {
+		return nil, err
+	}
+	outboxRelay, err := server.NewOutboxRelay(zapLogger, serverServer)
+	if err != nil {
+		return nil, err
+	}
+	changeFeed, err := server.NewChangeFeed(zapLogger, serverServer)
+	if err != nil {
+		return nil, err
+	}
+	gatewayGateway, err := gateway.NewGateway(zapLogger, serverServer, streamServerInterceptor, unaryServerInterceptor)
+	if err != nil {
+		return nil, err
+	}
+	app := &App{
+		Handler:           handlerHandler,
+		Purger:            purger,
+		RolloutScheduler:  rolloutScheduler,
+		WebhookDispatcher: webhookDispatcher,
+		OutboxRelay:       outboxRelay,
+		ChangeFeed:        changeFeed,
+		Gateway:           gatewayGateway,
+	}
+	return app, nil
 }
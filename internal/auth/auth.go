@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrUnauthenticated  = errors.New("unauthenticated")
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// Role is what a caller may do with a package. Each role includes the ones
+// below it.
+type Role int
+
+const (
+	// RoleReader may read the package when reads are not public.
+	RoleReader Role = iota + 1
+	// RolePublisher may create, re-weight and promote versions.
+	RolePublisher
+	// RoleOwner may also update and delete the package and its versions.
+	RoleOwner
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleReader:
+		return "reader"
+	case RolePublisher:
+		return "publisher"
+	case RoleOwner:
+		return "owner"
+	default:
+		return "none"
+	}
+}
+
+func parseRole(value string) (Role, error) {
+	for _, role := range []Role{RoleReader, RolePublisher, RoleOwner} {
+		if value == role.String() {
+			return role, nil
+		}
+	}
+
+	return 0, errors.Errorf("unknown role %q", value)
+}
+
+// Principal is the authenticated caller.
+type Principal struct {
+	Subject string
+	// Admin callers have every role on every package.
+	Admin bool
+}
+
+type principalKey struct{}
+
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+
+	return principal, ok && principal != nil
+}
+
+// ParseMaintainer parses the maintainer field of a package, a comma separated
+// list of subjects each optionally followed by ":" and a role, e.g.
+// "alice@example.com, ci-bot:publisher, bob@example.com:reader". Subjects
+// without a role are owners. Subjects can contain ":", like
+// "spiffe://example.org/ci", only a last segment that is a role is split off.
+func ParseMaintainer(maintainer string) (map[string]Role, error) {
+	roles := map[string]Role{}
+
+	for _, entry := range strings.Split(maintainer, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		subject, role := entry, RoleOwner
+		if i := strings.LastIndex(entry, ":"); i >= 0 {
+			if parsedRole, err := parseRole(entry[i+1:]); err == nil {
+				subject, role = entry[:i], parsedRole
+			}
+		}
+
+		if subject == "" {
+			return nil, errors.Errorf("maintainer %q has no subject", entry)
+		}
+
+		if role > roles[subject] {
+			roles[subject] = role
+		}
+	}
+
+	return roles, nil
+}
+
+// RoleOf returns the role of the subject in the maintainer field, 0 when it
+// has none. Malformed entries grant nothing.
+func RoleOf(maintainer, subject string) Role {
+	roles, err := ParseMaintainer(maintainer)
+	if err != nil {
+		return 0
+	}
+
+	return roles[subject]
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestParseMaintainer(t *testing.T) {
+	tests := []struct {
+		maintainer string
+		want       map[string]Role
+	}{
+		{"", map[string]Role{}},
+		{"alice@example.com", map[string]Role{"alice@example.com": RoleOwner}},
+		{
+			"alice@example.com, ci-bot:publisher, bob@example.com:reader",
+			map[string]Role{"alice@example.com": RoleOwner, "ci-bot": RolePublisher, "bob@example.com": RoleReader},
+		},
+		{"spiffe://example.org/ns/ci", map[string]Role{"spiffe://example.org/ns/ci": RoleOwner}},
+		{"spiffe://example.org/ns/ci:publisher", map[string]Role{"spiffe://example.org/ns/ci": RolePublisher}},
+		{"urn:team:web:reader", map[string]Role{"urn:team:web": RoleReader}},
+		{"urn:team:web", map[string]Role{"urn:team:web": RoleOwner}},
+		// The highest role of a subject listed twice wins.
+		{"ci-bot:reader, ci-bot:publisher", map[string]Role{"ci-bot": RolePublisher}},
+	}
+
+	for _, test := range tests {
+		roles, err := ParseMaintainer(test.maintainer)
+		if err != nil {
+			t.Errorf("ParseMaintainer(%q): %v", test.maintainer, err)
+			continue
+		}
+
+		if len(roles) != len(test.want) {
+			t.Errorf("ParseMaintainer(%q) = %v, want %v", test.maintainer, roles, test.want)
+			continue
+		}
+
+		for subject, role := range test.want {
+			if roles[subject] != role {
+				t.Errorf("ParseMaintainer(%q)[%q] = %v, want %v", test.maintainer, subject, roles[subject], role)
+			}
+		}
+	}
+}
+
+func TestParseMaintainerWithoutSubject(t *testing.T) {
+	for _, maintainer := range []string{":owner", "alice, :reader"} {
+		if _, err := ParseMaintainer(maintainer); err == nil {
+			t.Errorf("ParseMaintainer(%q) has no error", maintainer)
+		}
+	}
+}
+
+// newTestAuthenticator returns an Authenticator configured with the given
+// environment.
+func newTestAuthenticator(t *testing.T, env map[string]string) *Authenticator {
+	t.Helper()
+
+	for name, value := range env {
+		os.Setenv(name, value)
+		name := name
+		t.Cleanup(func() { os.Unsetenv(name) })
+	}
+
+	a, err := NewAuthenticator()
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+
+	return a
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	a := newTestAuthenticator(t, map[string]string{
+		"AUTH_API_KEYS": "ci-bot:key1, root:key2",
+		"AUTH_ADMINS":   "root",
+	})
+
+	tests := []struct {
+		key       string
+		want      string
+		wantAdmin bool
+		wantErr   bool
+	}{
+		{key: "key1", want: "ci-bot"},
+		{key: "key2", want: "root", wantAdmin: true},
+		{key: "key3", wantErr: true},
+	}
+
+	for _, test := range tests {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(apiKeyMetadata, test.key))
+
+		principal, err := a.Authenticate(ctx)
+		if test.wantErr {
+			if !errors.Is(err, ErrUnauthenticated) {
+				t.Errorf("Authenticate(%q) error = %v, want unauthenticated", test.key, err)
+			}
+			continue
+		}
+
+		if err != nil || principal.Subject != test.want || principal.Admin != test.wantAdmin {
+			t.Errorf("Authenticate(%q) = %+v, %v", test.key, principal, err)
+		}
+	}
+
+	if principal, err := a.Authenticate(context.Background()); principal != nil || err != nil {
+		t.Errorf("Authenticate without credentials = %+v, %v, want nil", principal, err)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(authorizationMetadata, "Bearer token"))
+	if _, err := a.Authenticate(ctx); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Authenticate a bearer token without JWKS error = %v, want unauthenticated", err)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	a := newTestAuthenticator(t, map[string]string{"AUTH_PUBLIC_READS": "false"})
+	maintainer := "alice, ci-bot:publisher"
+
+	tests := []struct {
+		principal *Principal
+		role      Role
+		want      error
+	}{
+		{principal: nil, role: RoleReader, want: ErrUnauthenticated},
+		{principal: &Principal{Subject: "alice"}, role: RoleOwner},
+		{principal: &Principal{Subject: "ci-bot"}, role: RolePublisher},
+		{principal: &Principal{Subject: "ci-bot"}, role: RoleOwner, want: ErrPermissionDenied},
+		{principal: &Principal{Subject: "bob"}, role: RoleReader, want: ErrPermissionDenied},
+		{principal: &Principal{Subject: "bob", Admin: true}, role: RoleOwner},
+	}
+
+	for _, test := range tests {
+		ctx := context.Background()
+		if test.principal != nil {
+			ctx = NewContext(ctx, test.principal)
+		}
+
+		err := a.Authorize(ctx, maintainer, test.role)
+		if (test.want == nil && err != nil) || (test.want != nil && !errors.Is(err, test.want)) {
+			t.Errorf("Authorize(%+v, %v) = %v, want %v", test.principal, test.role, err, test.want)
+		}
+	}
+}
+
+func TestAuthenticateCall(t *testing.T) {
+	a := newTestAuthenticator(t, map[string]string{"AUTH_API_KEYS": "alice:key1"})
+
+	// Reads are public, changes need credentials.
+	if _, err := a.authenticateCall(context.Background(), "/aiocean.polvo.v1.PolvoService/GetPackage"); err != nil {
+		t.Errorf("GetPackage without credentials: %v", err)
+	}
+
+	if _, err := a.authenticateCall(context.Background(), "/aiocean.polvo.v1.PolvoService/DeletePackage"); err == nil {
+		t.Error("DeletePackage without credentials has no error")
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(apiKeyMetadata, "key1"))
+	ctx, err := a.authenticateCall(ctx, "/aiocean.polvo.v1.PolvoService/DeletePackage")
+	if err != nil {
+		t.Fatalf("DeletePackage with an API key: %v", err)
+	}
+
+	if principal, ok := FromContext(ctx); !ok || principal.Subject != "alice" {
+		t.Errorf("principal = %+v, want alice", principal)
+	}
+}
+
+func TestRoleOf(t *testing.T) {
+	maintainer := "spiffe://example.org/ci:publisher, alice"
+
+	if role := RoleOf(maintainer, "spiffe://example.org/ci"); role != RolePublisher {
+		t.Errorf("RoleOf(spiffe) = %v, want publisher", role)
+	}
+
+	if role := RoleOf(maintainer, "spiffe"); role != 0 {
+		t.Errorf("RoleOf(spiffe prefix) = %v, want none", role)
+	}
+}
+
+func TestIsMutatingMethod(t *testing.T) {
+	for method, want := range map[string]bool{
+		"/aiocean.polvo.v1.PolvoService/CreateVersion":   true,
+		"/aiocean.polvo.v1.PolvoService/PromoteChannel":  true,
+		"/aiocean.polvo.v1.PolvoService/RollbackPackage": true,
+		"/aiocean.polvo.v1.PolvoService/PauseRollout":    true,
+		"/aiocean.polvo.v1.PolvoService/GetVersion":      false,
+		"/aiocean.polvo.v1.PolvoService/WatchRollout":    false,
+		"/aiocean.polvo.v1.PolvoService/ListAuditEvents": false,
+	} {
+		if got := isMutatingMethod(method); got != want {
+			t.Errorf("isMutatingMethod(%s) = %v, want %v", method, got, want)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/wire"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+)
+
+var WireSet = wire.NewSet(
+	NewAuthenticator,
+)
+
+const (
+	authorizationMetadata = "authorization"
+	apiKeyMetadata        = "x-api-key"
+)
+
+// Authenticator identifies callers from a bearer JWT or a static API key and
+// checks their roles. It is configured from the environment:
+//
+//  AUTH_DISABLED        "true" lets every call through, for local development.
+//  AUTH_JWKS_FILE       JSON Web Key Set used to verify bearer tokens.
+//  AUTH_JWT_ISSUER      required "iss" of bearer tokens, not checked if empty.
+//  AUTH_JWT_AUDIENCE    required "aud" of bearer tokens, not checked if empty.
+//  AUTH_SUBJECT_CLAIM   claim naming the caller, "sub" by default.
+//  AUTH_API_KEYS        comma separated "subject:key" pairs.
+//  AUTH_ADMINS          comma separated subjects that have every role.
+//  AUTH_PUBLIC_READS    "false" requires the reader role to read a package.
+type Authenticator struct {
+	disabled     bool
+	publicReads  bool
+	keys         map[string]interface{}
+	issuer       string
+	audience     string
+	subjectClaim string
+	// apiKeys maps the SHA-256 of each API key to its subject, so keys are
+	// compared in constant time and never kept in clear.
+	apiKeys map[[sha256.Size]byte]string
+	admins  map[string]bool
+}
+
+func NewAuthenticator() (*Authenticator, error) {
+	a := &Authenticator{
+		publicReads:  true,
+		issuer:       os.Getenv("AUTH_JWT_ISSUER"),
+		audience:     os.Getenv("AUTH_JWT_AUDIENCE"),
+		subjectClaim: "sub",
+		apiKeys:      map[[sha256.Size]byte]string{},
+		admins:       map[string]bool{},
+	}
+
+	for name, value := range map[string]*bool{
+		"AUTH_DISABLED":     &a.disabled,
+		"AUTH_PUBLIC_READS": &a.publicReads,
+	} {
+		if os.Getenv(name) == "" {
+			continue
+		}
+
+		parsed, err := strconv.ParseBool(os.Getenv(name))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", name)
+		}
+
+		*value = parsed
+	}
+
+	if claim := os.Getenv("AUTH_SUBJECT_CLAIM"); claim != "" {
+		a.subjectClaim = claim
+	}
+
+	if path := os.Getenv("AUTH_JWKS_FILE"); path != "" {
+		keys, err := loadJWKS(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid AUTH_JWKS_FILE")
+		}
+
+		a.keys = keys
+	}
+
+	for _, pair := range splitList(os.Getenv("AUTH_API_KEYS")) {
+		i := strings.Index(pair, ":")
+		if i <= 0 || i == len(pair)-1 {
+			return nil, errors.New("invalid AUTH_API_KEYS, expected subject:key pairs")
+		}
+
+		a.apiKeys[sha256.Sum256([]byte(pair[i+1:]))] = pair[:i]
+	}
+
+	for _, subject := range splitList(os.Getenv("AUTH_ADMINS")) {
+		a.admins[subject] = true
+	}
+
+	return a, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func (a *Authenticator) Disabled() bool {
+	return a.disabled
+}
+
+func (a *Authenticator) PublicReads() bool {
+	return a.disabled || a.publicReads
+}
+
+// Authenticate returns the caller identified by the request metadata, or nil
+// when the request has no credentials. Invalid credentials are an error.
+func (a *Authenticator) Authenticate(ctx context.Context) (*Principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if values := md.Get(apiKeyMetadata); len(values) > 0 {
+		return a.authenticateAPIKey(values[0])
+	}
+
+	if values := md.Get(authorizationMetadata); len(values) > 0 {
+		const prefix = "bearer "
+		if len(values[0]) <= len(prefix) || !strings.EqualFold(values[0][:len(prefix)], prefix) {
+			return nil, errors.Wrap(ErrUnauthenticated, "authorization is not a bearer token")
+		}
+
+		return a.authenticateToken(values[0][len(prefix):])
+	}
+
+	return nil, nil
+}
+
+func (a *Authenticator) authenticateAPIKey(key string) (*Principal, error) {
+	sum := sha256.Sum256([]byte(key))
+
+	subject := ""
+	for keySum, keySubject := range a.apiKeys {
+		if subtle.ConstantTimeCompare(keySum[:], sum[:]) == 1 {
+			subject = keySubject
+		}
+	}
+
+	if subject == "" {
+		return nil, errors.Wrap(ErrUnauthenticated, "unknown API key")
+	}
+
+	return a.principal(subject), nil
+}
+
+func (a *Authenticator) authenticateToken(tokenString string) (*Principal, error) {
+	if len(a.keys) == 0 {
+		return nil, errors.Wrap(ErrUnauthenticated, "bearer tokens are not accepted")
+	}
+
+	parser := &jwt.Parser{
+		ValidMethods: []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"},
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := parser.ParseWithClaims(tokenString, claims, a.key); err != nil {
+		return nil, errors.Wrapf(ErrUnauthenticated, "invalid bearer token: %s", err)
+	}
+
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return nil, errors.Wrap(ErrUnauthenticated, "bearer token has another issuer")
+	}
+
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return nil, errors.Wrap(ErrUnauthenticated, "bearer token has another audience")
+	}
+
+	subject, _ := claims[a.subjectClaim].(string)
+	if subject == "" {
+		return nil, errors.Wrapf(ErrUnauthenticated, "bearer token has no %s claim", a.subjectClaim)
+	}
+
+	return a.principal(subject), nil
+}
+
+// key picks the JWKS key named by the kid header of the token.
+func (a *Authenticator) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := a.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	return key, nil
+}
+
+func (a *Authenticator) principal(subject string) *Principal {
+	return &Principal{
+		Subject: subject,
+		Admin:   a.admins[subject],
+	}
+}
+
+// Authorize checks that the caller has at least role in the package with the
+// given maintainer field.
+func (a *Authenticator) Authorize(ctx context.Context, maintainer string, role Role) error {
+	if a.disabled || (role == RoleReader && a.publicReads) {
+		return nil
+	}
+
+	principal, ok := FromContext(ctx)
+	if !ok {
+		return errors.Wrap(ErrUnauthenticated, "credentials are required")
+	}
+
+	if principal.Admin || RoleOf(maintainer, principal.Subject) >= role {
+		return nil
+	}
+
+	return errors.Wrapf(ErrPermissionDenied, "%s does not have the %s role in the package", principal.Subject, role)
+}
+
+// AuthorizeAdmin checks that the caller is an admin.
+func (a *Authenticator) AuthorizeAdmin(ctx context.Context) error {
+	if a.disabled {
+		return nil
+	}
+
+	principal, ok := FromContext(ctx)
+	if !ok {
+		return errors.Wrap(ErrUnauthenticated, "credentials are required")
+	}
+
+	if !principal.Admin {
+		return errors.Wrapf(ErrPermissionDenied, "%s is not an admin", principal.Subject)
+	}
+
+	return nil
+}
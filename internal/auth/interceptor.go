@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// mutatingMethodPrefixes are the RPC name prefixes that change the registry.
+// They always need credentials, the other RPCs only when reads are not public.
+var mutatingMethodPrefixes = []string{
+	"Create", "Update", "Delete", "Undelete", "Purge",
+	"Promote", "Rollback", "Set", "Start", "Pause", "Resume", "Abort", "Redeliver",
+}
+
+func (a *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authenticateCall(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (a *Authenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticateCall(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// authenticateCall stores the caller in the context of the call. Health
+// checks are never authenticated.
+func (a *Authenticator) authenticateCall(ctx context.Context, fullMethod string) (context.Context, error) {
+	if a.disabled || strings.HasPrefix(fullMethod, "/grpc.health.") {
+		return ctx, nil
+	}
+
+	principal, err := a.Authenticate(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	if principal == nil {
+		if isMutatingMethod(fullMethod) || !a.publicReads {
+			return nil, status.Error(codes.Unauthenticated, "credentials are required")
+		}
+
+		return ctx, nil
+	}
+
+	return NewContext(ctx, principal), nil
+}
+
+func isMutatingMethod(fullMethod string) bool {
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+
+	for _, prefix := range mutatingMethodPrefixes {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// ChainUnaryServerInterceptors runs outer first, then inner, then the handler.
+func ChainUnaryServerInterceptors(outer, inner grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	if outer == nil {
+		return inner
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return outer(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return inner(ctx, req, info, handler)
+		})
+	}
+}
+
+// ChainStreamServerInterceptors runs outer first, then inner, then the
+// handler.
+func ChainStreamServerInterceptors(outer, inner grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	if outer == nil {
+		return inner
+	}
+
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return outer(srv, stream, info, func(srv interface{}, stream grpc.ServerStream) error {
+			return inner(srv, stream, info, handler)
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxRequestBody caps the size of the JSON body of an API request.
+const maxRequestBody = 1 << 20
+
+// apiRoute is a JSON route of an RPC that has no polvo_v1 message. Its path
+// is matched segment by segment, "*" matching any segment, and handle gets
+// the segments of the request path.
+type apiRoute struct {
+	method string
+	path   []string
+	handle func(g *Gateway, ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string)
+}
+
+func route(method, path string, handle func(g *Gateway, ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string)) apiRoute {
+	return apiRoute{method: method, path: strings.Split(path, "/"), handle: handle}
+}
+
+// apiRoutes are the routes of the RPCs of the server that are not in the
+// polvo_v1 proto, see Gateway.
+var apiRoutes = []apiRoute{
+	route(http.MethodGet, "packages/*/details", (*Gateway).describePackage),
+	route(http.MethodPost, "packages/*/undelete", (*Gateway).undeletePackage),
+	route(http.MethodGet, "packages/*/routing", (*Gateway).listRoutingRevisions),
+	route(http.MethodPost, "packages/*/rollback", (*Gateway).rollbackPackage),
+	route(http.MethodPut, "packages/*/weights", (*Gateway).setPackageWeights),
+	route(http.MethodGet, "packages/*/versions/*/details", (*Gateway).describeVersion),
+	route(http.MethodPost, "packages/*/versions/*/undelete", (*Gateway).undeleteVersion),
+	route(http.MethodGet, "packages/*/versions/*/manifest/integrity", (*Gateway).checkManifestIntegrity),
+	route(http.MethodGet, "packages/*/versions/*/manifest/pinned", (*Gateway).getPinnedManifest),
+	route(http.MethodGet, "packages/*/channels", (*Gateway).listChannels),
+	route(http.MethodPost, "packages/*/channels", (*Gateway).createChannel),
+	route(http.MethodGet, "packages/*/channels/*", (*Gateway).getChannel),
+	route(http.MethodPost, "packages/*/channels/*/promote", (*Gateway).promoteChannel),
+	route(http.MethodPost, "packages/*/channels/*/rollback", (*Gateway).rollbackChannel),
+	route(http.MethodGet, "packages/*/rollouts", (*Gateway).listRollouts),
+	route(http.MethodPost, "packages/*/rollouts", (*Gateway).startRollout),
+	route(http.MethodGet, "rollouts/*", (*Gateway).getRollout),
+	route(http.MethodPost, "rollouts/*/pause", (*Gateway).pauseRollout),
+	route(http.MethodPost, "rollouts/*/resume", (*Gateway).resumeRollout),
+	route(http.MethodPost, "rollouts/*/abort", (*Gateway).abortRollout),
+	route(http.MethodGet, "rollouts/*/watch", (*Gateway).watchRollout),
+	route(http.MethodGet, "webhooks", (*Gateway).listWebhooks),
+	route(http.MethodPost, "webhooks", (*Gateway).createWebhook),
+	route(http.MethodGet, "webhooks/*", (*Gateway).getWebhook),
+	route(http.MethodDelete, "webhooks/*", (*Gateway).deleteWebhook),
+	route(http.MethodGet, "deliveries", (*Gateway).listWebhookDeliveries),
+	route(http.MethodPost, "deliveries/*/redeliver", (*Gateway).redeliverWebhookDelivery),
+	route(http.MethodGet, "audit", (*Gateway).listAuditEvents),
+	route(http.MethodPost, "purge", (*Gateway).purgeDeleted),
+}
+
+// matchAPIRoute returns the route of a request, or, when no route has its
+// method, the methods of the routes of its path.
+func matchAPIRoute(method string, segments []string) (*apiRoute, []string) {
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+
+	var allowed []string
+	for i := range apiRoutes {
+		route := &apiRoutes[i]
+		if !route.matches(segments) {
+			continue
+		}
+
+		if route.method == method {
+			return route, nil
+		}
+
+		allowed = append(allowed, route.method)
+	}
+
+	return nil, allowed
+}
+
+func (r *apiRoute) matches(segments []string) bool {
+	if len(segments) != len(r.path) {
+		return false
+	}
+
+	for i, segment := range r.path {
+		if segment != "*" && segment != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// unary calls an RPC of the server through the unary interceptor, as the
+// gRPC server would, and writes the response handler returns.
+func (g *Gateway) unary(ctx context.Context, w http.ResponseWriter, method string, request interface{}, handler grpc.UnaryHandler) {
+	call := newCall(ctx, method)
+	response, err := g.unaryInterceptor(call.ctx, request, call.unaryInfo(g.server), handler)
+
+	call.write(w, response, err)
+}
+
+func decodeBody(r *http.Request, body interface{}) error {
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody)).Decode(body); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid request body: %v", err)
+	}
+
+	return nil
+}
+
+func queryPageSize(query url.Values) (uint32, error) {
+	value := query.Get("page_size")
+	if value == "" {
+		return 0, nil
+	}
+
+	pageSize, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid page_size: %v", err)
+	}
+
+	return uint32(pageSize), nil
+}
+
+// queryTime parses an RFC 3339 query parameter, it is zero when the
+// parameter is not set.
+func queryTime(query url.Values, name string) (time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, status.Errorf(codes.InvalidArgument, "invalid %s: %v", name, err)
+	}
+
+	return parsed, nil
+}
+
+// duration is a time.Duration written in JSON as a string like "30m".
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = duration(parsed)
+
+	return nil
+}
+
+// timestamp leaves out the times that are not set.
+func timestamp(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// emptyJSON is the response of the RPCs that return nothing.
+type emptyJSON struct{}
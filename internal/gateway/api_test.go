@@ -0,0 +1,320 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+func TestDescribeRoutes(t *testing.T) {
+	httpServer := newTestGateway(t)
+
+	var pkg packageDetailsJSON
+	if resp := do(t, http.MethodGet, httpServer.URL+"/packages/button/details", "", "", &pkg); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET package details: status %d", resp.StatusCode)
+	}
+
+	if pkg.Package.GetName() != "button" || pkg.CreatedAt == nil {
+		t.Errorf("package details = %+v", pkg)
+	}
+
+	// The version resolves like GET /packages/{package}/versions/{version}.
+	var version versionDetailsJSON
+	if resp := do(t, http.MethodGet, httpServer.URL+"/packages/button/versions/latest/details", "", "", &version); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET version details: status %d", resp.StatusCode)
+	}
+
+	if version.Version.GetName() != "2.0.0" || version.ManifestSHA256 != pinnedManifestSHA256 {
+		t.Errorf("version details = %+v, want 2.0.0 with its pin", version)
+	}
+
+	if resp := do(t, http.MethodGet, httpServer.URL+"/packages/card/details", "", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET details of a missing package: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestChannelRoutes(t *testing.T) {
+	httpServer := newTestGateway(t)
+	channels := httpServer.URL + "/packages/button/channels"
+
+	// Changes need credentials, like over gRPC.
+	if resp := do(t, http.MethodPost, channels, "", `{"name": "stable", "targets": [{"version": "1.0.0", "weight": 100}]}`, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("POST without credentials: status %d, want 401", resp.StatusCode)
+	}
+
+	var created channelJSON
+	if resp := do(t, http.MethodPost, channels, "alice-key", `{"name": "stable", "targets": [{"version": "1.0.0", "weight": 100}]}`, &created); resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST: status %d", resp.StatusCode)
+	}
+
+	if created.Name != "stable" || len(created.Targets) != 1 || created.Targets[0].Version != "1.0.0" {
+		t.Errorf("created channel = %+v", created)
+	}
+
+	var promoted channelJSON
+	do(t, http.MethodPost, channels+"/stable/promote", "alice-key", `{"targets": [{"version": "2.0.0", "weight": 100}]}`, &promoted)
+	if promoted.Targets[0].Version != "2.0.0" || promoted.Revision != created.Revision+1 {
+		t.Errorf("promoted channel = %+v", promoted)
+	}
+
+	var rolledBack channelJSON
+	do(t, http.MethodPost, channels+"/stable/rollback", "alice-key", "", &rolledBack)
+	if rolledBack.Targets[0].Version != "1.0.0" {
+		t.Errorf("rolled back channel = %+v", rolledBack)
+	}
+
+	// Reads are public.
+	var listed listChannelsJSON
+	do(t, http.MethodGet, channels, "", "", &listed)
+	if len(listed.Channels) != 1 || listed.Channels[0].Targets[0].Version != "1.0.0" {
+		t.Errorf("listed channels = %+v", listed)
+	}
+
+	// The channel resolves like a version.
+	var details struct {
+		Version *polvo_v1.Version `json:"version"`
+	}
+	if resp := do(t, http.MethodGet, httpServer.URL+"/packages/button/versions/stable/details", "", "", &details); resp.StatusCode != http.StatusOK || details.Version.GetName() != "1.0.0" {
+		t.Errorf("GET details: status %d, version %v", resp.StatusCode, details.Version)
+	}
+}
+
+func TestAPIRouteMethods(t *testing.T) {
+	httpServer := newTestGateway(t)
+
+	resp := do(t, http.MethodDelete, httpServer.URL+"/packages/button/channels", "alice-key", "", nil)
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET, POST, OPTIONS" {
+		t.Errorf("DELETE channels: status %d, Allow %q", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+
+	if resp := do(t, http.MethodPost, httpServer.URL+"/packages/button/channels", "alice-key", "{", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST an invalid body: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestUndeleteRoutes(t *testing.T) {
+	httpServer := newTestGateway(t)
+
+	// 1.0.0 is not deleted.
+	if resp := do(t, http.MethodPost, httpServer.URL+"/packages/button/versions/1.0.0/undelete", "alice-key", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("POST undelete of a live version: status %d, want 404", resp.StatusCode)
+	}
+
+	for body, want := range map[string]int{
+		``:                     http.StatusBadRequest,
+		`{}`:                   http.StatusBadRequest,
+		`{"retention": "-1h"}`: http.StatusBadRequest,
+		`{"retention": "1h"}`:  http.StatusForbidden,
+	} {
+		if resp := do(t, http.MethodPost, httpServer.URL+"/purge", "alice-key", body, nil); resp.StatusCode != want {
+			t.Errorf("POST purge %q: status %d, want %d", body, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestAuditRoute(t *testing.T) {
+	httpServer := newTestGateway(t)
+
+	do(t, http.MethodPost, httpServer.URL+"/packages/button/channels", "alice-key", `{"name": "stable", "targets": [{"version": "1.0.0", "weight": 100}]}`, nil)
+
+	var listed listAuditEventsJSON
+	if resp := do(t, http.MethodGet, httpServer.URL+"/audit?package_orn=packages/button&actor=alice", "alice-key", "", &listed); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET audit: status %d", resp.StatusCode)
+	}
+
+	if len(listed.Events) != 1 || listed.Events[0].Method != "CreateChannel" || listed.Events[0].Actor != "alice" {
+		t.Errorf("audit events = %+v", listed.Events)
+	}
+
+	for _, query := range []string{"since=yesterday", "page_size=many"} {
+		if resp := do(t, http.MethodGet, httpServer.URL+"/audit?package_orn=packages/button&"+query, "alice-key", "", nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET audit?%s: status %d, want 400", query, resp.StatusCode)
+		}
+	}
+
+	// Only admins read the events of every package.
+	if resp := do(t, http.MethodGet, httpServer.URL+"/audit", "alice-key", "", nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET audit of every package: status %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestRoutingRoutes(t *testing.T) {
+	httpServer := newTestGateway(t)
+	packageURL := httpServer.URL + "/packages/button"
+
+	var listed listRoutingRevisionsJSON
+	if resp := do(t, http.MethodGet, packageURL+"/routing", "", "", &listed); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET routing: status %d", resp.StatusCode)
+	}
+	if len(listed.Revisions) != 2 || listed.Revisions[0].Revision != 2 {
+		t.Fatalf("routing revisions = %+v, want the latest of the two first", listed.Revisions)
+	}
+
+	if resp := do(t, http.MethodPost, packageURL+"/rollback", "", `{"revision": 1}`, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("POST rollback without credentials: status %d, want 401", resp.StatusCode)
+	}
+
+	if resp := do(t, http.MethodPost, packageURL+"/rollback", "alice-key", `{}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST rollback without a revision: status %d, want 400", resp.StatusCode)
+	}
+
+	var restored routingRevisionJSON
+	if resp := do(t, http.MethodPost, packageURL+"/rollback", "alice-key", `{"revision": 1}`, &restored); resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST rollback: status %d", resp.StatusCode)
+	}
+
+	// The versions created after the first revision get no traffic.
+	weights := map[string]uint32{}
+	for _, entry := range listed.Revisions[1].Entries {
+		weights[entry.Version] = entry.Weight
+	}
+
+	if len(restored.Entries) != 2 {
+		t.Fatalf("restored revision = %+v", restored)
+	}
+
+	for _, entry := range restored.Entries {
+		if entry.Weight != weights[entry.Version] {
+			t.Errorf("restored weight of %s = %d, want %d", entry.Version, entry.Weight, weights[entry.Version])
+		}
+	}
+
+	do(t, http.MethodGet, packageURL+"/routing", "", "", &listed)
+	if listed.Revisions[0].Revision != restored.Revision {
+		t.Errorf("latest revision = %d, want the restored %d", listed.Revisions[0].Revision, restored.Revision)
+	}
+
+	if resp := do(t, http.MethodPost, packageURL+"/rollback", "alice-key", `{"revision": 9}`, nil); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("POST rollback to a missing revision: status %d, want 412", resp.StatusCode)
+	}
+}
+
+func TestSetPackageWeightsRoute(t *testing.T) {
+	httpServer := newTestGateway(t)
+	weightsURL := httpServer.URL + "/packages/button/weights"
+
+	if resp := do(t, http.MethodPut, weightsURL, "alice-key", `{"weights": {"1.0.0": 60, "2.0.0": 30}, "percentage": true}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("PUT weights that do not sum to 100: status %d, want 400", resp.StatusCode)
+	}
+
+	var revision routingRevisionJSON
+	if resp := do(t, http.MethodPut, weightsURL, "alice-key", `{"weights": {"2.0.0": 100}, "percentage": true}`, &revision); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT weights: status %d", resp.StatusCode)
+	}
+
+	weights := map[string]uint32{}
+	for _, entry := range revision.Entries {
+		weights[entry.Version] = entry.Weight
+	}
+
+	// The versions left out of the body get no traffic.
+	if revision.Revision != 3 || weights["1.0.0"] != 0 || weights["2.0.0"] != 100 {
+		t.Errorf("routing revision = %+v", revision)
+	}
+}
+
+func TestWatchRolloutStreamsEvents(t *testing.T) {
+	httpServer := newTestGateway(t)
+
+	var rollout rolloutJSON
+	do(t, http.MethodPost, httpServer.URL+"/packages/button/rollouts", "alice-key", `{"version": "2.0.0", "steps": [{"weight": 10, "after": "0s"}, {"weight": 100, "after": "24h"}]}`, &rollout)
+	if rollout.ID == "" || rollout.State != string(repository.RolloutRunning) || time.Duration(rollout.Steps[1].After) != 24*time.Hour {
+		t.Fatalf("started rollout = %+v", rollout)
+	}
+
+	resp, err := http.Get(httpServer.URL + "/rollouts/" + rollout.ID + "/watch")
+	if err != nil {
+		t.Fatalf("GET watch: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", resp.Header.Get("Content-Type"))
+	}
+
+	events := bufio.NewReader(resp.Body)
+
+	if event, data := readEvent(t, events); event != "running" || data.Rollout.Step != 0 {
+		t.Errorf("first event = %s %+v, want the running rollout", event, data.Rollout)
+	}
+
+	do(t, http.MethodPost, httpServer.URL+"/rollouts/"+rollout.ID+"/abort", "alice-key", "", nil)
+
+	if event, data := readEvent(t, events); event != "aborted" || data.Weights["1.0.0"] != 100 {
+		t.Errorf("event after the abort = %s %+v, want the restored weights", event, data)
+	}
+
+	// The stream ends with the rollout.
+	if rest, err := io.ReadAll(events); err != nil || strings.TrimSpace(string(rest)) != "" {
+		t.Errorf("the stream went on with %q, %v", rest, err)
+	}
+}
+
+func readEvent(t *testing.T, events *bufio.Reader) (string, *rolloutEventJSON) {
+	t.Helper()
+
+	var event string
+	data := &rolloutEventJSON{}
+
+	for {
+		line, err := events.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the events: %v", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event != "":
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), data); err != nil {
+				t.Fatalf("invalid event data: %v", err)
+			}
+		}
+	}
+}
+
+func TestManifestRoutes(t *testing.T) {
+	httpServer := newTestGateway(t)
+	versions := httpServer.URL + "/packages/button/versions/"
+
+	// The pin of 2.0.0 has no body, 1.0.0 is not pinned.
+	for _, url := range []string{versions + "2.0.0/manifest/pinned", versions + "1.0.0/manifest/pinned", versions + "1.0.0/manifest/integrity"} {
+		if resp := do(t, http.MethodGet, url, "", "", nil); resp.StatusCode != http.StatusPreconditionFailed {
+			t.Errorf("GET %s: status %d, want 412", url, resp.StatusCode)
+		}
+	}
+}
+
+func TestWebhookRoutesReturnTheSecretOnce(t *testing.T) {
+	httpServer := newTestGateway(t)
+
+	var created webhookJSON
+	do(t, http.MethodPost, httpServer.URL+"/webhooks", "alice-key", `{"package_orn": "packages/button", "url": "https://hooks.example.com/polvo", "event_types": ["version_created"]}`, &created)
+	if created.ID == "" || created.Secret == "" || created.Package != "button" {
+		t.Fatalf("created webhook = %+v, want it with its secret", created)
+	}
+
+	var webhook webhookJSON
+	do(t, http.MethodGet, httpServer.URL+"/webhooks/"+created.ID, "alice-key", "", &webhook)
+	if webhook.ID != created.ID || webhook.Secret != "" {
+		t.Errorf("webhook = %+v, want it without secret", webhook)
+	}
+
+	if resp := do(t, http.MethodDelete, httpServer.URL+"/webhooks/"+created.ID, "alice-key", "", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("DELETE: status %d", resp.StatusCode)
+	}
+
+	if resp := do(t, http.MethodGet, httpServer.URL+"/webhooks/"+created.ID, "alice-key", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET a deleted webhook: status %d, want 404", resp.StatusCode)
+	}
+}
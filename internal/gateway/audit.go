@@ -0,0 +1,91 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+	"pkg.aiocean.dev/polvoservice/internal/server"
+)
+
+type auditEventJSON struct {
+	ID        string                 `json:"id"`
+	Actor     string                 `json:"actor"`
+	Method    string                 `json:"method"`
+	Orn       string                 `json:"orn"`
+	Package   string                 `json:"package"`
+	Before    map[string]interface{} `json:"before"`
+	After     map[string]interface{} `json:"after"`
+	Time      time.Time              `json:"time"`
+	RequestID string                 `json:"request_id,omitempty"`
+}
+
+type listAuditEventsJSON struct {
+	Events        []*auditEventJSON `json:"events"`
+	NextPageToken string            `json:"next_page_token"`
+}
+
+func newAuditEventJSON(event *repository.AuditEvent) *auditEventJSON {
+	return &auditEventJSON{
+		ID:        event.ID,
+		Actor:     event.Actor,
+		Method:    event.Method,
+		Orn:       event.Orn,
+		Package:   event.Package,
+		Before:    event.Before,
+		After:     event.After,
+		Time:      event.Time,
+		RequestID: event.RequestID,
+	}
+}
+
+// listAuditEvents reads the package_orn, actor, since, until, page_size and
+// page_token query parameters, since and until being RFC 3339 times.
+func (g *Gateway) listAuditEvents(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	query := r.URL.Query()
+
+	pageSize, err := queryPageSize(query)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	since, err := queryTime(query, "since")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	until, err := queryTime(query, "until")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	request := &server.ListAuditEventsRequest{
+		PackageOrn: query.Get("package_orn"),
+		Actor:      query.Get("actor"),
+		Since:      since,
+		Until:      until,
+		PageSize:   pageSize,
+		PageToken:  query.Get("page_token"),
+	}
+
+	g.unary(ctx, w, "ListAuditEvents", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		page, err := g.server.ListAuditEvents(ctx, request.(*server.ListAuditEventsRequest))
+		if err != nil {
+			return nil, err
+		}
+
+		response := &listAuditEventsJSON{
+			Events:        make([]*auditEventJSON, 0, len(page.Events)),
+			NextPageToken: page.NextPageToken,
+		}
+		for _, event := range page.Events {
+			response.Events = append(response.Events, newAuditEventJSON(event))
+		}
+
+		return response, nil
+	})
+}
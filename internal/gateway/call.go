@@ -0,0 +1,274 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+)
+
+// serviceName prefixes the full method names given to the interceptors.
+const serviceName = "/aiocean.polvo.v1.PolvoService/"
+
+// forwardedMetadataPrefix selects the response headers and trailers of a call
+// that are sent as HTTP headers.
+const forwardedMetadataPrefix = "x-polvo-"
+
+// exposedHeaders are the forwarded headers a browser can read.
+var exposedHeaders = []string{
+	"X-Polvo-Created-At",
+	"X-Polvo-Updated-At",
+	"X-Polvo-Manifest-Sha256",
+	"X-Polvo-Next-Page-Token",
+	"X-Polvo-Resume-Token",
+	"X-Polvo-Description",
+	"X-Polvo-Repository-Url",
+	"X-Polvo-Homepage-Url",
+	"X-Polvo-Icon-Url",
+	"X-Polvo-Tags",
+	"X-Polvo-Owners",
+	"X-Polvo-Labels",
+}
+
+var (
+	errNotFound         = status.Error(codes.NotFound, "not found")
+	errMethodNotAllowed = status.Error(codes.Unimplemented, "method not allowed")
+)
+
+var marshalOptions = protojson.MarshalOptions{
+	EmitUnpopulated: true,
+}
+
+// call is an in-process call of an RPC. It collects the response metadata
+// the RPC sets, as a gRPC transport would.
+type call struct {
+	ctx    context.Context
+	method string
+
+	mu      sync.Mutex
+	header  metadata.MD
+	trailer metadata.MD
+	// headerSent, when set, is called when the RPC sends its header.
+	headerSent func()
+}
+
+func newCall(ctx context.Context, method string) *call {
+	c := &call{
+		method:  serviceName + method,
+		header:  metadata.MD{},
+		trailer: metadata.MD{},
+	}
+	c.ctx = grpc.NewContextWithServerTransportStream(ctx, &transportStream{call: c})
+
+	return c
+}
+
+func (c *call) unaryInfo(server interface{}) *grpc.UnaryServerInfo {
+	return &grpc.UnaryServerInfo{
+		Server:     server,
+		FullMethod: c.method,
+	}
+}
+
+func (c *call) streamInfo() *grpc.StreamServerInfo {
+	return &grpc.StreamServerInfo{
+		FullMethod:     c.method,
+		IsServerStream: true,
+	}
+}
+
+func (c *call) setHeader(md metadata.MD) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.header = metadata.Join(c.header, md)
+}
+
+func (c *call) sendHeader(md metadata.MD) {
+	c.setHeader(md)
+
+	if c.headerSent != nil {
+		c.headerSent()
+	}
+}
+
+func (c *call) setTrailer(md metadata.MD) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.trailer = metadata.Join(c.trailer, md)
+}
+
+// write sends the forwarded metadata, then the response as JSON, or the
+// error as a JSON google.rpc.Status with the matching HTTP status code.
+// Responses that are not proto messages are encoded with encoding/json.
+func (c *call) write(w http.ResponseWriter, response interface{}, err error) {
+	c.forwardMetadata(w)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if message, ok := response.(proto.Message); ok {
+		writeMessage(w, http.StatusOK, message)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (c *call) forwardMetadata(w http.ResponseWriter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, md := range []metadata.MD{c.header, c.trailer} {
+		for key, values := range md {
+			if strings.HasPrefix(key, forwardedMetadataPrefix) {
+				for _, value := range values {
+					w.Header().Add(key, value)
+				}
+			}
+		}
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+
+	writeMessage(w, httpStatus(st.Code()), st.Proto())
+}
+
+func writeMessage(w http.ResponseWriter, code int, message proto.Message) {
+	body, err := marshalOptions.Marshal(message)
+	if err != nil {
+		code = http.StatusInternalServerError
+		body, _ = marshalOptions.Marshal(status.New(codes.Internal, err.Error()).Proto())
+	}
+
+	writeBody(w, code, body)
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		code = http.StatusInternalServerError
+		body, _ = marshalOptions.Marshal(status.New(codes.Internal, err.Error()).Proto())
+	}
+
+	writeBody(w, code, body)
+}
+
+func writeBody(w http.ResponseWriter, code int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(body)
+}
+
+// httpStatus maps a gRPC status code to an HTTP status code, as grpc-gateway
+// does.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case codes.Unimplemented:
+		return http.StatusMethodNotAllowed
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
+
+// transportStream lets the RPC set response metadata with grpc.SetHeader and
+// grpc.SetTrailer.
+type transportStream struct {
+	call *call
+}
+
+func (s *transportStream) Method() string {
+	return s.call.method
+}
+
+func (s *transportStream) SetHeader(md metadata.MD) error {
+	s.call.setHeader(md)
+	return nil
+}
+
+func (s *transportStream) SendHeader(md metadata.MD) error {
+	s.call.sendHeader(md)
+	return nil
+}
+
+func (s *transportStream) SetTrailer(md metadata.MD) error {
+	s.call.setTrailer(md)
+	return nil
+}
+
+// serverStream is the stream of a server streaming RPC, send receives each
+// sent message.
+type serverStream struct {
+	call *call
+	send func(message interface{}) error
+}
+
+func (s *serverStream) SetHeader(md metadata.MD) error {
+	s.call.setHeader(md)
+	return nil
+}
+
+func (s *serverStream) SendHeader(md metadata.MD) error {
+	s.call.sendHeader(md)
+	return nil
+}
+
+func (s *serverStream) SetTrailer(md metadata.MD) {
+	s.call.setTrailer(md)
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.call.ctx
+}
+
+func (s *serverStream) SendMsg(message interface{}) error {
+	return s.send(message)
+}
+
+func (s *serverStream) RecvMsg(message interface{}) error {
+	return status.Error(codes.Unimplemented, "the HTTP gateway does not stream requests")
+}
+
+type listVersionsServer struct {
+	grpc.ServerStream
+}
+
+func (s *listVersionsServer) Send(response *polvo_v1.ListVersionsResponse) error {
+	return s.ServerStream.SendMsg(response)
+}
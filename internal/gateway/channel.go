@@ -0,0 +1,141 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+	"pkg.aiocean.dev/polvoservice/internal/server"
+)
+
+type channelJSON struct {
+	Name      string              `json:"name"`
+	Targets   []channelTargetJSON `json:"targets"`
+	Revision  int64               `json:"revision"`
+	CreatedAt time.Time           `json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+type channelTargetJSON struct {
+	Version string `json:"version"`
+	Weight  uint32 `json:"weight"`
+}
+
+type listChannelsJSON struct {
+	Channels []*channelJSON `json:"channels"`
+}
+
+// createChannelBody is the body of POST /packages/{package}/channels.
+type createChannelBody struct {
+	Name    string              `json:"name"`
+	Targets []channelTargetJSON `json:"targets"`
+}
+
+// promoteChannelBody is the body of POST
+// /packages/{package}/channels/{channel}/promote.
+type promoteChannelBody struct {
+	Targets []channelTargetJSON `json:"targets"`
+}
+
+func newChannelJSON(channel *repository.Channel) *channelJSON {
+	targets := make([]channelTargetJSON, 0, len(channel.Targets))
+	for _, target := range channel.Targets {
+		targets = append(targets, channelTargetJSON{Version: target.Version, Weight: target.Weight})
+	}
+
+	return &channelJSON{
+		Name:      channel.Name,
+		Targets:   targets,
+		Revision:  channel.Revision,
+		CreatedAt: channel.CreatedAt,
+		UpdatedAt: channel.UpdatedAt,
+	}
+}
+
+func channelTargets(targets []channelTargetJSON) []repository.ChannelTarget {
+	converted := make([]repository.ChannelTarget, 0, len(targets))
+	for _, target := range targets {
+		converted = append(converted, repository.ChannelTarget{Version: target.Version, Weight: target.Weight})
+	}
+
+	return converted
+}
+
+func (g *Gateway) listChannels(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.ListChannelsRequest{PackageOrn: strings.Join(segments[:2], "/")}
+
+	g.unary(ctx, w, "ListChannels", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		channels, err := g.server.ListChannels(ctx, request.(*server.ListChannelsRequest))
+		if err != nil {
+			return nil, err
+		}
+
+		response := &listChannelsJSON{Channels: make([]*channelJSON, 0, len(channels))}
+		for _, channel := range channels {
+			response.Channels = append(response.Channels, newChannelJSON(channel))
+		}
+
+		return response, nil
+	})
+}
+
+func (g *Gateway) createChannel(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	var body createChannelBody
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	request := &server.CreateChannelRequest{
+		PackageOrn: strings.Join(segments[:2], "/"),
+		Name:       body.Name,
+		Targets:    channelTargets(body.Targets),
+	}
+
+	g.unary(ctx, w, "CreateChannel", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return channelResponse(g.server.CreateChannel(ctx, request.(*server.CreateChannelRequest)))
+	})
+}
+
+func (g *Gateway) getChannel(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.GetChannelRequest{Orn: strings.Join(segments, "/")}
+
+	g.unary(ctx, w, "GetChannel", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return channelResponse(g.server.GetChannel(ctx, request.(*server.GetChannelRequest)))
+	})
+}
+
+func (g *Gateway) promoteChannel(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	var body promoteChannelBody
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	request := &server.PromoteChannelRequest{
+		Orn:     strings.Join(segments[:4], "/"),
+		Targets: channelTargets(body.Targets),
+	}
+
+	g.unary(ctx, w, "PromoteChannel", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return channelResponse(g.server.PromoteChannel(ctx, request.(*server.PromoteChannelRequest)))
+	})
+}
+
+func (g *Gateway) rollbackChannel(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.RollbackChannelRequest{Orn: strings.Join(segments[:4], "/")}
+
+	g.unary(ctx, w, "RollbackChannel", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return channelResponse(g.server.RollbackChannel(ctx, request.(*server.RollbackChannelRequest)))
+	})
+}
+
+func channelResponse(channel *repository.Channel, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return newChannelJSON(channel), nil
+}
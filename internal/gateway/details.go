@@ -0,0 +1,141 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+	"pkg.aiocean.dev/polvoservice/internal/server"
+)
+
+type packageDetailsJSON struct {
+	Package   *polvo_v1.Package   `json:"package"`
+	Metadata  packageMetadataJSON `json:"metadata"`
+	CreatedAt *time.Time          `json:"created_at,omitempty"`
+	UpdatedAt *time.Time          `json:"updated_at,omitempty"`
+}
+
+type packageMetadataJSON struct {
+	Description   string   `json:"description"`
+	RepositoryUrl string   `json:"repository_url"`
+	HomepageUrl   string   `json:"homepage_url"`
+	IconUrl       string   `json:"icon_url"`
+	Tags          []string `json:"tags"`
+	Owners        []string `json:"owners"`
+}
+
+type versionDetailsJSON struct {
+	Version        *polvo_v1.Version `json:"version"`
+	CreatedAt      *time.Time        `json:"created_at,omitempty"`
+	UpdatedAt      *time.Time        `json:"updated_at,omitempty"`
+	ManifestSHA256 string            `json:"manifest_sha256,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+}
+
+func newPackageDetailsJSON(details *repository.PackageDetails) *packageDetailsJSON {
+	return &packageDetailsJSON{
+		Package: details.Package,
+		Metadata: packageMetadataJSON{
+			Description:   details.Metadata.Description,
+			RepositoryUrl: details.Metadata.RepositoryUrl,
+			HomepageUrl:   details.Metadata.HomepageUrl,
+			IconUrl:       details.Metadata.IconUrl,
+			Tags:          details.Metadata.Tags,
+			Owners:        details.Metadata.Owners,
+		},
+		CreatedAt: timestamp(details.CreatedAt),
+		UpdatedAt: timestamp(details.UpdatedAt),
+	}
+}
+
+func newVersionDetailsJSON(details *repository.VersionDetails) *versionDetailsJSON {
+	return &versionDetailsJSON{
+		Version:        details.Version,
+		CreatedAt:      timestamp(details.CreatedAt),
+		UpdatedAt:      timestamp(details.UpdatedAt),
+		ManifestSHA256: details.ManifestSHA256,
+		Labels:         details.Labels,
+	}
+}
+
+func (g *Gateway) describePackage(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.DescribePackageRequest{Orn: strings.Join(segments[:2], "/")}
+
+	g.unary(ctx, w, "DescribePackage", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		details, err := g.server.DescribePackage(ctx, request.(*server.DescribePackageRequest))
+		if err != nil {
+			return nil, err
+		}
+
+		return newPackageDetailsJSON(details), nil
+	})
+}
+
+// describeVersion resolves the version like GET
+// /packages/{package}/versions/{version} does.
+func (g *Gateway) describeVersion(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.DescribeVersionRequest{
+		Orn:           strings.Join(segments[:4], "/"),
+		StickyKey:     stickyKey(r),
+		LabelSelector: labelSelector(r),
+	}
+
+	g.unary(ctx, w, "DescribeVersion", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		details, err := g.server.DescribeVersion(ctx, request.(*server.DescribeVersionRequest))
+		if err != nil {
+			return nil, err
+		}
+
+		return newVersionDetailsJSON(details), nil
+	})
+}
+
+func (g *Gateway) checkManifestIntegrity(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.CheckManifestIntegrityRequest{Orn: strings.Join(segments[:4], "/")}
+
+	g.unary(ctx, w, "CheckManifestIntegrity", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return g.server.CheckManifestIntegrity(ctx, request.(*server.CheckManifestIntegrityRequest))
+	})
+}
+
+// getPinnedManifest serves the manifest stored when the version was created,
+// with its SHA-256 in the X-Polvo-Manifest-Sha256 header.
+func (g *Gateway) getPinnedManifest(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	call := newCall(ctx, "GetPinnedManifest")
+	request := &server.GetPinnedManifestRequest{Orn: strings.Join(segments[:4], "/")}
+
+	response, err := g.unaryInterceptor(call.ctx, request, call.unaryInfo(g.server), func(ctx context.Context, request interface{}) (interface{}, error) {
+		pin, err := g.server.GetPinnedManifest(ctx, request.(*server.GetPinnedManifestRequest))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(pin.Body) == 0 {
+			return nil, status.Errorf(codes.FailedPrecondition, "the manifest of %s is not stored", request.(*server.GetPinnedManifestRequest).Orn)
+		}
+
+		return pin, nil
+	})
+
+	call.forwardMetadata(w)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	pin := response.(*repository.ManifestPin)
+
+	header := w.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("X-Polvo-Manifest-Sha256", pin.SHA256)
+	header.Set("ETag", `"`+pin.SHA256+`"`)
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(pin.Body)
+}
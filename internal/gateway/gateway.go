@@ -0,0 +1,350 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/wire"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/server"
+	"pkg.aiocean.dev/serviceutil/interceptor"
+)
+
+var WireSet = wire.NewSet(
+	NewGateway,
+)
+
+const (
+	defaultPort            = "8081"
+	defaultCORSMaxAge      = 10 * time.Minute
+	defaultRedirectMaxAge  = time.Minute
+	defaultShutdownTimeout = 10 * time.Second
+)
+
+// queryMetadata maps the query parameters of ListVersions to the request
+// metadata the RPC reads its list options from.
+var queryMetadata = map[string]string{
+	"page_size":      "x-polvo-page-size",
+	"page_token":     "x-polvo-page-token",
+	"name_prefix":    "x-polvo-name-prefix",
+	"has_weight":     "x-polvo-has-weight",
+	"created_after":  "x-polvo-created-after",
+	"order_by":       "x-polvo-order-by",
+	"sticky_key":     "x-polvo-sticky-key",
+	"label_selector": "x-polvo-label-selector",
+}
+
+// corsAllowedHeaders are the request headers a browser may send, the
+// credentials and the metadata the read RPCs understand.
+var corsAllowedHeaders = []string{
+	"Authorization",
+	"Content-Type",
+	"X-Api-Key",
+	"X-Polvo-Sticky-Key",
+	"X-Polvo-Label-Selector",
+	"Last-Event-ID",
+}
+
+// Gateway serves the read RPCs as HTTP/JSON for browsers and CDNs:
+//
+//  GET /packages/{package}                              GetPackage
+//  GET /packages/{package}/versions                     ListVersions
+//  GET /packages/{package}/versions/{version}           GetVersion
+//  GET /packages/{package}/versions/{version}/manifest  GetManifestUrl
+//  GET /r/{package}@{version}                           redirect to the manifest
+//  GET, POST /importmap                                 GenerateImportMap
+//  GET /watch                                           WatchPackages as Server-Sent Events
+//  GET /packages/{package}/watch                        WatchPackage as Server-Sent Events
+//
+// It is also the only transport of the RPCs of the server that are not in
+// the polvo_v1 proto, see apiRoutes:
+//
+//  GET /packages/{package}/details                               DescribePackage
+//  POST /packages/{package}/undelete                             UndeletePackage
+//  GET /packages/{package}/routing                               ListRoutingRevisions
+//  POST /packages/{package}/rollback                             RollbackPackage
+//  PUT /packages/{package}/weights                               SetPackageWeights
+//  GET /packages/{package}/versions/{version}/details            DescribeVersion
+//  POST /packages/{package}/versions/{version}/undelete          UndeleteVersion
+//  GET /packages/{package}/versions/{version}/manifest/integrity CheckManifestIntegrity
+//  GET /packages/{package}/versions/{version}/manifest/pinned    GetPinnedManifest
+//  GET, POST /packages/{package}/channels                        ListChannels, CreateChannel
+//  GET /packages/{package}/channels/{channel}                    GetChannel
+//  POST /packages/{package}/channels/{channel}/promote           PromoteChannel
+//  POST /packages/{package}/channels/{channel}/rollback          RollbackChannel
+//  GET, POST /packages/{package}/rollouts                        ListRollouts, StartRollout
+//  GET /rollouts/{id}                                            GetRollout
+//  POST /rollouts/{id}/pause, resume, abort                      PauseRollout, ResumeRollout, AbortRollout
+//  GET /rollouts/{id}/watch                                      WatchRollout as Server-Sent Events
+//  GET, POST /webhooks                                           ListWebhooks, CreateWebhook
+//  GET, DELETE /webhooks/{id}                                    GetWebhook, DeleteWebhook
+//  GET /deliveries                                               ListWebhookDeliveries
+//  POST /deliveries/{id}/redeliver                               RedeliverWebhookDelivery
+//  GET /audit                                                    ListAuditEvents
+//  POST /purge                                                   PurgeDeleted
+//
+// The calls go through the same interceptors as the gRPC server, so they are
+// logged and authenticated the same way. NewGateway configures it from the
+// environment:
+//
+//  HTTP_PORT              port to listen on, "8081" by default.
+//  CORS_ALLOWED_ORIGINS   comma separated origins, "*" (any origin) by default.
+//  CORS_MAX_AGE           how long browsers cache a preflight, "10m" by default.
+//  REDIRECT_MAX_AGE       how long a redirect can be cached, "1m" by default.
+type Gateway struct {
+	logger            *zap.Logger
+	server            *server.Server
+	streamInterceptor grpc.StreamServerInterceptor
+	unaryInterceptor  grpc.UnaryServerInterceptor
+	port              string
+	allowedOrigins    map[string]bool
+	allowAnyOrigin    bool
+	corsMaxAge        time.Duration
+	redirectMaxAge    time.Duration
+	// watches is done when the gateway shuts down, ending the watches.
+	watches     context.Context
+	stopWatches context.CancelFunc
+}
+
+func NewGateway(logger *zap.Logger, server *server.Server, streamInterceptor interceptor.StreamServerInterceptor, unaryInterceptor interceptor.UnaryServerInterceptor) (*Gateway, error) {
+	watches, stopWatches := context.WithCancel(context.Background())
+
+	g := &Gateway{
+		logger:            logger,
+		server:            server,
+		streamInterceptor: grpc.StreamServerInterceptor(streamInterceptor),
+		unaryInterceptor:  grpc.UnaryServerInterceptor(unaryInterceptor),
+		port:              defaultPort,
+		allowedOrigins:    map[string]bool{},
+		allowAnyOrigin:    true,
+		corsMaxAge:        defaultCORSMaxAge,
+		redirectMaxAge:    defaultRedirectMaxAge,
+		watches:           watches,
+		stopWatches:       stopWatches,
+	}
+
+	if port := os.Getenv("HTTP_PORT"); port != "" {
+		g.port = port
+	}
+
+	if value := os.Getenv("CORS_ALLOWED_ORIGINS"); value != "" {
+		g.allowAnyOrigin = false
+
+		for _, origin := range strings.Split(value, ",") {
+			origin = strings.TrimSpace(origin)
+			if origin == "*" {
+				g.allowAnyOrigin = true
+			} else if origin != "" {
+				g.allowedOrigins[strings.ToLower(origin)] = true
+			}
+		}
+	}
+
+	if value := os.Getenv("CORS_MAX_AGE"); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid CORS_MAX_AGE")
+		}
+
+		g.corsMaxAge = maxAge
+	}
+
+	if value := os.Getenv("REDIRECT_MAX_AGE"); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid REDIRECT_MAX_AGE")
+		}
+
+		g.redirectMaxAge = maxAge
+	}
+
+	return g, nil
+}
+
+// Run serves HTTP until ctx is done, then shuts the server down gracefully.
+func (g *Gateway) Run(ctx context.Context) {
+	httpServer := &http.Server{
+		Addr:    net.JoinHostPort("", g.port),
+		Handler: g,
+	}
+	httpServer.RegisterOnShutdown(g.stopWatches)
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
+		defer cancel()
+
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			g.logger.Error("failed to shut down the HTTP gateway", zap.Error(err))
+		}
+	}()
+
+	g.logger.Info("serving the HTTP gateway", zap.String("port", g.port))
+
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		g.logger.Error("failed to serve the HTTP gateway", zap.Error(err))
+	}
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.setCORSHeaders(w, r)
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Method == http.MethodPost && r.URL.Path == importMapPath {
+		g.postImportMap(w, r)
+		return
+	}
+
+	// The ORNs of packages and versions are their paths, e.g.
+	// packages/sidebar/versions/any.
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	ctx := incomingContext(r)
+
+	route, allowed := matchAPIRoute(r.Method, segments)
+	if route != nil {
+		route.handle(g, ctx, w, r, segments)
+		return
+	}
+
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(append(allowed, http.MethodOptions), ", "))
+		writeError(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+		writeError(w, errMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case len(segments) == 2 && segments[0] == "r":
+		g.redirect(ctx, w, r, segments[1])
+	case r.URL.Path == importMapPath:
+		g.getImportMap(ctx, w, r)
+	case r.URL.Path == watchPath:
+		g.watch(ctx, w, r, "")
+	case segments[0] != "packages":
+		writeError(w, errNotFound)
+	case len(segments) == 2:
+		g.getPackage(ctx, w, strings.Join(segments, "/"))
+	case len(segments) == 3 && segments[2] == "versions":
+		g.listVersions(ctx, w, strings.Join(segments[:2], "/"))
+	case len(segments) == 3 && segments[2] == "watch":
+		g.watch(ctx, w, r, strings.Join(segments[:2], "/"))
+	case len(segments) == 4 && segments[2] == "versions":
+		g.getVersion(ctx, w, strings.Join(segments, "/"))
+	case len(segments) == 5 && segments[2] == "versions" && segments[4] == "manifest":
+		g.getManifestUrl(ctx, w, strings.Join(segments[:4], "/"))
+	default:
+		writeError(w, errNotFound)
+	}
+}
+
+func (g *Gateway) getPackage(ctx context.Context, w http.ResponseWriter, orn string) {
+	call := newCall(ctx, "GetPackage")
+	response, err := g.unaryInterceptor(call.ctx, &polvo_v1.GetPackageRequest{Orn: orn}, call.unaryInfo(g.server), func(ctx context.Context, request interface{}) (interface{}, error) {
+		return g.server.GetPackage(ctx, request.(*polvo_v1.GetPackageRequest))
+	})
+
+	call.write(w, response, err)
+}
+
+func (g *Gateway) getVersion(ctx context.Context, w http.ResponseWriter, orn string) {
+	call := newCall(ctx, "GetVersion")
+	response, err := g.unaryInterceptor(call.ctx, &polvo_v1.GetVersionRequest{Orn: orn}, call.unaryInfo(g.server), func(ctx context.Context, request interface{}) (interface{}, error) {
+		return g.server.GetVersion(ctx, request.(*polvo_v1.GetVersionRequest))
+	})
+
+	call.write(w, response, err)
+}
+
+func (g *Gateway) getManifestUrl(ctx context.Context, w http.ResponseWriter, orn string) {
+	call := newCall(ctx, "GetManifestUrl")
+	response, err := g.unaryInterceptor(call.ctx, &polvo_v1.GetManifestUrlRequest{Orn: orn}, call.unaryInfo(g.server), func(ctx context.Context, request interface{}) (interface{}, error) {
+		return g.server.GetManifestUrl(ctx, request.(*polvo_v1.GetManifestUrlRequest))
+	})
+
+	call.write(w, response, err)
+}
+
+// listVersions collects the streamed versions into a single
+// ListVersionsResponse. The next page token is in the
+// X-Polvo-Next-Page-Token header.
+func (g *Gateway) listVersions(ctx context.Context, w http.ResponseWriter, orn string) {
+	call := newCall(ctx, "ListVersions")
+	request := &polvo_v1.ListVersionsRequest{Orn: orn}
+	response := &polvo_v1.ListVersionsResponse{}
+
+	stream := &serverStream{call: call, send: func(message interface{}) error {
+		response.Versions = append(response.Versions, message.(*polvo_v1.ListVersionsResponse).GetVersions()...)
+		return nil
+	}}
+
+	err := g.streamInterceptor(g.server, stream, call.streamInfo(), func(srv interface{}, stream grpc.ServerStream) error {
+		return g.server.ListVersions(request, &listVersionsServer{ServerStream: stream})
+	})
+
+	call.write(w, response, err)
+}
+
+func (g *Gateway) setCORSHeaders(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+
+	header := w.Header()
+	header.Add("Vary", "Origin")
+
+	switch {
+	case g.allowAnyOrigin:
+		header.Set("Access-Control-Allow-Origin", "*")
+	case g.allowedOrigins[strings.ToLower(origin)]:
+		header.Set("Access-Control-Allow-Origin", origin)
+	default:
+		return
+	}
+
+	header.Set("Access-Control-Expose-Headers", strings.Join(exposedHeaders, ", "))
+
+	if r.Method == http.MethodOptions {
+		header.Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, DELETE, OPTIONS")
+		header.Set("Access-Control-Allow-Headers", strings.Join(corsAllowedHeaders, ", "))
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(g.corsMaxAge.Seconds())))
+	}
+}
+
+// incomingContext turns the request headers and the list query parameters
+// into the incoming metadata of a gRPC call.
+func incomingContext(r *http.Request) context.Context {
+	md := metadata.MD{}
+
+	for name, values := range r.Header {
+		md.Append(name, values...)
+	}
+
+	query := r.URL.Query()
+	for parameter, key := range queryMetadata {
+		if values, ok := query[parameter]; ok {
+			md.Set(key, values...)
+		}
+	}
+
+	return metadata.NewIncomingContext(r.Context(), md)
+}
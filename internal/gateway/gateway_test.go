@@ -0,0 +1,232 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/manifest"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+	"pkg.aiocean.dev/polvoservice/internal/server"
+	"pkg.aiocean.dev/serviceutil/interceptor"
+)
+
+// pinnedManifestSHA256 is the SHA-256 of "{}".
+const pinnedManifestSHA256 = "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+
+// newTestGateway serves a Gateway on a memory repository holding the button
+// package, maintained by alice, with the versions 1.0.0 and 2.0.0. The
+// manifest of 2.0.0 is pinned to pinnedManifestSHA256. alice authenticates
+// with the API key "alice-key".
+func newTestGateway(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	return newTestGatewayWithEnv(t, nil)
+}
+
+// newTestGatewayWithEnv is newTestGateway with env set over its environment.
+func newTestGatewayWithEnv(t *testing.T, env map[string]string) *httptest.Server {
+	t.Helper()
+
+	defaults := map[string]string{
+		"AUTH_API_KEYS":     "alice:alice-key",
+		"AUTH_PUBLIC_READS": "true",
+	}
+	for name, value := range env {
+		defaults[name] = value
+	}
+
+	for name, value := range defaults {
+		os.Setenv(name, value)
+		name := name
+		t.Cleanup(func() { os.Unsetenv(name) })
+	}
+
+	authenticator, err := auth.NewAuthenticator()
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+
+	manifests, err := manifest.NewValidator()
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+
+	repo, err := repository.NewMemoryRepository()
+	if err != nil {
+		t.Fatalf("NewMemoryRepository: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := repo.CreatePackage(ctx, &polvo_v1.Package{Name: "button", Maintainer: "alice"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	for name, weight := range map[string]uint32{"1.0.0": 100, "2.0.0": 0} {
+		var pin *repository.ManifestPin
+		if name == "2.0.0" {
+			pin = &repository.ManifestPin{SHA256: pinnedManifestSHA256}
+		}
+
+		version := &polvo_v1.Version{Name: name, ManifestUrl: "https://cdn.example.com/button/" + name + ".json", Weight: weight}
+		if _, err := repo.CreateVersion(ctx, "button", version, pin, nil); err != nil {
+			t.Fatalf("CreateVersion: %v", err)
+		}
+	}
+
+	g, err := NewGateway(
+		zap.NewNop(),
+		server.NewServer(zap.NewNop(), repo, authenticator, manifests),
+		interceptor.StreamServerInterceptor(authenticator.StreamServerInterceptor()),
+		interceptor.UnaryServerInterceptor(authenticator.UnaryServerInterceptor()),
+	)
+	if err != nil {
+		t.Fatalf("NewGateway: %v", err)
+	}
+	t.Cleanup(g.stopWatches)
+
+	httpServer := httptest.NewServer(g)
+	t.Cleanup(httpServer.Close)
+
+	return httpServer
+}
+
+// do sends a request with the API key of alice when key is set, and decodes
+// the JSON response into response when it is not nil.
+func do(t *testing.T, method, url, key, body string, response interface{}) *http.Response {
+	t.Helper()
+
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	if key != "" {
+		request.Header.Set("X-Api-Key", key)
+	}
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	if response != nil {
+		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+			t.Fatalf("%s %s: invalid response: %v", method, url, err)
+		}
+	}
+
+	return resp
+}
+
+func TestCallForwardsPolvoMetadata(t *testing.T) {
+	c := newCall(context.Background(), "ListVersions")
+
+	if err := grpc.SetHeader(c.ctx, metadata.Pairs("x-polvo-updated-at", "2024-01-01T00:00:00Z", "x-internal", "secret")); err != nil {
+		t.Fatalf("SetHeader: %v", err)
+	}
+
+	if err := grpc.SetTrailer(c.ctx, metadata.Pairs("x-polvo-next-page-token", "token")); err != nil {
+		t.Fatalf("SetTrailer: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c.write(w, nil, status.Error(codes.NotFound, "version 3.0.0 not found"))
+
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("write: status %d, Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	if w.Header().Get("X-Polvo-Updated-At") == "" || w.Header().Get("X-Polvo-Next-Page-Token") != "token" || w.Header().Get("X-Internal") != "" {
+		t.Errorf("write forwarded the headers %v", w.Header())
+	}
+}
+
+func TestCallWritesOtherResponsesAsJSON(t *testing.T) {
+	c := newCall(context.Background(), "DescribePackage")
+
+	w := httptest.NewRecorder()
+	c.write(w, struct {
+		Name string `json:"name"`
+	}{Name: "button"}, nil)
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" || w.Body.String() != `{"name":"button"}` {
+		t.Errorf("write: status %d, Content-Type %q, body %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+}
+
+func TestErrorsAreJSONStatuses(t *testing.T) {
+	httpServer := newTestGateway(t)
+
+	var st struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+
+	for _, test := range []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/packages/card", http.StatusNotFound},
+		{http.MethodGet, "/packages/button/versions/3.0.0", http.StatusNotFound},
+		{http.MethodGet, "/packages/but+ton", http.StatusBadRequest},
+		{http.MethodGet, "/apps/button", http.StatusNotFound},
+		{http.MethodPost, "/packages/button", http.StatusMethodNotAllowed},
+	} {
+		resp := do(t, test.method, httpServer.URL+test.path, "", "", &st)
+		if resp.StatusCode != test.status || st.Code == 0 || st.Message == "" {
+			t.Errorf("%s %s: status %d, %+v, want %d", test.method, test.path, resp.StatusCode, st, test.status)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	os.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com")
+	t.Cleanup(func() { os.Unsetenv("CORS_ALLOWED_ORIGINS") })
+
+	httpServer := newTestGateway(t)
+
+	for origin, allowed := range map[string]bool{
+		"https://app.example.com":  true,
+		"https://evil.example.com": false,
+	} {
+		request, _ := http.NewRequest(http.MethodOptions, httpServer.URL+"/packages/button", nil)
+		request.Header.Set("Origin", origin)
+		request.Header.Set("Access-Control-Request-Method", http.MethodGet)
+
+		resp, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("OPTIONS: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("OPTIONS from %s: status %d", origin, resp.StatusCode)
+		}
+
+		if got := resp.Header.Get("Access-Control-Allow-Origin") == origin; got != allowed {
+			t.Errorf("OPTIONS from %s: Access-Control-Allow-Origin %q", origin, resp.Header.Get("Access-Control-Allow-Origin"))
+		}
+
+		if allowed && !strings.Contains(resp.Header.Get("Access-Control-Allow-Headers"), "X-Api-Key") {
+			t.Errorf("OPTIONS from %s: Access-Control-Allow-Headers %q", origin, resp.Header.Get("Access-Control-Allow-Headers"))
+		}
+
+		if allowed && !strings.Contains(resp.Header.Get("Access-Control-Allow-Methods"), http.MethodDelete) {
+			t.Errorf("OPTIONS from %s: Access-Control-Allow-Methods %q", origin, resp.Header.Get("Access-Control-Allow-Methods"))
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"pkg.aiocean.dev/polvoservice/internal/server"
+)
+
+const importMapPath = "/importmap"
+
+// maxImportMapBody caps the size of a POST /importmap request.
+const maxImportMapBody = 1 << 20
+
+// importMapRequest is the body of POST /importmap.
+type importMapRequest struct {
+	Specs []struct {
+		Package       string `json:"package"`
+		Version       string `json:"version"`
+		Specifier     string `json:"specifier"`
+		Scope         string `json:"scope"`
+		LabelSelector string `json:"label_selector"`
+	} `json:"specs"`
+	StickyKey string `json:"sticky_key"`
+	Integrity bool   `json:"integrity"`
+}
+
+// getImportMap reads the specs from the repeated package query parameter,
+// each one "[{specifier}=]{package}[@{version}]", so the import map has a URL
+// that can be cached. Scopes need POST /importmap.
+func (g *Gateway) getImportMap(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	request := &server.GenerateImportMapRequest{
+		StickyKey: stickyKey(r),
+	}
+
+	if value := query.Get("integrity"); value != "" {
+		integrity, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, status.Errorf(codes.InvalidArgument, "invalid integrity: %v", err))
+			return
+		}
+
+		request.Integrity = integrity
+	}
+
+	versions := make([]string, 0, len(query["package"]))
+	for _, value := range query["package"] {
+		spec := server.ImportSpec{Version: anyVersion}
+		if i := strings.Index(value, "="); i >= 0 {
+			spec.Specifier, value = value[:i], value[i+1:]
+		}
+
+		spec.Package = value
+		if i := strings.Index(value, "@"); i >= 0 {
+			spec.Package, spec.Version = value[:i], value[i+1:]
+		}
+
+		request.Specs = append(request.Specs, spec)
+		versions = append(versions, spec.Version)
+	}
+
+	call := newCall(ctx, "GenerateImportMap")
+	importMap, err := g.generateImportMap(call, request)
+	call.forwardMetadata(w)
+
+	if err != nil {
+		w.Header().Set("Cache-Control", "no-store")
+		writeError(w, err)
+		return
+	}
+
+	body, err := json.Marshal(importMap)
+	if err != nil {
+		writeError(w, status.Error(codes.Internal, err.Error()))
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	header := w.Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", g.cacheControl(r, versions...))
+	header.Add("Vary", "X-Polvo-Sticky-Key")
+
+	if matchesETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeImportMap(w, body)
+}
+
+func (g *Gateway) postImportMap(w http.ResponseWriter, r *http.Request) {
+	var requestBody importMapRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxImportMapBody)).Decode(&requestBody); err != nil {
+		writeError(w, status.Errorf(codes.InvalidArgument, "invalid request body: %v", err))
+		return
+	}
+
+	request := &server.GenerateImportMapRequest{
+		StickyKey: requestBody.StickyKey,
+		Integrity: requestBody.Integrity,
+	}
+	if request.StickyKey == "" {
+		request.StickyKey = stickyKey(r)
+	}
+
+	for _, spec := range requestBody.Specs {
+		request.Specs = append(request.Specs, server.ImportSpec{
+			Package:       spec.Package,
+			Version:       spec.Version,
+			Specifier:     spec.Specifier,
+			Scope:         spec.Scope,
+			LabelSelector: spec.LabelSelector,
+		})
+	}
+
+	call := newCall(incomingContext(r), "GenerateImportMap")
+	importMap, err := g.generateImportMap(call, request)
+	call.forwardMetadata(w)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	body, err := json.Marshal(importMap)
+	if err != nil {
+		writeError(w, status.Error(codes.Internal, err.Error()))
+		return
+	}
+
+	writeImportMap(w, body)
+}
+
+func writeImportMap(w http.ResponseWriter, body []byte) {
+	w.Header().Set("Content-Type", "application/importmap+json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
+
+func (g *Gateway) generateImportMap(call *call, request *server.GenerateImportMapRequest) (*server.ImportMap, error) {
+	response, err := g.unaryInterceptor(call.ctx, request, call.unaryInfo(g.server), func(ctx context.Context, request interface{}) (interface{}, error) {
+		return g.server.GenerateImportMap(ctx, request.(*server.GenerateImportMapRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.(*server.ImportMap), nil
+}
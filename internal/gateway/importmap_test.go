@@ -0,0 +1,132 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type importMapJSON struct {
+	Imports   map[string]string            `json:"imports"`
+	Scopes    map[string]map[string]string `json:"scopes"`
+	Integrity map[string]string            `json:"integrity"`
+}
+
+func TestGetImportMap(t *testing.T) {
+	httpServer := newTestGateway(t)
+	url := httpServer.URL + "/importmap?package=button@2.0.0&package=old-button=button@1.0.0"
+
+	var importMap importMapJSON
+	resp := do(t, http.MethodGet, url, "", "", &importMap)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/importmap+json" {
+		t.Fatalf("GET: status %d, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	want := map[string]string{
+		"button":     "https://cdn.example.com/button/2.0.0.json",
+		"old-button": "https://cdn.example.com/button/1.0.0.json",
+	}
+	if len(importMap.Imports) != len(want) || importMap.Imports["button"] != want["button"] || importMap.Imports["old-button"] != want["old-button"] {
+		t.Errorf("imports = %v, want %v", importMap.Imports, want)
+	}
+
+	if resp.Header.Get("Cache-Control") != "public, max-age=60" || resp.Header.Get("ETag") == "" {
+		t.Errorf("GET: Cache-Control %q, ETag %q", resp.Header.Get("Cache-Control"), resp.Header.Get("ETag"))
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, url, nil)
+	request.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	notModified, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	notModified.Body.Close()
+
+	if notModified.StatusCode != http.StatusNotModified {
+		t.Errorf("GET with the ETag: status %d, want 304", notModified.StatusCode)
+	}
+
+	// "any" picks again on every request, a range moves with the versions.
+	for _, query := range []string{"package=button", "package=button@2.0.0&package=old-button=button@^1"} {
+		if resp := do(t, http.MethodGet, httpServer.URL+"/importmap?"+query, "", "", &importMap); resp.Header.Get("Cache-Control") != "no-store" {
+			t.Errorf("GET %s: Cache-Control %q, want no-store", query, resp.Header.Get("Cache-Control"))
+		}
+	}
+}
+
+func TestGetImportMapWithoutPublicReads(t *testing.T) {
+	httpServer := newTestGatewayWithEnv(t, map[string]string{"AUTH_PUBLIC_READS": "false"})
+	url := httpServer.URL + "/importmap?package=button@2.0.0"
+
+	if resp := do(t, http.MethodGet, url, "", "", nil); resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("GET without credentials: status %d, Cache-Control %q", resp.StatusCode, resp.Header.Get("Cache-Control"))
+	}
+
+	var importMap importMapJSON
+	resp := do(t, http.MethodGet, url, "alice-key", "", &importMap)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Cache-Control") != "private, max-age=60" {
+		t.Errorf("GET: status %d, Cache-Control %q, want a private import map", resp.StatusCode, resp.Header.Get("Cache-Control"))
+	}
+}
+
+func TestPostImportMapScopesAndIntegrity(t *testing.T) {
+	httpServer := newTestGateway(t)
+
+	body := `{
+		"specs": [
+			{"package": "button", "version": "1.0.0"},
+			{"package": "button", "version": "2.0.0", "scope": "/checkout/"}
+		],
+		"integrity": true
+	}`
+
+	var importMap importMapJSON
+	if resp := do(t, http.MethodPost, httpServer.URL+"/importmap", "", body, &importMap); resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST: status %d", resp.StatusCode)
+	}
+
+	if importMap.Imports["button"] != "https://cdn.example.com/button/1.0.0.json" {
+		t.Errorf("imports = %v", importMap.Imports)
+	}
+
+	if importMap.Scopes["/checkout/"]["button"] != "https://cdn.example.com/button/2.0.0.json" {
+		t.Errorf("scopes = %v", importMap.Scopes)
+	}
+
+	// Only the pinned manifest of 2.0.0 has an integrity, the SHA-256 of "{}".
+	const want = "sha256-RBNvo1WzZ4oRRq0W9+hknpT7T8If536DEMBg9hyq/4o="
+	if len(importMap.Integrity) != 1 || importMap.Integrity["https://cdn.example.com/button/2.0.0.json"] != want {
+		t.Errorf("integrity = %v, want %s for 2.0.0", importMap.Integrity, want)
+	}
+}
+
+func TestImportMapRejectsInvalidSpecs(t *testing.T) {
+	httpServer := newTestGateway(t)
+
+	var st struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+
+	for _, body := range []string{
+		`{"specs": [{"package": "button", "version": "1.0.0"}, {"package": "button", "version": "2.0.0"}]}`,
+		`{"specs": [{"package": "button", "specifier": "ui"}, {"package": "card", "specifier": "ui"}]}`,
+		`{"specs": []}`,
+		`{"specs": [{"package": "but+ton"}]}`,
+		`{`,
+	} {
+		if resp := do(t, http.MethodPost, httpServer.URL+"/importmap", "", body, &st); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("POST %s: status %d, want 400", body, resp.StatusCode)
+		}
+	}
+
+	// The same specifier can be mapped once per scope.
+	body := `{"specs": [{"package": "button", "version": "1.0.0"}, {"package": "button", "version": "2.0.0", "scope": "/next/"}]}`
+	if resp := do(t, http.MethodPost, httpServer.URL+"/importmap", "", body, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("POST the same specifier in two scopes: status %d", resp.StatusCode)
+	}
+
+	if resp := do(t, http.MethodGet, httpServer.URL+"/importmap?package=card", "", "", &st); resp.StatusCode != http.StatusNotFound || !strings.Contains(st.Message, "card") {
+		t.Errorf("GET a missing package: status %d, %+v", resp.StatusCode, st)
+	}
+}
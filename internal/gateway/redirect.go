@@ -0,0 +1,113 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/semver"
+)
+
+// anyVersion is the version selector used when a redirect has none. It picks
+// a version by weight, see server.pickVersion.
+const anyVersion = "any"
+
+// redirect sends a 302 to the manifest URL of {package}@{version}, resolved
+// by GetManifestUrl, cached as told by cacheControl.
+func (g *Gateway) redirect(ctx context.Context, w http.ResponseWriter, r *http.Request, target string) {
+	packageName, version := target, anyVersion
+	if i := strings.Index(target, "@"); i >= 0 {
+		packageName, version = target[:i], target[i+1:]
+	}
+
+	call := newCall(ctx, "GetManifestUrl")
+	orn := "packages/" + packageName + "/versions/" + version
+	response, err := g.unaryInterceptor(call.ctx, &polvo_v1.GetManifestUrlRequest{Orn: orn}, call.unaryInfo(g.server), func(ctx context.Context, request interface{}) (interface{}, error) {
+		return g.server.GetManifestUrl(ctx, request.(*polvo_v1.GetManifestUrlRequest))
+	})
+
+	call.forwardMetadata(w)
+
+	if err != nil {
+		w.Header().Set("Cache-Control", "no-store")
+		writeError(w, err)
+		return
+	}
+
+	manifestUrl := response.(*polvo_v1.GetManifestUrlResponse).GetManifestUrl()
+	sum := sha256.Sum256([]byte(manifestUrl))
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	header := w.Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", g.cacheControl(r, version))
+	header.Add("Vary", "X-Polvo-Sticky-Key")
+
+	if matchesETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set("Location", manifestUrl)
+	w.WriteHeader(http.StatusFound)
+}
+
+// cacheControl returns the Cache-Control of a response resolving versions.
+// Only a full version always resolves to the same manifest. "any", channels
+// and ranges move with the weights and rollouts, so they are resolved again on
+// every request unless the request has a sticky key, and then only cached by
+// the client. When reads need credentials no response is cached by shared
+// caches.
+func (g *Gateway) cacheControl(r *http.Request, versions ...string) string {
+	maxAge := "max-age=" + strconv.Itoa(int(g.redirectMaxAge.Seconds()))
+
+	for _, version := range versions {
+		if _, err := semver.Parse(version); err == nil {
+			continue
+		}
+
+		if stickyKey(r) != "" {
+			return "private, " + maxAge
+		}
+
+		return "no-store"
+	}
+
+	if !g.server.PublicReads() {
+		return "private, " + maxAge
+	}
+
+	return "public, " + maxAge
+}
+
+func stickyKey(r *http.Request) string {
+	if key := r.Header.Get("X-Polvo-Sticky-Key"); key != "" {
+		return key
+	}
+
+	return r.URL.Query().Get("sticky_key")
+}
+
+func labelSelector(r *http.Request) string {
+	if selector := r.Header.Get("X-Polvo-Label-Selector"); selector != "" {
+		return selector
+	}
+
+	return r.URL.Query().Get("label_selector")
+}
+
+// matchesETag reports whether an If-None-Match header lists etag.
+func matchesETag(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// noRedirects is a client that returns redirects instead of following them.
+var noRedirects = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func getRedirect(t *testing.T, url string, header map[string]string) *http.Response {
+	t.Helper()
+
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	for name, value := range header {
+		request.Header.Set(name, value)
+	}
+
+	resp, err := noRedirects.Do(request)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+func TestRedirect(t *testing.T) {
+	httpServer := newTestGateway(t)
+
+	tests := []struct {
+		path         string
+		location     string
+		cacheControl string
+	}{
+		{"/r/button@2.0.0", "https://cdn.example.com/button/2.0.0.json", "public, max-age=60"},
+		// Ranges and channels move with the versions and rollouts.
+		{"/r/button@^1", "https://cdn.example.com/button/1.0.0.json", "no-store"},
+		{"/r/button@^1?sticky_key=user-1", "https://cdn.example.com/button/1.0.0.json", "private, max-age=60"},
+		// Without a version, "any" picks again on every request.
+		{"/r/button", "https://cdn.example.com/button/1.0.0.json", "no-store"},
+		{"/r/button@any?sticky_key=user-1", "https://cdn.example.com/button/1.0.0.json", "private, max-age=60"},
+	}
+
+	for _, test := range tests {
+		resp := getRedirect(t, httpServer.URL+test.path, nil)
+
+		if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != test.location {
+			t.Errorf("GET %s: status %d, Location %q, want 302 to %s", test.path, resp.StatusCode, resp.Header.Get("Location"), test.location)
+		}
+
+		if resp.Header.Get("Cache-Control") != test.cacheControl || resp.Header.Get("ETag") == "" {
+			t.Errorf("GET %s: Cache-Control %q, ETag %q, want %q", test.path, resp.Header.Get("Cache-Control"), resp.Header.Get("ETag"), test.cacheControl)
+		}
+	}
+}
+
+func TestRedirectWithoutPublicReads(t *testing.T) {
+	httpServer := newTestGatewayWithEnv(t, map[string]string{"AUTH_PUBLIC_READS": "false"})
+
+	if resp := getRedirect(t, httpServer.URL+"/r/button@2.0.0", nil); resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("GET without credentials: status %d, Cache-Control %q", resp.StatusCode, resp.Header.Get("Cache-Control"))
+	}
+
+	// Shared caches would serve the redirect to readers without credentials.
+	resp := getRedirect(t, httpServer.URL+"/r/button@2.0.0", map[string]string{"X-Api-Key": "alice-key"})
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Cache-Control") != "private, max-age=60" {
+		t.Errorf("GET: status %d, Cache-Control %q, want a private 302", resp.StatusCode, resp.Header.Get("Cache-Control"))
+	}
+}
+
+func TestRedirectNotModified(t *testing.T) {
+	httpServer := newTestGateway(t)
+
+	etag := getRedirect(t, httpServer.URL+"/r/button@2.0.0", nil).Header.Get("ETag")
+
+	for ifNoneMatch, want := range map[string]int{
+		etag:                 http.StatusNotModified,
+		`"other", W/` + etag: http.StatusNotModified,
+		"*":                  http.StatusNotModified,
+		`"other"`:            http.StatusFound,
+	} {
+		resp := getRedirect(t, httpServer.URL+"/r/button@2.0.0", map[string]string{"If-None-Match": ifNoneMatch})
+		if resp.StatusCode != want || resp.Header.Get("ETag") != etag || resp.Header.Get("Cache-Control") != "public, max-age=60" {
+			t.Errorf("If-None-Match %s: status %d, ETag %q, Cache-Control %q, want %d", ifNoneMatch, resp.StatusCode, resp.Header.Get("ETag"), resp.Header.Get("Cache-Control"), want)
+		}
+	}
+}
+
+func TestRedirectNotFound(t *testing.T) {
+	httpServer := newTestGateway(t)
+
+	for _, path := range []string{"/r/card", "/r/button@3.0.0"} {
+		resp := getRedirect(t, httpServer.URL+path, nil)
+
+		var st struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+			t.Fatalf("GET %s: invalid body: %v", path, err)
+		}
+
+		if resp.StatusCode != http.StatusNotFound || st.Code != 5 || st.Message == "" {
+			t.Errorf("GET %s: status %d, %+v, want a NotFound status", path, resp.StatusCode, st)
+		}
+
+		if resp.Header.Get("Cache-Control") != "no-store" || resp.Header.Get("Location") != "" {
+			t.Errorf("GET %s: Cache-Control %q, Location %q", path, resp.Header.Get("Cache-Control"), resp.Header.Get("Location"))
+		}
+	}
+}
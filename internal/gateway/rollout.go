@@ -0,0 +1,181 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+	"pkg.aiocean.dev/polvoservice/internal/server"
+)
+
+type rolloutJSON struct {
+	ID       string            `json:"id"`
+	Package  string            `json:"package"`
+	Version  string            `json:"version"`
+	Steps    []rolloutStepJSON `json:"steps"`
+	Baseline map[string]uint32 `json:"baseline"`
+	State    string            `json:"state"`
+	// Step is the index of the last applied step, -1 before the first one.
+	Step       int        `json:"step"`
+	NextStepAt *time.Time `json:"next_step_at,omitempty"`
+	PausedAt   *time.Time `json:"paused_at,omitempty"`
+	Revision   int64      `json:"revision"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+type rolloutStepJSON struct {
+	Weight uint32   `json:"weight"`
+	After  duration `json:"after"`
+}
+
+type listRolloutsJSON struct {
+	Rollouts []*rolloutJSON `json:"rollouts"`
+}
+
+// rolloutEventJSON is the data of the events of GET /rollouts/{id}/watch.
+type rolloutEventJSON struct {
+	Rollout *rolloutJSON      `json:"rollout"`
+	Weights map[string]uint32 `json:"weights,omitempty"`
+	Time    time.Time         `json:"time"`
+}
+
+// startRolloutBody is the body of POST /packages/{package}/rollouts, e.g.
+// {"version": "1.2.0", "steps": [{"weight": 5, "after": "0s"}, {"weight": 100, "after": "24h"}]}.
+type startRolloutBody struct {
+	Version string            `json:"version"`
+	Steps   []rolloutStepJSON `json:"steps"`
+}
+
+func newRolloutJSON(rollout *repository.Rollout) *rolloutJSON {
+	steps := make([]rolloutStepJSON, 0, len(rollout.Steps))
+	for _, step := range rollout.Steps {
+		steps = append(steps, rolloutStepJSON{Weight: step.Weight, After: duration(step.After)})
+	}
+
+	return &rolloutJSON{
+		ID:         rollout.ID,
+		Package:    rollout.Package,
+		Version:    rollout.Version,
+		Steps:      steps,
+		Baseline:   rollout.Baseline,
+		State:      string(rollout.State),
+		Step:       rollout.Step,
+		NextStepAt: timestamp(rollout.NextStepAt),
+		PausedAt:   timestamp(rollout.PausedAt),
+		Revision:   rollout.Revision,
+		CreatedAt:  rollout.CreatedAt,
+		UpdatedAt:  rollout.UpdatedAt,
+	}
+}
+
+func (g *Gateway) listRollouts(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.ListRolloutsRequest{PackageOrn: strings.Join(segments[:2], "/")}
+
+	g.unary(ctx, w, "ListRollouts", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		rollouts, err := g.server.ListRollouts(ctx, request.(*server.ListRolloutsRequest))
+		if err != nil {
+			return nil, err
+		}
+
+		response := &listRolloutsJSON{Rollouts: make([]*rolloutJSON, 0, len(rollouts))}
+		for _, rollout := range rollouts {
+			response.Rollouts = append(response.Rollouts, newRolloutJSON(rollout))
+		}
+
+		return response, nil
+	})
+}
+
+func (g *Gateway) startRollout(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	var body startRolloutBody
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	request := &server.StartRolloutRequest{
+		PackageOrn: strings.Join(segments[:2], "/"),
+		Version:    body.Version,
+	}
+	for _, step := range body.Steps {
+		request.Steps = append(request.Steps, repository.RolloutStep{Weight: step.Weight, After: time.Duration(step.After)})
+	}
+
+	g.unary(ctx, w, "StartRollout", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return rolloutResponse(g.server.StartRollout(ctx, request.(*server.StartRolloutRequest)))
+	})
+}
+
+func (g *Gateway) getRollout(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.GetRolloutRequest{ID: segments[1]}
+
+	g.unary(ctx, w, "GetRollout", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return rolloutResponse(g.server.GetRollout(ctx, request.(*server.GetRolloutRequest)))
+	})
+}
+
+func (g *Gateway) pauseRollout(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.PauseRolloutRequest{ID: segments[1]}
+
+	g.unary(ctx, w, "PauseRollout", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return rolloutResponse(g.server.PauseRollout(ctx, request.(*server.PauseRolloutRequest)))
+	})
+}
+
+func (g *Gateway) resumeRollout(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.ResumeRolloutRequest{ID: segments[1]}
+
+	g.unary(ctx, w, "ResumeRollout", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return rolloutResponse(g.server.ResumeRollout(ctx, request.(*server.ResumeRolloutRequest)))
+	})
+}
+
+func (g *Gateway) abortRollout(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.AbortRolloutRequest{ID: segments[1]}
+
+	g.unary(ctx, w, "AbortRollout", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return rolloutResponse(g.server.AbortRollout(ctx, request.(*server.AbortRolloutRequest)))
+	})
+}
+
+// watchRollout streams the events of WatchRollout as Server-Sent Events,
+// typed by the state of the rollout. The stream ends when the rollout is
+// completed or aborted. Its first event is the current state of the rollout,
+// so a client reconnects without resume token.
+func (g *Gateway) watchRollout(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.WatchRolloutRequest{ID: segments[1]}
+
+	g.serveEvents(ctx, w, "WatchRollout", rolloutEventText, func(srv interface{}, stream grpc.ServerStream) error {
+		return g.server.WatchRollout(stream.Context(), request, func(event *server.RolloutEvent) error {
+			return stream.SendMsg(event)
+		})
+	})
+}
+
+func rolloutEventText(message interface{}) (string, error) {
+	event := message.(*server.RolloutEvent)
+
+	data, err := json.Marshal(&rolloutEventJSON{
+		Rollout: newRolloutJSON(event.Rollout),
+		Weights: event.Weights,
+		Time:    event.Time,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return "event: " + string(event.Rollout.State) + "\ndata: " + string(data) + "\n\n", nil
+}
+
+func rolloutResponse(rollout *repository.Rollout, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return newRolloutJSON(rollout), nil
+}
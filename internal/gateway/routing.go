@@ -0,0 +1,106 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+	"pkg.aiocean.dev/polvoservice/internal/server"
+)
+
+type routingRevisionJSON struct {
+	Revision  int64                     `json:"revision"`
+	Entries   []repository.RoutingEntry `json:"entries"`
+	CreatedAt time.Time                 `json:"created_at"`
+}
+
+type listRoutingRevisionsJSON struct {
+	Revisions []*routingRevisionJSON `json:"revisions"`
+}
+
+// rollbackPackageBody is the body of POST /packages/{package}/rollback.
+type rollbackPackageBody struct {
+	Revision int64 `json:"revision"`
+}
+
+// setPackageWeightsBody is the body of PUT /packages/{package}/weights.
+type setPackageWeightsBody struct {
+	Weights    map[string]uint32 `json:"weights"`
+	Percentage bool              `json:"percentage"`
+}
+
+func newRoutingRevisionJSON(revision *repository.RoutingRevision) *routingRevisionJSON {
+	entries := revision.Entries
+	if entries == nil {
+		entries = []repository.RoutingEntry{}
+	}
+
+	return &routingRevisionJSON{
+		Revision:  revision.Revision,
+		Entries:   entries,
+		CreatedAt: revision.CreatedAt,
+	}
+}
+
+func (g *Gateway) listRoutingRevisions(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.ListRoutingRevisionsRequest{Orn: strings.Join(segments[:2], "/")}
+
+	g.unary(ctx, w, "ListRoutingRevisions", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		revisions, err := g.server.ListRoutingRevisions(ctx, request.(*server.ListRoutingRevisionsRequest))
+		if err != nil {
+			return nil, err
+		}
+
+		response := &listRoutingRevisionsJSON{Revisions: make([]*routingRevisionJSON, 0, len(revisions))}
+		for _, revision := range revisions {
+			response.Revisions = append(response.Revisions, newRoutingRevisionJSON(revision))
+		}
+
+		return response, nil
+	})
+}
+
+func (g *Gateway) rollbackPackage(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	var body rollbackPackageBody
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	request := &server.RollbackPackageRequest{
+		Orn:      strings.Join(segments[:2], "/"),
+		Revision: body.Revision,
+	}
+
+	g.unary(ctx, w, "RollbackPackage", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return routingRevisionResponse(g.server.RollbackPackage(ctx, request.(*server.RollbackPackageRequest)))
+	})
+}
+
+func (g *Gateway) setPackageWeights(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	var body setPackageWeightsBody
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	request := &server.SetPackageWeightsRequest{
+		Orn:        strings.Join(segments[:2], "/"),
+		Weights:    body.Weights,
+		Percentage: body.Percentage,
+	}
+
+	g.unary(ctx, w, "SetPackageWeights", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return routingRevisionResponse(g.server.SetPackageWeights(ctx, request.(*server.SetPackageWeightsRequest)))
+	})
+}
+
+func routingRevisionResponse(revision *repository.RoutingRevision, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return newRoutingRevisionJSON(revision), nil
+}
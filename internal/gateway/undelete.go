@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"pkg.aiocean.dev/polvoservice/internal/server"
+)
+
+type purgeResultJSON struct {
+	Packages int `json:"packages"`
+	Versions int `json:"versions"`
+}
+
+// purgeDeletedBody is the body of POST /purge. The retention is required, so
+// that an empty body does not purge every deleted record.
+type purgeDeletedBody struct {
+	Retention *duration `json:"retention"`
+}
+
+func (g *Gateway) undeletePackage(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.UndeletePackageRequest{Orn: strings.Join(segments[:2], "/")}
+
+	g.unary(ctx, w, "UndeletePackage", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return g.server.UndeletePackage(ctx, request.(*server.UndeletePackageRequest))
+	})
+}
+
+func (g *Gateway) undeleteVersion(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.UndeleteVersionRequest{Orn: strings.Join(segments[:4], "/")}
+
+	g.unary(ctx, w, "UndeleteVersion", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return g.server.UndeleteVersion(ctx, request.(*server.UndeleteVersionRequest))
+	})
+}
+
+func (g *Gateway) purgeDeleted(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	var body purgeDeletedBody
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if body.Retention == nil {
+		writeError(w, status.Error(codes.InvalidArgument, "retention is required"))
+		return
+	}
+
+	request := &server.PurgeDeletedRequest{Retention: time.Duration(*body.Retention)}
+
+	g.unary(ctx, w, "PurgeDeleted", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		result, err := g.server.PurgeDeleted(ctx, request.(*server.PurgeDeletedRequest))
+		if err != nil {
+			return nil, err
+		}
+
+		return &purgeResultJSON{Packages: result.Packages, Versions: result.Versions}, nil
+	})
+}
@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"pkg.aiocean.dev/polvoservice/internal/server"
+)
+
+const (
+	watchPath = "/watch"
+	// watchKeepAlive is how often an idle event stream sends a comment, so
+	// that proxies do not close it.
+	watchKeepAlive = 30 * time.Second
+)
+
+// watch streams the change events of WatchPackages, or of WatchPackage when
+// packageOrn is set, as Server-Sent Events. The id of an event is its resume
+// token, so an EventSource resumes from the Last-Event-ID it sends when it
+// reconnects.
+func (g *Gateway) watch(ctx context.Context, w http.ResponseWriter, r *http.Request, packageOrn string) {
+	resumeToken := r.Header.Get("Last-Event-ID")
+	if resumeToken == "" {
+		resumeToken = r.URL.Query().Get("resume_token")
+	}
+
+	method := "WatchPackages"
+	if packageOrn != "" {
+		method = "WatchPackage"
+	}
+
+	g.serveEvents(ctx, w, method, changeEventText, func(srv interface{}, stream grpc.ServerStream) error {
+		send := func(event *server.ChangeEvent) error {
+			return stream.SendMsg(event)
+		}
+
+		if packageOrn == "" {
+			return g.server.WatchPackages(stream.Context(), &server.WatchPackagesRequest{ResumeToken: resumeToken}, send)
+		}
+
+		return g.server.WatchPackage(stream.Context(), &server.WatchPackageRequest{Orn: packageOrn, ResumeToken: resumeToken}, send)
+	})
+}
+
+func changeEventText(message interface{}) (string, error) {
+	event := message.(*server.ChangeEvent)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+
+	return "id: " + event.ResumeToken + "\nevent: " + string(event.Type) + "\ndata: " + string(data) + "\n\n", nil
+}
+
+// serveEvents runs a server streaming RPC through the stream interceptor and
+// writes the messages it sends as Server-Sent Events, formatted by format. An
+// error before the stream starts is a JSON error response, an error after is
+// an "error" event.
+func (g *Gateway) serveEvents(ctx context.Context, w http.ResponseWriter, method string, format func(message interface{}) (string, error), handler grpc.StreamHandler) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, status.Error(codes.Unimplemented, "the connection does not support streaming"))
+		return
+	}
+
+	// The watches never end by themselves, end them when the gateway shuts
+	// down.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-g.watches.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	call := newCall(ctx, method)
+	events := &eventStream{w: w, flusher: flusher, call: call, format: format, done: make(chan struct{})}
+	call.headerSent = events.start
+
+	stream := &serverStream{call: call, send: events.send}
+	err := g.streamInterceptor(g.server, stream, call.streamInfo(), handler)
+
+	events.finish(err)
+}
+
+// eventStream writes the events of a watch as Server-Sent Events. The
+// response starts when the watch sends its header.
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	call    *call
+	// format turns a sent message into the text of its event.
+	format func(message interface{}) (string, error)
+
+	mu      sync.Mutex
+	started bool
+	done    chan struct{}
+}
+
+func (s *eventStream) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return
+	}
+	s.started = true
+
+	s.call.forwardMetadata(s.w)
+
+	header := s.w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-store")
+	// Disables the response buffering of nginx.
+	header.Set("X-Accel-Buffering", "no")
+
+	s.w.WriteHeader(http.StatusOK)
+	s.flusher.Flush()
+
+	go s.keepAlive()
+}
+
+func (s *eventStream) keepAlive() {
+	ticker := time.NewTicker(watchKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			_ = s.write(": keep-alive\n\n")
+		}
+	}
+}
+
+func (s *eventStream) send(message interface{}) error {
+	text, err := s.format(message)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	s.start()
+
+	return s.write(text)
+}
+
+func (s *eventStream) write(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	default:
+	}
+
+	if _, err := io.WriteString(s.w, text); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+
+	return nil
+}
+
+// finish reports the error that ended the watch and stops the keep-alive.
+func (s *eventStream) finish(err error) {
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+
+	if !started {
+		s.call.forwardMetadata(s.w)
+		writeError(s.w, err)
+		return
+	}
+
+	if st := status.Convert(err); err != nil && st.Code() != codes.Canceled {
+		if data, marshalErr := marshalOptions.Marshal(st.Proto()); marshalErr == nil {
+			_ = s.write("event: error\ndata: " + string(data) + "\n\n")
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	close(s.done)
+}
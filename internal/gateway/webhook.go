@@ -0,0 +1,213 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+	"pkg.aiocean.dev/polvoservice/internal/server"
+)
+
+type webhookJSON struct {
+	ID      string `json:"id"`
+	Package string `json:"package,omitempty"`
+	URL     string `json:"url"`
+	// Secret is only returned when the webhook is created.
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type listWebhooksJSON struct {
+	Webhooks []*webhookJSON `json:"webhooks"`
+}
+
+type webhookDeliveryJSON struct {
+	ID             string          `json:"id"`
+	WebhookID      string          `json:"webhook_id"`
+	IdempotencyKey string          `json:"idempotency_key"`
+	Package        string          `json:"package"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	State          string          `json:"state"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastStatusCode int             `json:"last_status_code"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+type listWebhookDeliveriesJSON struct {
+	Deliveries    []*webhookDeliveryJSON `json:"deliveries"`
+	NextPageToken string                 `json:"next_page_token"`
+}
+
+// createWebhookBody is the body of POST /webhooks.
+type createWebhookBody struct {
+	PackageOrn string   `json:"package_orn"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+}
+
+func newWebhookJSON(webhook *repository.Webhook) *webhookJSON {
+	eventTypes := webhook.EventTypes
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+
+	return &webhookJSON{
+		ID:         webhook.ID,
+		Package:    webhook.Package,
+		URL:        webhook.URL,
+		Secret:     webhook.Secret,
+		EventTypes: eventTypes,
+		CreatedBy:  webhook.CreatedBy,
+		CreatedAt:  webhook.CreatedAt,
+	}
+}
+
+func newWebhookDeliveryJSON(delivery *repository.WebhookDelivery) *webhookDeliveryJSON {
+	payload := json.RawMessage(delivery.Payload)
+	if !json.Valid(payload) {
+		payload = json.RawMessage("null")
+	}
+
+	return &webhookDeliveryJSON{
+		ID:             delivery.ID,
+		WebhookID:      delivery.WebhookID,
+		IdempotencyKey: delivery.IdempotencyKey,
+		Package:        delivery.Package,
+		EventType:      delivery.EventType,
+		Payload:        payload,
+		State:          string(delivery.State),
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  timestamp(delivery.NextAttemptAt),
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+		CreatedAt:      delivery.CreatedAt,
+		UpdatedAt:      delivery.UpdatedAt,
+	}
+}
+
+// listWebhooks lists the webhooks of the package of the package_orn query
+// parameter, or every webhook without it.
+func (g *Gateway) listWebhooks(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.ListWebhooksRequest{PackageOrn: r.URL.Query().Get("package_orn")}
+
+	g.unary(ctx, w, "ListWebhooks", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		webhooks, err := g.server.ListWebhooks(ctx, request.(*server.ListWebhooksRequest))
+		if err != nil {
+			return nil, err
+		}
+
+		response := &listWebhooksJSON{Webhooks: make([]*webhookJSON, 0, len(webhooks))}
+		for _, webhook := range webhooks {
+			response.Webhooks = append(response.Webhooks, newWebhookJSON(webhook))
+		}
+
+		return response, nil
+	})
+}
+
+func (g *Gateway) createWebhook(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	var body createWebhookBody
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	request := &server.CreateWebhookRequest{
+		PackageOrn: body.PackageOrn,
+		URL:        body.URL,
+		Secret:     body.Secret,
+	}
+	for _, eventType := range body.EventTypes {
+		request.EventTypes = append(request.EventTypes, server.ChangeType(eventType))
+	}
+
+	g.unary(ctx, w, "CreateWebhook", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return webhookResponse(g.server.CreateWebhook(ctx, request.(*server.CreateWebhookRequest)))
+	})
+}
+
+func (g *Gateway) getWebhook(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.GetWebhookRequest{ID: segments[1]}
+
+	g.unary(ctx, w, "GetWebhook", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return webhookResponse(g.server.GetWebhook(ctx, request.(*server.GetWebhookRequest)))
+	})
+}
+
+func (g *Gateway) deleteWebhook(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.DeleteWebhookRequest{ID: segments[1]}
+
+	g.unary(ctx, w, "DeleteWebhook", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		if err := g.server.DeleteWebhook(ctx, request.(*server.DeleteWebhookRequest)); err != nil {
+			return nil, err
+		}
+
+		return &emptyJSON{}, nil
+	})
+}
+
+// listWebhookDeliveries reads the webhook_id, state, page_size and
+// page_token query parameters.
+func (g *Gateway) listWebhookDeliveries(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	query := r.URL.Query()
+
+	pageSize, err := queryPageSize(query)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	request := &server.ListWebhookDeliveriesRequest{
+		WebhookID: query.Get("webhook_id"),
+		State:     repository.WebhookDeliveryState(query.Get("state")),
+		PageSize:  pageSize,
+		PageToken: query.Get("page_token"),
+	}
+
+	g.unary(ctx, w, "ListWebhookDeliveries", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		page, err := g.server.ListWebhookDeliveries(ctx, request.(*server.ListWebhookDeliveriesRequest))
+		if err != nil {
+			return nil, err
+		}
+
+		response := &listWebhookDeliveriesJSON{
+			Deliveries:    make([]*webhookDeliveryJSON, 0, len(page.Deliveries)),
+			NextPageToken: page.NextPageToken,
+		}
+		for _, delivery := range page.Deliveries {
+			response.Deliveries = append(response.Deliveries, newWebhookDeliveryJSON(delivery))
+		}
+
+		return response, nil
+	})
+}
+
+func (g *Gateway) redeliverWebhookDelivery(ctx context.Context, w http.ResponseWriter, r *http.Request, segments []string) {
+	request := &server.RedeliverWebhookDeliveryRequest{ID: segments[1]}
+
+	g.unary(ctx, w, "RedeliverWebhookDelivery", request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		delivery, err := g.server.RedeliverWebhookDelivery(ctx, request.(*server.RedeliverWebhookDeliveryRequest))
+		if err != nil {
+			return nil, err
+		}
+
+		return newWebhookDeliveryJSON(delivery), nil
+	})
+}
+
+func webhookResponse(webhook *repository.Webhook, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return newWebhookJSON(webhook), nil
+}
@@ -0,0 +1,133 @@
+package labels
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MaxLabels is the maximum number of labels of a version.
+const MaxLabels = 32
+
+// Keys and values are at most 63 letters, digits, "-", "_" and ".", starting
+// and ending with a letter or a digit. Values can also be empty. Neither can
+// contain "=" or ",", so a label is stored as the string "key=value".
+var (
+	keyPattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_.-]{0,61}[A-Za-z0-9])?$`)
+	valuePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9_.-]{0,61}[A-Za-z0-9])?)?$`)
+)
+
+// Parse parses labels written as "key=value,key=value", the format of String.
+// An empty expression has no labels.
+func Parse(expression string) (map[string]string, error) {
+	labels := map[string]string{}
+
+	for _, label := range strings.Split(expression, ",") {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid label %q, labels are written key=value", label)
+		}
+
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if _, ok := labels[key]; ok {
+			return nil, errors.Errorf("label %q is set twice", key)
+		}
+
+		labels[key] = value
+	}
+
+	if err := Validate(labels); err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// Validate checks the keys, the values and the number of labels.
+func Validate(labels map[string]string) error {
+	if len(labels) > MaxLabels {
+		return errors.Errorf("a version has at most %d labels", MaxLabels)
+	}
+
+	for key, value := range labels {
+		if err := validateKey(key); err != nil {
+			return err
+		}
+
+		if err := validateValue(value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// String formats labels as sorted "key=value,key=value".
+func String(labels map[string]string) string {
+	return strings.Join(Pairs(labels), ",")
+}
+
+// Pairs returns the labels as sorted "key=value" strings.
+func Pairs(labels map[string]string) []string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, Pair(key, value))
+	}
+	sort.Strings(pairs)
+
+	return pairs
+}
+
+// Pair is the "key=value" string of a label.
+func Pair(key, value string) string {
+	return key + "=" + value
+}
+
+// FromPairs is the reverse of Pairs, it skips strings without "=".
+func FromPairs(pairs []string) map[string]string {
+	labels := map[string]string{}
+	for _, pair := range pairs {
+		if parts := strings.SplitN(pair, "=", 2); len(parts) == 2 {
+			labels[parts[0]] = parts[1]
+		}
+	}
+
+	return labels
+}
+
+// Copy returns a copy of labels, nil when there is no label.
+func Copy(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	copied := make(map[string]string, len(labels))
+	for key, value := range labels {
+		copied[key] = value
+	}
+
+	return copied
+}
+
+func validateKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return errors.Errorf("invalid label key %q, keys are at most 63 letters, digits, '-', '_' and '.', starting and ending with a letter or a digit", key)
+	}
+
+	return nil
+}
+
+func validateValue(value string) error {
+	if !valuePattern.MatchString(value) {
+		return errors.Errorf("invalid label value %q, values are empty or at most 63 letters, digits, '-', '_' and '.', starting and ending with a letter or a digit", value)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package labels
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	got, err := Parse(" tier=web , env=prod,canary= ")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	want := map[string]string{"env": "prod", "tier": "web", "canary": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse = %v, want %v", got, want)
+	}
+
+	if String(got) != "canary=,env=prod,tier=web" {
+		t.Errorf("String = %q, want the sorted labels", String(got))
+	}
+
+	if !reflect.DeepEqual(FromPairs(Pairs(got)), want) {
+		t.Errorf("FromPairs(Pairs) = %v, want %v", FromPairs(Pairs(got)), want)
+	}
+
+	if empty, err := Parse(""); err != nil || len(empty) != 0 {
+		t.Errorf("Parse of an empty expression = %v, %v", empty, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tooMany := make([]string, MaxLabels+1)
+	for i := range tooMany {
+		tooMany[i] = "key" + strconv.Itoa(i) + "=value"
+	}
+
+	for _, expression := range []string{
+		"env",
+		"env=prod,env=staging",
+		"=prod",
+		"env=prod=1",
+		"env=-prod",
+		"env.=prod",
+		strings.Repeat("k", 64) + "=v",
+		"k=" + strings.Repeat("v", 64),
+		strings.Join(tooMany, ","),
+	} {
+		if labels, err := Parse(expression); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", expression, labels)
+		}
+	}
+}
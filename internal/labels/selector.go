@@ -0,0 +1,192 @@
+package labels
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type Operator string
+
+const (
+	Equals       Operator = "="
+	NotEquals    Operator = "!="
+	In           Operator = "in"
+	NotIn        Operator = "notin"
+	Exists       Operator = "exists"
+	DoesNotExist Operator = "!"
+)
+
+// Requirement is one condition of a Selector. Values has one value for Equals
+// and NotEquals, at least one for In and NotIn, and none otherwise.
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Values   []string
+}
+
+// Selector is a set of requirements joined by ",". Labels match the selector
+// when they match every requirement. Like in Kubernetes, NotEquals and NotIn
+// also match labels without the key.
+type Selector struct {
+	requirements []Requirement
+	original     string
+}
+
+var setPattern = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+
+// ParseSelector parses Kubernetes style selectors like "env=prod",
+// "env!=staging", "tier in (web, api)", "tier notin (batch)", "canary" and
+// "!canary". An empty expression selects everything.
+func ParseSelector(expression string) (*Selector, error) {
+	s := &Selector{original: expression}
+
+	for _, requirement := range splitRequirements(expression) {
+		if requirement == "" {
+			continue
+		}
+
+		parsed, err := parseRequirement(requirement)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid label selector %q", expression)
+		}
+
+		s.requirements = append(s.requirements, parsed)
+	}
+
+	return s, nil
+}
+
+func (s *Selector) String() string {
+	return s.original
+}
+
+// Empty is true for a nil selector and for a selector without requirement,
+// both select everything.
+func (s *Selector) Empty() bool {
+	return s == nil || len(s.requirements) == 0
+}
+
+func (s *Selector) Requirements() []Requirement {
+	if s == nil {
+		return nil
+	}
+
+	return s.requirements
+}
+
+func (s *Selector) Matches(labels map[string]string) bool {
+	for _, requirement := range s.Requirements() {
+		if !requirement.Matches(labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r Requirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+
+	switch r.Operator {
+	case Exists:
+		return ok
+	case DoesNotExist:
+		return !ok
+	case Equals, In:
+		return ok && contains(r.Values, value)
+	case NotEquals, NotIn:
+		return !ok || !contains(r.Values, value)
+	}
+
+	return false
+}
+
+// splitRequirements splits the selector on the commas that are not inside the
+// parentheses of a set.
+func splitRequirements(expression string) []string {
+	var requirements []string
+
+	depth, start := 0, 0
+	for i, c := range expression {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				requirements = append(requirements, strings.TrimSpace(expression[start:i]))
+				start = i + 1
+			}
+		}
+	}
+
+	return append(requirements, strings.TrimSpace(expression[start:]))
+}
+
+func parseRequirement(expression string) (Requirement, error) {
+	if match := setPattern.FindStringSubmatch(expression); match != nil {
+		requirement := Requirement{Key: match[1], Operator: Operator(match[2])}
+		for _, value := range strings.Split(match[3], ",") {
+			requirement.Values = append(requirement.Values, strings.TrimSpace(value))
+		}
+
+		return requirement, requirement.validate()
+	}
+
+	if strings.HasPrefix(expression, "!") && !strings.Contains(expression, "=") {
+		requirement := Requirement{Key: strings.TrimSpace(expression[1:]), Operator: DoesNotExist}
+
+		return requirement, requirement.validate()
+	}
+
+	// Longest tokens first so that "!=" is not read as "=".
+	for _, token := range []struct {
+		text     string
+		operator Operator
+	}{
+		{"!=", NotEquals},
+		{"==", Equals},
+		{"=", Equals},
+	} {
+		if parts := strings.SplitN(expression, token.text, 2); len(parts) == 2 {
+			requirement := Requirement{
+				Key:      strings.TrimSpace(parts[0]),
+				Operator: token.operator,
+				Values:   []string{strings.TrimSpace(parts[1])},
+			}
+
+			return requirement, requirement.validate()
+		}
+	}
+
+	requirement := Requirement{Key: expression, Operator: Exists}
+
+	return requirement, requirement.validate()
+}
+
+func (r Requirement) validate() error {
+	if err := validateKey(r.Key); err != nil {
+		return err
+	}
+
+	for _, value := range r.Values {
+		if err := validateValue(value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
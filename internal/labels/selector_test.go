@@ -0,0 +1,117 @@
+package labels
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       []Requirement
+	}{
+		{"env=prod", []Requirement{{Key: "env", Operator: Equals, Values: []string{"prod"}}}},
+		{"env==prod", []Requirement{{Key: "env", Operator: Equals, Values: []string{"prod"}}}},
+		{"env=", []Requirement{{Key: "env", Operator: Equals, Values: []string{""}}}},
+		{"env!=staging", []Requirement{{Key: "env", Operator: NotEquals, Values: []string{"staging"}}}},
+		{"tier in (web, api)", []Requirement{{Key: "tier", Operator: In, Values: []string{"web", "api"}}}},
+		{"tier notin (batch)", []Requirement{{Key: "tier", Operator: NotIn, Values: []string{"batch"}}}},
+		{"canary", []Requirement{{Key: "canary", Operator: Exists}}},
+		{"!canary", []Requirement{{Key: "canary", Operator: DoesNotExist}}},
+		{"env=prod,tier in (web,api),!canary", []Requirement{
+			{Key: "env", Operator: Equals, Values: []string{"prod"}},
+			{Key: "tier", Operator: In, Values: []string{"web", "api"}},
+			{Key: "canary", Operator: DoesNotExist},
+		}},
+		// Whitespace around the keys, the operators and the values is ignored.
+		{"  env = prod ,  tier  in ( web , api ) , ! canary ", []Requirement{
+			{Key: "env", Operator: Equals, Values: []string{"prod"}},
+			{Key: "tier", Operator: In, Values: []string{"web", "api"}},
+			{Key: "canary", Operator: DoesNotExist},
+		}},
+		{"", nil},
+		{" , ", nil},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseSelector(tt.expression)
+		if err != nil {
+			t.Errorf("ParseSelector(%q): %v", tt.expression, err)
+			continue
+		}
+
+		if got := s.Requirements(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSelector(%q) = %+v, want %+v", tt.expression, got, tt.want)
+		}
+
+		if s.String() != tt.expression || s.Empty() != (len(tt.want) == 0) {
+			t.Errorf("ParseSelector(%q) = %q, empty %v", tt.expression, s, s.Empty())
+		}
+	}
+}
+
+func TestParseSelectorErrors(t *testing.T) {
+	for _, expression := range []string{
+		"=prod",
+		"!=prod",
+		"env=pro=d",
+		"env=prod value",
+		"env!=-staging",
+		"!env=prod",
+		"!",
+		"-env",
+		"env.",
+		"tier in web",
+		"tier in (web",
+		"tier in (web api)",
+		"tier notin (web,-api)",
+		"env=prod,,tier=web=api",
+	} {
+		if s, err := ParseSelector(expression); err == nil {
+			t.Errorf("ParseSelector(%q) = %+v, want an error", expression, s.Requirements())
+		}
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	labels := map[string]string{"env": "prod", "tier": "web"}
+
+	tests := []struct {
+		expression string
+		want       bool
+	}{
+		{"", true},
+		{"env=prod", true},
+		{"env=staging", false},
+		{"env!=staging", true},
+		{"env!=prod", false},
+		// NotEquals and NotIn match the labels without the key.
+		{"region!=eu", true},
+		{"region notin (eu)", true},
+		{"tier in (web, api)", true},
+		{"tier in (api)", false},
+		{"tier notin (web)", false},
+		{"env", true},
+		{"canary", false},
+		{"!canary", true},
+		{"!env", false},
+		{"env=prod,tier in (api, web),!canary", true},
+		{"env=prod,canary", false},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseSelector(tt.expression)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q): %v", tt.expression, err)
+		}
+
+		if got := s.Matches(labels); got != tt.want {
+			t.Errorf("%q.Matches(%v) = %v, want %v", tt.expression, labels, got, tt.want)
+		}
+	}
+
+	var nilSelector *Selector
+	if !nilSelector.Empty() || !nilSelector.Matches(labels) {
+		t.Error("a nil selector does not select everything")
+	}
+}
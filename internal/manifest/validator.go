@@ -0,0 +1,345 @@
+package manifest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/wire"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+var WireSet = wire.NewSet(
+	NewValidator,
+)
+
+// ErrInvalidManifest is returned when a manifest URL is not allowed or does not
+// point at a valid manifest.
+var ErrInvalidManifest = errors.New("invalid manifest")
+
+const (
+	defaultFetchTimeout = 10 * time.Second
+	// maxManifestSize bounds the body read from a manifest URL.
+	maxManifestSize = 1 << 20
+	// maxRedirects bounds the redirects followed when fetching a manifest.
+	maxRedirects = 5
+)
+
+type Stage string
+
+const (
+	StageURL     Stage = "url"
+	StageFetch   Stage = "fetch"
+	StageContent Stage = "content"
+)
+
+// Progress reports a validation stage that passed, or the stage that failed.
+type Progress struct {
+	Stage   Stage
+	Message string
+	Failed  bool
+}
+
+type Options struct {
+	// Schemes are the allowed URL schemes.
+	Schemes []string
+	// Hosts are the allowed hosts, "*.example.com" allows every subdomain of
+	// example.com. Every host is allowed when it is empty.
+	Hosts []string
+	// RequiredKeys are gjson paths that the manifest must have.
+	RequiredKeys []string
+	// Client fetches the manifests. It is copied, and its CheckRedirect only
+	// runs for redirects to allowed URLs.
+	Client *http.Client
+}
+
+// Validator checks that a manifest URL is allowed and serves a JSON manifest.
+// NewValidator configures it from the environment:
+//
+//  MANIFEST_VALIDATION        "true" validates the manifest of new versions.
+//  MANIFEST_PINNING           "true" pins the SHA-256 of the manifest of new
+//                             versions.
+//  MANIFEST_STORE_BODY        "true" also stores pinned manifests.
+//  MANIFEST_ALLOWED_SCHEMES   comma separated schemes, "https" by default.
+//  MANIFEST_ALLOWED_HOSTS     comma separated hosts, any host if empty.
+//  MANIFEST_REQUIRED_KEYS     comma separated keys the manifest must have.
+//  MANIFEST_FETCH_TIMEOUT     timeout of the request, "10s" by default.
+type Validator struct {
+	enabled      bool
+	pinning      bool
+	storeBody    bool
+	schemes      map[string]bool
+	hosts        []string
+	requiredKeys []string
+	client       *http.Client
+}
+
+func NewValidator() (*Validator, error) {
+	options := Options{
+		Schemes:      []string{"https"},
+		Hosts:        splitList(os.Getenv("MANIFEST_ALLOWED_HOSTS")),
+		RequiredKeys: splitList(os.Getenv("MANIFEST_REQUIRED_KEYS")),
+		Client:       &http.Client{Timeout: defaultFetchTimeout},
+	}
+
+	if schemes := splitList(os.Getenv("MANIFEST_ALLOWED_SCHEMES")); len(schemes) > 0 {
+		options.Schemes = schemes
+	}
+
+	if value := os.Getenv("MANIFEST_FETCH_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid MANIFEST_FETCH_TIMEOUT")
+		}
+
+		options.Client.Timeout = timeout
+	}
+
+	validator := New(options)
+
+	validator.enabled = false
+
+	for name, value := range map[string]*bool{
+		"MANIFEST_VALIDATION": &validator.enabled,
+		"MANIFEST_PINNING":    &validator.pinning,
+		"MANIFEST_STORE_BODY": &validator.storeBody,
+	} {
+		if os.Getenv(name) == "" {
+			continue
+		}
+
+		parsed, err := strconv.ParseBool(os.Getenv(name))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", name)
+		}
+
+		*value = parsed
+	}
+
+	return validator, nil
+}
+
+// New returns a Validator that validates manifests, without pinning them.
+func New(options Options) *Validator {
+	v := &Validator{
+		enabled:      true,
+		schemes:      map[string]bool{},
+		requiredKeys: options.RequiredKeys,
+	}
+
+	for _, scheme := range options.Schemes {
+		v.schemes[strings.ToLower(scheme)] = true
+	}
+
+	for _, host := range options.Hosts {
+		v.hosts = append(v.hosts, strings.ToLower(host))
+	}
+
+	client := &http.Client{Timeout: defaultFetchTimeout}
+	if options.Client != nil {
+		copied := *options.Client
+		client = &copied
+	}
+
+	client.CheckRedirect = v.checkRedirect(client.CheckRedirect)
+	v.client = client
+
+	return v
+}
+
+// checkRedirect checks every redirect target like the manifest URL, so that an
+// allowed host can not send the fetch to a host that is not, and stops after
+// maxRedirects.
+func (v *Validator) checkRedirect(next func(*http.Request, []*http.Request) error) func(*http.Request, []*http.Request) error {
+	return func(request *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return errors.Errorf("stopped after %d redirects", maxRedirects)
+		}
+
+		if _, err := v.checkURL(request.URL.String()); err != nil {
+			return errors.Wrap(err, "redirect")
+		}
+
+		if next != nil {
+			return next(request, via)
+		}
+
+		return nil
+	}
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func (v *Validator) Enabled() bool {
+	return v.enabled
+}
+
+// Pinning reports whether the manifest of new versions is pinned by its
+// SHA-256.
+func (v *Validator) Pinning() bool {
+	return v.pinning
+}
+
+// StoreBody reports whether pinned manifests are stored with their SHA-256.
+func (v *Validator) StoreBody() bool {
+	return v.storeBody
+}
+
+// Validate parses the URL, fetches the manifest and checks its content,
+// calling progress after each stage, and returns the manifest. The stage that
+// failed is reported with Failed set. Failures wrap ErrInvalidManifest, except
+// when ctx is done.
+func (v *Validator) Validate(ctx context.Context, rawURL string, progress func(Progress)) ([]byte, error) {
+	failed := func(stage Stage, err error) ([]byte, error) {
+		progress(Progress{Stage: stage, Message: err.Error(), Failed: true})
+
+		return nil, err
+	}
+
+	manifestURL, err := v.checkURL(rawURL)
+	if err != nil {
+		return failed(StageURL, err)
+	}
+	progress(Progress{Stage: StageURL, Message: "allowed " + manifestURL.Scheme + " URL on " + manifestURL.Hostname()})
+
+	body, err := v.fetch(ctx, manifestURL)
+	if err != nil {
+		return failed(StageFetch, err)
+	}
+	progress(Progress{Stage: StageFetch, Message: fmt.Sprintf("fetched %d bytes", len(body))})
+
+	if err := v.checkContent(body); err != nil {
+		return failed(StageContent, err)
+	}
+	progress(Progress{Stage: StageContent, Message: fmt.Sprintf("JSON object with %d required keys", len(v.requiredKeys))})
+
+	return body, nil
+}
+
+// Fetch returns the manifest at an allowed URL, without checking its content.
+func (v *Validator) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	manifestURL, err := v.checkURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.fetch(ctx, manifestURL)
+}
+
+// Digest returns the hex SHA-256 of a manifest.
+func Digest(body []byte) string {
+	sum := sha256.Sum256(body)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func (v *Validator) checkURL(rawURL string) (*url.URL, error) {
+	manifestURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidManifest, "manifest URL can not be parsed: %s", err)
+	}
+
+	if !manifestURL.IsAbs() || manifestURL.Host == "" {
+		return nil, errors.Wrapf(ErrInvalidManifest, "manifest URL %q is not absolute", rawURL)
+	}
+
+	if !v.schemes[strings.ToLower(manifestURL.Scheme)] {
+		return nil, errors.Wrapf(ErrInvalidManifest, "scheme %s of the manifest URL is not allowed", manifestURL.Scheme)
+	}
+
+	if !v.isHostAllowed(strings.ToLower(manifestURL.Hostname())) {
+		return nil, errors.Wrapf(ErrInvalidManifest, "host %s of the manifest URL is not allowed", manifestURL.Hostname())
+	}
+
+	return manifestURL, nil
+}
+
+func (v *Validator) isHostAllowed(host string) bool {
+	if len(v.hosts) == 0 {
+		return true
+	}
+
+	for _, allowed := range v.hosts {
+		if allowed == host {
+			return true
+		}
+
+		if strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *Validator) fetch(ctx context.Context, manifestURL *url.URL) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, manifestURL.String(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidManifest, "failed to build request: %s", err)
+	}
+
+	request.Header.Set("Accept", "application/json")
+
+	response, err := v.client.Do(request)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		return nil, errors.Wrapf(ErrInvalidManifest, "failed to fetch manifest: %s", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.Wrapf(ErrInvalidManifest, "fetching manifest returned %s", response.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidManifest, "failed to read manifest: %s", err)
+	}
+
+	if len(body) > maxManifestSize {
+		return nil, errors.Wrapf(ErrInvalidManifest, "manifest is larger than %d bytes", maxManifestSize)
+	}
+
+	return body, nil
+}
+
+func (v *Validator) checkContent(body []byte) error {
+	if !gjson.ValidBytes(body) || !gjson.ParseBytes(body).IsObject() {
+		return errors.Wrap(ErrInvalidManifest, "manifest is not a JSON object")
+	}
+
+	var missing []string
+	for _, key := range v.requiredKeys {
+		if !gjson.GetBytes(body, key).Exists() {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) > 0 {
+		return errors.Wrapf(ErrInvalidManifest, "manifest is missing %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
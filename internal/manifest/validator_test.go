@@ -0,0 +1,221 @@
+package manifest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// newTestValidator returns a Validator that allows the host of server.
+func newTestValidator(t *testing.T, server *httptest.Server, requiredKeys ...string) *Validator {
+	t.Helper()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+
+	return New(Options{
+		Schemes:      []string{"http"},
+		Hosts:        []string{serverURL.Hostname()},
+		RequiredKeys: requiredKeys,
+		Client:       server.Client(),
+	})
+}
+
+func validate(v *Validator, rawURL string) ([]byte, []Progress, error) {
+	var stages []Progress
+	body, err := v.Validate(context.Background(), rawURL, func(progress Progress) {
+		stages = append(stages, progress)
+	})
+
+	return body, stages, err
+}
+
+func TestValidate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"name": "button", "entry": {"js": "index.js"}}`))
+	}))
+	defer server.Close()
+
+	body, stages, err := validate(newTestValidator(t, server, "name", "entry.js"), server.URL+"/manifest.json")
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	if !strings.Contains(string(body), "button") {
+		t.Errorf("body = %s", body)
+	}
+
+	want := []Stage{StageURL, StageFetch, StageContent}
+	if len(stages) != len(want) {
+		t.Fatalf("stages = %v, want %v", stages, want)
+	}
+
+	for i, stage := range want {
+		if stages[i].Stage != stage || stages[i].Failed {
+			t.Errorf("stage %d = %+v, want %s", i, stages[i], stage)
+		}
+	}
+}
+
+func TestValidateReportsTheFailedStage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/array":
+			_, _ = w.Write([]byte(`[]`))
+		default:
+			_, _ = w.Write([]byte(`{"name": "button"}`))
+		}
+	}))
+	defer server.Close()
+
+	v := newTestValidator(t, server, "name", "entry.js")
+
+	tests := []struct {
+		url    string
+		passed int
+		failed Stage
+	}{
+		{"ftp://example.com/manifest.json", 0, StageURL},
+		{"/manifest.json", 0, StageURL},
+		{"http://cdn.example.com/manifest.json", 0, StageURL},
+		{server.URL + "/missing", 1, StageFetch},
+		{server.URL + "/array", 2, StageContent},
+		{server.URL + "/manifest.json", 2, StageContent},
+	}
+
+	for _, test := range tests {
+		_, stages, err := validate(v, test.url)
+		if !errors.Is(err, ErrInvalidManifest) {
+			t.Errorf("Validate(%s) = %v, want ErrInvalidManifest", test.url, err)
+		}
+
+		if len(stages) != test.passed+1 {
+			t.Errorf("Validate(%s) stages = %+v", test.url, stages)
+			continue
+		}
+
+		last := stages[test.passed]
+		if last.Stage != test.failed || !last.Failed || last.Message != err.Error() {
+			t.Errorf("Validate(%s) reported %+v, want %s failed with %v", test.url, last, test.failed, err)
+		}
+	}
+}
+
+func TestFetchChecksRedirects(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the redirect to a host that is not allowed was followed")
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(other.URL, "127.0.0.1", "localhost", 1)+"/manifest.json", http.StatusFound)
+	}))
+	defer server.Close()
+
+	_, err := newTestValidator(t, server).Fetch(context.Background(), server.URL+"/manifest.json")
+	if !errors.Is(err, ErrInvalidManifest) || !strings.Contains(err.Error(), "host localhost") {
+		t.Errorf("Fetch = %v, want the host of the redirect not allowed", err)
+	}
+}
+
+func TestFetchFollowsAllowedRedirects(t *testing.T) {
+	var hops int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/manifest.json" {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+
+		hops++
+		http.Redirect(w, r, "/manifest.json", http.StatusMovedPermanently)
+	}))
+	defer server.Close()
+
+	body, err := newTestValidator(t, server).Fetch(context.Background(), server.URL+"/latest")
+	if err != nil || string(body) != "{}" || hops != 1 {
+		t.Errorf("Fetch = %s, %v after %d redirects", body, err, hops)
+	}
+}
+
+func TestFetchStopsAfterMaxRedirects(t *testing.T) {
+	var hops int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hops++
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	}))
+	defer server.Close()
+
+	_, err := newTestValidator(t, server).Fetch(context.Background(), server.URL+"/loop")
+	if !errors.Is(err, ErrInvalidManifest) {
+		t.Errorf("Fetch = %v, want ErrInvalidManifest", err)
+	}
+
+	if hops != maxRedirects {
+		t.Errorf("the server got %d requests, want %d", hops, maxRedirects)
+	}
+}
+
+func TestNewKeepsTheRedirectPolicyOfTheClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/manifest.json" {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+
+		http.Redirect(w, r, "/manifest.json", http.StatusFound)
+	}))
+	defer server.Close()
+
+	client := server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	serverURL, _ := url.Parse(server.URL)
+	v := New(Options{Schemes: []string{"http"}, Hosts: []string{serverURL.Hostname()}, Client: client})
+
+	if _, err := v.Fetch(context.Background(), server.URL+"/latest"); !errors.Is(err, ErrInvalidManifest) {
+		t.Errorf("Fetch = %v, want the redirect response", err)
+	}
+
+	if v.client == client {
+		t.Error("New changed the client it was given")
+	}
+}
+
+func TestIsHostAllowed(t *testing.T) {
+	v := New(Options{Hosts: []string{"cdn.example.com", "*.assets.example.com"}})
+
+	for host, want := range map[string]bool{
+		"cdn.example.com":        true,
+		"a.assets.example.com":   true,
+		"a.b.assets.example.com": true,
+		"assets.example.com":     false,
+		"example.com":            false,
+		"cdn.example.com.evil":   false,
+	} {
+		if got := v.isHostAllowed(host); got != want {
+			t.Errorf("isHostAllowed(%q) = %v, want %v", host, got, want)
+		}
+	}
+
+	if !New(Options{}).isHostAllowed("anything.example.org") {
+		t.Error("a Validator without hosts does not allow every host")
+	}
+}
+
+func TestDigest(t *testing.T) {
+	// SHA-256 of "{}".
+	if got := Digest([]byte(`{}`)); got != "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a" {
+		t.Errorf("Digest = %s", got)
+	}
+}
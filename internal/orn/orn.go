@@ -0,0 +1,208 @@
+// Package orn parses and formats Object Resource Names, the resource paths
+// used by the Polvo API to address packages and versions:
+//
+//	packages/{package}
+//	packages/{package}/versions/{version}
+//	packages/{package}/channels/{channel}
+package orn
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	packagesCollection = "packages"
+	versionsCollection = "versions"
+	channelsCollection = "channels"
+
+	maxNameLength = 214
+)
+
+var (
+	packageNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	versionNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+	// versionSelectorPattern also allows the version range syntax, e.g. ^1.4,
+	// ~2.0.1 or ">=1.2 <2", which can be used wherever a version is read.
+	versionSelectorPattern = regexp.MustCompile(`^[A-Za-z0-9.^~<>=*|+ _-]+$`)
+)
+
+type PackageORN struct {
+	Package string
+}
+
+type VersionORN struct {
+	Package string
+	Version string
+}
+
+type ChannelORN struct {
+	Package string
+	Channel string
+}
+
+func NewPackageORN(packageName string) (PackageORN, error) {
+	if err := ValidatePackageName(packageName); err != nil {
+		return PackageORN{}, err
+	}
+
+	return PackageORN{Package: packageName}, nil
+}
+
+func NewVersionORN(packageName, versionName string) (VersionORN, error) {
+	if err := ValidatePackageName(packageName); err != nil {
+		return VersionORN{}, err
+	}
+
+	if err := ValidateVersionName(versionName); err != nil {
+		return VersionORN{}, err
+	}
+
+	return VersionORN{Package: packageName, Version: versionName}, nil
+}
+
+// ParsePackage parses an ORN of the form packages/{package}.
+func ParsePackage(orn string) (PackageORN, error) {
+	segments, err := split(orn, 2)
+	if err != nil {
+		return PackageORN{}, err
+	}
+
+	if segments[0] != packagesCollection {
+		return PackageORN{}, errors.Errorf("invalid orn %q: expected %q collection, got %q", orn, packagesCollection, segments[0])
+	}
+
+	if err := ValidatePackageName(segments[1]); err != nil {
+		return PackageORN{}, errors.Wrapf(err, "invalid orn %q", orn)
+	}
+
+	return PackageORN{Package: segments[1]}, nil
+}
+
+// ParseChannel parses an ORN of the form packages/{package}/channels/{channel}.
+func ParseChannel(orn string) (ChannelORN, error) {
+	segments, err := split(orn, 4)
+	if err != nil {
+		return ChannelORN{}, err
+	}
+
+	if segments[0] != packagesCollection {
+		return ChannelORN{}, errors.Errorf("invalid orn %q: expected %q collection, got %q", orn, packagesCollection, segments[0])
+	}
+
+	if segments[2] != channelsCollection {
+		return ChannelORN{}, errors.Errorf("invalid orn %q: expected %q collection, got %q", orn, channelsCollection, segments[2])
+	}
+
+	if err := ValidatePackageName(segments[1]); err != nil {
+		return ChannelORN{}, errors.Wrapf(err, "invalid orn %q", orn)
+	}
+
+	if err := ValidateChannelName(segments[3]); err != nil {
+		return ChannelORN{}, errors.Wrapf(err, "invalid orn %q", orn)
+	}
+
+	return ChannelORN{Package: segments[1], Channel: segments[3]}, nil
+}
+
+// ParseVersion parses an ORN of the form packages/{package}/versions/{version}.
+// The version segment may be a version selector, see ValidateVersionSelector.
+func ParseVersion(orn string) (VersionORN, error) {
+	segments, err := split(orn, 4)
+	if err != nil {
+		return VersionORN{}, err
+	}
+
+	if segments[0] != packagesCollection {
+		return VersionORN{}, errors.Errorf("invalid orn %q: expected %q collection, got %q", orn, packagesCollection, segments[0])
+	}
+
+	if segments[2] != versionsCollection {
+		return VersionORN{}, errors.Errorf("invalid orn %q: expected %q collection, got %q", orn, versionsCollection, segments[2])
+	}
+
+	if err := ValidatePackageName(segments[1]); err != nil {
+		return VersionORN{}, errors.Wrapf(err, "invalid orn %q", orn)
+	}
+
+	if err := ValidateVersionSelector(segments[3]); err != nil {
+		return VersionORN{}, errors.Wrapf(err, "invalid orn %q", orn)
+	}
+
+	return VersionORN{Package: segments[1], Version: segments[3]}, nil
+}
+
+func (o PackageORN) String() string {
+	return packagesCollection + "/" + o.Package
+}
+
+func (o VersionORN) String() string {
+	return o.PackageORN().String() + "/" + versionsCollection + "/" + o.Version
+}
+
+func (o VersionORN) PackageORN() PackageORN {
+	return PackageORN{Package: o.Package}
+}
+
+func (o ChannelORN) String() string {
+	return o.PackageORN().String() + "/" + channelsCollection + "/" + o.Channel
+}
+
+func (o ChannelORN) PackageORN() PackageORN {
+	return PackageORN{Package: o.Package}
+}
+
+func ValidatePackageName(name string) error {
+	return validateName("package", name, packageNamePattern)
+}
+
+func ValidateVersionName(name string) error {
+	return validateName("version", name, versionNamePattern)
+}
+
+// ValidateChannelName validates a channel name. Channel names follow the
+// package name rules.
+func ValidateChannelName(name string) error {
+	return validateName("channel", name, packageNamePattern)
+}
+
+// ValidateVersionSelector validates a version name or a version range used to
+// look a version up.
+func ValidateVersionSelector(selector string) error {
+	if strings.TrimSpace(selector) != selector {
+		return errors.Errorf("version selector %q must not start or end with a space", selector)
+	}
+
+	return validateName("version selector", selector, versionSelectorPattern)
+}
+
+func validateName(kind, name string, pattern *regexp.Regexp) error {
+	if name == "" {
+		return errors.Errorf("%s name must not be empty", kind)
+	}
+
+	if len(name) > maxNameLength {
+		return errors.Errorf("%s name must be at most %d characters", kind, maxNameLength)
+	}
+
+	if !pattern.MatchString(name) {
+		return errors.Errorf("%s name %q contains invalid characters, it must match %s", kind, name, pattern.String())
+	}
+
+	return nil
+}
+
+func split(orn string, segmentCount int) ([]string, error) {
+	if orn == "" {
+		return nil, errors.New("orn must not be empty")
+	}
+
+	segments := strings.Split(orn, "/")
+	if len(segments) != segmentCount {
+		return nil, errors.Errorf("invalid orn %q: expected %d segments, got %d", orn, segmentCount, len(segments))
+	}
+
+	return segments, nil
+}
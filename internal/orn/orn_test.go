@@ -0,0 +1,189 @@
+package orn
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePackage(t *testing.T) {
+	tests := []struct {
+		orn     string
+		want    string
+		wantErr bool
+	}{
+		{orn: "packages/button", want: "button"},
+		{orn: "packages/ui.button_v2-beta", want: "ui.button_v2-beta"},
+		{orn: "packages/9lives", want: "9lives"},
+		{orn: "", wantErr: true},
+		{orn: "packages", wantErr: true},
+		{orn: "packages/", wantErr: true},
+		{orn: "/button", wantErr: true},
+		{orn: "package/button", wantErr: true},
+		{orn: "packages/button/", wantErr: true},
+		{orn: "packages/button/versions/1.0.0", wantErr: true},
+		{orn: "packages//button", wantErr: true},
+		{orn: "packages/-button", wantErr: true},
+		{orn: "packages/.button", wantErr: true},
+		{orn: "packages/but ton", wantErr: true},
+		{orn: "packages/button+1", wantErr: true},
+		{orn: `packages/button"`, wantErr: true},
+		{orn: "packages/" + strings.Repeat("a", maxNameLength+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePackage(tt.orn)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePackage(%q) error = %v, wantErr %v", tt.orn, err, tt.wantErr)
+			continue
+		}
+
+		if err == nil && (got.Package != tt.want || got.String() != tt.orn) {
+			t.Errorf("ParsePackage(%q) = %+v (%s), want %q", tt.orn, got, got, tt.want)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		orn         string
+		wantPackage string
+		wantVersion string
+		wantErr     bool
+	}{
+		{orn: "packages/button/versions/1.0.0", wantPackage: "button", wantVersion: "1.0.0"},
+		{orn: "packages/button/versions/1.0.0-beta.1+build.5", wantPackage: "button", wantVersion: "1.0.0-beta.1+build.5"},
+		{orn: "packages/button/versions/latest", wantPackage: "button", wantVersion: "latest"},
+		{orn: "", wantErr: true},
+		{orn: "packages/button", wantErr: true},
+		{orn: "packages/button/versions", wantErr: true},
+		{orn: "packages/button/versions/", wantErr: true},
+		{orn: "packages//versions/1.0.0", wantErr: true},
+		{orn: "packages/button/version/1.0.0", wantErr: true},
+		{orn: "apps/button/versions/1.0.0", wantErr: true},
+		{orn: "packages/button/versions/1.0.0/", wantErr: true},
+		{orn: "packages/button/versions/1.0.0/manifest", wantErr: true},
+		{orn: "packages/button/versions/^1.4", wantPackage: "button", wantVersion: "^1.4"},
+		{orn: "packages/button/versions/>=1.2 <2 || 3.x", wantPackage: "button", wantVersion: ">=1.2 <2 || 3.x"},
+		{orn: "packages/button/versions/1.0.0;", wantErr: true},
+		{orn: "packages/button/versions/1.0.0 ", wantErr: true},
+		{orn: "packages/but+ton/versions/1.0.0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.orn)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseVersion(%q) error = %v, wantErr %v", tt.orn, err, tt.wantErr)
+			continue
+		}
+
+		if err == nil && (got.Package != tt.wantPackage || got.Version != tt.wantVersion || got.String() != tt.orn) {
+			t.Errorf("ParseVersion(%q) = %+v (%s)", tt.orn, got, got)
+		}
+	}
+}
+
+func TestParseChannel(t *testing.T) {
+	tests := []struct {
+		orn         string
+		wantPackage string
+		wantChannel string
+		wantErr     bool
+	}{
+		{orn: "packages/button/channels/stable", wantPackage: "button", wantChannel: "stable"},
+		{orn: "packages/button/channels/beta-2", wantPackage: "button", wantChannel: "beta-2"},
+		{orn: "packages/button/channels", wantErr: true},
+		{orn: "packages/button/channels/", wantErr: true},
+		{orn: "packages/button/versions/stable", wantErr: true},
+		{orn: "packages/button/channels/stable/1", wantErr: true},
+		{orn: "packages/button/channels/^1", wantErr: true},
+		{orn: "packages/button/channels/+beta", wantErr: true},
+		{orn: "packages/-button/channels/stable", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseChannel(tt.orn)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseChannel(%q) error = %v, wantErr %v", tt.orn, err, tt.wantErr)
+			continue
+		}
+
+		if err == nil && (got.Package != tt.wantPackage || got.Channel != tt.wantChannel || got.String() != tt.orn || got.PackageORN().Package != tt.wantPackage) {
+			t.Errorf("ParseChannel(%q) = %+v (%s)", tt.orn, got, got)
+		}
+	}
+}
+
+func TestValidatePackageName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "button"},
+		{name: "Button.Group_2-x"},
+		{name: strings.Repeat("a", maxNameLength)},
+		{name: "", wantErr: true},
+		{name: "_button", wantErr: true},
+		{name: "button/group", wantErr: true},
+		{name: "button@1", wantErr: true},
+		{name: "button\n", wantErr: true},
+		{name: "bütton", wantErr: true},
+		{name: strings.Repeat("a", maxNameLength+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidatePackageName(tt.name); (err != nil) != tt.wantErr {
+			t.Errorf("ValidatePackageName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNewVersionORN(t *testing.T) {
+	o, err := NewVersionORN("button", "1.0.0")
+	if err != nil {
+		t.Fatalf("NewVersionORN: %v", err)
+	}
+
+	if o.String() != "packages/button/versions/1.0.0" || o.PackageORN().String() != "packages/button" {
+		t.Errorf("NewVersionORN = %s in %s", o, o.PackageORN())
+	}
+
+	if _, err := NewVersionORN("button", "1.0.0/x"); err == nil {
+		t.Error("NewVersionORN accepted a version name with a slash")
+	}
+
+	if _, err := NewPackageORN(""); err == nil {
+		t.Error("NewPackageORN accepted an empty name")
+	}
+}
+
+func TestValidateVersionSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		wantErr  bool
+	}{
+		{selector: "1.0.0"},
+		{selector: "latest"},
+		{selector: "any"},
+		{selector: "^1.4"},
+		{selector: "~2.0.1"},
+		{selector: ">=1.2 <2"},
+		{selector: "1.2.3 - 1.4"},
+		{selector: "^1 || ^2"},
+		{selector: "1.x"},
+		{selector: "*"},
+		{selector: "", wantErr: true},
+		{selector: " ^1", wantErr: true},
+		{selector: "^1 ", wantErr: true},
+		{selector: "1.0.0/1", wantErr: true},
+		{selector: `1.0.0"`, wantErr: true},
+		{selector: "1.0.0\n", wantErr: true},
+		{selector: "$1", wantErr: true},
+		{selector: strings.Repeat("1", maxNameLength+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateVersionSelector(tt.selector); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateVersionSelector(%q) error = %v, wantErr %v", tt.selector, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// auditTimeFormat is RFC 3339 with a fixed number of fractional digits, so
+// that formatted times sort like the times themselves.
+const auditTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// AuditEvent records one mutation of the registry. Events are only ever
+// appended.
+type AuditEvent struct {
+	// ID is set when the event is recorded.
+	ID string
+	// Actor is the subject of the caller.
+	Actor string
+	// Method is the name of the RPC, e.g. "UpdateVersion".
+	Method string
+	// Orn is the resource the RPC changed.
+	Orn       string
+	Package   string
+	Before    map[string]interface{}
+	After     map[string]interface{}
+	Time      time.Time
+	RequestID string
+}
+
+// Audit is the audit event of a change given to WithAudit. The repository
+// records it in the transaction of the change, so that the event is stored
+// if and only if the change is.
+type Audit struct {
+	Event *AuditEvent
+	// Complete, when set, completes Event with the resource the change
+	// saved, as returned by the method making it, or nil for deletions.
+	Complete func(event *AuditEvent, saved interface{})
+}
+
+type auditKey struct{}
+
+// WithAudit returns a context whose change is recorded with audit. Only the
+// method making the change should get it, since every change made with the
+// context records the event.
+func WithAudit(ctx context.Context, audit *Audit) context.Context {
+	return context.WithValue(ctx, auditKey{}, audit)
+}
+
+// auditEventOf returns the event of the audit of ctx completed with saved,
+// nil when ctx has none.
+func auditEventOf(ctx context.Context, saved interface{}) *AuditEvent {
+	audit, _ := ctx.Value(auditKey{}).(*Audit)
+	if audit == nil || audit.Event == nil {
+		return nil
+	}
+
+	event := *audit.Event
+	if audit.Complete != nil {
+		audit.Complete(&event, saved)
+	}
+
+	event.ID = newID()
+	audit.Event.ID = event.ID
+
+	return &event
+}
+
+type ListAuditEventsOptions struct {
+	// PageSize is the maximum number of events returned, all of them are
+	// returned when it is 0.
+	PageSize  uint
+	PageToken string
+	Package   string
+	Actor     string
+	// Since and Until bound the time of the events, Until is exclusive.
+	// Either one is ignored when it is nil.
+	Since *time.Time
+	Until *time.Time
+}
+
+// AuditEventPage holds audit events, newest first.
+type AuditEventPage struct {
+	Events []*AuditEvent
+	// NextPageToken is empty on the last page.
+	NextPageToken string
+}
+
+// newID returns a random id for records that have no natural name.
+func newID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+func auditCursor(event *AuditEvent) pageCursor {
+	return pageCursor{Key: event.Time.UTC().Format(auditTimeFormat), Name: event.ID}
+}
+
+func (o ListAuditEventsOptions) matches(event *AuditEvent) bool {
+	if o.Package != "" && event.Package != o.Package {
+		return false
+	}
+
+	if o.Actor != "" && event.Actor != o.Actor {
+		return false
+	}
+
+	if o.Since != nil && event.Time.Before(*o.Since) {
+		return false
+	}
+
+	return o.Until == nil || event.Time.Before(*o.Until)
+}
@@ -2,9 +2,9 @@ package repository
 
 import (
 	"context"
-	"fmt"
+	"encoding/json"
+	"math/rand"
 	"os"
-	"strconv"
 	"time"
 
 	"github.com/dgraph-io/dgo/v210"
@@ -36,7 +36,7 @@ func (r *DgraphRepository) getDgraphClient () (*dgo.Dgraph, error) {
 	if r.dgraphClient == nil {
 		d, err := grpc.Dial(os.Getenv("DGRAPH_ADDRESS"), grpc.WithInsecure())
 		if err != nil {
-			return nil, err
+			return nil, errors.Wrapf(ErrUnavailable, "failed to dial dgraph: %s", err)
 		}
 
 		r.dgraphClient = dgo.NewDgraphClient(
@@ -47,12 +47,116 @@ func (r *DgraphRepository) getDgraphClient () (*dgo.Dgraph, error) {
 	return r.dgraphClient, nil
 }
 
+// Bounds of retryAborted.
+const (
+	maxTxnAttempts   = 8
+	txnRetryDelay    = 10 * time.Millisecond
+	maxTxnRetryDelay = 500 * time.Millisecond
+)
+
+// errAborted is the ErrConflict of a transaction aborted by a concurrent one.
+var errAborted = errors.WithMessage(ErrConflict, "transaction aborted")
+
+// dgraphError converts errors from the Dgraph client into the repository
+// errors so that callers do not depend on dgo.
+func dgraphError(err error, message string) error {
+	if errors.Is(err, dgo.ErrAborted) {
+		return errors.Wrap(errAborted, message)
+	}
+
+	if status.Code(err) == codes.Unavailable {
+		return errors.Wrapf(ErrUnavailable, "%s: %s", message, err)
+	}
+
+	return errors.Wrap(err, message)
+}
+
+// retryAborted runs change again when its transaction was aborted by a
+// concurrent one. Every change writing events updates the outbox counter, so
+// concurrent changes abort each other even when they touch different packages.
+// The delay between attempts doubles from txnRetryDelay, with jitter so that
+// the aborted changes do not meet again. After maxTxnAttempts the ErrConflict
+// of the last attempt is returned.
+func retryAborted(ctx context.Context, change func() error) error {
+	delay := txnRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		err := change()
+		if !errors.Is(err, errAborted) || attempt == maxTxnAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(delay/2 + time.Duration(rand.Int63n(int64(delay))))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		if delay *= 2; delay > maxTxnRetryDelay {
+			delay = maxTxnRetryDelay
+		}
+	}
+}
+
+// mutations returns the mutations of a request without the nil ones, such as
+// the audit mutation of a change made without WithAudit.
+func mutations(all ...*api.Mutation) []*api.Mutation {
+	var kept []*api.Mutation
+	for _, mutation := range all {
+		if mutation != nil {
+			kept = append(kept, mutation)
+		}
+	}
+
+	return kept
+}
+
+func parsePackageDetails(value gjson.Result) *PackageDetails {
+	return &PackageDetails{
+		Package: &polvo_v1.Package{
+			Name:       value.Get("name").String(),
+			Maintainer: value.Get("maintainer").String(),
+		},
+		Metadata:  parsePackageMetadata(value),
+		CreatedAt: value.Get("created_at").Time(),
+		UpdatedAt: value.Get("updated_at").Time(),
+	}
+}
+
+func parseVersionDetails(value gjson.Result) *VersionDetails {
+	return &VersionDetails{
+		Version: &polvo_v1.Version{
+			Name:        value.Get("name").String(),
+			ManifestUrl: value.Get("manifest_url").String(),
+			Weight:      uint32(value.Get("weight").Uint()),
+		},
+		CreatedAt:      value.Get("created_at").Time(),
+		UpdatedAt:      value.Get("updated_at").Time(),
+		ManifestSHA256: value.Get("manifest_sha256").String(),
+		Labels:         parseVersionLabels(value),
+	}
+}
+
 func (r *DgraphRepository) GetPackage(ctx context.Context, name string) (*polvo_v1.Package, error) {
+	details, err := r.GetPackageDetails(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return details.Package, nil
+}
 
-	query := `{
-		  items(func: eq(dgraph.type, "Package")) @filter(eq(name, "` + name + `")){
+func (r *DgraphRepository) GetPackageDetails(ctx context.Context, name string) (*PackageDetails, error) {
+
+	query := `query q($name: string) {
+		  items(func: eq(dgraph.type, "Package")) @filter(eq(name, $name) AND NOT has(deleted_at)){
 			uid
 			name
+			maintainer` + packageMetadataFields + `
+			created_at
+			updated_at
 		  }
 		}`
 
@@ -64,34 +168,46 @@ func (r *DgraphRepository) GetPackage(ctx context.Context, name string) (*polvo_
 	txn := dgraphClient.NewReadOnlyTxn()
 
 	request := &api.Request{
-		Query:      query,
+		Query: query,
+		Vars: map[string]string{
+			"$name": name,
+		},
 	}
 
 	requestResult, err := txn.Do(ctx, request)
 	if err != nil {
-		return nil, err
+		return nil, dgraphError(err, "failed to query data")
 	}
 
 	items := gjson.GetBytes(requestResult.Json, "items.0")
 	if !items.Exists() {
-		return nil, errors.New("package " + name + " not found")
+		return nil, errors.Wrapf(ErrPackageNotFound, "package %s", name)
 	}
 
-	pkg := &polvo_v1.Package{
-		Name:       items.Get("name").String(),
+	return parsePackageDetails(items), nil
+}
+
+func (r *DgraphRepository) GetVersion(ctx context.Context, packageName, versionName string) (*polvo_v1.Version, error) {
+	details, err := r.GetVersionDetails(ctx, packageName, versionName)
+	if err != nil {
+		return nil, err
 	}
 
-	return pkg, nil
+	return details.Version, nil
 }
 
-func (r *DgraphRepository) GetVersion(ctx context.Context, packageName, versionName string) (*polvo_v1.Version, error) {
+func (r *DgraphRepository) GetVersionDetails(ctx context.Context, packageName, versionName string) (*VersionDetails, error) {
 
-	query := `{
-		  package(func: eq(name, "` + packageName + `")) @filter(eq(dgraph.type, "Package")){
-			versions @filter(eq(name, "` + versionName + `")) @facets(weight: weight) {
+	query := `query q($packageName: string, $versionName: string) {
+		  package(func: eq(name, $packageName)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)){
+			uid
+			versions @filter(eq(name, $versionName) AND NOT has(deleted_at)) @facets(weight: weight) {
 				uid
 				name
 				manifest_url
+				manifest_sha256` + versionLabelFields + `
+				created_at
+				updated_at
 			}
 		  }
 		}`
@@ -104,33 +220,36 @@ func (r *DgraphRepository) GetVersion(ctx context.Context, packageName, versionN
 	txn := dgraphClient.NewReadOnlyTxn()
 
 	request := &api.Request{
-		Query:      query,
+		Query: query,
+		Vars: map[string]string{
+			"$packageName": packageName,
+			"$versionName": versionName,
+		},
 	}
 
 	requestResult, err := txn.Do(ctx, request)
 	if err != nil {
-		return nil, err
+		return nil, dgraphError(err, "failed to query data")
 	}
-	fmt.Println(string(requestResult.Json))
-	items := gjson.GetBytes(requestResult.Json, "package.0.versions.0")
-	if !items.Exists() {
-		return nil, errors.New("version not found")
+
+	if !gjson.GetBytes(requestResult.Json, "package.0").Exists() {
+		return nil, errors.Wrapf(ErrPackageNotFound, "package %s", packageName)
 	}
 
-	pkg := &polvo_v1.Version{
-		Name:        items.Get("name").String(),
-		ManifestUrl: items.Get("manifest_url").String(),
-		Weight: uint32(items.Get("weight").Uint()),
+	items := gjson.GetBytes(requestResult.Json, "package.0.versions.0")
+	if !items.Exists() {
+		return nil, errors.Wrapf(ErrVersionNotFound, "version %s of package %s", versionName, packageName)
 	}
 
-	return pkg, nil
+	return parseVersionDetails(items), nil
 }
 
 func (r *DgraphRepository) GetHeaviestVersion(ctx context.Context, packageName string) (*polvo_v1.Version, error) {
 
-	query := `{
-		  package(func: eq(name, "` + packageName + `")) @filter(eq(dgraph.type, "Package")){
-			versions @facets(orderdesc: weight) (first: 1) {
+	query := `query q($packageName: string) {
+		  package(func: eq(name, $packageName)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)){
+			uid
+			versions @filter(NOT has(deleted_at)) @facets(orderdesc: weight) (first: 1) {
 				uid
 				name
 				manifest_url
@@ -146,17 +265,24 @@ func (r *DgraphRepository) GetHeaviestVersion(ctx context.Context, packageName s
 	txn := dgraphClient.NewReadOnlyTxn()
 
 	request := &api.Request{
-		Query:      query,
+		Query: query,
+		Vars: map[string]string{
+			"$packageName": packageName,
+		},
 	}
 
 	requestResult, err := txn.Do(ctx, request)
 	if err != nil {
-		return nil, err
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	if !gjson.GetBytes(requestResult.Json, "package.0").Exists() {
+		return nil, errors.Wrapf(ErrPackageNotFound, "package %s", packageName)
 	}
 
 	items := gjson.GetBytes(requestResult.Json, "package.0.versions.0")
 	if !items.Exists() {
-		return nil, errors.New("version not found")
+		return nil, errors.Wrapf(ErrVersionNotFound, "package %s has no version", packageName)
 	}
 
 	pkg := &polvo_v1.Version{
@@ -167,98 +293,354 @@ func (r *DgraphRepository) GetHeaviestVersion(ctx context.Context, packageName s
 	return pkg, nil
 }
 
-func (r *DgraphRepository) CreatePackage(ctx context.Context, pkg *polvo_v1.Package) (*polvo_v1.Package, error) {
+func (r *DgraphRepository) CreatePackage(ctx context.Context, pkg *polvo_v1.Package, metadata *PackageMetadata) (*polvo_v1.Package, error) {
+	var saved *polvo_v1.Package
+	err := retryAborted(ctx, func() (err error) {
+		saved, err = r.createPackage(ctx, pkg, metadata)
+		return err
+	})
+
+	return saved, err
+}
+
+// createPackage is one attempt of CreatePackage.
+func (r *DgraphRepository) createPackage(ctx context.Context, pkg *polvo_v1.Package, metadata *PackageMetadata) (*polvo_v1.Package, error) {
 	dgraphClient, err := r.getDgraphClient()
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to get db client", err)
+		return nil, err
 	}
 
 	txn := dgraphClient.NewTxn()
 	defer txn.Discard(ctx)
 
-	setStatment := `
-_:package <dgraph.type> "Package" .
-_:package <name> "` + pkg.GetName() + `" .
-_:package <maintainer> "` + pkg.GetMaintainer() + `" .
-_:package <created_at> "` + time.Now().Format(time.RFC3339) + `" .`
+	now := time.Now()
+	node := map[string]interface{}{
+		"uid":         "_:package",
+		"dgraph.type": "Package",
+		"name":        pkg.GetName(),
+		"maintainer":  pkg.GetMaintainer(),
+		"created_at":  now.Format(time.RFC3339),
+		"updated_at":  now.Format(time.RFC3339),
+	}
+
+	if metadata != nil {
+		setPackageMetadata(node, *metadata)
+	}
+
+	setJson, err := json.Marshal(node)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode mutation")
+	}
+
+	cond := "@if(eq(len(pkg), 0))"
+	outbox, err := r.outboxMutation(ctx, txn, cond, newPackageEvent(ctx, EventPackageCreated, pkg, now))
+	if err != nil {
+		return nil, err
+	}
+
+	audit, err := auditMutation(ctx, cond, pkg)
+	if err != nil {
+		return nil, err
+	}
 
 	request := &api.Request{
-		Query:      `query {pkg as var(func: eq(name, "` + pkg.GetName() + `")) @filter(eq(dgraph.type, "Package"))}`,
-		Mutations:  []*api.Mutation{
-			{
-				SetNquads: []byte(setStatment),
-				Cond:       "@if(eq(len(pkg), 0))",
-			},
+		Query: `query q($name: string) {pkg as var(func: eq(name, $name)) @filter(eq(dgraph.type, "Package"))}`,
+		Vars: map[string]string{
+			"$name": pkg.GetName(),
 		},
+		Mutations: mutations(
+			&api.Mutation{
+				SetJson: setJson,
+				Cond:    cond,
+			},
+			outbox,
+			audit,
+		),
 	}
 
 	mutateResult, err := txn.Do(ctx, request)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to mutate data", err)
+		return nil, dgraphError(err, "failed to mutate data")
 	}
 
 	if err := txn.Commit(ctx); err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to commit data", err)
+		return nil, dgraphError(err, "failed to commit data")
 	}
 
 	if len(mutateResult.Uids) == 0 {
-		return nil, status.Errorf(codes.Aborted, "application was not created, maybe it was exists")
+		return nil, errors.Wrapf(ErrAlreadyExists, "package %s", pkg.GetName())
 	}
 
 	return pkg, nil
 }
 
+// UpdatePackage reads the package inside the transaction so that a concurrent
+// rename of either name aborts the commit, and the update is tried again.
+func (r *DgraphRepository) UpdatePackage(ctx context.Context, name string, updatedFields map[string]interface{}) (*polvo_v1.Package, error) {
+	var saved *polvo_v1.Package
+	err := retryAborted(ctx, func() (err error) {
+		saved, err = r.updatePackage(ctx, name, updatedFields)
+		return err
+	})
+
+	return saved, err
+}
+
+// updatePackage is one attempt of UpdatePackage.
+func (r *DgraphRepository) updatePackage(ctx context.Context, name string, updatedFields map[string]interface{}) (*polvo_v1.Package, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewTxn()
+	defer txn.Discard(ctx)
+
+	newName := name
+	if value, ok := updatedFields["Name"]; ok {
+		newName = value.(string)
+	}
+
+	request := &api.Request{
+		Query: `query q($name: string, $newName: string) {
+					package(func: eq(name, $name)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)) {
+						uid
+						maintainer
+					}
+					existing(func: eq(name, $newName)) @filter(eq(dgraph.type, "Package")) {
+						uid
+					}
+				}`,
+		Vars: map[string]string{
+			"$name":    name,
+			"$newName": newName,
+		},
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	packageUid := gjson.GetBytes(requestResult.Json, "package.0.uid")
+	if !packageUid.Exists() {
+		return nil, errors.Wrapf(ErrPackageNotFound, "package %s", name)
+	}
+
+	if newName != name && gjson.GetBytes(requestResult.Json, "existing.0").Exists() {
+		return nil, errors.Wrapf(ErrAlreadyExists, "package %s", newName)
+	}
+
+	now := time.Now()
+	packageUpdate := map[string]interface{}{
+		"uid":        packageUid.String(),
+		"name":       newName,
+		"updated_at": now.Format(time.RFC3339),
+	}
+
+	updatedPackage := &polvo_v1.Package{
+		Name:       newName,
+		Maintainer: gjson.GetBytes(requestResult.Json, "package.0.maintainer").String(),
+	}
+
+	if maintainer, ok := updatedFields["Maintainer"]; ok {
+		packageUpdate["maintainer"] = maintainer.(string)
+		updatedPackage.Maintainer = maintainer.(string)
+	}
+
+	if lists := packageMetadataUpdate(packageUpdate, updatedFields); len(lists) > 0 {
+		deletion := map[string]interface{}{"uid": packageUid.String()}
+		for _, predicate := range lists {
+			deletion[predicate] = nil
+		}
+
+		deleteJson, err := json.Marshal(deletion)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encode mutation")
+		}
+
+		if _, err := txn.Mutate(ctx, &api.Mutation{DeleteJson: deleteJson}); err != nil {
+			return nil, dgraphError(err, "failed to mutate data")
+		}
+	}
+
+	setJson, err := json.Marshal(packageUpdate)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode mutation")
+	}
+
+	if _, err := txn.Mutate(ctx, &api.Mutation{SetJson: setJson}); err != nil {
+		return nil, dgraphError(err, "failed to mutate data")
+	}
+
+	if err := r.writeEvents(ctx, txn, newPackageEvent(ctx, EventPackageUpdated, updatedPackage, now)); err != nil {
+		return nil, err
+	}
+
+	if err := r.writeAudit(ctx, txn, updatedPackage); err != nil {
+		return nil, err
+	}
+
+	if err := txn.Commit(ctx); err != nil {
+		return nil, dgraphError(err, "failed to commit data")
+	}
+
+	return r.GetPackage(ctx, newName)
+}
+
+// UpdateVersion renames the version only when its package has no other version,
+// live or deleted, with the new name, like CreateVersion.
 func (r *DgraphRepository) UpdateVersion(ctx context.Context, packageName, versionName string, updatedFields map[string]interface{}) (*polvo_v1.Version, error) {
+	var saved *polvo_v1.Version
+	err := retryAborted(ctx, func() (err error) {
+		saved, err = r.updateVersion(ctx, packageName, versionName, updatedFields)
+		return err
+	})
+
+	return saved, err
+}
+
+// updateVersion is one attempt of UpdateVersion.
+func (r *DgraphRepository) updateVersion(ctx context.Context, packageName, versionName string, updatedFields map[string]interface{}) (*polvo_v1.Version, error) {
 	dgraphClient, err := r.getDgraphClient()
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to get db client", err)
+		return nil, err
 	}
 
 	txn := dgraphClient.NewTxn()
 	defer txn.Discard(ctx)
 
-	updateNquads := ``
+	versionUpdate := map[string]interface{}{
+		"uid":        "uid(versionUid)",
+		"updated_at": time.Now().Format(time.RFC3339),
+	}
 
 	if manifestUrl, ok := updatedFields["ManifestUrl"]; ok {
-		updateNquads += `uid(versionUid) <manifest_url> "` + manifestUrl.(string) + `" .` + "\n"
+		versionUpdate["manifest_url"] = manifestUrl.(string)
+	}
+
+	updatedName := versionName
+	if newVersionName, ok := updatedFields["Name"]; ok {
+		updatedName = newVersionName.(string)
+		versionUpdate["name"] = updatedName
+	}
+
+	cond := "@if(eq(len(packageUid), 1) AND eq(len(versionUid), 1))"
+	if updatedName != versionName {
+		cond = "@if(eq(len(packageUid), 1) AND eq(len(versionUid), 1) AND eq(len(existingUid), 0))"
+	}
+
+	var deleteJson []byte
+	if versionLabels, ok := updatedFields[LabelsField]; ok {
+		setVersionLabels(versionUpdate, versionLabels.(map[string]string))
+
+		// Deletions are applied before the values are set.
+		deleteJson, err = json.Marshal(map[string]interface{}{
+			"uid":                "uid(versionUid)",
+			"version_labels":     nil,
+			"version_label_keys": nil,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encode mutation")
+		}
 	}
 
-	definePackageUid := ``
+	var update interface{} = versionUpdate
+
 	if weight, ok := updatedFields["Weight"]; ok {
-		definePackageUid = "packageUid as uid\n"
-		updateNquads += `uid(packageUid) <versions> uid(versionUid) (weight=` + strconv.FormatInt(int64(weight.(uint32)), 10) + `) .` + "\n"
+		// The weight is a facet of the package -> version edge, so the version
+		// has to be written through its package for the facet to be set. It is
+		// mirrored in version_weight to order lists by weight.
+		versionUpdate["versions|weight"] = weight.(uint32)
+		versionUpdate["version_weight"] = weight.(uint32)
+		update = map[string]interface{}{
+			"uid":      "uid(packageUid)",
+			"versions": versionUpdate,
+		}
 	}
 
-	if versionName, ok := updatedFields["Name"]; ok {
-		updateNquads += `uid(versionUid) <name> "` + versionName.(string) + `" .` + "\n"
+	setJson, err := json.Marshal(update)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode mutation")
 	}
 
 	request := &api.Request{
-		Query:      `{
-						var(func: eq(name, ` + packageName + `)) @filter(eq(dgraph.type, "Package")) {`+
-						definePackageUid +
-						`versions @filter(eq(name, `+ versionName +`)) {
-								versionUid as uid
-							}
+		Query: `query q($packageName: string, $versionName: string, $updatedName: string) {
+					var(func: eq(name, $packageName)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)) {
+						packageUid as uid
+						versions @filter(eq(name, $versionName) AND NOT has(deleted_at)) {
+							versionUid as uid
+						}
+					}
+					existing(func: eq(name, $packageName)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)) {
+						versions @filter(eq(name, $updatedName)) {
+							existingUid as uid
 						}
-					}`,
-		Mutations:  []*api.Mutation{
+					}
+				}`,
+		Vars: map[string]string{
+			"$packageName": packageName,
+			"$versionName": versionName,
+			"$updatedName": updatedName,
+		},
+		Mutations: []*api.Mutation{
 			{
-				SetNquads: []byte(updateNquads),
-				Cond:       "@if(eq(len(versionUid), 1))",
+				SetJson:    setJson,
+				DeleteJson: deleteJson,
+				Cond:       cond,
 			},
 		},
 	}
 
-	if _, err := txn.Do(ctx, request); err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to mutate data", err)
+	if manifestUrl, ok := updatedFields["ManifestUrl"]; ok {
+		if err := r.checkManifestUnpinned(ctx, txn, packageName, versionName, manifestUrl.(string)); err != nil {
+			return nil, err
+		}
+	}
+
+	previous, err := r.recordRoutingRevision(ctx, txn, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return nil, dgraphError(err, "failed to mutate data")
+	}
+
+	if updatedName != versionName && gjson.GetBytes(requestResult.Json, "existing.0.versions.0").Exists() {
+		return nil, errors.Wrapf(ErrAlreadyExists, "version %s of package %s", updatedName, packageName)
+	}
+
+	latest, err := r.recordRoutingRevision(ctx, txn, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	// The routing revisions hold the version as it was before and after the
+	// update.
+	if entry, ok := findRoutingEntry(latest, updatedName); ok {
+		previousEntry, _ := findRoutingEntry(previous, versionName)
+		version := &polvo_v1.Version{Name: entry.Version, ManifestUrl: entry.ManifestUrl, Weight: entry.Weight}
+
+		now := time.Now()
+		if err := r.writeEvents(ctx, txn,
+			newVersionEvent(ctx, EventVersionUpdated, packageName, version, now),
+			newWeightEvent(ctx, packageName, version, previousEntry.Weight, now),
+		); err != nil {
+			return nil, err
+		}
+
+		if err := r.writeAudit(ctx, txn, version); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := txn.Commit(ctx); err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to commit data", err)
+		return nil, dgraphError(err, "failed to commit data")
 	}
 
-	savedVersion, err := r.GetVersion(ctx, packageName, versionName)
+	savedVersion, err := r.GetVersion(ctx, packageName, updatedName)
 	if err != nil {
 		return nil, err
 	}
@@ -266,55 +648,219 @@ func (r *DgraphRepository) UpdateVersion(ctx context.Context, packageName, versi
 	return savedVersion, nil
 }
 
-func (r *DgraphRepository) CreateVersion(ctx context.Context, packageName string, version *polvo_v1.Version) (*polvo_v1.Version, error) {
+func (r *DgraphRepository) CreateVersion(ctx context.Context, packageName string, version *polvo_v1.Version, pin *ManifestPin, versionLabels map[string]string) (*polvo_v1.Version, error) {
+	var saved *polvo_v1.Version
+	err := retryAborted(ctx, func() (err error) {
+		saved, err = r.createVersion(ctx, packageName, version, pin, versionLabels)
+		return err
+	})
+
+	return saved, err
+}
+
+// createVersion is one attempt of CreateVersion.
+func (r *DgraphRepository) createVersion(ctx context.Context, packageName string, version *polvo_v1.Version, pin *ManifestPin, versionLabels map[string]string) (*polvo_v1.Version, error) {
 	dgraphClient, err := r.getDgraphClient()
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to get db client", err)
+		return nil, err
 	}
 
 	txn := dgraphClient.NewTxn()
 	defer txn.Discard(ctx)
 
+	now := time.Now()
+	newVersion := map[string]interface{}{
+		"uid":             "_:version",
+		"dgraph.type":     "Version",
+		"name":            version.GetName(),
+		"manifest_url":    version.GetManifestUrl(),
+		"created_at":      now.Format(time.RFC3339),
+		"updated_at":      now.Format(time.RFC3339),
+		"versions|weight": version.GetWeight(),
+		"version_weight":  version.GetWeight(),
+	}
+
+	if pin != nil {
+		newVersion["manifest_sha256"] = pin.SHA256
+		if pin.Body != nil {
+			newVersion["manifest_body"] = string(pin.Body)
+		}
+	}
+
+	if len(versionLabels) > 0 {
+		setVersionLabels(newVersion, versionLabels)
+	}
+
+	setJson, err := json.Marshal(map[string]interface{}{
+		"uid":      "uid(packageUid)",
+		"versions": newVersion,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode mutation")
+	}
+
+	cond := "@if(eq(len(versionUid), 0) AND eq(len(packageUid), 1))"
+	outbox, err := r.outboxMutation(ctx, txn, cond, newVersionEvent(ctx, EventVersionCreated, packageName, version, now))
+	if err != nil {
+		return nil, err
+	}
+
+	audit, err := auditMutation(ctx, cond, version)
+	if err != nil {
+		return nil, err
+	}
+
 	request := &api.Request{
-		Query:      `{
-						var(func: eq(dgraph.type, "Package")) @filter(eq(name, ` + packageName + `)) {
-							packageUid as uid
-							versions @filter(eq(name, `+ version.GetName() +`)) {
-								versionUid as uid
-							}
+		Query: `query q($packageName: string, $versionName: string) {
+					var(func: eq(dgraph.type, "Package")) @filter(eq(name, $packageName) AND NOT has(deleted_at)) {
+						packageUid as uid
+						versions @filter(eq(name, $versionName)) {
+							versionUid as uid
 						}
-					}`,
-			Mutations:  []*api.Mutation{
-			{
-				SetNquads: []byte(` _:version <dgraph.type> "Version" .
-									_:version <name> "` + version.GetName() + `" .
-									_:version <manifest_url> "` + version.GetManifestUrl() + `" .
-									_:version <created_at> "` + time.Now().Format(time.RFC3339) + `" .
-									uid(packageUid) <versions> _:version (weight=` + strconv.FormatInt(int64(version.Weight), 10) + `) .`,
-							),
-				Cond:       "@if(eq(len(versionUid), 0) AND eq(len(packageUid), 1))",
-			},
+					}
+				}`,
+		Vars: map[string]string{
+			"$packageName": packageName,
+			"$versionName": version.GetName(),
 		},
+		Mutations: mutations(
+			&api.Mutation{
+				SetJson: setJson,
+				Cond:    cond,
+			},
+			outbox,
+			audit,
+		),
+	}
+
+	if _, err := r.recordRoutingRevision(ctx, txn, packageName); err != nil {
+		return nil, err
 	}
 
 	mutateResult, err := txn.Do(ctx, request)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to mutate data", err)
+		return nil, dgraphError(err, "failed to mutate data")
 	}
 
 	if len(mutateResult.Uids) == 0 {
-		return nil, status.Errorf(codes.Aborted, "version was not created, maybe it was exists")
+		isPackageExists, err := r.IsPackageExists(ctx, packageName)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isPackageExists {
+			return nil, errors.Wrapf(ErrPackageNotFound, "package %s", packageName)
+		}
+
+		return nil, errors.Wrapf(ErrAlreadyExists, "version %s of package %s", version.GetName(), packageName)
+	}
+
+	if _, err := r.recordRoutingRevision(ctx, txn, packageName); err != nil {
+		return nil, err
 	}
 
 	if err := txn.Commit(ctx); err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to commit data", err)
+		return nil, dgraphError(err, "failed to commit data")
 	}
 
 	return version, nil
 }
 
-
 func (r *DgraphRepository) DeleteVersion(ctx context.Context, packageName, versionName string) error {
+	return r.setDeletedAt(ctx, versionUidQuery(false), map[string]string{
+		"$packageName": packageName,
+		"$versionName": versionName,
+	}, versionTargetPath, true, errors.Wrapf(ErrVersionNotFound, "version %s of package %s", versionName, packageName), func(target gjson.Result, now time.Time) *OutboxEvent {
+		return newVersionEvent(ctx, EventVersionDeleted, packageName, parseVersionDetails(target).Version, now)
+	})
+}
+
+func (r *DgraphRepository) UndeleteVersion(ctx context.Context, packageName, versionName string) (*polvo_v1.Version, error) {
+	if err := r.setDeletedAt(ctx, versionUidQuery(true), map[string]string{
+		"$packageName": packageName,
+		"$versionName": versionName,
+	}, versionTargetPath, false, errors.Wrapf(ErrVersionNotFound, "deleted version %s of package %s", versionName, packageName), func(target gjson.Result, now time.Time) *OutboxEvent {
+		return newVersionEvent(ctx, EventVersionUndeleted, packageName, parseVersionDetails(target).Version, now)
+	}); err != nil {
+		return nil, err
+	}
+
+	return r.GetVersion(ctx, packageName, versionName)
+}
+
+func (r *DgraphRepository) DeletePackage(ctx context.Context, name string) error {
+	return r.setDeletedAt(ctx, packageUidQuery(false), map[string]string{
+		"$name": name,
+	}, packageTargetPath, true, errors.Wrapf(ErrPackageNotFound, "package %s", name), func(target gjson.Result, now time.Time) *OutboxEvent {
+		return newPackageEvent(ctx, EventPackageDeleted, parsePackageDetails(target).Package, now)
+	})
+}
+
+func (r *DgraphRepository) UndeletePackage(ctx context.Context, name string) (*polvo_v1.Package, error) {
+	if err := r.setDeletedAt(ctx, packageUidQuery(true), map[string]string{
+		"$name": name,
+	}, packageTargetPath, false, errors.Wrapf(ErrPackageNotFound, "deleted package %s", name), func(target gjson.Result, now time.Time) *OutboxEvent {
+		return newPackageEvent(ctx, EventPackageUndeleted, parsePackageDetails(target).Package, now)
+	}); err != nil {
+		return nil, err
+	}
+
+	return r.GetPackage(ctx, name)
+}
+
+// The paths of the node found by packageUidQuery and versionUidQuery.
+const (
+	packageTargetPath = "target.0"
+	versionTargetPath = "target.0.versions.0"
+)
+
+// packageUidQuery finds the package named $name, either among the live
+// packages or among the soft deleted ones.
+func packageUidQuery(deleted bool) string {
+	return `query q($name: string) {
+					target(func: eq(dgraph.type, "Package")) @filter(eq(name, $name) AND ` + deletedFilter(deleted) + `) {
+						uid
+						name
+						maintainer
+					}
+				}`
+}
+
+// versionUidQuery finds the version $versionName of the live package
+// $packageName, either among the live versions or among the soft deleted
+// ones.
+func versionUidQuery(deleted bool) string {
+	return `query q($packageName: string, $versionName: string) {
+					target(func: eq(dgraph.type, "Package")) @filter(eq(name, $packageName) AND NOT has(deleted_at)) {
+						versions @filter(eq(name, $versionName) AND ` + deletedFilter(deleted) + `) @facets(weight: weight) {
+							uid
+							name
+							manifest_url
+						}
+					}
+				}`
+}
+
+func deletedFilter(deleted bool) string {
+	if deleted {
+		return "has(deleted_at)"
+	}
+
+	return "NOT has(deleted_at)"
+}
+
+// setDeletedAt sets deleted_at of the node found at targetPath by query, or
+// removes it when deleted is false, and touches its updated_at. The event
+// newEvent builds from the node is written in the same transaction. It fails
+// with notFound when the node is not found.
+func (r *DgraphRepository) setDeletedAt(ctx context.Context, query string, vars map[string]string, targetPath string, deleted bool, notFound error, newEvent func(target gjson.Result, now time.Time) *OutboxEvent) error {
+	return retryAborted(ctx, func() error {
+		return r.trySetDeletedAt(ctx, query, vars, targetPath, deleted, notFound, newEvent)
+	})
+}
+
+// trySetDeletedAt is one attempt of setDeletedAt.
+func (r *DgraphRepository) trySetDeletedAt(ctx context.Context, query string, vars map[string]string, targetPath string, deleted bool, notFound error, newEvent func(target gjson.Result, now time.Time) *OutboxEvent) error {
 	dgraphClient, err := r.getDgraphClient()
 	if err != nil {
 		return err
@@ -324,119 +870,191 @@ func (r *DgraphRepository) DeleteVersion(ctx context.Context, packageName, versi
 	defer txn.Discard(ctx)
 
 	request := &api.Request{
-		Query: `
-{
-	 var(func: eq(dgraph.type, "Package")) @filter(eq(name,"`+ packageName +`")){
-		packageUid as uid
-	  versions @filter(eq(name, "` + versionName + `")) {
-				versionUid as uid
-	  }
-	}
- }`,
-		Mutations:  []*api.Mutation{
-			{
-				DelNquads: []byte(`uid(versionUid) * * .
-								   uid(packageUid) <versions> uid(versionUid) .`),
-			},
-		},
+		Query: query,
+		Vars:  vars,
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return dgraphError(err, "failed to do request")
+	}
+
+	target := gjson.GetBytes(requestResult.Json, targetPath)
+	if !target.Exists() {
+		return notFound
+	}
+
+	now := time.Now()
+	update := map[string]interface{}{
+		"uid":        target.Get("uid").String(),
+		"updated_at": now.Format(time.RFC3339),
+	}
+
+	mutation := &api.Mutation{}
+
+	if deleted {
+		update["deleted_at"] = now.Format(time.RFC3339)
+	} else {
+		deleteJson, err := json.Marshal(map[string]interface{}{
+			"uid":        target.Get("uid").String(),
+			"deleted_at": nil,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to encode mutation")
+		}
+
+		mutation.DeleteJson = deleteJson
+	}
+
+	setJson, err := json.Marshal(update)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode mutation")
+	}
+
+	mutation.SetJson = setJson
+
+	if _, err := txn.Mutate(ctx, mutation); err != nil {
+		return dgraphError(err, "failed to do request")
+	}
+
+	event := newEvent(target, now)
+	if err := r.writeEvents(ctx, txn, event); err != nil {
+		return err
+	}
+
+	// A deletion saves nothing, an undeletion the restored resource.
+	var saved interface{}
+	if !deleted {
+		saved = event.PackageState
+		if event.VersionState != nil {
+			saved = event.VersionState
+		}
 	}
 
-	if _, err := txn.Do(ctx, request); err != nil {
-		return errors.Wrap(err, "failed to do request")
+	if err := r.writeAudit(ctx, txn, saved); err != nil {
+		return err
 	}
 
 	if err := txn.Commit(ctx); err != nil {
-		return errors.Wrap(err, "failed to do request")
+		return dgraphError(err, "failed to do request")
 	}
 
 	return nil
 }
 
-func (r *DgraphRepository)DeletePackage(ctx context.Context, name string) error {
+// PurgeDeleted removes soft deleted packages together with their versions,
+// channels, routing revisions and rollouts, and soft deleted versions of live
+// packages, in one transaction.
+func (r *DgraphRepository) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (*PurgeResult, error) {
 	dgraphClient, err := r.getDgraphClient()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	txn := dgraphClient.NewTxn()
 	defer txn.Discard(ctx)
 
 	request := &api.Request{
-		Query: `{
-					var(func: eq(dgraph.type, "Package")) @filter(eq(name, ` + name + `)) {
-						packageUid as uid
+		Query: `query q($deletedBefore: string) {
+					packages(func: eq(dgraph.type, "Package")) @filter(lt(deleted_at, $deletedBefore)) {
+						uid
 						versions {
-							versionUid as uid
+							uid
+						}
+						channels {
+							uid
+						}
+						routing_revisions {
+							uid
+						}
+						rollouts {
+							uid
+						}
+					}
+					versions(func: eq(dgraph.type, "Version")) @filter(lt(deleted_at, $deletedBefore)) {
+						uid
+						~versions {
+							uid
 						}
 					}
 				}`,
-		Mutations:  []*api.Mutation{
-			{
-				DelNquads: []byte(`uid(packageUid) * * .
-									uid(versionUid) * * .`),
-			},
+		Vars: map[string]string{
+			"$deletedBefore": deletedBefore.Format(time.RFC3339),
 		},
 	}
 
-	if _, err := txn.Do(ctx, request); err != nil {
-		return errors.Wrap(err, "failed to do request")
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
 	}
 
-	if err := txn.Commit(ctx); err != nil {
-		return errors.Wrap(err, "failed to do request")
-	}
+	result := &PurgeResult{}
+	var deletions []map[string]interface{}
+	purgedUids := map[string]bool{}
 
-	return nil
-}
+	gjson.GetBytes(requestResult.Json, "packages").ForEach(func(key, pkg gjson.Result) bool {
+		result.Packages++
+		for _, path := range []string{"uid", "versions.#.uid", "channels.#.uid", "routing_revisions.#.uid", "rollouts.#.uid"} {
+			pkg.Get(path).ForEach(func(key, uid gjson.Result) bool {
+				purgedUids[uid.String()] = true
+				deletions = append(deletions, map[string]interface{}{"uid": uid.String()})
 
-func (r *DgraphRepository) ListPackages(ctx context.Context) ([]*polvo_v1.Package, error)  {
+				return true
+			})
+		}
 
-	query := `{
-		  items(func: eq(dgraph.type, "Package")){
-			uid
-			name
-			maintainer
-		  }
-		}`
+		return true
+	})
 
-	dgraphClient, err := r.getDgraphClient()
-	if err != nil {
-		return nil, err
-	}
+	gjson.GetBytes(requestResult.Json, "versions").ForEach(func(key, version gjson.Result) bool {
+		versionUid := version.Get("uid").String()
+		if purgedUids[versionUid] {
+			return true
+		}
 
-	txn := dgraphClient.NewReadOnlyTxn()
+		result.Versions++
+		deletions = append(deletions, map[string]interface{}{"uid": versionUid})
+		version.Get("~versions.#.uid").ForEach(func(key, packageUid gjson.Result) bool {
+			deletions = append(deletions, map[string]interface{}{
+				"uid": packageUid.String(),
+				"versions": map[string]interface{}{
+					"uid": versionUid,
+				},
+			})
 
-	request := &api.Request{
-		Query:      query,
+			return true
+		})
+
+		return true
+	})
+
+	if len(deletions) == 0 {
+		return result, nil
 	}
 
-	requestResult, err := txn.Do(ctx, request)
+	deleteJson, err := json.Marshal(deletions)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "failed to encode mutation")
 	}
 
-	var packages []*polvo_v1.Package
+	if _, err := txn.Mutate(ctx, &api.Mutation{DeleteJson: deleteJson}); err != nil {
+		return nil, dgraphError(err, "failed to mutate data")
+	}
 
-	rawPackages := gjson.GetBytes(requestResult.Json, "items")
-	if !rawPackages.Exists() {
-		return nil, errors.New("no item found")
+	if err := r.writeAudit(ctx, txn, result); err != nil {
+		return nil, err
 	}
-	rawPackages.ForEach(func(key, value gjson.Result) bool {
-		pkg := &polvo_v1.Package{
-			Name: value.Get("name").String(),
-			Maintainer: value.Get("maintainer").String(),
-		}
-		packages = append(packages, pkg)
 
-		return true
-	})
+	if err := txn.Commit(ctx); err != nil {
+		return nil, dgraphError(err, "failed to commit data")
+	}
 
-	return packages, nil
+	return result, nil
 }
 
 func (r *DgraphRepository) IsPackageExists(ctx context.Context, name string) (bool, error) {
-	query := `{
-		  packages(func: eq(name, ` + name + `)) @filter(eq(dgraph.type, "Package")){
+	query := `query q($name: string) {
+		  packages(func: eq(name, $name)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)){
 			uid
 		  }
 		}`
@@ -450,11 +1068,14 @@ func (r *DgraphRepository) IsPackageExists(ctx context.Context, name string) (bo
 
 	request := &api.Request{
 		Query: query,
+		Vars: map[string]string{
+			"$name": name,
+		},
 	}
 
 	requestResult, err := txn.Do(ctx, request)
 	if err != nil {
-		return false, err
+		return false, dgraphError(err, "failed to query data")
 	}
 
 	packageCount := gjson.GetBytes(requestResult.Json, "packages.#")
@@ -463,9 +1084,9 @@ func (r *DgraphRepository) IsPackageExists(ctx context.Context, name string) (bo
 }
 
 func (r *DgraphRepository) IsVersionExists(ctx context.Context, packageName string, versionName string) (bool, error) {
-	query := `{
-		  packages(func: eq(name, "` + packageName + `")) @filter(eq(dgraph.type, "Package")){
-			versions @filter(eq(name, "` + versionName + `")) {
+	query := `query q($packageName: string, $versionName: string) {
+		  packages(func: eq(name, $packageName)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)){
+			versions @filter(eq(name, $versionName) AND NOT has(deleted_at)) {
 				uid
 			}
 		  }
@@ -480,11 +1101,15 @@ func (r *DgraphRepository) IsVersionExists(ctx context.Context, packageName stri
 
 	request := &api.Request{
 		Query: query,
+		Vars: map[string]string{
+			"$packageName": packageName,
+			"$versionName": versionName,
+		},
 	}
 
 	requestResult, err := txn.Do(ctx, request)
 	if err != nil {
-		return false, err
+		return false, dgraphError(err, "failed to query data")
 	}
 
 	versionUid := gjson.GetBytes(requestResult.Json, "packages.0.versions.0.uid")
@@ -492,53 +1117,16 @@ func (r *DgraphRepository) IsVersionExists(ctx context.Context, packageName stri
 	return versionUid.Exists(), nil
 }
 
-func (r *DgraphRepository) ListVersions(ctx context.Context, packageName string, option ...ListVersionsOptions) ([]*polvo_v1.Version, error) {
-
-	query := `
-{
-  package(func: eq(dgraph.type, "Package")) @filter(eq(name,"` + packageName + `")) {
-	uid
-	versions @facets(orderdesc: weight, weight: weight) {
-		uid
-		name
-		manifest_url
-	}
-  }
-}`
-
-	dgraphClient, err := r.getDgraphClient()
+func (r *DgraphRepository) ListVersions(ctx context.Context, packageName string) ([]*polvo_v1.Version, error) {
+	page, err := r.ListVersionDetails(ctx, packageName, ListVersionsOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	txn := dgraphClient.NewReadOnlyTxn()
-
-	request := &api.Request{
-		Query:      query,
+	versions := make([]*polvo_v1.Version, 0, len(page.Versions))
+	for _, version := range page.Versions {
+		versions = append(versions, version.Version)
 	}
 
-	requestResult, err := txn.Do(ctx, request)
-	if err != nil {
-		return nil, err
-	}
-
-	var versions []*polvo_v1.Version
-
-	rawVersions := gjson.GetBytes(requestResult.Json, "package.0.versions")
-	if !rawVersions.Exists() {
-		return nil, errors.New("not found")
-	}
-
-	rawVersions.ForEach(func(key, value gjson.Result) bool {
-		version := &polvo_v1.Version{
-			Name:        value.Get("name").String(),
-			ManifestUrl: value.Get("manifest_url").String(),
-			Weight: uint32(value.Get("weight").Uint()),
-		}
-		versions = append(versions, version)
-
-		return true
-	})
-
 	return versions, nil
 }
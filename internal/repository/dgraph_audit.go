@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dgraph-io/dgo/v210"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+// AppendAuditEvent stores the event as an AuditEvent node.
+func (r *DgraphRepository) AppendAuditEvent(ctx context.Context, event *AuditEvent) error {
+	id := newID()
+
+	setJson, err := auditSetJson(id, event)
+	if err != nil {
+		return err
+	}
+
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return err
+	}
+
+	txn := dgraphClient.NewTxn()
+	defer txn.Discard(ctx)
+
+	if _, err := txn.Mutate(ctx, &api.Mutation{SetJson: setJson}); err != nil {
+		return dgraphError(err, "failed to mutate data")
+	}
+
+	if err := txn.Commit(ctx); err != nil {
+		return dgraphError(err, "failed to commit data")
+	}
+
+	event.ID = id
+
+	return nil
+}
+
+// auditMutation returns the mutation writing the audit event of ctx completed
+// with saved, with the condition cond. Adding it to the request of a change
+// records the event with the change. The mutation is nil when there is
+// nothing to record.
+func auditMutation(ctx context.Context, cond string, saved interface{}) (*api.Mutation, error) {
+	event := auditEventOf(ctx, saved)
+	if event == nil {
+		return nil, nil
+	}
+
+	setJson, err := auditSetJson(event.ID, event)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.Mutation{SetJson: setJson, Cond: cond}, nil
+}
+
+// writeAudit adds the audit event of ctx completed with saved to txn, to be
+// committed with the change it records.
+func (r *DgraphRepository) writeAudit(ctx context.Context, txn *dgo.Txn, saved interface{}) error {
+	mutation, err := auditMutation(ctx, "", saved)
+	if err != nil || mutation == nil {
+		return err
+	}
+
+	if _, err := txn.Mutate(ctx, mutation); err != nil {
+		return dgraphError(err, "failed to mutate data")
+	}
+
+	return nil
+}
+
+// auditSetJson encodes the AuditEvent node of event. Before and after values
+// are kept as JSON strings since they differ from one RPC to another.
+func auditSetJson(id string, event *AuditEvent) ([]byte, error) {
+	before, err := json.Marshal(event.Before)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode audit event")
+	}
+
+	after, err := json.Marshal(event.After)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode audit event")
+	}
+
+	setJson, err := json.Marshal(map[string]interface{}{
+		"uid":              "_:audit",
+		"dgraph.type":      "AuditEvent",
+		"audit_id":         id,
+		"audit_actor":      event.Actor,
+		"audit_method":     event.Method,
+		"audit_orn":        event.Orn,
+		"audit_package":    event.Package,
+		"audit_before":     string(before),
+		"audit_after":      string(after),
+		"audit_request_id": event.RequestID,
+		"created_at":       event.Time.UTC().Format(auditTimeFormat),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode mutation")
+	}
+
+	return setJson, nil
+}
+
+func (r *DgraphRepository) ListAuditEvents(ctx context.Context, options ListAuditEventsOptions) (*AuditEventPage, error) {
+	cursor, err := parsePageToken(options.PageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	list := newListQuery(`eq(dgraph.type, "AuditEvent")`)
+
+	if options.Package != "" {
+		list.filter("eq(audit_package, $package)", "$package", options.Package)
+	}
+
+	if options.Actor != "" {
+		list.filter("eq(audit_actor, $actor)", "$actor", options.Actor)
+	}
+
+	if options.Since != nil {
+		list.filter("ge(created_at, $since)", "$since", options.Since.UTC().Format(auditTimeFormat))
+	}
+
+	if options.Until != nil {
+		list.filter("lt(created_at, $until)", "$until", options.Until.UTC().Format(auditTimeFormat))
+	}
+
+	if cursor != nil {
+		list.filter("(lt(created_at, $afterKey) OR (eq(created_at, $afterKey) AND lt(audit_id, $afterName)))",
+			"$afterKey", cursor.Key,
+			"$afterName", cursor.Name,
+		)
+	}
+
+	first := ""
+	if options.PageSize > 0 {
+		first = fmt.Sprintf(", first: %d", options.PageSize+1)
+	}
+
+	query := list.header() + ` {
+		  events(func: type(AuditEvent), orderdesc: created_at, orderdesc: audit_id` + first + `) @filter(` + list.filterExpression() + `) {
+			audit_id
+			audit_actor
+			audit_method
+			audit_orn
+			audit_package
+			audit_before
+			audit_after
+			audit_request_id
+			created_at
+		  }
+		}`
+
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewReadOnlyTxn()
+
+	request := &api.Request{
+		Query: query,
+		Vars:  list.vars,
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	page := &AuditEventPage{}
+
+	gjson.GetBytes(requestResult.Json, "events").ForEach(func(key, value gjson.Result) bool {
+		if options.PageSize > 0 && uint(len(page.Events)) == options.PageSize {
+			page.NextPageToken = auditCursor(page.Events[len(page.Events)-1]).token()
+
+			return false
+		}
+
+		page.Events = append(page.Events, parseAuditEvent(value))
+
+		return true
+	})
+
+	return page, nil
+}
+
+func parseAuditEvent(value gjson.Result) *AuditEvent {
+	event := &AuditEvent{
+		ID:        value.Get("audit_id").String(),
+		Actor:     value.Get("audit_actor").String(),
+		Method:    value.Get("audit_method").String(),
+		Orn:       value.Get("audit_orn").String(),
+		Package:   value.Get("audit_package").String(),
+		RequestID: value.Get("audit_request_id").String(),
+		Time:      value.Get("created_at").Time(),
+	}
+
+	_ = json.Unmarshal([]byte(value.Get("audit_before").String()), &event.Before)
+	_ = json.Unmarshal([]byte(value.Get("audit_after").String()), &event.After)
+
+	return event
+}
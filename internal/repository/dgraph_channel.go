@@ -0,0 +1,464 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/dgraph-io/dgo/v210"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+const channelFields = `
+				uid
+				name
+				revision
+				created_at
+				updated_at
+				channel_targets @filter(NOT has(deleted_at)) @facets(weight: weight) {
+					uid
+					name
+				}
+				channel_previous_targets @filter(NOT has(deleted_at)) @facets(weight: weight) {
+					uid
+					name
+				}`
+
+func parseChannel(value gjson.Result) *Channel {
+	return &Channel{
+		Name:      value.Get("name").String(),
+		Targets:   parseChannelTargets(value.Get("channel_targets")),
+		Revision:  value.Get("revision").Int(),
+		CreatedAt: value.Get("created_at").Time(),
+		UpdatedAt: value.Get("updated_at").Time(),
+	}
+}
+
+func parseChannelTargets(value gjson.Result) []ChannelTarget {
+	var targets []ChannelTarget
+
+	value.ForEach(func(key, target gjson.Result) bool {
+		targets = append(targets, ChannelTarget{
+			Version: target.Get("name").String(),
+			Weight:  uint32(target.Get("weight").Uint()),
+		})
+
+		return true
+	})
+
+	return targets
+}
+
+func (r *DgraphRepository) ListChannels(ctx context.Context, packageName string) ([]*Channel, error) {
+	query := `query q($packageName: string) {
+		  package(func: eq(name, $packageName)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)){
+			uid
+			channels {` + channelFields + `
+			}
+		  }
+		}`
+
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewReadOnlyTxn()
+
+	request := &api.Request{
+		Query: query,
+		Vars: map[string]string{
+			"$packageName": packageName,
+		},
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	if !gjson.GetBytes(requestResult.Json, "package.0").Exists() {
+		return nil, errors.Wrapf(ErrPackageNotFound, "package %s", packageName)
+	}
+
+	var channels []*Channel
+	gjson.GetBytes(requestResult.Json, "package.0.channels").ForEach(func(key, value gjson.Result) bool {
+		channels = append(channels, parseChannel(value))
+
+		return true
+	})
+
+	return channels, nil
+}
+
+func (r *DgraphRepository) GetChannel(ctx context.Context, packageName, channelName string) (*Channel, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewReadOnlyTxn()
+
+	channel, err := r.queryChannel(ctx, txn, packageName, channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseChannel(channel.Get("package.0.channels.0")), nil
+}
+
+func (r *DgraphRepository) CreateChannel(ctx context.Context, packageName string, channel *Channel) (*Channel, error) {
+	var saved *Channel
+	err := retryAborted(ctx, func() (err error) {
+		saved, err = r.createChannel(ctx, packageName, channel)
+		return err
+	})
+
+	return saved, err
+}
+
+// createChannel is one attempt of CreateChannel.
+func (r *DgraphRepository) createChannel(ctx context.Context, packageName string, channel *Channel) (*Channel, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewTxn()
+	defer txn.Discard(ctx)
+
+	current, err := r.queryChannelForUpdate(ctx, txn, packageName, channel.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.Get("package.0.channels.0").Exists() {
+		return nil, errors.Wrapf(ErrAlreadyExists, "channel %s of package %s", channel.Name, packageName)
+	}
+
+	targets, err := channelTargetsJson(current, "channel_targets", packageName, channel.Targets)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	setJson, err := json.Marshal(map[string]interface{}{
+		"uid": current.Get("package.0.uid").String(),
+		"channels": map[string]interface{}{
+			"uid":             "_:channel",
+			"dgraph.type":     "Channel",
+			"name":            channel.Name,
+			"revision":        1,
+			"created_at":      now.Format(time.RFC3339),
+			"updated_at":      now.Format(time.RFC3339),
+			"channel_targets": targets,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode mutation")
+	}
+
+	if _, err := txn.Mutate(ctx, &api.Mutation{SetJson: setJson}); err != nil {
+		return nil, dgraphError(err, "failed to mutate data")
+	}
+
+	saved := &Channel{
+		Name:      channel.Name,
+		Targets:   channel.Targets,
+		Revision:  1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := r.writeEvents(ctx, txn, newChannelEvent(ctx, EventChannelCreated, packageName, saved, now)); err != nil {
+		return nil, err
+	}
+
+	if err := r.writeAudit(ctx, txn, saved); err != nil {
+		return nil, err
+	}
+
+	if err := txn.Commit(ctx); err != nil {
+		return nil, dgraphError(err, "failed to commit data")
+	}
+
+	return saved, nil
+}
+
+func (r *DgraphRepository) PromoteChannel(ctx context.Context, packageName, channelName string, targets []ChannelTarget) (*Channel, error) {
+	var saved *Channel
+	err := retryAborted(ctx, func() (err error) {
+		saved, err = r.promoteChannel(ctx, packageName, channelName, targets)
+		return err
+	})
+
+	return saved, err
+}
+
+// promoteChannel is one attempt of PromoteChannel.
+func (r *DgraphRepository) promoteChannel(ctx context.Context, packageName, channelName string, targets []ChannelTarget) (*Channel, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewTxn()
+	defer txn.Discard(ctx)
+
+	current, err := r.queryChannelForUpdate(ctx, txn, packageName, channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	channel := current.Get("package.0.channels.0")
+	if !channel.Exists() {
+		return nil, errors.Wrapf(ErrChannelNotFound, "channel %s of package %s", channelName, packageName)
+	}
+
+	newTargets, err := channelTargetsJson(current, "channel_targets", packageName, targets)
+	if err != nil {
+		return nil, err
+	}
+
+	previousTargets := edgesJson(channel.Get("channel_targets"), "channel_previous_targets")
+
+	revision := channel.Get("revision").Int() + 1
+	if err := r.replaceChannelTargets(ctx, txn, channel.Get("uid").String(), revision, newTargets, previousTargets); err != nil {
+		return nil, err
+	}
+
+	saved := &Channel{
+		Name:      channelName,
+		Targets:   targets,
+		Revision:  revision,
+		CreatedAt: channel.Get("created_at").Time(),
+		UpdatedAt: time.Now(),
+	}
+
+	if err := r.writeEvents(ctx, txn, newChannelEvent(ctx, EventChannelUpdated, packageName, saved, saved.UpdatedAt)); err != nil {
+		return nil, err
+	}
+
+	if err := r.writeAudit(ctx, txn, saved); err != nil {
+		return nil, err
+	}
+
+	if err := txn.Commit(ctx); err != nil {
+		return nil, dgraphError(err, "failed to commit data")
+	}
+
+	return saved, nil
+}
+
+func (r *DgraphRepository) RollbackChannel(ctx context.Context, packageName, channelName string) (*Channel, error) {
+	var saved *Channel
+	err := retryAborted(ctx, func() (err error) {
+		saved, err = r.rollbackChannel(ctx, packageName, channelName)
+		return err
+	})
+
+	return saved, err
+}
+
+// rollbackChannel is one attempt of RollbackChannel.
+func (r *DgraphRepository) rollbackChannel(ctx context.Context, packageName, channelName string) (*Channel, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewTxn()
+	defer txn.Discard(ctx)
+
+	current, err := r.queryChannelForUpdate(ctx, txn, packageName, channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	channel := current.Get("package.0.channels.0")
+	if !channel.Exists() {
+		return nil, errors.Wrapf(ErrChannelNotFound, "channel %s of package %s", channelName, packageName)
+	}
+
+	if !channel.Get("channel_previous_targets.0").Exists() {
+		return nil, errors.Wrapf(ErrPrecondition, "channel %s of package %s has nothing to roll back to", channelName, packageName)
+	}
+
+	newTargets := edgesJson(channel.Get("channel_previous_targets"), "channel_targets")
+	previousTargets := edgesJson(channel.Get("channel_targets"), "channel_previous_targets")
+
+	revision := channel.Get("revision").Int() + 1
+	if err := r.replaceChannelTargets(ctx, txn, channel.Get("uid").String(), revision, newTargets, previousTargets); err != nil {
+		return nil, err
+	}
+
+	saved := &Channel{
+		Name:      channelName,
+		Targets:   parseChannelTargets(channel.Get("channel_previous_targets")),
+		Revision:  revision,
+		CreatedAt: channel.Get("created_at").Time(),
+		UpdatedAt: time.Now(),
+	}
+
+	if err := r.writeEvents(ctx, txn, newChannelEvent(ctx, EventChannelUpdated, packageName, saved, saved.UpdatedAt)); err != nil {
+		return nil, err
+	}
+
+	if err := r.writeAudit(ctx, txn, saved); err != nil {
+		return nil, err
+	}
+
+	if err := txn.Commit(ctx); err != nil {
+		return nil, dgraphError(err, "failed to commit data")
+	}
+
+	return saved, nil
+}
+
+func (r *DgraphRepository) queryChannel(ctx context.Context, txn *dgo.Txn, packageName, channelName string) (gjson.Result, error) {
+	query := `query q($packageName: string, $channelName: string) {
+		  package(func: eq(name, $packageName)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)){
+			uid
+			channels @filter(eq(name, $channelName)) {` + channelFields + `
+			}
+		  }
+		}`
+
+	request := &api.Request{
+		Query: query,
+		Vars: map[string]string{
+			"$packageName": packageName,
+			"$channelName": channelName,
+		},
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return gjson.Result{}, dgraphError(err, "failed to query data")
+	}
+
+	result := gjson.ParseBytes(requestResult.Json)
+	if !result.Get("package.0").Exists() {
+		return gjson.Result{}, errors.Wrapf(ErrPackageNotFound, "package %s", packageName)
+	}
+
+	if !result.Get("package.0.channels.0").Exists() {
+		return gjson.Result{}, errors.Wrapf(ErrChannelNotFound, "channel %s of package %s", channelName, packageName)
+	}
+
+	return result, nil
+}
+
+// queryChannelForUpdate reads the package, its versions and the channel
+// inside txn, so that the mutation built from the result conflicts with any
+// concurrent change of the same channel.
+func (r *DgraphRepository) queryChannelForUpdate(ctx context.Context, txn *dgo.Txn, packageName, channelName string) (gjson.Result, error) {
+	query := `query q($packageName: string, $channelName: string) {
+		  package(func: eq(name, $packageName)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)){
+			uid
+			versions @filter(NOT has(deleted_at)) {
+				uid
+				name
+			}
+			channels @filter(eq(name, $channelName)) {` + channelFields + `
+			}
+		  }
+		}`
+
+	request := &api.Request{
+		Query: query,
+		Vars: map[string]string{
+			"$packageName": packageName,
+			"$channelName": channelName,
+		},
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return gjson.Result{}, dgraphError(err, "failed to query data")
+	}
+
+	result := gjson.ParseBytes(requestResult.Json)
+	if !result.Get("package.0").Exists() {
+		return gjson.Result{}, errors.Wrapf(ErrPackageNotFound, "package %s", packageName)
+	}
+
+	return result, nil
+}
+
+func (r *DgraphRepository) replaceChannelTargets(ctx context.Context, txn *dgo.Txn, channelUid string, revision int64, targets, previousTargets []map[string]interface{}) error {
+	deleteJson, err := json.Marshal(map[string]interface{}{
+		"uid":                      channelUid,
+		"channel_targets":          nil,
+		"channel_previous_targets": nil,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode mutation")
+	}
+
+	setJson, err := json.Marshal(map[string]interface{}{
+		"uid":                      channelUid,
+		"revision":                 revision,
+		"updated_at":               time.Now().Format(time.RFC3339),
+		"channel_targets":          targets,
+		"channel_previous_targets": previousTargets,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode mutation")
+	}
+
+	if _, err := txn.Mutate(ctx, &api.Mutation{DeleteJson: deleteJson}); err != nil {
+		return dgraphError(err, "failed to mutate data")
+	}
+
+	if _, err := txn.Mutate(ctx, &api.Mutation{SetJson: setJson}); err != nil {
+		return dgraphError(err, "failed to mutate data")
+	}
+
+	return nil
+}
+
+// channelTargetsJson maps version names to the uids of the package versions
+// found by queryChannelForUpdate, with the weight as a facet of predicate.
+func channelTargetsJson(current gjson.Result, predicate, packageName string, targets []ChannelTarget) ([]map[string]interface{}, error) {
+	versionUids := map[string]string{}
+	current.Get("package.0.versions").ForEach(func(key, value gjson.Result) bool {
+		versionUids[value.Get("name").String()] = value.Get("uid").String()
+
+		return true
+	})
+
+	edges := make([]map[string]interface{}, 0, len(targets))
+	for _, target := range targets {
+		versionUid, ok := versionUids[target.Version]
+		if !ok {
+			return nil, errors.Wrapf(ErrVersionNotFound, "version %s of package %s", target.Version, packageName)
+		}
+
+		edges = append(edges, map[string]interface{}{
+			"uid":                 versionUid,
+			predicate + "|weight": target.Weight,
+		})
+	}
+
+	return edges, nil
+}
+
+// edgesJson copies queried channel target edges, keeping their weights, so
+// they can be written to predicate.
+func edgesJson(value gjson.Result, predicate string) []map[string]interface{} {
+	var edges []map[string]interface{}
+
+	value.ForEach(func(key, target gjson.Result) bool {
+		edges = append(edges, map[string]interface{}{
+			"uid":                 target.Get("uid").String(),
+			predicate + "|weight": target.Get("weight").Uint(),
+		})
+
+		return true
+	})
+
+	return edges
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"pkg.aiocean.dev/polvoservice/internal/labels"
+)
+
+// Labels are stored twice, as "key=value" strings in version_labels and as
+// their keys in version_label_keys, so that every requirement of a selector is
+// an eq on an exact index.
+const versionLabelFields = `
+				version_labels`
+
+func parseVersionLabels(value gjson.Result) map[string]string {
+	var pairs []string
+	value.Get("version_labels").ForEach(func(key, pair gjson.Result) bool {
+		pairs = append(pairs, pair.String())
+
+		return true
+	})
+
+	return labels.Copy(labels.FromPairs(pairs))
+}
+
+// setVersionLabels sets the labels predicates of a version node. When the node
+// already has labels they must be deleted first, setting a list predicate adds
+// to its values.
+func setVersionLabels(node map[string]interface{}, versionLabels map[string]string) {
+	keys := make([]string, 0, len(versionLabels))
+	for key := range versionLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	node["version_labels"] = labels.Pairs(versionLabels)
+	node["version_label_keys"] = keys
+}
+
+// labelSelectorFilter adds a filter for every requirement of the selector.
+func (q *listQuery) labelSelectorFilter(selector *labels.Selector) {
+	for i, requirement := range selector.Requirements() {
+		name := "$label" + strconv.Itoa(i)
+
+		if requirement.Operator == labels.Exists || requirement.Operator == labels.DoesNotExist {
+			filter := "eq(version_label_keys, " + name + ")"
+			if requirement.Operator == labels.DoesNotExist {
+				filter = "NOT " + filter
+			}
+
+			q.filter(filter, name, requirement.Key)
+			continue
+		}
+
+		var matches, vars []string
+		for j, value := range requirement.Values {
+			valueName := name + "_" + strconv.Itoa(j)
+			matches = append(matches, "eq(version_labels, "+valueName+")")
+			vars = append(vars, valueName, labels.Pair(requirement.Key, value))
+		}
+
+		filter := "(" + strings.Join(matches, " OR ") + ")"
+		if requirement.Operator == labels.NotEquals || requirement.Operator == labels.NotIn {
+			filter = "NOT " + filter
+		}
+
+		q.filter(filter, vars...)
+	}
+}
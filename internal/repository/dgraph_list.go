@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+// listQuery collects the filters and variables of a paginated list query.
+type listQuery struct {
+	filters []string
+	vars    map[string]string
+	// types are the types of the variables that are not strings.
+	types map[string]string
+}
+
+func newListQuery(filters ...string) *listQuery {
+	return &listQuery{
+		filters: filters,
+		vars:    map[string]string{},
+		types:   map[string]string{},
+	}
+}
+
+// filter adds a filter that uses the given variables, passed as name and
+// value pairs.
+func (q *listQuery) filter(filter string, vars ...string) {
+	q.filters = append(q.filters, filter)
+	for i := 0; i+1 < len(vars); i += 2 {
+		q.vars[vars[i]] = vars[i+1]
+	}
+}
+
+// header declares the variables of the query, a query without variables can
+// not have a name.
+func (q *listQuery) header() string {
+	if len(q.vars) == 0 {
+		return ""
+	}
+
+	params := make([]string, 0, len(q.vars))
+	for name := range q.vars {
+		varType, ok := q.types[name]
+		if !ok {
+			varType = "string"
+		}
+
+		params = append(params, name+": "+varType)
+	}
+	sort.Strings(params)
+
+	return "query q(" + strings.Join(params, ", ") + ")"
+}
+
+func (q *listQuery) filterExpression() string {
+	return strings.Join(q.filters, " AND ")
+}
+
+// namePrefixFilter matches names starting with the prefix through the exact
+// index of name.
+func (q *listQuery) namePrefixFilter(prefix string) {
+	if prefix == "" {
+		return
+	}
+
+	q.filter("ge(name, $namePrefix) AND lt(name, $namePrefixEnd)",
+		"$namePrefix", prefix,
+		"$namePrefixEnd", prefix+"\U0010FFFF",
+	)
+}
+
+func (q *listQuery) createdAfterFilter(createdAfter *time.Time) {
+	if createdAfter == nil {
+		return
+	}
+
+	q.filter("gt(created_at, $createdAfter)", "$createdAfter", createdAfter.Format(time.RFC3339))
+}
+
+// orderPredicate is the predicate a list is ordered by. The weight of a
+// version is a facet of the package -> version edge, which can not be compared
+// together with the name, so it is mirrored in the version_weight predicate.
+func orderPredicate(orderBy OrderBy) string {
+	if orderBy == OrderByWeight {
+		return "version_weight"
+	}
+
+	return string(orderBy)
+}
+
+// cursorFilter skips the items up to and including the cursor.
+func (q *listQuery) cursorFilter(orderBy OrderBy, descending bool, cursor *pageCursor) error {
+	if cursor == nil {
+		return nil
+	}
+
+	compare := "gt"
+	if descending {
+		compare = "lt"
+	}
+
+	if orderBy == OrderByName {
+		q.filter(compare+"(name, $afterName)", "$afterName", cursor.Name)
+		return nil
+	}
+
+	afterKey := cursor.Key
+	if orderBy == OrderByWeight {
+		weight, err := strconv.ParseUint(cursor.Key, 10, 32)
+		if err != nil {
+			return errors.Wrap(ErrInvalidArgument, "malformed page token")
+		}
+
+		afterKey = strconv.FormatUint(weight, 10)
+		q.types["$afterKey"] = "int"
+	}
+
+	q.filter(fmt.Sprintf("(%[1]s(%[2]s, $afterKey) OR (eq(%[2]s, $afterKey) AND %[1]s(name, $afterName)))", compare, orderPredicate(orderBy)),
+		"$afterKey", afterKey,
+		"$afterName", cursor.Name,
+	)
+
+	return nil
+}
+
+// listOrder orders by the predicate and then by name, and fetches one item
+// more than the page so that the caller knows whether there is a next page.
+func listOrder(orderBy OrderBy, descending bool, pageSize uint) string {
+	direction := "orderasc"
+	if descending {
+		direction = "orderdesc"
+	}
+
+	order := direction + ": name"
+	if orderBy != OrderByName {
+		order = fmt.Sprintf("%[1]s: %[2]s, %[1]s: name", direction, orderPredicate(orderBy))
+	}
+
+	if pageSize > 0 {
+		order += fmt.Sprintf(", first: %d", pageSize+1)
+	}
+
+	return order
+}
+
+func (r *DgraphRepository) ListPackages(ctx context.Context, options ListPackagesOptions) (*PackagePage, error) {
+	options, err := options.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := parsePageToken(options.PageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	list := newListQuery("NOT has(deleted_at)")
+	list.namePrefixFilter(options.NamePrefix)
+	list.createdAfterFilter(options.CreatedAfter)
+
+	if err := list.cursorFilter(options.OrderBy, options.Descending, cursor); err != nil {
+		return nil, err
+	}
+
+	if options.Maintainer != "" {
+		list.filter("eq(maintainer, $maintainer)", "$maintainer", options.Maintainer)
+	}
+
+	if options.Tag != "" {
+		list.filter("eq(package_tags, $tag)", "$tag", options.Tag)
+	}
+
+	if options.Owner != "" {
+		list.filter("eq(package_owners, $owner)", "$owner", options.Owner)
+	}
+
+	query := list.header() + ` {
+		  items(func: type(Package), ` + listOrder(options.OrderBy, options.Descending, options.PageSize) + `) @filter(` + list.filterExpression() + `){
+			uid
+			name
+			maintainer` + packageMetadataFields + `
+			created_at
+			updated_at
+		  }
+		}`
+
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewReadOnlyTxn()
+
+	request := &api.Request{
+		Query: query,
+		Vars:  list.vars,
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	page := &PackagePage{}
+
+	gjson.GetBytes(requestResult.Json, "items").ForEach(func(key, value gjson.Result) bool {
+		if options.PageSize > 0 && uint(len(page.Packages)) == options.PageSize {
+			last := page.Packages[len(page.Packages)-1]
+			page.NextPageToken = newPageCursor(options.OrderBy, last.Package.GetName(), last.CreatedAt, 0).token()
+
+			return false
+		}
+
+		page.Packages = append(page.Packages, parsePackageDetails(value))
+
+		return true
+	})
+
+	return page, nil
+}
+
+// ListVersionDetails pages through the versions in Dgraph, versions ordered by
+// weight are ordered by version_weight.
+func (r *DgraphRepository) ListVersionDetails(ctx context.Context, packageName string, options ListVersionsOptions) (*VersionPage, error) {
+	options, err := options.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := parsePageToken(options.PageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	list := newListQuery("NOT has(deleted_at)")
+	list.namePrefixFilter(options.NamePrefix)
+	list.createdAfterFilter(options.CreatedAfter)
+	list.labelSelectorFilter(options.LabelSelector)
+	list.vars["$packageName"] = packageName
+
+	facetFilter := ""
+	if options.HasWeight != nil {
+		facetFilter = "@facets(gt(weight, 0))"
+		if !*options.HasWeight {
+			facetFilter = "@facets(NOT gt(weight, 0))"
+		}
+	}
+
+	if err := list.cursorFilter(options.OrderBy, options.Descending, cursor); err != nil {
+		return nil, err
+	}
+
+	versionsEdge := "versions (" + listOrder(options.OrderBy, options.Descending, options.PageSize) + ") @filter(" + list.filterExpression() + ") " + facetFilter + " @facets(weight: weight)"
+
+	query := list.header() + ` {
+		  package(func: eq(dgraph.type, "Package")) @filter(eq(name, $packageName) AND NOT has(deleted_at)) {
+			uid
+			` + versionsEdge + ` {
+				uid
+				name
+				manifest_url
+				manifest_sha256` + versionLabelFields + `
+				created_at
+				updated_at
+			}
+		  }
+		}`
+
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewReadOnlyTxn()
+
+	request := &api.Request{
+		Query: query,
+		Vars:  list.vars,
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	if !gjson.GetBytes(requestResult.Json, "package.0").Exists() {
+		return nil, errors.Wrapf(ErrPackageNotFound, "package %s", packageName)
+	}
+
+	var versions []*VersionDetails
+	gjson.GetBytes(requestResult.Json, "package.0.versions").ForEach(func(key, value gjson.Result) bool {
+		versions = append(versions, parseVersionDetails(value))
+
+		return true
+	})
+
+	page := &VersionPage{
+		Versions: versions,
+	}
+
+	if options.PageSize > 0 && uint(len(versions)) > options.PageSize {
+		page.Versions = versions[:options.PageSize]
+		last := page.Versions[len(page.Versions)-1]
+		page.NextPageToken = newPageCursor(options.OrderBy, last.Version.GetName(), last.CreatedAt, last.Version.GetWeight()).token()
+	}
+
+	return page, nil
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/dgraph-io/dgo/v210"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+func (r *DgraphRepository) GetManifestPin(ctx context.Context, packageName, versionName string) (*ManifestPin, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := r.queryManifestPin(ctx, dgraphClient.NewReadOnlyTxn(), packageName, versionName, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !version.Get("manifest_sha256").Exists() {
+		return nil, nil
+	}
+
+	pin := &ManifestPin{
+		SHA256: version.Get("manifest_sha256").String(),
+	}
+
+	if body := version.Get("manifest_body"); body.Exists() {
+		pin.Body = []byte(body.String())
+	}
+
+	return pin, nil
+}
+
+// checkManifestUnpinned fails with ErrPrecondition when manifestUrl would
+// change the manifest URL of a pinned version.
+func (r *DgraphRepository) checkManifestUnpinned(ctx context.Context, txn *dgo.Txn, packageName, versionName, manifestUrl string) error {
+	version, err := r.queryManifestPin(ctx, txn, packageName, versionName, false)
+	if err != nil {
+		return err
+	}
+
+	if version.Get("manifest_sha256").Exists() && version.Get("manifest_url").String() != manifestUrl {
+		return errors.Wrapf(ErrPrecondition, "manifest of version %s of package %s is pinned", versionName, packageName)
+	}
+
+	return nil
+}
+
+func (r *DgraphRepository) queryManifestPin(ctx context.Context, txn *dgo.Txn, packageName, versionName string, withBody bool) (gjson.Result, error) {
+	body := ""
+	if withBody {
+		body = "manifest_body"
+	}
+
+	query := `query q($packageName: string, $versionName: string) {
+		  package(func: eq(name, $packageName)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)){
+			uid
+			versions @filter(eq(name, $versionName) AND NOT has(deleted_at)) {
+				uid
+				manifest_url
+				manifest_sha256
+				` + body + `
+			}
+		  }
+		}`
+
+	request := &api.Request{
+		Query: query,
+		Vars: map[string]string{
+			"$packageName": packageName,
+			"$versionName": versionName,
+		},
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return gjson.Result{}, dgraphError(err, "failed to query data")
+	}
+
+	if !gjson.GetBytes(requestResult.Json, "package.0").Exists() {
+		return gjson.Result{}, errors.Wrapf(ErrPackageNotFound, "package %s", packageName)
+	}
+
+	version := gjson.GetBytes(requestResult.Json, "package.0.versions.0")
+	if !version.Exists() {
+		return gjson.Result{}, errors.Wrapf(ErrVersionNotFound, "version %s of package %s", versionName, packageName)
+	}
+
+	return version, nil
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"sort"
+
+	"github.com/tidwall/gjson"
+)
+
+// packageMetadataFields reads the PackageMetadata of a package node.
+const packageMetadataFields = `
+			package_description
+			package_repository_url
+			package_homepage_url
+			package_icon_url
+			package_tags
+			package_owners`
+
+// metadataPredicates maps the metadata keys of updatedFields to their
+// predicates.
+var metadataPredicates = map[string]string{
+	DescriptionField:   "package_description",
+	RepositoryUrlField: "package_repository_url",
+	HomepageUrlField:   "package_homepage_url",
+	IconUrlField:       "package_icon_url",
+	TagsField:          "package_tags",
+	OwnersField:        "package_owners",
+}
+
+func parsePackageMetadata(value gjson.Result) PackageMetadata {
+	metadata := PackageMetadata{
+		Description:   value.Get("package_description").String(),
+		RepositoryUrl: value.Get("package_repository_url").String(),
+		HomepageUrl:   value.Get("package_homepage_url").String(),
+		IconUrl:       value.Get("package_icon_url").String(),
+	}
+
+	for path, values := range map[string]*[]string{
+		"package_tags":   &metadata.Tags,
+		"package_owners": &metadata.Owners,
+	} {
+		value.Get(path).ForEach(func(key, item gjson.Result) bool {
+			*values = append(*values, item.String())
+
+			return true
+		})
+	}
+
+	// Dgraph does not keep the order of list values.
+	sort.Strings(metadata.Tags)
+	sort.Strings(metadata.Owners)
+
+	return metadata
+}
+
+// setPackageMetadata adds the predicates of metadata to the mutation of a new
+// package node.
+func setPackageMetadata(node map[string]interface{}, metadata PackageMetadata) {
+	node["package_description"] = metadata.Description
+	node["package_repository_url"] = metadata.RepositoryUrl
+	node["package_homepage_url"] = metadata.HomepageUrl
+	node["package_icon_url"] = metadata.IconUrl
+	node["package_tags"] = metadata.Tags
+	node["package_owners"] = metadata.Owners
+}
+
+// packageMetadataUpdate adds the metadata found in updatedFields to the
+// update of a package node. The list predicates it returns must be deleted
+// before the update, setting a list predicate adds to its values.
+func packageMetadataUpdate(update map[string]interface{}, updatedFields map[string]interface{}) []string {
+	var lists []string
+	for key, predicate := range metadataPredicates {
+		value, ok := updatedFields[key]
+		if !ok {
+			continue
+		}
+
+		update[predicate] = value
+		if _, ok := value.([]string); ok {
+			lists = append(lists, predicate)
+		}
+	}
+
+	return lists
+}
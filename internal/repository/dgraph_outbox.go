@@ -0,0 +1,348 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo/v210"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+)
+
+const outboxFields = `
+				uid
+				outbox_id
+				outbox_sequence
+				outbox_type
+				outbox_package
+				outbox_version
+				outbox_channel
+				outbox_state
+				outbox_previous_weight
+				outbox_actor
+				outbox_delivered_at
+				created_at`
+
+// outboxState is the JSON stored in outbox_state.
+type outboxState struct {
+	Package *polvo_v1.Package `json:"package,omitempty"`
+	Version *polvo_v1.Version `json:"version,omitempty"`
+	Channel *Channel          `json:"channel,omitempty"`
+}
+
+// outboxCounterQuery reads the node counting the outbox events. The counter
+// is the only node every change writes, so that concurrent changes conflict
+// and the sequences of their events follow the order of their commits.
+const outboxCounterQuery = `{
+		  counter(func: eq(outbox_counter, "outbox")) {
+			uid
+			outbox_counter_sequence
+		  }
+		}`
+
+// outboxMutation numbers events after the counter read in txn, and returns
+// the mutation writing them and the counter, with the condition cond. Adding
+// it to the request or transaction of a change commits the events with the
+// change, a concurrent change aborts one of the commits, see retryAborted.
+// The mutation is nil when there is no event, nil events are skipped.
+func (r *DgraphRepository) outboxMutation(ctx context.Context, txn *dgo.Txn, cond string, events ...*OutboxEvent) (*api.Mutation, error) {
+	var written []*OutboxEvent
+	for _, event := range events {
+		if event != nil {
+			written = append(written, event)
+		}
+	}
+
+	if len(written) == 0 {
+		return nil, nil
+	}
+
+	requestResult, err := txn.Do(ctx, &api.Request{Query: outboxCounterQuery})
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	counter := gjson.GetBytes(requestResult.Json, "counter.0")
+	sequence := counter.Get("outbox_counter_sequence").Uint()
+
+	nodes := []map[string]interface{}{}
+	for _, event := range written {
+		sequence++
+		event.Sequence = sequence
+
+		state, err := json.Marshal(outboxState{
+			Package: event.PackageState,
+			Version: event.VersionState,
+			Channel: event.ChannelState,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encode outbox event")
+		}
+
+		nodes = append(nodes, map[string]interface{}{
+			"uid":                    "_:outbox" + strconv.Itoa(len(nodes)),
+			"dgraph.type":            "OutboxEvent",
+			"outbox_id":              event.ID,
+			"outbox_sequence":        event.Sequence,
+			"outbox_type":            event.Type,
+			"outbox_package":         event.Package,
+			"outbox_version":         event.Version,
+			"outbox_channel":         event.Channel,
+			"outbox_state":           string(state),
+			"outbox_previous_weight": event.PreviousWeight,
+			"outbox_actor":           event.Actor,
+			"created_at":             event.CreatedAt.UTC().Format(auditTimeFormat),
+		})
+	}
+
+	counterUid := counter.Get("uid").String()
+	if counterUid == "" {
+		counterUid = "_:counter"
+	}
+
+	nodes = append(nodes, map[string]interface{}{
+		"uid":                     counterUid,
+		"dgraph.type":             "OutboxCounter",
+		"outbox_counter":          "outbox",
+		"outbox_counter_sequence": sequence,
+	})
+
+	setJson, err := json.Marshal(nodes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode mutation")
+	}
+
+	return &api.Mutation{SetJson: setJson, Cond: cond}, nil
+}
+
+// writeEvents adds events to txn, to be committed with the change they
+// report.
+func (r *DgraphRepository) writeEvents(ctx context.Context, txn *dgo.Txn, events ...*OutboxEvent) error {
+	mutation, err := r.outboxMutation(ctx, txn, "", events...)
+	if err != nil || mutation == nil {
+		return err
+	}
+
+	if _, err := txn.Mutate(ctx, mutation); err != nil {
+		return dgraphError(err, "failed to mutate data")
+	}
+
+	return nil
+}
+
+func parseOutboxEvent(value gjson.Result) *OutboxEvent {
+	event := &OutboxEvent{
+		ID:             value.Get("outbox_id").String(),
+		Sequence:       value.Get("outbox_sequence").Uint(),
+		Type:           value.Get("outbox_type").String(),
+		Package:        value.Get("outbox_package").String(),
+		Version:        value.Get("outbox_version").String(),
+		Channel:        value.Get("outbox_channel").String(),
+		PreviousWeight: uint32(value.Get("outbox_previous_weight").Uint()),
+		Actor:          value.Get("outbox_actor").String(),
+		CreatedAt:      value.Get("created_at").Time(),
+		DeliveredAt:    value.Get("outbox_delivered_at").Time(),
+	}
+
+	var state outboxState
+	_ = json.Unmarshal([]byte(value.Get("outbox_state").String()), &state)
+	event.PackageState = state.Package
+	event.VersionState = state.Version
+	event.ChannelState = state.Channel
+
+	return event
+}
+
+func (r *DgraphRepository) ListPendingOutboxEvents(ctx context.Context, limit int) ([]*OutboxEvent, error) {
+	first := ""
+	if limit > 0 {
+		first = fmt.Sprintf(", first: %d", limit)
+	}
+
+	query := `{
+		  events(func: eq(dgraph.type, "OutboxEvent"), orderasc: outbox_sequence` + first + `) @filter(NOT has(outbox_delivered_at)) {` + outboxFields + `
+		  }
+		}`
+
+	return r.queryOutboxEvents(ctx, &api.Request{Query: query})
+}
+
+func (r *DgraphRepository) ListOutboxEvents(ctx context.Context, afterSequence uint64, limit int) ([]*OutboxEvent, error) {
+	first := ""
+	if limit > 0 {
+		first = fmt.Sprintf(", first: %d", limit)
+	}
+
+	request := &api.Request{
+		Query: `query q($afterSequence: int) {
+		  events(func: gt(outbox_sequence, $afterSequence), orderasc: outbox_sequence` + first + `) @filter(eq(dgraph.type, "OutboxEvent")) {` + outboxFields + `
+		  }
+		}`,
+		Vars: map[string]string{
+			"$afterSequence": strconv.FormatUint(afterSequence, 10),
+		},
+	}
+
+	return r.queryOutboxEvents(ctx, request)
+}
+
+func (r *DgraphRepository) queryOutboxEvents(ctx context.Context, request *api.Request) ([]*OutboxEvent, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	requestResult, err := dgraphClient.NewReadOnlyTxn().Do(ctx, request)
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	var events []*OutboxEvent
+	gjson.GetBytes(requestResult.Json, "events").ForEach(func(key, value gjson.Result) bool {
+		events = append(events, parseOutboxEvent(value))
+
+		return true
+	})
+
+	return events, nil
+}
+
+func (r *DgraphRepository) LatestOutboxSequence(ctx context.Context) (uint64, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return 0, err
+	}
+
+	requestResult, err := dgraphClient.NewReadOnlyTxn().Do(ctx, &api.Request{Query: outboxCounterQuery})
+	if err != nil {
+		return 0, dgraphError(err, "failed to query data")
+	}
+
+	return gjson.GetBytes(requestResult.Json, "counter.0.outbox_counter_sequence").Uint(), nil
+}
+
+// MarkOutboxEventsDelivered queries every event in its own block, block i
+// reading the event with the id $id<i>, and marks the ones found.
+func (r *DgraphRepository) MarkOutboxEventsDelivered(ctx context.Context, ids []string, deliveredAt time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var variables, blocks []string
+	vars := map[string]string{}
+	for i, id := range ids {
+		name := "$id" + strconv.Itoa(i)
+		variables = append(variables, name+": string")
+		vars[name] = id
+
+		blocks = append(blocks, `
+		  e`+strconv.Itoa(i)+`(func: eq(outbox_id, `+name+`)) @filter(NOT has(outbox_delivered_at)) {
+			uid
+		  }`)
+	}
+
+	query := `query q(` + strings.Join(variables, ", ") + `) {` + strings.Join(blocks, "") + `
+		}`
+
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return err
+	}
+
+	txn := dgraphClient.NewTxn()
+	defer txn.Discard(ctx)
+
+	requestResult, err := txn.Do(ctx, &api.Request{Query: query, Vars: vars})
+	if err != nil {
+		return dgraphError(err, "failed to query data")
+	}
+
+	var updates []map[string]interface{}
+	for i := range ids {
+		gjson.GetBytes(requestResult.Json, "e"+strconv.Itoa(i)+".#.uid").ForEach(func(key, uid gjson.Result) bool {
+			updates = append(updates, map[string]interface{}{
+				"uid":                 uid.String(),
+				"outbox_delivered_at": deliveredAt.UTC().Format(auditTimeFormat),
+			})
+
+			return true
+		})
+	}
+
+	if len(updates) == 0 {
+		return nil
+	}
+
+	setJson, err := json.Marshal(updates)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode mutation")
+	}
+
+	if _, err := txn.Mutate(ctx, &api.Mutation{SetJson: setJson}); err != nil {
+		return dgraphError(err, "failed to mutate data")
+	}
+
+	if err := txn.Commit(ctx); err != nil {
+		return dgraphError(err, "failed to commit data")
+	}
+
+	return nil
+}
+
+func (r *DgraphRepository) PurgeOutboxEvents(ctx context.Context, deliveredBefore time.Time) (int, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return 0, err
+	}
+
+	txn := dgraphClient.NewTxn()
+	defer txn.Discard(ctx)
+
+	request := &api.Request{
+		Query: `query q($deliveredBefore: string) {
+					events(func: lt(outbox_delivered_at, $deliveredBefore)) {
+						uid
+					}
+				}`,
+		Vars: map[string]string{
+			"$deliveredBefore": deliveredBefore.UTC().Format(auditTimeFormat),
+		},
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return 0, dgraphError(err, "failed to query data")
+	}
+
+	var deletions []map[string]interface{}
+	gjson.GetBytes(requestResult.Json, "events.#.uid").ForEach(func(key, uid gjson.Result) bool {
+		deletions = append(deletions, map[string]interface{}{"uid": uid.String()})
+
+		return true
+	})
+
+	if len(deletions) == 0 {
+		return 0, nil
+	}
+
+	deleteJson, err := json.Marshal(deletions)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to encode mutation")
+	}
+
+	if _, err := txn.Mutate(ctx, &api.Mutation{DeleteJson: deleteJson}); err != nil {
+		return 0, dgraphError(err, "failed to mutate data")
+	}
+
+	if err := txn.Commit(ctx); err != nil {
+		return 0, dgraphError(err, "failed to commit data")
+	}
+
+	return len(deletions), nil
+}
@@ -0,0 +1,368 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/dgraph-io/dgo/v210"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+const rolloutFields = `
+				uid
+				rollout_id
+				rollout_package
+				rollout_version
+				rollout_steps
+				rollout_baseline
+				rollout_state
+				rollout_step
+				rollout_next_step_at
+				rollout_paused_at
+				revision
+				created_at
+				updated_at`
+
+// rolloutJson encodes the fields of a rollout that change over its life. Steps
+// and baseline are kept as JSON strings.
+func rolloutJson(uid string, rollout *Rollout) (map[string]interface{}, error) {
+	steps, err := json.Marshal(rollout.Steps)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode rollout steps")
+	}
+
+	baseline, err := json.Marshal(rollout.Baseline)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode rollout baseline")
+	}
+
+	fields := map[string]interface{}{
+		"uid":              uid,
+		"rollout_steps":    string(steps),
+		"rollout_baseline": string(baseline),
+		"rollout_state":    string(rollout.State),
+		"rollout_step":     rollout.Step,
+		"revision":         rollout.Revision,
+		"updated_at":       rollout.UpdatedAt.Format(time.RFC3339),
+	}
+
+	for predicate, value := range map[string]time.Time{
+		"rollout_next_step_at": rollout.NextStepAt,
+		"rollout_paused_at":    rollout.PausedAt,
+	} {
+		if !value.IsZero() {
+			fields[predicate] = value.Format(time.RFC3339)
+		}
+	}
+
+	return fields, nil
+}
+
+func parseRollout(value gjson.Result) (*Rollout, error) {
+	rollout := &Rollout{
+		ID:         value.Get("rollout_id").String(),
+		Package:    value.Get("rollout_package").String(),
+		Version:    value.Get("rollout_version").String(),
+		State:      RolloutState(value.Get("rollout_state").String()),
+		Step:       int(value.Get("rollout_step").Int()),
+		NextStepAt: value.Get("rollout_next_step_at").Time(),
+		PausedAt:   value.Get("rollout_paused_at").Time(),
+		Revision:   value.Get("revision").Int(),
+		CreatedAt:  value.Get("created_at").Time(),
+		UpdatedAt:  value.Get("updated_at").Time(),
+	}
+
+	if err := json.Unmarshal([]byte(value.Get("rollout_steps").String()), &rollout.Steps); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode steps of rollout %s", rollout.ID)
+	}
+
+	if err := json.Unmarshal([]byte(value.Get("rollout_baseline").String()), &rollout.Baseline); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode baseline of rollout %s", rollout.ID)
+	}
+
+	return rollout, nil
+}
+
+func parseRollouts(value gjson.Result) ([]*Rollout, error) {
+	var rollouts []*Rollout
+	var parseErr error
+
+	value.ForEach(func(key, value gjson.Result) bool {
+		rollout, err := parseRollout(value)
+		if err != nil {
+			parseErr = err
+			return false
+		}
+
+		rollouts = append(rollouts, rollout)
+
+		return true
+	})
+
+	return rollouts, parseErr
+}
+
+// CreateRollout checks for an active rollout and writes the new one in the same
+// transaction. The start time of the latest rollout is written to the package,
+// so that concurrent creations for the same package conflict.
+func (r *DgraphRepository) CreateRollout(ctx context.Context, rollout *Rollout) (*Rollout, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewTxn()
+	defer txn.Discard(ctx)
+
+	request := &api.Request{
+		Query: `query q($packageName: string) {
+					package(func: eq(name, $packageName)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)) {
+						uid
+					}
+					active(func: eq(rollout_package, $packageName)) @filter(eq(rollout_state, "running") OR eq(rollout_state, "paused")) {
+						rollout_id
+					}
+				}`,
+		Vars: map[string]string{
+			"$packageName": rollout.Package,
+		},
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	packageUid := gjson.GetBytes(requestResult.Json, "package.0.uid")
+	if !packageUid.Exists() {
+		return nil, errors.Wrapf(ErrPackageNotFound, "package %s", rollout.Package)
+	}
+
+	if active := gjson.GetBytes(requestResult.Json, "active.0.rollout_id"); active.Exists() {
+		return nil, errors.Wrapf(ErrAlreadyExists, "active rollout %s of package %s", active.String(), rollout.Package)
+	}
+
+	now := time.Now()
+	saved := copyRollout(rollout)
+	saved.ID = newID()
+	saved.Revision = 1
+	saved.CreatedAt = now
+	saved.UpdatedAt = now
+
+	fields, err := rolloutJson("_:rollout", saved)
+	if err != nil {
+		return nil, err
+	}
+
+	fields["dgraph.type"] = "Rollout"
+	fields["rollout_id"] = saved.ID
+	fields["rollout_package"] = saved.Package
+	fields["rollout_version"] = saved.Version
+	fields["created_at"] = now.Format(time.RFC3339)
+
+	setJson, err := json.Marshal(map[string]interface{}{
+		"uid":                packageUid.String(),
+		"rollout_started_at": now.Format(time.RFC3339),
+		"rollouts":           fields,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode mutation")
+	}
+
+	if _, err := txn.Mutate(ctx, &api.Mutation{SetJson: setJson}); err != nil {
+		return nil, dgraphError(err, "failed to mutate data")
+	}
+
+	if err := r.writeAudit(ctx, txn, saved); err != nil {
+		return nil, err
+	}
+
+	if err := txn.Commit(ctx); err != nil {
+		return nil, dgraphError(err, "failed to commit data")
+	}
+
+	return saved, nil
+}
+
+func (r *DgraphRepository) GetRollout(ctx context.Context, id string) (*Rollout, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := r.queryRollout(ctx, dgraphClient.NewReadOnlyTxn(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRollout(value)
+}
+
+func (r *DgraphRepository) ListRollouts(ctx context.Context, packageName string) ([]*Rollout, error) {
+	query := `query q($packageName: string) {
+		  package(func: eq(name, $packageName)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)){
+			uid
+			rollouts (orderdesc: created_at) {` + rolloutFields + `
+			}
+		  }
+		}`
+
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewReadOnlyTxn()
+
+	request := &api.Request{
+		Query: query,
+		Vars: map[string]string{
+			"$packageName": packageName,
+		},
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	if !gjson.GetBytes(requestResult.Json, "package.0").Exists() {
+		return nil, errors.Wrapf(ErrPackageNotFound, "package %s", packageName)
+	}
+
+	return parseRollouts(gjson.GetBytes(requestResult.Json, "package.0.rollouts"))
+}
+
+func (r *DgraphRepository) ListDueRollouts(ctx context.Context, now time.Time) ([]*Rollout, error) {
+	query := `query q($now: string) {
+		  rollouts(func: eq(rollout_state, "running")) @filter(le(rollout_next_step_at, $now)) {` + rolloutFields + `
+		  }
+		}`
+
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewReadOnlyTxn()
+
+	request := &api.Request{
+		Query: query,
+		Vars: map[string]string{
+			"$now": now.Format(time.RFC3339),
+		},
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	return parseRollouts(gjson.GetBytes(requestResult.Json, "rollouts"))
+}
+
+// UpdateRollout reads the rollout inside the transaction and writes its
+// revision, so that concurrent updates of the same rollout conflict.
+func (r *DgraphRepository) UpdateRollout(ctx context.Context, rollout *Rollout) (*Rollout, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewTxn()
+	defer txn.Discard(ctx)
+
+	current, err := r.queryRollout(ctx, txn, rollout.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.Get("revision").Int() != rollout.Revision {
+		return nil, errors.Wrapf(ErrConflict, "rollout %s was changed since revision %d", rollout.ID, rollout.Revision)
+	}
+
+	saved := copyRollout(rollout)
+	saved.Revision++
+	saved.UpdatedAt = time.Now()
+
+	fields, err := rolloutJson(current.Get("uid").String(), saved)
+	if err != nil {
+		return nil, err
+	}
+
+	mutation := &api.Mutation{}
+
+	// Times that were cleared are deleted, since they are only set when they
+	// are not zero.
+	var cleared []string
+	if saved.NextStepAt.IsZero() {
+		cleared = append(cleared, "rollout_next_step_at")
+	}
+	if saved.PausedAt.IsZero() {
+		cleared = append(cleared, "rollout_paused_at")
+	}
+
+	if len(cleared) > 0 {
+		deletion := map[string]interface{}{"uid": current.Get("uid").String()}
+		for _, predicate := range cleared {
+			deletion[predicate] = nil
+		}
+
+		deleteJson, err := json.Marshal(deletion)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encode mutation")
+		}
+
+		mutation.DeleteJson = deleteJson
+	}
+
+	setJson, err := json.Marshal(fields)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode mutation")
+	}
+
+	mutation.SetJson = setJson
+
+	if _, err := txn.Mutate(ctx, mutation); err != nil {
+		return nil, dgraphError(err, "failed to mutate data")
+	}
+
+	if err := r.writeAudit(ctx, txn, saved); err != nil {
+		return nil, err
+	}
+
+	if err := txn.Commit(ctx); err != nil {
+		return nil, dgraphError(err, "failed to commit data")
+	}
+
+	return saved, nil
+}
+
+func (r *DgraphRepository) queryRollout(ctx context.Context, txn *dgo.Txn, id string) (gjson.Result, error) {
+	query := `query q($id: string) {
+		  rollout(func: eq(rollout_id, $id)) @filter(eq(dgraph.type, "Rollout")) {` + rolloutFields + `
+		  }
+		}`
+
+	request := &api.Request{
+		Query: query,
+		Vars: map[string]string{
+			"$id": id,
+		},
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return gjson.Result{}, dgraphError(err, "failed to query data")
+	}
+
+	rollout := gjson.GetBytes(requestResult.Json, "rollout.0")
+	if !rollout.Exists() {
+		return gjson.Result{}, errors.Wrapf(ErrRolloutNotFound, "rollout %s", id)
+	}
+
+	return rollout, nil
+}
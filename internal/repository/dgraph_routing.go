@@ -0,0 +1,364 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/dgo/v210"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+const routingRevisionFields = `
+				revision
+				routing_table
+				created_at`
+
+func parseRoutingRevision(value gjson.Result) (*RoutingRevision, error) {
+	revision := &RoutingRevision{
+		Revision:  value.Get("revision").Int(),
+		CreatedAt: value.Get("created_at").Time(),
+	}
+
+	if err := json.Unmarshal([]byte(value.Get("routing_table").String()), &revision.Entries); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode routing revision %d", revision.Revision)
+	}
+
+	return revision, nil
+}
+
+func (r *DgraphRepository) ListRoutingRevisions(ctx context.Context, packageName string) ([]*RoutingRevision, error) {
+	query := `query q($packageName: string) {
+		  package(func: eq(name, $packageName)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)){
+			uid
+			routing_revisions (orderdesc: revision) {` + routingRevisionFields + `
+			}
+		  }
+		}`
+
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewReadOnlyTxn()
+
+	request := &api.Request{
+		Query: query,
+		Vars: map[string]string{
+			"$packageName": packageName,
+		},
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	if !gjson.GetBytes(requestResult.Json, "package.0").Exists() {
+		return nil, errors.Wrapf(ErrPackageNotFound, "package %s", packageName)
+	}
+
+	var revisions []*RoutingRevision
+	var parseErr error
+	gjson.GetBytes(requestResult.Json, "package.0.routing_revisions").ForEach(func(key, value gjson.Result) bool {
+		revision, err := parseRoutingRevision(value)
+		if err != nil {
+			parseErr = err
+			return false
+		}
+
+		revisions = append(revisions, revision)
+
+		return true
+	})
+
+	return revisions, parseErr
+}
+
+func (r *DgraphRepository) RollbackPackage(ctx context.Context, packageName string, revision int64) (*RoutingRevision, error) {
+	var latest *RoutingRevision
+	err := retryAborted(ctx, func() (err error) {
+		latest, err = r.rollbackPackage(ctx, packageName, revision)
+		return err
+	})
+
+	return latest, err
+}
+
+// rollbackPackage is one attempt of RollbackPackage.
+func (r *DgraphRepository) rollbackPackage(ctx context.Context, packageName string, revision int64) (*RoutingRevision, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewTxn()
+	defer txn.Discard(ctx)
+
+	current, err := r.queryRouting(ctx, txn, packageName, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	target := current.Get("target.0")
+	if !target.Exists() {
+		return nil, errors.Wrapf(ErrPrecondition, "package %s has no routing revision %d", packageName, revision)
+	}
+
+	restored, err := parseRoutingRevision(target)
+	if err != nil {
+		return nil, err
+	}
+
+	versionUids := map[string]string{}
+	current.Get("versions").ForEach(func(key, value gjson.Result) bool {
+		versionUids[value.Get("name").String()] = value.Get("uid").String()
+
+		return true
+	})
+
+	entries := map[string]RoutingEntry{}
+	for _, entry := range restored.Entries {
+		if _, ok := versionUids[entry.Version]; !ok {
+			return nil, errors.Wrapf(ErrPrecondition, "version %s of routing revision %d of package %s is deleted", entry.Version, revision, packageName)
+		}
+
+		entries[entry.Version] = entry
+	}
+
+	return r.applyRouting(ctx, txn, packageName, current, entries)
+}
+
+func (r *DgraphRepository) SetPackageWeights(ctx context.Context, packageName string, weights map[string]uint32) (*RoutingRevision, error) {
+	var latest *RoutingRevision
+	err := retryAborted(ctx, func() (err error) {
+		latest, err = r.setPackageWeights(ctx, packageName, weights)
+		return err
+	})
+
+	return latest, err
+}
+
+// setPackageWeights is one attempt of SetPackageWeights.
+func (r *DgraphRepository) setPackageWeights(ctx context.Context, packageName string, weights map[string]uint32) (*RoutingRevision, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewTxn()
+	defer txn.Discard(ctx)
+
+	current, err := r.queryRouting(ctx, txn, packageName, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestUrls := map[string]string{}
+	current.Get("versions").ForEach(func(key, value gjson.Result) bool {
+		manifestUrls[value.Get("name").String()] = value.Get("manifest_url").String()
+
+		return true
+	})
+
+	entries := map[string]RoutingEntry{}
+	for name, weight := range weights {
+		manifestUrl, ok := manifestUrls[name]
+		if !ok {
+			return nil, errors.Wrapf(ErrVersionNotFound, "version %s of package %s", name, packageName)
+		}
+
+		entries[name] = RoutingEntry{
+			Version:     name,
+			ManifestUrl: manifestUrl,
+			Weight:      weight,
+		}
+	}
+
+	return r.applyRouting(ctx, txn, packageName, current, entries)
+}
+
+// applyRouting sets the manifest and weight of every live version found by
+// queryRouting from entries, versions without an entry get no weight. The
+// routing state before and after is recorded with the events of the change,
+// and txn is committed.
+func (r *DgraphRepository) applyRouting(ctx context.Context, txn *dgo.Txn, packageName string, current gjson.Result, entries map[string]RoutingEntry) (*RoutingRevision, error) {
+	previous, err := r.recordRoutingRevision(ctx, txn, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var versions []map[string]interface{}
+	current.Get("versions").ForEach(func(key, value gjson.Result) bool {
+		entry, ok := entries[value.Get("name").String()]
+		if !ok {
+			entry = RoutingEntry{ManifestUrl: value.Get("manifest_url").String()}
+		}
+
+		if entry.ManifestUrl == value.Get("manifest_url").String() && uint64(entry.Weight) == value.Get("weight").Uint() {
+			return true
+		}
+
+		versions = append(versions, map[string]interface{}{
+			"uid":             value.Get("uid").String(),
+			"manifest_url":    entry.ManifestUrl,
+			"updated_at":      now.Format(time.RFC3339),
+			"versions|weight": entry.Weight,
+			"version_weight":  entry.Weight,
+		})
+
+		return true
+	})
+
+	if len(versions) > 0 {
+		setJson, err := json.Marshal(map[string]interface{}{
+			"uid":      current.Get("uid").String(),
+			"versions": versions,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encode mutation")
+		}
+
+		if _, err := txn.Mutate(ctx, &api.Mutation{SetJson: setJson}); err != nil {
+			return nil, dgraphError(err, "failed to mutate data")
+		}
+	}
+
+	latest, err := r.recordRoutingRevision(ctx, txn, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.writeEvents(ctx, txn, newRoutingEvents(ctx, packageName, previous, latest, now)...); err != nil {
+		return nil, err
+	}
+
+	if latest == nil {
+		latest = &RoutingRevision{}
+	}
+
+	if err := r.writeAudit(ctx, txn, latest); err != nil {
+		return nil, err
+	}
+
+	if err := txn.Commit(ctx); err != nil {
+		return nil, dgraphError(err, "failed to commit data")
+	}
+
+	return latest, nil
+}
+
+// queryRouting reads the live versions of the package with their weights, its
+// latest routing revision and, when revision is not 0, that revision inside
+// txn, so that the routing state written from the result conflicts with any
+// concurrent change.
+func (r *DgraphRepository) queryRouting(ctx context.Context, txn *dgo.Txn, packageName string, revision int64) (gjson.Result, error) {
+	query := `query q($packageName: string, $revision: int) {
+		  package(func: eq(name, $packageName)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)){
+			uid
+			routing_revision
+			versions @filter(NOT has(deleted_at)) @facets(weight: weight) {
+				uid
+				name
+				manifest_url
+			}
+			latest: routing_revisions (orderdesc: revision, first: 1) {` + routingRevisionFields + `
+			}
+			target: routing_revisions @filter(eq(revision, $revision)) {` + routingRevisionFields + `
+			}
+		  }
+		}`
+
+	request := &api.Request{
+		Query: query,
+		Vars: map[string]string{
+			"$packageName": packageName,
+			"$revision":    strconv.FormatInt(revision, 10),
+		},
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return gjson.Result{}, dgraphError(err, "failed to query data")
+	}
+
+	result := gjson.GetBytes(requestResult.Json, "package.0")
+	if !result.Exists() {
+		return gjson.Result{}, errors.Wrapf(ErrPackageNotFound, "package %s", packageName)
+	}
+
+	return result, nil
+}
+
+// recordRoutingRevision adds the routing state of the package, as seen inside
+// txn, as a new revision unless it is the same as the latest one, and returns
+// the latest revision. The revision counter of the package is written with it,
+// so concurrent recordings of the same package conflict.
+func (r *DgraphRepository) recordRoutingRevision(ctx context.Context, txn *dgo.Txn, packageName string) (*RoutingRevision, error) {
+	current, err := r.queryRouting(ctx, txn, packageName, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *RoutingRevision
+	if value := current.Get("latest.0"); value.Exists() {
+		latest, err = parseRoutingRevision(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []RoutingEntry
+	current.Get("versions").ForEach(func(key, value gjson.Result) bool {
+		version := parseVersionDetails(value).Version
+		entries = append(entries, RoutingEntry{
+			Version:     version.GetName(),
+			ManifestUrl: version.GetManifestUrl(),
+			Weight:      version.GetWeight(),
+		})
+
+		return true
+	})
+	sortRoutingEntries(entries)
+
+	if !isRoutingChanged(latest, entries) {
+		return latest, nil
+	}
+
+	routingTable, err := json.Marshal(entries)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode routing table")
+	}
+
+	revision := &RoutingRevision{
+		Revision:  current.Get("routing_revision").Int() + 1,
+		Entries:   entries,
+		CreatedAt: time.Now(),
+	}
+
+	setJson, err := json.Marshal(map[string]interface{}{
+		"uid":              current.Get("uid").String(),
+		"routing_revision": revision.Revision,
+		"routing_revisions": map[string]interface{}{
+			"uid":           "_:revision",
+			"dgraph.type":   "RoutingRevision",
+			"revision":      revision.Revision,
+			"routing_table": string(routingTable),
+			"created_at":    revision.CreatedAt.Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode mutation")
+	}
+
+	if _, err := txn.Mutate(ctx, &api.Mutation{SetJson: setJson}); err != nil {
+		return nil, dgraphError(err, "failed to mutate data")
+	}
+
+	return revision, nil
+}
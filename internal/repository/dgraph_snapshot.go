@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/tidwall/gjson"
+)
+
+// GetPackageSnapshots queries every package in its own block of a single
+// query, block i reading the package named by $name<i>.
+func (r *DgraphRepository) GetPackageSnapshots(ctx context.Context, packageNames []string) (map[string]*PackageSnapshot, error) {
+	snapshots := map[string]*PackageSnapshot{}
+	if len(packageNames) == 0 {
+		return snapshots, nil
+	}
+
+	var variables, blocks []string
+	vars := map[string]string{}
+	for i, packageName := range packageNames {
+		name := "$name" + strconv.Itoa(i)
+		variables = append(variables, name+": string")
+		vars[name] = packageName
+
+		blocks = append(blocks, `
+		  p`+strconv.Itoa(i)+`(func: eq(name, `+name+`)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)){
+			uid
+			name
+			maintainer
+			versions (orderasc: created_at) @filter(NOT has(deleted_at)) @facets(weight: weight) {
+				uid
+				name
+				manifest_url
+				manifest_sha256`+versionLabelFields+`
+				created_at
+				updated_at
+			}
+			channels {`+channelFields+`
+			}
+		  }`)
+	}
+
+	query := `query q(` + strings.Join(variables, ", ") + `) {` + strings.Join(blocks, "") + `
+		}`
+
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewReadOnlyTxn()
+
+	request := &api.Request{
+		Query: query,
+		Vars:  vars,
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	for i, packageName := range packageNames {
+		value := gjson.GetBytes(requestResult.Json, "p"+strconv.Itoa(i)+".0")
+		if !value.Exists() {
+			continue
+		}
+
+		snapshot := &PackageSnapshot{
+			Package: parsePackageDetails(value).Package,
+		}
+
+		value.Get("versions").ForEach(func(key, version gjson.Result) bool {
+			snapshot.Versions = append(snapshot.Versions, parseVersionDetails(version))
+
+			return true
+		})
+		sortSnapshotVersions(snapshot.Versions)
+
+		value.Get("channels").ForEach(func(key, channel gjson.Result) bool {
+			snapshot.Channels = append(snapshot.Channels, parseChannel(channel))
+
+			return true
+		})
+
+		snapshots[packageName] = snapshot
+	}
+
+	return snapshots, nil
+}
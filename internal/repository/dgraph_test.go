@@ -0,0 +1,634 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/dgo/v210"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/labels"
+)
+
+// recordingDgraphClient is an api.DgraphClient that keeps every request and
+// answers them with respond.
+type recordingDgraphClient struct {
+	requests []*api.Request
+	respond  func(request *api.Request) *api.Response
+}
+
+func (c *recordingDgraphClient) Login(ctx context.Context, in *api.LoginRequest, opts ...grpc.CallOption) (*api.Response, error) {
+	return &api.Response{}, nil
+}
+
+func (c *recordingDgraphClient) Query(ctx context.Context, in *api.Request, opts ...grpc.CallOption) (*api.Response, error) {
+	c.requests = append(c.requests, in)
+
+	return c.respond(in), nil
+}
+
+func (c *recordingDgraphClient) Alter(ctx context.Context, in *api.Operation, opts ...grpc.CallOption) (*api.Payload, error) {
+	return &api.Payload{}, nil
+}
+
+func (c *recordingDgraphClient) CommitOrAbort(ctx context.Context, in *api.TxnContext, opts ...grpc.CallOption) (*api.TxnContext, error) {
+	return in, nil
+}
+
+func (c *recordingDgraphClient) CheckVersion(ctx context.Context, in *api.Check, opts ...grpc.CallOption) (*api.Version, error) {
+	return &api.Version{}, nil
+}
+
+func respondEmpty(request *api.Request) *api.Response {
+	return &api.Response{Json: []byte(`{}`)}
+}
+
+var queryBlockPattern = regexp.MustCompile(`(\w+)\s*\(\s*func:`)
+
+// respondFound answers every named block of the query with one node, and
+// every mutation with new uids, so that the methods go on to their writes.
+func respondFound(request *api.Request) *api.Response {
+	result := map[string]interface{}{}
+	for _, match := range queryBlockPattern.FindAllStringSubmatch(request.Query, -1) {
+		if match[1] != "var" {
+			result[match[1]] = []map[string]interface{}{{"uid": "0x1", "name": "found", "revision": 1}}
+		}
+	}
+
+	data, _ := json.Marshal(result)
+	response := &api.Response{Json: data}
+	if len(request.Mutations) > 0 {
+		response.Uids = map[string]string{"new": "0x2"}
+	}
+
+	return response
+}
+
+func newTestDgraphRepository(respond func(request *api.Request) *api.Response) (*DgraphRepository, *recordingDgraphClient) {
+	client := &recordingDgraphClient{respond: respond}
+
+	return &DgraphRepository{dgraphClient: dgo.NewDgraphClient(client)}, client
+}
+
+// checkParameterized fails when name is part of the text of a query, a
+// condition or N-Quads, instead of a variable or an encoded JSON value.
+func checkParameterized(t *testing.T, method, name string, requests []*api.Request) {
+	t.Helper()
+
+	for _, request := range requests {
+		if strings.Contains(request.Query, name) {
+			t.Errorf("%s(%q) put the name in the query:\n%s", method, name, request.Query)
+		}
+
+		for variable := range request.Vars {
+			if !strings.HasPrefix(variable, "$") || strings.Contains(variable, name) {
+				t.Errorf("%s(%q) has the variable %q", method, name, variable)
+			}
+		}
+
+		for _, mutation := range request.Mutations {
+			if strings.Contains(mutation.Cond, name) {
+				t.Errorf("%s(%q) put the name in the condition %s", method, name, mutation.Cond)
+			}
+
+			if len(mutation.SetNquads) > 0 || len(mutation.DelNquads) > 0 {
+				t.Errorf("%s(%q) mutates with N-Quads", method, name)
+			}
+
+			for _, data := range [][]byte{mutation.SetJson, mutation.DeleteJson} {
+				if len(data) > 0 && !json.Valid(data) {
+					t.Errorf("%s(%q) sent invalid JSON %s", method, name, data)
+				}
+			}
+		}
+	}
+}
+
+func TestDgraphRepositoryHostileNames(t *testing.T) {
+	ctx := context.Background()
+
+	for _, respond := range []func(request *api.Request) *api.Response{respondEmpty, respondFound} {
+		for _, name := range hostileNames {
+			for _, call := range repositoryCalls {
+				r, client := newTestDgraphRepository(respond)
+
+				_ = call.call(ctx, r, name)
+
+				if len(client.requests) == 0 {
+					t.Errorf("%s sent no request", call.method)
+				}
+
+				checkParameterized(t, call.method, name, client.requests)
+			}
+		}
+	}
+}
+
+// The hostile names reach the variables unchanged.
+func TestDgraphRepositoryPassesNamesAsVariables(t *testing.T) {
+	ctx := context.Background()
+
+	for _, name := range hostileNames {
+		r, client := newTestDgraphRepository(respondEmpty)
+
+		if _, err := r.GetVersion(ctx, name, name+"-version"); err == nil {
+			t.Errorf("GetVersion(%q) found a version in an empty graph", name)
+		}
+
+		request := client.requests[0]
+		if request.Vars["$packageName"] != name || request.Vars["$versionName"] != name+"-version" {
+			t.Errorf("GetVersion(%q) vars = %v", name, request.Vars)
+		}
+	}
+}
+
+
+func TestDgraphRepositoryNotFound(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestDgraphRepository(respondEmpty)
+
+	if _, err := r.GetPackage(ctx, "button"); !errors.Is(err, ErrPackageNotFound) {
+		t.Errorf("GetPackage in an empty graph = %v, want ErrPackageNotFound", err)
+	}
+
+	// The package is missing as well as the version.
+	if _, err := r.GetVersion(ctx, "button", "1.0.0"); !errors.Is(err, ErrPackageNotFound) {
+		t.Errorf("GetVersion in an empty graph = %v, want ErrPackageNotFound", err)
+	}
+
+	if _, err := r.CreateVersion(ctx, "button", &polvo_v1.Version{Name: "1.0.0"}, nil, nil); !errors.Is(err, ErrPackageNotFound) {
+		t.Errorf("CreateVersion in a missing package = %v, want ErrPackageNotFound", err)
+	}
+	// Deleting twice finds nothing live the second time.
+	r, client := newTestDgraphRepository(respondEmpty)
+
+	if err := r.DeletePackage(ctx, "button"); !errors.Is(err, ErrPackageNotFound) {
+		t.Errorf("DeletePackage in an empty graph = %v, want ErrPackageNotFound", err)
+	}
+
+	if err := r.DeleteVersion(ctx, "button", "1.0.0"); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("DeleteVersion in an empty graph = %v, want ErrVersionNotFound", err)
+	}
+
+	for _, request := range client.requests {
+		if len(request.Mutations) > 0 {
+			t.Errorf("a deletion of nothing sent the mutations %v", request.Mutations)
+		}
+	}
+}
+
+func TestUpdateVersionRenameToAnExistingName(t *testing.T) {
+	ctx := context.Background()
+
+	r, client := newTestDgraphRepository(func(request *api.Request) *api.Response {
+		if strings.Contains(request.Query, "existing(") {
+			return &api.Response{Json: []byte(`{"existing": [{"versions": [{"uid": "0x3"}]}]}`)}
+		}
+
+		return respondFound(request)
+	})
+
+	_, err := r.UpdateVersion(ctx, "button", "1.0.0", map[string]interface{}{"Name": "2.0.0"})
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Fatalf("UpdateVersion to the name of another version = %v, want ErrAlreadyExists", err)
+	}
+
+	var rename *api.Request
+	for _, request := range client.requests {
+		if strings.Contains(request.Query, "existing(") {
+			rename = request
+		}
+	}
+
+	// The name is checked in the same upsert as the write.
+	if rename == nil || rename.Vars["$updatedName"] != "2.0.0" || !strings.Contains(rename.Mutations[0].Cond, "eq(len(existingUid), 0)") {
+		t.Errorf("the rename is written by %+v", rename)
+	}
+}
+
+func TestListQueryFilters(t *testing.T) {
+	for _, name := range hostileNames {
+		q := newListQuery(`eq(dgraph.type, "Package")`)
+		q.namePrefixFilter(name)
+		if err := q.cursorFilter(OrderByCreatedAt, true, &pageCursor{Key: name, Name: name}); err != nil {
+			t.Fatalf("cursorFilter: %v", err)
+		}
+		q.filter("eq(maintainer, $maintainer)", "$maintainer", name)
+
+		expression := q.header() + q.filterExpression()
+		if strings.Contains(expression, name) {
+			t.Errorf("the filter contains %q:\n%s", name, expression)
+		}
+
+		for _, variable := range []string{"$namePrefix", "$afterKey", "$afterName", "$maintainer"} {
+			if !strings.Contains(q.header(), variable+": string") {
+				t.Errorf("the header does not declare %s: %s", variable, q.header())
+			}
+		}
+
+		if q.vars["$namePrefix"] != name || q.vars["$afterName"] != name || q.vars["$maintainer"] != name {
+			t.Errorf("vars = %v", q.vars)
+		}
+	}
+}
+
+func TestLabelSelectorFilter(t *testing.T) {
+	selector, err := labels.ParseSelector("env in (prod, staging), tier!=batch, canary, !legacy")
+	if err != nil {
+		t.Fatalf("ParseSelector: %v", err)
+	}
+
+	q := newListQuery()
+	q.labelSelectorFilter(selector)
+
+	want := "(eq(version_labels, $label0_0) OR eq(version_labels, $label0_1)) AND " +
+		"NOT (eq(version_labels, $label1_0)) AND " +
+		"eq(version_label_keys, $label2) AND " +
+		"NOT eq(version_label_keys, $label3)"
+	if got := q.filterExpression(); got != want {
+		t.Errorf("filter = %s, want %s", got, want)
+	}
+
+	wantVars := map[string]string{
+		"$label0_0": "env=prod",
+		"$label0_1": "env=staging",
+		"$label1_0": "tier=batch",
+		"$label2":   "canary",
+		"$label3":   "legacy",
+	}
+	for variable, value := range wantVars {
+		if q.vars[variable] != value {
+			t.Errorf("%s = %q, want %q", variable, q.vars[variable], value)
+		}
+	}
+}
+
+func TestUidQueriesOnlyUseVariables(t *testing.T) {
+	for _, deleted := range []bool{false, true} {
+		for _, query := range []string{packageUidQuery(deleted), versionUidQuery(deleted)} {
+			if !strings.Contains(query, "$name") && !strings.Contains(query, "$packageName") {
+				t.Errorf("the query has no name variable:\n%s", query)
+			}
+
+			if strings.Contains(query, `"`) && !strings.Contains(query, `"Package"`) {
+				t.Errorf("the query has a string literal other than the type:\n%s", query)
+			}
+		}
+	}
+}
+
+func TestListVersionDetailsOrdersByWeightInDgraph(t *testing.T) {
+	ctx := context.Background()
+	r, client := newTestDgraphRepository(func(request *api.Request) *api.Response {
+		return &api.Response{Json: []byte(`{"package": [{"uid": "0x1", "versions": [
+			{"name": "1.2.0", "weight": 20},
+			{"name": "1.1.0", "weight": 10},
+			{"name": "1.0.0", "weight": 10}
+		]}]}`)}
+	})
+
+	token := newPageCursor(OrderByWeight, "2.0.0", time.Time{}, 30).token()
+	page, err := r.ListVersionDetails(ctx, "button", ListVersionsOptions{PageSize: 2, PageToken: token})
+	if err != nil {
+		t.Fatalf("ListVersionDetails: %v", err)
+	}
+
+	request := client.requests[0]
+	for _, part := range []string{
+		"$afterKey: int",
+		"versions (orderdesc: version_weight, orderdesc: name, first: 3)",
+		"(lt(version_weight, $afterKey) OR (eq(version_weight, $afterKey) AND lt(name, $afterName)))",
+	} {
+		if !strings.Contains(request.Query, part) {
+			t.Errorf("the query does not contain %q:\n%s", part, request.Query)
+		}
+	}
+
+	if request.Vars["$afterKey"] != "30" || request.Vars["$afterName"] != "2.0.0" {
+		t.Errorf("vars = %v", request.Vars)
+	}
+
+	if len(page.Versions) != 2 || page.NextPageToken != newPageCursor(OrderByWeight, "1.1.0", time.Time{}, 10).token() {
+		t.Errorf("page = %d versions, next page token %q", len(page.Versions), page.NextPageToken)
+	}
+}
+
+func TestListVersionDetailsMalformedWeightToken(t *testing.T) {
+	r, _ := newTestDgraphRepository(respondEmpty)
+
+	token := pageCursor{Key: "heavy", Name: "1.0.0"}.token()
+	if _, err := r.ListVersionDetails(context.Background(), "button", ListVersionsOptions{PageToken: token}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("ListVersionDetails = %v, want ErrInvalidArgument", err)
+	}
+}
+
+func TestOutboxEventsAreNumberedWithTheCounter(t *testing.T) {
+	ctx := WithActor(context.Background(), "alice")
+	r, client := newTestDgraphRepository(func(request *api.Request) *api.Response {
+		if strings.Contains(request.Query, "outbox_counter") {
+			return &api.Response{Json: []byte(`{"counter": [{"uid": "0x9", "outbox_counter_sequence": 41}]}`)}
+		}
+
+		return &api.Response{Json: []byte(`{}`), Uids: map[string]string{"package": "0x2"}}
+	})
+
+	if _, err := r.CreatePackage(ctx, &polvo_v1.Package{Name: "button"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	var nodes []map[string]interface{}
+	for _, request := range client.requests {
+		for _, mutation := range request.Mutations {
+			if !strings.Contains(string(mutation.SetJson), "outbox_counter") {
+				continue
+			}
+
+			if mutation.Cond != "@if(eq(len(pkg), 0))" {
+				t.Errorf("the outbox is written with the condition %q", mutation.Cond)
+			}
+
+			if err := json.Unmarshal(mutation.SetJson, &nodes); err != nil {
+				t.Fatalf("the outbox mutation is not a list of nodes: %v", err)
+			}
+		}
+	}
+
+	if len(nodes) != 2 {
+		t.Fatalf("the outbox mutation = %v, want the event and the counter", nodes)
+	}
+
+	event, counter := nodes[0], nodes[1]
+	if event["outbox_sequence"] != float64(42) || event["outbox_actor"] != "alice" {
+		t.Errorf("event = %v, want the sequence 42 by alice", event)
+	}
+
+	if counter["uid"] != "0x9" || counter["outbox_counter_sequence"] != float64(42) {
+		t.Errorf("counter = %v, want 0x9 set to 42", counter)
+	}
+}
+
+// counterDgraphClient is an api.DgraphClient that aborts, like Dgraph, the
+// commit of a transaction that read the outbox counter before another one
+// updated it. The first reads of the counter wait for each other so that the
+// writers surely conflict.
+type counterDgraphClient struct {
+	recordingDgraphClient
+
+	mu        sync.Mutex
+	lastTs    uint64
+	version   int
+	sequence  int
+	reads     map[uint64]int
+	written   map[uint64][]int
+	committed []int
+	aborts    int
+
+	// barrier holds the first read of the counter of each writer.
+	barrier  sync.WaitGroup
+	blocking int
+}
+
+func newCounterDgraphClient(writers int) *counterDgraphClient {
+	client := &counterDgraphClient{reads: map[uint64]int{}, written: map[uint64][]int{}, blocking: writers}
+	client.barrier.Add(writers)
+
+	return client
+}
+
+func (c *counterDgraphClient) Query(ctx context.Context, in *api.Request, opts ...grpc.CallOption) (*api.Response, error) {
+	c.mu.Lock()
+	ts := in.StartTs
+	if ts == 0 {
+		c.lastTs++
+		ts = c.lastTs
+	}
+
+	response := &api.Response{Json: []byte(`{}`), Txn: &api.TxnContext{StartTs: ts}}
+	for _, mutation := range in.Mutations {
+		var nodes []map[string]interface{}
+		if json.Unmarshal(mutation.SetJson, &nodes) != nil {
+			continue
+		}
+
+		for _, node := range nodes {
+			if sequence, ok := node["outbox_sequence"].(float64); ok {
+				c.written[ts] = append(c.written[ts], int(sequence))
+			}
+		}
+	}
+
+	if len(in.Mutations) > 0 {
+		response.Uids = map[string]string{"package": "0x2"}
+	}
+
+	if !strings.Contains(in.Query, "outbox_counter") {
+		c.mu.Unlock()
+
+		return response, nil
+	}
+
+	first := c.blocking > 0
+	if first {
+		c.blocking--
+	}
+
+	c.reads[ts] = c.version
+	response.Json = []byte(fmt.Sprintf(`{"counter": [{"uid": "0x9", "outbox_counter_sequence": %d}]}`, c.sequence))
+	c.mu.Unlock()
+
+	if first {
+		c.barrier.Done()
+		c.barrier.Wait()
+	}
+
+	return response, nil
+}
+
+func (c *counterDgraphClient) CommitOrAbort(ctx context.Context, in *api.TxnContext, opts ...grpc.CallOption) (*api.TxnContext, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	read, ok := c.reads[in.StartTs]
+	if !ok {
+		return in, nil
+	}
+
+	if read != c.version {
+		c.aborts++
+
+		return nil, status.Error(codes.Aborted, "Transaction has been aborted. Please retry")
+	}
+
+	c.version++
+	c.sequence += len(c.written[in.StartTs])
+	c.committed = append(c.committed, c.written[in.StartTs]...)
+
+	return in, nil
+}
+
+func TestConcurrentWritesAreRetried(t *testing.T) {
+	const writers = 6
+
+	client := newCounterDgraphClient(writers)
+	r := &DgraphRepository{dgraphClient: dgo.NewDgraphClient(client)}
+
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		go func(i int) {
+			_, err := r.CreatePackage(context.Background(), &polvo_v1.Package{Name: fmt.Sprintf("package-%d", i)}, nil)
+			errs <- err
+		}(i)
+	}
+
+	for i := 0; i < writers; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("CreatePackage: %v", err)
+		}
+	}
+
+	if client.aborts == 0 {
+		t.Error("no commit was aborted, the writers did not conflict")
+	}
+
+	seen := map[int]bool{}
+	for _, sequence := range client.committed {
+		if seen[sequence] {
+			t.Errorf("the sequence %d is committed twice", sequence)
+		}
+
+		seen[sequence] = true
+	}
+
+	if len(seen) != writers {
+		t.Errorf("committed sequences = %v, want %d events", client.committed, writers)
+	}
+}
+
+func TestListOutboxEventsAfterSequence(t *testing.T) {
+	r, client := newTestDgraphRepository(func(request *api.Request) *api.Response {
+		return &api.Response{Json: []byte(`{"events": [{"outbox_id": "b", "outbox_sequence": 8}]}`)}
+	})
+
+	events, err := r.ListOutboxEvents(context.Background(), 7, 100)
+	if err != nil {
+		t.Fatalf("ListOutboxEvents: %v", err)
+	}
+
+	request := client.requests[0]
+	if request.Vars["$afterSequence"] != "7" || !strings.Contains(request.Query, "gt(outbox_sequence, $afterSequence), orderasc: outbox_sequence, first: 100") {
+		t.Errorf("ListOutboxEvents sent %s with %v", request.Query, request.Vars)
+	}
+
+	if len(events) != 1 || events[0].ID != "b" || events[0].Sequence != 8 {
+		t.Errorf("ListOutboxEvents = %+v", events)
+	}
+}
+
+func TestAuditIsWrittenWithTheChange(t *testing.T) {
+	auditCtx := WithAudit(context.Background(), &Audit{
+		Event: &AuditEvent{Actor: "alice", Method: "CreatePackage", Orn: "packages/button", Package: "button", Time: time.Now()},
+		Complete: func(event *AuditEvent, saved interface{}) {
+			event.After = map[string]interface{}{"name": saved.(*polvo_v1.Package).GetName()}
+		},
+	})
+
+	r, client := newTestDgraphRepository(func(request *api.Request) *api.Response {
+		return &api.Response{Json: []byte(`{}`), Uids: map[string]string{"package": "0x2"}}
+	})
+
+	if _, err := r.CreatePackage(auditCtx, &polvo_v1.Package{Name: "button"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	var audit *api.Mutation
+	for _, request := range client.requests {
+		for _, mutation := range request.Mutations {
+			if strings.Contains(string(mutation.SetJson), `"AuditEvent"`) {
+				audit = mutation
+
+				if !strings.Contains(request.Query, "pkg as var") {
+					t.Error("the audit event is not written in the request creating the package")
+				}
+			}
+		}
+	}
+
+	if audit == nil {
+		t.Fatal("CreatePackage wrote no audit event")
+	}
+
+	// The event is only written when the package is.
+	if audit.Cond != "@if(eq(len(pkg), 0))" {
+		t.Errorf("the audit event is written with the condition %q", audit.Cond)
+	}
+
+	var node map[string]interface{}
+	if err := json.Unmarshal(audit.SetJson, &node); err != nil {
+		t.Fatalf("the audit mutation is not a node: %v", err)
+	}
+
+	if node["audit_method"] != "CreatePackage" || node["audit_after"] != `{"name":"button"}` {
+		t.Errorf("audit node = %v, want the creation of button", node)
+	}
+}
+
+func TestAuditIsWrittenBeforeTheCommit(t *testing.T) {
+	auditCtx := WithAudit(context.Background(), &Audit{
+		Event: &AuditEvent{Actor: "alice", Method: "DeleteWebhook", Orn: "webhooks/a", Time: time.Now()},
+	})
+
+	r, client := newTestDgraphRepository(respondFound)
+
+	if err := r.DeleteWebhook(auditCtx, "a"); err != nil {
+		t.Fatalf("DeleteWebhook: %v", err)
+	}
+
+	last := client.requests[len(client.requests)-1]
+	if len(last.Mutations) != 1 || !strings.Contains(string(last.Mutations[0].SetJson), `"AuditEvent"`) {
+		t.Fatalf("the last request of DeleteWebhook is %v, want the audit event", last)
+	}
+
+	if last.CommitNow {
+		t.Error("the audit event is committed on its own")
+	}
+}
+
+func TestWebhookDeliveriesAreWrittenOncePerIdempotencyKey(t *testing.T) {
+	r, client := newTestDgraphRepository(func(request *api.Request) *api.Response {
+		// The first key is already stored.
+		return &api.Response{Json: []byte(`{}`), Uids: map[string]string{"delivery1": "0x3"}}
+	})
+
+	deliveries := []*WebhookDelivery{
+		{WebhookID: "a", IdempotencyKey: "a/event"},
+		{WebhookID: "b", IdempotencyKey: "b/event"},
+	}
+	if err := r.CreateWebhookDeliveries(context.Background(), deliveries); err != nil {
+		t.Fatalf("CreateWebhookDeliveries: %v", err)
+	}
+
+	request := client.requests[0]
+	if request.Vars["$key0"] != "a/event" || request.Vars["$key1"] != "b/event" {
+		t.Errorf("the keys are sent as %v", request.Vars)
+	}
+
+	for i, mutation := range request.Mutations {
+		if want := fmt.Sprintf("@if(eq(len(key%d), 0))", i); mutation.Cond != want {
+			t.Errorf("delivery %d is written with the condition %q, want %q", i, mutation.Cond, want)
+		}
+	}
+
+	if deliveries[0].ID != "" || deliveries[1].ID == "" {
+		t.Errorf("ids = %q, %q, want only the second delivery stored", deliveries[0].ID, deliveries[1].ID)
+	}
+}
@@ -0,0 +1,563 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo/v210"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+const webhookFields = `
+				uid
+				webhook_id
+				webhook_package
+				webhook_url
+				webhook_secret
+				webhook_event_types
+				webhook_created_by
+				created_at`
+
+const deliveryFields = `
+				uid
+				delivery_id
+				delivery_webhook_id
+				delivery_idempotency_key
+				delivery_package
+				delivery_event_type
+				delivery_payload
+				delivery_state
+				delivery_attempts
+				delivery_next_attempt_at
+				delivery_last_status
+				delivery_last_error
+				revision
+				created_at
+				updated_at`
+
+func parseWebhook(value gjson.Result) *Webhook {
+	webhook := &Webhook{
+		ID:        value.Get("webhook_id").String(),
+		Package:   value.Get("webhook_package").String(),
+		URL:       value.Get("webhook_url").String(),
+		Secret:    value.Get("webhook_secret").String(),
+		CreatedBy: value.Get("webhook_created_by").String(),
+		CreatedAt: value.Get("created_at").Time(),
+	}
+
+	_ = json.Unmarshal([]byte(value.Get("webhook_event_types").String()), &webhook.EventTypes)
+
+	return webhook
+}
+
+// deliveryJson encodes the fields of a delivery that change over its life.
+func deliveryJson(uid string, delivery *WebhookDelivery) map[string]interface{} {
+	fields := map[string]interface{}{
+		"uid":                  uid,
+		"delivery_state":       string(delivery.State),
+		"delivery_attempts":    delivery.Attempts,
+		"delivery_last_status": delivery.LastStatusCode,
+		"delivery_last_error":  delivery.LastError,
+		"revision":             delivery.Revision,
+		"updated_at":           delivery.UpdatedAt.Format(time.RFC3339),
+	}
+
+	if !delivery.NextAttemptAt.IsZero() {
+		fields["delivery_next_attempt_at"] = delivery.NextAttemptAt.UTC().Format(auditTimeFormat)
+	}
+
+	return fields
+}
+
+func parseWebhookDelivery(value gjson.Result) *WebhookDelivery {
+	return &WebhookDelivery{
+		ID:             value.Get("delivery_id").String(),
+		WebhookID:      value.Get("delivery_webhook_id").String(),
+		IdempotencyKey: value.Get("delivery_idempotency_key").String(),
+		Package:        value.Get("delivery_package").String(),
+		EventType:      value.Get("delivery_event_type").String(),
+		Payload:        []byte(value.Get("delivery_payload").String()),
+		State:          WebhookDeliveryState(value.Get("delivery_state").String()),
+		Attempts:       int(value.Get("delivery_attempts").Int()),
+		NextAttemptAt:  value.Get("delivery_next_attempt_at").Time(),
+		LastStatusCode: int(value.Get("delivery_last_status").Int()),
+		LastError:      value.Get("delivery_last_error").String(),
+		Revision:       value.Get("revision").Int(),
+		CreatedAt:      value.Get("created_at").Time(),
+		UpdatedAt:      value.Get("updated_at").Time(),
+	}
+}
+
+func parseWebhookDeliveries(value gjson.Result) []*WebhookDelivery {
+	var deliveries []*WebhookDelivery
+
+	value.ForEach(func(key, value gjson.Result) bool {
+		deliveries = append(deliveries, parseWebhookDelivery(value))
+
+		return true
+	})
+
+	return deliveries
+}
+
+// CreateWebhook checks that the package of the webhook is live in the
+// transaction that writes the webhook.
+func (r *DgraphRepository) CreateWebhook(ctx context.Context, webhook *Webhook) (*Webhook, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewTxn()
+	defer txn.Discard(ctx)
+
+	if webhook.Package != "" {
+		request := &api.Request{
+			Query: `query q($packageName: string) {
+						package(func: eq(name, $packageName)) @filter(eq(dgraph.type, "Package") AND NOT has(deleted_at)) {
+							uid
+						}
+					}`,
+			Vars: map[string]string{
+				"$packageName": webhook.Package,
+			},
+		}
+
+		requestResult, err := txn.Do(ctx, request)
+		if err != nil {
+			return nil, dgraphError(err, "failed to query data")
+		}
+
+		if !gjson.GetBytes(requestResult.Json, "package.0.uid").Exists() {
+			return nil, errors.Wrapf(ErrPackageNotFound, "package %s", webhook.Package)
+		}
+	}
+
+	saved := copyWebhook(webhook)
+	saved.ID = newID()
+	saved.CreatedAt = time.Now()
+
+	eventTypes, err := json.Marshal(saved.EventTypes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode webhook event types")
+	}
+
+	setJson, err := json.Marshal(map[string]interface{}{
+		"uid":                 "_:webhook",
+		"dgraph.type":         "Webhook",
+		"webhook_id":          saved.ID,
+		"webhook_package":     saved.Package,
+		"webhook_url":         saved.URL,
+		"webhook_secret":      saved.Secret,
+		"webhook_event_types": string(eventTypes),
+		"webhook_created_by":  saved.CreatedBy,
+		"created_at":          saved.CreatedAt.Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode mutation")
+	}
+
+	if _, err := txn.Mutate(ctx, &api.Mutation{SetJson: setJson}); err != nil {
+		return nil, dgraphError(err, "failed to mutate data")
+	}
+
+	if err := r.writeAudit(ctx, txn, saved); err != nil {
+		return nil, err
+	}
+
+	if err := txn.Commit(ctx); err != nil {
+		return nil, dgraphError(err, "failed to commit data")
+	}
+
+	return saved, nil
+}
+
+func (r *DgraphRepository) GetWebhook(ctx context.Context, id string) (*Webhook, error) {
+	query := `query q($id: string) {
+		  webhook(func: eq(webhook_id, $id)) @filter(eq(dgraph.type, "Webhook")) {` + webhookFields + `
+		  }
+		}`
+
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	request := &api.Request{
+		Query: query,
+		Vars: map[string]string{
+			"$id": id,
+		},
+	}
+
+	requestResult, err := dgraphClient.NewReadOnlyTxn().Do(ctx, request)
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	webhook := gjson.GetBytes(requestResult.Json, "webhook.0")
+	if !webhook.Exists() {
+		return nil, errors.Wrapf(ErrWebhookNotFound, "webhook %s", id)
+	}
+
+	return parseWebhook(webhook), nil
+}
+
+func (r *DgraphRepository) ListWebhooks(ctx context.Context) ([]*Webhook, error) {
+	query := `{
+		  webhooks(func: type(Webhook), orderdesc: created_at) {` + webhookFields + `
+		  }
+		}`
+
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	requestResult, err := dgraphClient.NewReadOnlyTxn().Do(ctx, &api.Request{Query: query})
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	var webhooks []*Webhook
+	gjson.GetBytes(requestResult.Json, "webhooks").ForEach(func(key, value gjson.Result) bool {
+		webhooks = append(webhooks, parseWebhook(value))
+
+		return true
+	})
+
+	return webhooks, nil
+}
+
+func (r *DgraphRepository) DeleteWebhook(ctx context.Context, id string) error {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return err
+	}
+
+	txn := dgraphClient.NewTxn()
+	defer txn.Discard(ctx)
+
+	request := &api.Request{
+		Query: `query q($id: string) {
+					webhook(func: eq(webhook_id, $id)) @filter(eq(dgraph.type, "Webhook")) {
+						uid
+					}
+					deliveries(func: eq(delivery_webhook_id, $id)) @filter(eq(dgraph.type, "WebhookDelivery")) {
+						uid
+					}
+				}`,
+		Vars: map[string]string{
+			"$id": id,
+		},
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return dgraphError(err, "failed to query data")
+	}
+
+	webhookUid := gjson.GetBytes(requestResult.Json, "webhook.0.uid")
+	if !webhookUid.Exists() {
+		return errors.Wrapf(ErrWebhookNotFound, "webhook %s", id)
+	}
+
+	deletions := []map[string]interface{}{{"uid": webhookUid.String()}}
+	gjson.GetBytes(requestResult.Json, "deliveries.#.uid").ForEach(func(key, uid gjson.Result) bool {
+		deletions = append(deletions, map[string]interface{}{"uid": uid.String()})
+
+		return true
+	})
+
+	deleteJson, err := json.Marshal(deletions)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode mutation")
+	}
+
+	if _, err := txn.Mutate(ctx, &api.Mutation{DeleteJson: deleteJson}); err != nil {
+		return dgraphError(err, "failed to mutate data")
+	}
+
+	if err := r.writeAudit(ctx, txn, nil); err != nil {
+		return err
+	}
+
+	if err := txn.Commit(ctx); err != nil {
+		return dgraphError(err, "failed to commit data")
+	}
+
+	return nil
+}
+
+// CreateWebhookDeliveries writes each delivery with a condition on its
+// idempotency key, which is indexed with @upsert so that two processes
+// writing the same key conflict.
+func (r *DgraphRepository) CreateWebhookDeliveries(ctx context.Context, deliveries []*WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var parameters []string
+	var query strings.Builder
+	vars := map[string]string{}
+	var mutations []*api.Mutation
+	for i, delivery := range deliveries {
+		delivery.ID = newID()
+		delivery.Revision = 1
+		delivery.CreatedAt = now
+		delivery.UpdatedAt = now
+
+		fields := deliveryJson(fmt.Sprintf("_:delivery%d", i), delivery)
+		fields["dgraph.type"] = "WebhookDelivery"
+		fields["delivery_id"] = delivery.ID
+		fields["delivery_webhook_id"] = delivery.WebhookID
+		fields["delivery_idempotency_key"] = delivery.IdempotencyKey
+		fields["delivery_package"] = delivery.Package
+		fields["delivery_event_type"] = delivery.EventType
+		fields["delivery_payload"] = string(delivery.Payload)
+		fields["created_at"] = now.UTC().Format(auditTimeFormat)
+
+		setJson, err := json.Marshal(fields)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode mutation")
+		}
+
+		parameters = append(parameters, fmt.Sprintf("$key%d: string", i))
+		fmt.Fprintf(&query, "key%d as var(func: eq(delivery_idempotency_key, $key%d))\n", i, i)
+		vars[fmt.Sprintf("$key%d", i)] = delivery.IdempotencyKey
+		mutations = append(mutations, &api.Mutation{
+			SetJson: setJson,
+			Cond:    fmt.Sprintf("@if(eq(len(key%d), 0))", i),
+		})
+	}
+
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return err
+	}
+
+	txn := dgraphClient.NewTxn()
+	defer txn.Discard(ctx)
+
+	mutateResult, err := txn.Do(ctx, &api.Request{
+		Query:     "query q(" + strings.Join(parameters, ", ") + ") {\n" + query.String() + "}",
+		Vars:      vars,
+		Mutations: mutations,
+	})
+	if err != nil {
+		return dgraphError(err, "failed to mutate data")
+	}
+
+	if err := txn.Commit(ctx); err != nil {
+		return dgraphError(err, "failed to commit data")
+	}
+
+	for i, delivery := range deliveries {
+		if _, ok := mutateResult.Uids[fmt.Sprintf("delivery%d", i)]; !ok {
+			delivery.ID = ""
+		}
+	}
+
+	return nil
+}
+
+func (r *DgraphRepository) GetWebhookDelivery(ctx context.Context, id string) (*WebhookDelivery, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := r.queryWebhookDelivery(ctx, dgraphClient.NewReadOnlyTxn(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseWebhookDelivery(value), nil
+}
+
+func (r *DgraphRepository) ListWebhookDeliveries(ctx context.Context, options ListWebhookDeliveriesOptions) (*WebhookDeliveryPage, error) {
+	cursor, err := parsePageToken(options.PageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	list := newListQuery(`eq(dgraph.type, "WebhookDelivery")`)
+
+	if options.WebhookID != "" {
+		list.filter("eq(delivery_webhook_id, $webhookId)", "$webhookId", options.WebhookID)
+	}
+
+	if options.State != "" {
+		list.filter("eq(delivery_state, $state)", "$state", string(options.State))
+	}
+
+	if cursor != nil {
+		list.filter("(lt(created_at, $afterKey) OR (eq(created_at, $afterKey) AND lt(delivery_id, $afterName)))",
+			"$afterKey", cursor.Key,
+			"$afterName", cursor.Name,
+		)
+	}
+
+	first := ""
+	if options.PageSize > 0 {
+		first = fmt.Sprintf(", first: %d", options.PageSize+1)
+	}
+
+	query := list.header() + ` {
+		  deliveries(func: type(WebhookDelivery), orderdesc: created_at, orderdesc: delivery_id` + first + `) @filter(` + list.filterExpression() + `) {` + deliveryFields + `
+		  }
+		}`
+
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	request := &api.Request{
+		Query: query,
+		Vars:  list.vars,
+	}
+
+	requestResult, err := dgraphClient.NewReadOnlyTxn().Do(ctx, request)
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	page := &WebhookDeliveryPage{}
+
+	gjson.GetBytes(requestResult.Json, "deliveries").ForEach(func(key, value gjson.Result) bool {
+		if options.PageSize > 0 && uint(len(page.Deliveries)) == options.PageSize {
+			page.NextPageToken = deliveryCursor(page.Deliveries[len(page.Deliveries)-1]).token()
+
+			return false
+		}
+
+		page.Deliveries = append(page.Deliveries, parseWebhookDelivery(value))
+
+		return true
+	})
+
+	return page, nil
+}
+
+func (r *DgraphRepository) ListDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error) {
+	first := ""
+	if limit > 0 {
+		first = fmt.Sprintf(", first: %d", limit)
+	}
+
+	query := `query q($now: string) {
+		  deliveries(func: eq(delivery_state, "pending"), orderasc: delivery_next_attempt_at` + first + `) @filter(le(delivery_next_attempt_at, $now)) {` + deliveryFields + `
+		  }
+		}`
+
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	request := &api.Request{
+		Query: query,
+		Vars: map[string]string{
+			"$now": now.UTC().Format(auditTimeFormat),
+		},
+	}
+
+	requestResult, err := dgraphClient.NewReadOnlyTxn().Do(ctx, request)
+	if err != nil {
+		return nil, dgraphError(err, "failed to query data")
+	}
+
+	return parseWebhookDeliveries(gjson.GetBytes(requestResult.Json, "deliveries")), nil
+}
+
+// UpdateWebhookDelivery reads the delivery inside the transaction and writes
+// its revision, so that concurrent updates of the same delivery conflict.
+func (r *DgraphRepository) UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) (*WebhookDelivery, error) {
+	dgraphClient, err := r.getDgraphClient()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := dgraphClient.NewTxn()
+	defer txn.Discard(ctx)
+
+	current, err := r.queryWebhookDelivery(ctx, txn, delivery.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.Get("revision").Int() != delivery.Revision {
+		return nil, errors.Wrapf(ErrConflict, "webhook delivery %s was changed since revision %d", delivery.ID, delivery.Revision)
+	}
+
+	saved := copyWebhookDelivery(delivery)
+	saved.Revision++
+	saved.UpdatedAt = time.Now()
+
+	setJson, err := json.Marshal(deliveryJson(current.Get("uid").String(), saved))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode mutation")
+	}
+
+	mutation := &api.Mutation{SetJson: setJson}
+
+	// The next attempt is only set while the delivery is pending.
+	if saved.NextAttemptAt.IsZero() {
+		deleteJson, err := json.Marshal(map[string]interface{}{
+			"uid":                      current.Get("uid").String(),
+			"delivery_next_attempt_at": nil,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encode mutation")
+		}
+
+		mutation.DeleteJson = deleteJson
+	}
+
+	if _, err := txn.Mutate(ctx, mutation); err != nil {
+		return nil, dgraphError(err, "failed to mutate data")
+	}
+
+	if err := r.writeAudit(ctx, txn, saved); err != nil {
+		return nil, err
+	}
+
+	if err := txn.Commit(ctx); err != nil {
+		return nil, dgraphError(err, "failed to commit data")
+	}
+
+	return saved, nil
+}
+
+func (r *DgraphRepository) queryWebhookDelivery(ctx context.Context, txn *dgo.Txn, id string) (gjson.Result, error) {
+	query := `query q($id: string) {
+		  delivery(func: eq(delivery_id, $id)) @filter(eq(dgraph.type, "WebhookDelivery")) {` + deliveryFields + `
+		  }
+		}`
+
+	request := &api.Request{
+		Query: query,
+		Vars: map[string]string{
+			"$id": id,
+		},
+	}
+
+	requestResult, err := txn.Do(ctx, request)
+	if err != nil {
+		return gjson.Result{}, dgraphError(err, "failed to query data")
+	}
+
+	delivery := gjson.GetBytes(requestResult.Json, "delivery.0")
+	if !delivery.Exists() {
+		return gjson.Result{}, errors.Wrapf(ErrDeliveryNotFound, "webhook delivery %s", id)
+	}
+
+	return delivery, nil
+}
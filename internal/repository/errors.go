@@ -0,0 +1,23 @@
+package repository
+
+import "github.com/pkg/errors"
+
+// Errors returned by Repository implementations. They are wrapped with
+// context about the resource, so callers should match them with errors.Is.
+var (
+	ErrPackageNotFound  = errors.New("package not found")
+	ErrVersionNotFound  = errors.New("version not found")
+	ErrChannelNotFound  = errors.New("channel not found")
+	ErrRolloutNotFound  = errors.New("rollout not found")
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrAlreadyExists    = errors.New("already exists")
+	ErrConflict         = errors.New("conflicting concurrent modification")
+	// ErrPrecondition is returned when the registry is not in a state that
+	// allows the operation, e.g. rolling back a channel that was never promoted.
+	ErrPrecondition = errors.New("precondition failed")
+	ErrUnavailable  = errors.New("storage is unavailable")
+	// ErrInvalidArgument is returned for list options the repository can not
+	// use, like a malformed page token.
+	ErrInvalidArgument = errors.New("invalid argument")
+)
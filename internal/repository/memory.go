@@ -0,0 +1,710 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/labels"
+)
+
+// MemoryRepository keeps the whole registry in process memory. It mirrors the
+// behaviour of DgraphRepository so the service can run without a Dgraph server.
+type MemoryRepository struct {
+	mu       sync.RWMutex
+	packages map[string]*memoryPackage
+	// order keeps package names in creation order, like uid order in Dgraph.
+	order             []string
+	rollouts          []*Rollout
+	auditEvents       []*AuditEvent
+	webhooks          []*Webhook
+	webhookDeliveries []*WebhookDelivery
+	outboxEvents      []*OutboxEvent
+	// outboxSequence is the sequence of the latest outbox event.
+	outboxSequence uint64
+}
+
+type memoryPackage struct {
+	name       string
+	maintainer string
+	metadata   PackageMetadata
+	createdAt  time.Time
+	updatedAt  time.Time
+	deletedAt  *time.Time
+	versions   []*memoryVersion
+	channels   []*memoryChannel
+	// routingRevisions are ordered from the oldest to the latest.
+	routingRevisions []*RoutingRevision
+}
+
+type memoryVersion struct {
+	name        string
+	manifestUrl string
+	weight      uint32
+	labels      map[string]string
+	pin         *ManifestPin
+	createdAt   time.Time
+	updatedAt   time.Time
+	deletedAt   *time.Time
+}
+
+type memoryChannel struct {
+	name            string
+	targets         []ChannelTarget
+	previousTargets []ChannelTarget
+	revision        int64
+	createdAt       time.Time
+	updatedAt       time.Time
+}
+
+func NewMemoryRepository() (*MemoryRepository, error) {
+	return &MemoryRepository{
+		packages: map[string]*memoryPackage{},
+	}, nil
+}
+
+func (p *memoryPackage) toProto() *polvo_v1.Package {
+	return &polvo_v1.Package{
+		Name:       p.name,
+		Maintainer: p.maintainer,
+	}
+}
+
+func (p *memoryPackage) matches(options ListPackagesOptions) bool {
+	if !strings.HasPrefix(p.name, options.NamePrefix) {
+		return false
+	}
+
+	if options.Maintainer != "" && p.maintainer != options.Maintainer {
+		return false
+	}
+
+	if options.Tag != "" && !containsString(p.metadata.Tags, options.Tag) {
+		return false
+	}
+
+	if options.Owner != "" && !containsString(p.metadata.Owners, options.Owner) {
+		return false
+	}
+
+	return options.CreatedAfter == nil || p.createdAt.After(*options.CreatedAfter)
+}
+
+func (p *memoryPackage) toDetails() *PackageDetails {
+	return &PackageDetails{
+		Package:   p.toProto(),
+		Metadata:  copyPackageMetadata(p.metadata),
+		CreatedAt: p.createdAt,
+		UpdatedAt: p.updatedAt,
+	}
+}
+
+// findVersion looks a version up by name, including soft deleted ones.
+func (p *memoryPackage) findVersion(name string) (int, *memoryVersion) {
+	for i, version := range p.versions {
+		if version.name == name {
+			return i, version
+		}
+	}
+
+	return -1, nil
+}
+
+func (p *memoryPackage) findLiveVersion(name string) *memoryVersion {
+	if _, version := p.findVersion(name); version != nil && version.deletedAt == nil {
+		return version
+	}
+
+	return nil
+}
+
+func (p *memoryPackage) findChannel(name string) *memoryChannel {
+	for _, channel := range p.channels {
+		if channel.name == name {
+			return channel
+		}
+	}
+
+	return nil
+}
+
+// toChannel converts the channel, leaving out targets that were soft deleted.
+func (c *memoryChannel) toChannel(pkg *memoryPackage) *Channel {
+	var targets []ChannelTarget
+	for _, target := range c.targets {
+		if pkg.findLiveVersion(target.Version) != nil {
+			targets = append(targets, target)
+		}
+	}
+
+	return &Channel{
+		Name:      c.name,
+		Targets:   targets,
+		Revision:  c.revision,
+		CreatedAt: c.createdAt,
+		UpdatedAt: c.updatedAt,
+	}
+}
+
+func (v *memoryVersion) toProto() *polvo_v1.Version {
+	return &polvo_v1.Version{
+		Name:        v.name,
+		ManifestUrl: v.manifestUrl,
+		Weight:      v.weight,
+	}
+}
+
+func (v *memoryVersion) matches(options ListVersionsOptions) bool {
+	if !strings.HasPrefix(v.name, options.NamePrefix) {
+		return false
+	}
+
+	if options.HasWeight != nil && (v.weight > 0) != *options.HasWeight {
+		return false
+	}
+
+	if !options.LabelSelector.Matches(v.labels) {
+		return false
+	}
+
+	return options.CreatedAfter == nil || v.createdAt.After(*options.CreatedAfter)
+}
+
+func (v *memoryVersion) toDetails() *VersionDetails {
+	details := &VersionDetails{
+		Version:   v.toProto(),
+		CreatedAt: v.createdAt,
+		UpdatedAt: v.updatedAt,
+		Labels:    labels.Copy(v.labels),
+	}
+
+	if v.pin != nil {
+		details.ManifestSHA256 = v.pin.SHA256
+	}
+
+	return details
+}
+
+// livePackage returns the package unless it does not exist or is soft deleted.
+func (r *MemoryRepository) livePackage(name string) (*memoryPackage, error) {
+	pkg, ok := r.packages[name]
+	if !ok || pkg.deletedAt != nil {
+		return nil, errors.Wrapf(ErrPackageNotFound, "package %s", name)
+	}
+
+	return pkg, nil
+}
+
+func (r *MemoryRepository) liveVersion(packageName, versionName string) (*memoryPackage, *memoryVersion, error) {
+	pkg, err := r.livePackage(packageName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	version := pkg.findLiveVersion(versionName)
+	if version == nil {
+		return nil, nil, errors.Wrapf(ErrVersionNotFound, "version %s of package %s", versionName, packageName)
+	}
+
+	return pkg, version, nil
+}
+
+func (r *MemoryRepository) GetPackage(ctx context.Context, name string) (*polvo_v1.Package, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pkg, err := r.livePackage(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return pkg.toProto(), nil
+}
+
+func (r *MemoryRepository) GetPackageDetails(ctx context.Context, name string) (*PackageDetails, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pkg, err := r.livePackage(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return pkg.toDetails(), nil
+}
+
+func (r *MemoryRepository) ListPackages(ctx context.Context, options ListPackagesOptions) (*PackagePage, error) {
+	options, err := options.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var packages []*memoryPackage
+	var cursors []pageCursor
+	for _, name := range r.order {
+		pkg := r.packages[name]
+		if pkg.deletedAt != nil || !pkg.matches(options) {
+			continue
+		}
+
+		packages = append(packages, pkg)
+		cursors = append(cursors, newPageCursor(options.OrderBy, pkg.name, pkg.createdAt, 0))
+	}
+
+	indexes, nextPageToken, err := paginate(cursors, options.PageToken, options.PageSize, options.Descending)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &PackagePage{
+		Packages:      make([]*PackageDetails, 0, len(indexes)),
+		NextPageToken: nextPageToken,
+	}
+	for _, i := range indexes {
+		page.Packages = append(page.Packages, packages[i].toDetails())
+	}
+
+	return page, nil
+}
+
+// CreatePackage fails with ErrAlreadyExists when a soft deleted package has
+// the same name, the name is only released once the package is purged.
+func (r *MemoryRepository) CreatePackage(ctx context.Context, pkg *polvo_v1.Package, metadata *PackageMetadata) (*polvo_v1.Package, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.packages[pkg.GetName()]; ok {
+		return nil, errors.Wrapf(ErrAlreadyExists, "package %s", pkg.GetName())
+	}
+
+	now := time.Now()
+	saved := &memoryPackage{
+		name:       pkg.GetName(),
+		maintainer: pkg.GetMaintainer(),
+		createdAt:  now,
+		updatedAt:  now,
+	}
+
+	if metadata != nil {
+		saved.metadata = copyPackageMetadata(*metadata)
+	}
+
+	r.packages[saved.name] = saved
+	r.order = append(r.order, saved.name)
+	r.recordEvents(newPackageEvent(ctx, EventPackageCreated, saved.toProto(), now))
+	r.recordAudit(ctx, saved.toProto())
+
+	return saved.toProto(), nil
+}
+
+func (r *MemoryRepository) UpdatePackage(ctx context.Context, name string, updatedFields map[string]interface{}) (*polvo_v1.Package, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pkg, err := r.livePackage(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if newName, ok := updatedFields["Name"]; ok && newName.(string) != name {
+		if _, exists := r.packages[newName.(string)]; exists {
+			return nil, errors.Wrapf(ErrAlreadyExists, "package %s", newName)
+		}
+	}
+
+	if maintainer, ok := updatedFields["Maintainer"]; ok {
+		pkg.maintainer = maintainer.(string)
+	}
+
+	applyMetadataFields(&pkg.metadata, updatedFields)
+
+	if newName, ok := updatedFields["Name"]; ok && newName.(string) != name {
+		delete(r.packages, name)
+		pkg.name = newName.(string)
+		r.packages[pkg.name] = pkg
+
+		for i, orderedName := range r.order {
+			if orderedName == name {
+				r.order[i] = pkg.name
+			}
+		}
+	}
+
+	now := time.Now()
+	pkg.updatedAt = now
+	r.recordEvents(newPackageEvent(ctx, EventPackageUpdated, pkg.toProto(), now))
+	r.recordAudit(ctx, pkg.toProto())
+
+	return pkg.toProto(), nil
+}
+
+// DeletePackage soft deletes the package. Its versions and channels are kept
+// and come back with UndeletePackage.
+func (r *MemoryRepository) DeletePackage(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pkg, err := r.livePackage(name)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	pkg.deletedAt = &now
+	pkg.updatedAt = now
+	r.recordEvents(newPackageEvent(ctx, EventPackageDeleted, pkg.toProto(), now))
+	r.recordAudit(ctx, nil)
+
+	return nil
+}
+
+func (r *MemoryRepository) UndeletePackage(ctx context.Context, name string) (*polvo_v1.Package, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pkg, ok := r.packages[name]
+	if !ok || pkg.deletedAt == nil {
+		return nil, errors.Wrapf(ErrPackageNotFound, "deleted package %s", name)
+	}
+
+	now := time.Now()
+	pkg.deletedAt = nil
+	pkg.updatedAt = now
+	r.recordEvents(newPackageEvent(ctx, EventPackageUndeleted, pkg.toProto(), now))
+	r.recordAudit(ctx, pkg.toProto())
+
+	return pkg.toProto(), nil
+}
+
+func (r *MemoryRepository) IsPackageExists(ctx context.Context, name string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, err := r.livePackage(name)
+
+	return err == nil, nil
+}
+
+func (r *MemoryRepository) ListVersions(ctx context.Context, packageName string) ([]*polvo_v1.Version, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pkg, err := r.livePackage(packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]*polvo_v1.Version, 0, len(pkg.versions))
+	for _, version := range pkg.versions {
+		if version.deletedAt == nil {
+			versions = append(versions, version.toProto())
+		}
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].GetWeight() > versions[j].GetWeight()
+	})
+
+	return versions, nil
+}
+
+func (r *MemoryRepository) ListVersionDetails(ctx context.Context, packageName string, options ListVersionsOptions) (*VersionPage, error) {
+	options, err := options.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pkg, err := r.livePackage(packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []*memoryVersion
+	var cursors []pageCursor
+	for _, version := range pkg.versions {
+		if version.deletedAt != nil || !version.matches(options) {
+			continue
+		}
+
+		versions = append(versions, version)
+		cursors = append(cursors, newPageCursor(options.OrderBy, version.name, version.createdAt, version.weight))
+	}
+
+	indexes, nextPageToken, err := paginate(cursors, options.PageToken, options.PageSize, options.Descending)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &VersionPage{
+		Versions:      make([]*VersionDetails, 0, len(indexes)),
+		NextPageToken: nextPageToken,
+	}
+	for _, i := range indexes {
+		page.Versions = append(page.Versions, versions[i].toDetails())
+	}
+
+	return page, nil
+}
+
+func (r *MemoryRepository) GetVersion(ctx context.Context, packageName, versionName string) (*polvo_v1.Version, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, version, err := r.liveVersion(packageName, versionName)
+	if err != nil {
+		return nil, err
+	}
+
+	return version.toProto(), nil
+}
+
+func (r *MemoryRepository) GetVersionDetails(ctx context.Context, packageName, versionName string) (*VersionDetails, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, version, err := r.liveVersion(packageName, versionName)
+	if err != nil {
+		return nil, err
+	}
+
+	return version.toDetails(), nil
+}
+
+func (r *MemoryRepository) GetManifestPin(ctx context.Context, packageName, versionName string) (*ManifestPin, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, version, err := r.liveVersion(packageName, versionName)
+	if err != nil {
+		return nil, err
+	}
+
+	if version.pin == nil {
+		return nil, nil
+	}
+
+	return &ManifestPin{
+		SHA256: version.pin.SHA256,
+		Body:   append([]byte(nil), version.pin.Body...),
+	}, nil
+}
+
+// GetHeaviestVersion returns the version with the highest weight. Ties are
+// broken by creation order so the result is stable between calls.
+func (r *MemoryRepository) GetHeaviestVersion(ctx context.Context, packageName string) (*polvo_v1.Version, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pkg, err := r.livePackage(packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	var heaviest *memoryVersion
+	for _, version := range pkg.versions {
+		if version.deletedAt != nil {
+			continue
+		}
+
+		if heaviest == nil || version.weight > heaviest.weight {
+			heaviest = version
+		}
+	}
+
+	if heaviest == nil {
+		return nil, errors.Wrapf(ErrVersionNotFound, "package %s has no version", packageName)
+	}
+
+	return heaviest.toProto(), nil
+}
+
+// CreateVersion fails with ErrAlreadyExists when a soft deleted version has
+// the same name, the name is only released once the version is purged.
+func (r *MemoryRepository) CreateVersion(ctx context.Context, packageName string, version *polvo_v1.Version, pin *ManifestPin, versionLabels map[string]string) (*polvo_v1.Version, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pkg, err := r.livePackage(packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, existing := pkg.findVersion(version.GetName()); existing != nil {
+		return nil, errors.Wrapf(ErrAlreadyExists, "version %s of package %s", version.GetName(), packageName)
+	}
+
+	now := time.Now()
+	saved := &memoryVersion{
+		name:        version.GetName(),
+		manifestUrl: version.GetManifestUrl(),
+		weight:      version.GetWeight(),
+		labels:      labels.Copy(versionLabels),
+		createdAt:   now,
+		updatedAt:   now,
+	}
+
+	if pin != nil {
+		saved.pin = &ManifestPin{
+			SHA256: pin.SHA256,
+			Body:   append([]byte(nil), pin.Body...),
+		}
+	}
+
+	pkg.recordRoutingRevision(now)
+	pkg.versions = append(pkg.versions, saved)
+	pkg.recordRoutingRevision(now)
+	r.recordEvents(newVersionEvent(ctx, EventVersionCreated, packageName, saved.toProto(), now))
+	r.recordAudit(ctx, saved.toProto())
+
+	return saved.toProto(), nil
+}
+
+func (r *MemoryRepository) UpdateVersion(ctx context.Context, packageName, versionName string, updatedFields map[string]interface{}) (*polvo_v1.Version, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pkg, version, err := r.liveVersion(packageName, versionName)
+	if err != nil {
+		return nil, err
+	}
+
+	if newName, ok := updatedFields["Name"]; ok && newName.(string) != versionName {
+		if _, existing := pkg.findVersion(newName.(string)); existing != nil {
+			return nil, errors.Wrapf(ErrAlreadyExists, "version %s of package %s", newName, packageName)
+		}
+	}
+
+	if manifestUrl, ok := updatedFields["ManifestUrl"]; ok && version.pin != nil && manifestUrl.(string) != version.manifestUrl {
+		return nil, errors.Wrapf(ErrPrecondition, "manifest of version %s of package %s is pinned", versionName, packageName)
+	}
+
+	now := time.Now()
+	pkg.recordRoutingRevision(now)
+	previousWeight := version.weight
+
+	if manifestUrl, ok := updatedFields["ManifestUrl"]; ok {
+		version.manifestUrl = manifestUrl.(string)
+	}
+
+	if weight, ok := updatedFields["Weight"]; ok {
+		version.weight = weight.(uint32)
+	}
+
+	if versionLabels, ok := updatedFields[LabelsField]; ok {
+		version.labels = labels.Copy(versionLabels.(map[string]string))
+	}
+
+	if newName, ok := updatedFields["Name"]; ok {
+		version.name = newName.(string)
+	}
+
+	version.updatedAt = now
+	pkg.recordRoutingRevision(now)
+	r.recordEvents(
+		newVersionEvent(ctx, EventVersionUpdated, packageName, version.toProto(), now),
+		newWeightEvent(ctx, packageName, version.toProto(), previousWeight, now),
+	)
+	r.recordAudit(ctx, version.toProto())
+
+	return version.toProto(), nil
+}
+
+// DeleteVersion soft deletes the version, it comes back with UndeleteVersion.
+func (r *MemoryRepository) DeleteVersion(ctx context.Context, packageName, versionName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, version, err := r.liveVersion(packageName, versionName)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	version.deletedAt = &now
+	version.updatedAt = now
+	r.recordEvents(newVersionEvent(ctx, EventVersionDeleted, packageName, version.toProto(), now))
+	r.recordAudit(ctx, nil)
+
+	return nil
+}
+
+func (r *MemoryRepository) UndeleteVersion(ctx context.Context, packageName, versionName string) (*polvo_v1.Version, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pkg, err := r.livePackage(packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	_, version := pkg.findVersion(versionName)
+	if version == nil || version.deletedAt == nil {
+		return nil, errors.Wrapf(ErrVersionNotFound, "deleted version %s of package %s", versionName, packageName)
+	}
+
+	now := time.Now()
+	version.deletedAt = nil
+	version.updatedAt = now
+	r.recordEvents(newVersionEvent(ctx, EventVersionUndeleted, packageName, version.toProto(), now))
+	r.recordAudit(ctx, version.toProto())
+
+	return version.toProto(), nil
+}
+
+func (r *MemoryRepository) IsVersionExists(ctx context.Context, packageName string, versionName string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, _, err := r.liveVersion(packageName, versionName)
+
+	return err == nil, nil
+}
+
+func (r *MemoryRepository) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (*PurgeResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := &PurgeResult{}
+
+	order := r.order[:0]
+	for _, name := range r.order {
+		pkg := r.packages[name]
+
+		if pkg.deletedAt != nil && pkg.deletedAt.Before(deletedBefore) {
+			delete(r.packages, name)
+			r.purgeRollouts(name)
+			result.Packages++
+			continue
+		}
+
+		versions := pkg.versions[:0]
+		for _, version := range pkg.versions {
+			if version.deletedAt != nil && version.deletedAt.Before(deletedBefore) {
+				result.Versions++
+				continue
+			}
+
+			versions = append(versions, version)
+		}
+		pkg.versions = versions
+
+		order = append(order, name)
+	}
+	r.order = order
+
+	if result.Packages > 0 || result.Versions > 0 {
+		r.recordAudit(ctx, result)
+	}
+
+	return result, nil
+}
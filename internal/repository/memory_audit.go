@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+)
+
+func (r *MemoryRepository) AppendAuditEvent(ctx context.Context, event *AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	saved := *event
+	saved.ID = newID()
+	event.ID = saved.ID
+
+	r.auditEvents = append(r.auditEvents, &saved)
+
+	return nil
+}
+
+// recordAudit appends the audit event of ctx completed with saved. The caller
+// holds r.mu for the change.
+func (r *MemoryRepository) recordAudit(ctx context.Context, saved interface{}) {
+	if event := auditEventOf(ctx, saved); event != nil {
+		r.auditEvents = append(r.auditEvents, event)
+	}
+}
+
+func (r *MemoryRepository) ListAuditEvents(ctx context.Context, options ListAuditEventsOptions) (*AuditEventPage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var events []*AuditEvent
+	var cursors []pageCursor
+	for _, event := range r.auditEvents {
+		if options.matches(event) {
+			events = append(events, event)
+			cursors = append(cursors, auditCursor(event))
+		}
+	}
+
+	indexes, nextPageToken, err := paginate(cursors, options.PageToken, options.PageSize, true)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &AuditEventPage{
+		Events:        make([]*AuditEvent, 0, len(indexes)),
+		NextPageToken: nextPageToken,
+	}
+	for _, i := range indexes {
+		event := *events[i]
+		page.Events = append(page.Events, &event)
+	}
+
+	return page, nil
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryRepositoryAuditEvents(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, event := range []*AuditEvent{
+		{Actor: "alice", Method: "CreatePackage", Orn: "packages/button", Package: "button"},
+		{Actor: "ci-bot", Method: "CreateVersion", Orn: "packages/button/versions/1.0.0", Package: "button"},
+		{Actor: "alice", Method: "CreatePackage", Orn: "packages/card", Package: "card"},
+	} {
+		event.Time = start.Add(time.Duration(i) * time.Minute)
+		if err := r.AppendAuditEvent(ctx, event); err != nil || event.ID == "" {
+			t.Fatalf("AppendAuditEvent = %q, %v", event.ID, err)
+		}
+	}
+
+	orns := func(page *AuditEventPage) []string {
+		var orns []string
+		for _, event := range page.Events {
+			orns = append(orns, event.Orn)
+		}
+
+		return orns
+	}
+
+	until := start.Add(2 * time.Minute)
+	for _, test := range []struct {
+		options ListAuditEventsOptions
+		want    []string
+	}{
+		// Newest first.
+		{ListAuditEventsOptions{}, []string{"packages/card", "packages/button/versions/1.0.0", "packages/button"}},
+		{ListAuditEventsOptions{Package: "button"}, []string{"packages/button/versions/1.0.0", "packages/button"}},
+		{ListAuditEventsOptions{Actor: "alice"}, []string{"packages/card", "packages/button"}},
+		{ListAuditEventsOptions{Since: &start, Until: &until}, []string{"packages/button/versions/1.0.0", "packages/button"}},
+	} {
+		page, err := r.ListAuditEvents(ctx, test.options)
+		if err != nil {
+			t.Fatalf("ListAuditEvents(%+v): %v", test.options, err)
+		}
+
+		if got := orns(page); !equalStrings(got, test.want) {
+			t.Errorf("ListAuditEvents(%+v) = %v, want %v", test.options, got, test.want)
+		}
+	}
+
+	var got []string
+	options := ListAuditEventsOptions{PageSize: 2}
+	for {
+		page, err := r.ListAuditEvents(ctx, options)
+		if err != nil {
+			t.Fatalf("ListAuditEvents(%+v): %v", options, err)
+		}
+
+		got = append(got, orns(page)...)
+		if page.NextPageToken == "" {
+			break
+		}
+
+		options.PageToken = page.NextPageToken
+	}
+
+	if want := []string{"packages/card", "packages/button/versions/1.0.0", "packages/button"}; !equalStrings(got, want) {
+		t.Errorf("paged ListAuditEvents = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func (r *MemoryRepository) ListChannels(ctx context.Context, packageName string) ([]*Channel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pkg, err := r.livePackage(packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := make([]*Channel, 0, len(pkg.channels))
+	for _, channel := range pkg.channels {
+		channels = append(channels, channel.toChannel(pkg))
+	}
+
+	return channels, nil
+}
+
+func (r *MemoryRepository) GetChannel(ctx context.Context, packageName, channelName string) (*Channel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pkg, channel, err := r.findChannel(packageName, channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	return channel.toChannel(pkg), nil
+}
+
+func (r *MemoryRepository) CreateChannel(ctx context.Context, packageName string, channel *Channel) (*Channel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pkg, err := r.livePackage(packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	if pkg.findChannel(channel.Name) != nil {
+		return nil, errors.Wrapf(ErrAlreadyExists, "channel %s of package %s", channel.Name, packageName)
+	}
+
+	if err := r.checkTargets(pkg, channel.Targets); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	saved := &memoryChannel{
+		name:      channel.Name,
+		targets:   append([]ChannelTarget(nil), channel.Targets...),
+		revision:  1,
+		createdAt: now,
+		updatedAt: now,
+	}
+
+	pkg.channels = append(pkg.channels, saved)
+	r.recordEvents(newChannelEvent(ctx, EventChannelCreated, packageName, saved.toChannel(pkg), now))
+	r.recordAudit(ctx, saved.toChannel(pkg))
+
+	return saved.toChannel(pkg), nil
+}
+
+func (r *MemoryRepository) PromoteChannel(ctx context.Context, packageName, channelName string, targets []ChannelTarget) (*Channel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pkg, channel, err := r.findChannel(packageName, channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.checkTargets(pkg, targets); err != nil {
+		return nil, err
+	}
+
+	channel.previousTargets = channel.targets
+	channel.targets = append([]ChannelTarget(nil), targets...)
+	channel.revision++
+	channel.updatedAt = time.Now()
+	r.recordEvents(newChannelEvent(ctx, EventChannelUpdated, packageName, channel.toChannel(pkg), channel.updatedAt))
+	r.recordAudit(ctx, channel.toChannel(pkg))
+
+	return channel.toChannel(pkg), nil
+}
+
+func (r *MemoryRepository) RollbackChannel(ctx context.Context, packageName, channelName string) (*Channel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pkg, channel, err := r.findChannel(packageName, channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(channel.previousTargets) == 0 {
+		return nil, errors.Wrapf(ErrPrecondition, "channel %s of package %s has nothing to roll back to", channelName, packageName)
+	}
+
+	channel.targets, channel.previousTargets = channel.previousTargets, channel.targets
+	channel.revision++
+	channel.updatedAt = time.Now()
+	r.recordEvents(newChannelEvent(ctx, EventChannelUpdated, packageName, channel.toChannel(pkg), channel.updatedAt))
+	r.recordAudit(ctx, channel.toChannel(pkg))
+
+	return channel.toChannel(pkg), nil
+}
+
+func (r *MemoryRepository) findChannel(packageName, channelName string) (*memoryPackage, *memoryChannel, error) {
+	pkg, err := r.livePackage(packageName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	channel := pkg.findChannel(channelName)
+	if channel == nil {
+		return nil, nil, errors.Wrapf(ErrChannelNotFound, "channel %s of package %s", channelName, packageName)
+	}
+
+	return pkg, channel, nil
+}
+
+func (r *MemoryRepository) checkTargets(pkg *memoryPackage, targets []ChannelTarget) error {
+	for _, target := range targets {
+		if pkg.findLiveVersion(target.Version) == nil {
+			return errors.Wrapf(ErrVersionNotFound, "version %s of package %s", target.Version, pkg.name)
+		}
+	}
+
+	return nil
+}
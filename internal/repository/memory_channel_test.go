@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestMemoryRepositoryChannels(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	mustCreatePackage(t, r, "button", "alice")
+	mustCreateVersion(t, r, "button", "1.0.0", 100)
+	mustCreateVersion(t, r, "button", "2.0.0", 0)
+
+	stable := &Channel{Name: "stable", Targets: []ChannelTarget{{Version: "1.0.0", Weight: 100}}}
+	created, err := r.CreateChannel(ctx, "button", stable)
+	if err != nil {
+		t.Fatalf("CreateChannel: %v", err)
+	}
+
+	if created.Revision != 1 || created.Targets[0].Version != "1.0.0" {
+		t.Errorf("CreateChannel = %+v", created)
+	}
+
+	if _, err := r.CreateChannel(ctx, "button", stable); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("CreateChannel of an existing channel = %v, want ErrAlreadyExists", err)
+	}
+
+	if _, err := r.CreateChannel(ctx, "button", &Channel{Name: "beta", Targets: []ChannelTarget{{Version: "3.0.0"}}}); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("CreateChannel to a missing version = %v, want ErrVersionNotFound", err)
+	}
+
+	if _, err := r.RollbackChannel(ctx, "button", "stable"); !errors.Is(err, ErrPrecondition) {
+		t.Errorf("RollbackChannel of a channel never promoted = %v, want ErrPrecondition", err)
+	}
+
+	promoted, err := r.PromoteChannel(ctx, "button", "stable", []ChannelTarget{{Version: "1.0.0", Weight: 90}, {Version: "2.0.0", Weight: 10}})
+	if err != nil {
+		t.Fatalf("PromoteChannel: %v", err)
+	}
+
+	if promoted.Revision != 2 || len(promoted.Targets) != 2 {
+		t.Errorf("PromoteChannel = %+v", promoted)
+	}
+
+	rolledBack, err := r.RollbackChannel(ctx, "button", "stable")
+	if err != nil {
+		t.Fatalf("RollbackChannel: %v", err)
+	}
+
+	if rolledBack.Revision != 3 || len(rolledBack.Targets) != 1 || rolledBack.Targets[0].Version != "1.0.0" {
+		t.Errorf("RollbackChannel = %+v, want the targets before the promotion", rolledBack)
+	}
+
+	channel, err := r.GetChannel(ctx, "button", "stable")
+	if err != nil || channel.Revision != 3 {
+		t.Errorf("GetChannel = %+v, %v", channel, err)
+	}
+
+	if _, err := r.GetChannel(ctx, "button", "beta"); !errors.Is(err, ErrChannelNotFound) {
+		t.Errorf("GetChannel of a missing channel = %v, want ErrChannelNotFound", err)
+	}
+
+	if channels, err := r.ListChannels(ctx, "button"); err != nil || len(channels) != 1 {
+		t.Errorf("ListChannels = %v, %v", channels, err)
+	}
+
+	if _, err := r.ListChannels(ctx, "missing"); !errors.Is(err, ErrPackageNotFound) {
+		t.Errorf("ListChannels of a missing package = %v, want ErrPackageNotFound", err)
+	}
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// recordEvents appends events to the outbox and numbers them. The caller
+// holds r.mu for the mutation that made the changes.
+func (r *MemoryRepository) recordEvents(events ...*OutboxEvent) {
+	for _, event := range events {
+		if event != nil {
+			r.outboxSequence++
+			event.Sequence = r.outboxSequence
+			r.outboxEvents = append(r.outboxEvents, copyOutboxEvent(event))
+		}
+	}
+}
+
+func (r *MemoryRepository) ListPendingOutboxEvents(ctx context.Context, limit int) ([]*OutboxEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var events []*OutboxEvent
+	for _, event := range r.outboxEvents {
+		if limit > 0 && len(events) == limit {
+			break
+		}
+
+		if event.DeliveredAt.IsZero() {
+			events = append(events, copyOutboxEvent(event))
+		}
+	}
+
+	return events, nil
+}
+
+func (r *MemoryRepository) ListOutboxEvents(ctx context.Context, afterSequence uint64, limit int) ([]*OutboxEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var events []*OutboxEvent
+	for _, event := range r.outboxEvents {
+		if limit > 0 && len(events) == limit {
+			break
+		}
+
+		if event.Sequence > afterSequence {
+			events = append(events, copyOutboxEvent(event))
+		}
+	}
+
+	return events, nil
+}
+
+func (r *MemoryRepository) LatestOutboxSequence(ctx context.Context) (uint64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.outboxSequence, nil
+}
+
+func (r *MemoryRepository) MarkOutboxEventsDelivered(ctx context.Context, ids []string, deliveredAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delivered := map[string]bool{}
+	for _, id := range ids {
+		delivered[id] = true
+	}
+
+	for _, event := range r.outboxEvents {
+		if delivered[event.ID] && event.DeliveredAt.IsZero() {
+			event.DeliveredAt = deliveredAt
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) PurgeOutboxEvents(ctx context.Context, deliveredBefore time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	purged := 0
+	events := r.outboxEvents[:0]
+	for _, event := range r.outboxEvents {
+		if !event.DeliveredAt.IsZero() && event.DeliveredAt.Before(deliveredBefore) {
+			purged++
+			continue
+		}
+
+		events = append(events, event)
+	}
+	r.outboxEvents = events
+
+	return purged, nil
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+)
+
+func TestMemoryRepositoryOutbox(t *testing.T) {
+	ctx := WithActor(context.Background(), "alice")
+	r := newTestMemoryRepository(t)
+
+	if _, err := r.CreatePackage(ctx, &polvo_v1.Package{Name: "button", Maintainer: "alice"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	for name, weight := range map[string]uint32{"1.0.0": 100, "2.0.0": 0} {
+		if _, err := r.CreateVersion(ctx, "button", &polvo_v1.Version{Name: name, Weight: weight}, nil, nil); err != nil {
+			t.Fatalf("CreateVersion(%q): %v", name, err)
+		}
+	}
+
+	events, err := r.ListPendingOutboxEvents(ctx, 0)
+	if err != nil {
+		t.Fatalf("ListPendingOutboxEvents: %v", err)
+	}
+
+	if len(events) != 3 || events[0].Type != EventPackageCreated || events[1].Type != EventVersionCreated || events[2].Type != EventVersionCreated {
+		t.Fatalf("pending events = %+v, want the package then its versions", events)
+	}
+
+	if events[0].Actor != "alice" || events[0].ID == "" || events[1].Version == "" || events[1].VersionState == nil {
+		t.Errorf("first events = %+v, %+v", events[0], events[1])
+	}
+
+	if limited, _ := r.ListPendingOutboxEvents(ctx, 2); len(limited) != 2 || limited[0].ID != events[0].ID {
+		t.Errorf("ListPendingOutboxEvents(2) = %+v, want the first two events", limited)
+	}
+
+	deliveredAt := time.Now().Add(-time.Hour)
+	if err := r.MarkOutboxEventsDelivered(ctx, []string{events[0].ID, events[1].ID}, deliveredAt); err != nil {
+		t.Fatalf("MarkOutboxEventsDelivered: %v", err)
+	}
+
+	if pending, _ := r.ListPendingOutboxEvents(ctx, 0); len(pending) != 1 || pending[0].ID != events[2].ID {
+		t.Errorf("pending events after the delivery = %+v, want the last one", pending)
+	}
+
+	// Only the delivered events older than the retention are purged.
+	if purged, err := r.PurgeOutboxEvents(ctx, deliveredAt); err != nil || purged != 0 {
+		t.Errorf("PurgeOutboxEvents at the delivery = %d, %v, want none", purged, err)
+	}
+
+	if purged, err := r.PurgeOutboxEvents(ctx, time.Now()); err != nil || purged != 2 {
+		t.Errorf("PurgeOutboxEvents = %d, %v, want the delivered ones", purged, err)
+	}
+
+	if pending, _ := r.ListPendingOutboxEvents(ctx, 0); len(pending) != 1 {
+		t.Errorf("pending events after the purge = %+v, want the last one", pending)
+	}
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func (r *MemoryRepository) findRollout(id string) (*Rollout, error) {
+	for _, rollout := range r.rollouts {
+		if rollout.ID == id {
+			return rollout, nil
+		}
+	}
+
+	return nil, errors.Wrapf(ErrRolloutNotFound, "rollout %s", id)
+}
+
+func (r *MemoryRepository) CreateRollout(ctx context.Context, rollout *Rollout) (*Rollout, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.livePackage(rollout.Package); err != nil {
+		return nil, err
+	}
+
+	for _, existing := range r.rollouts {
+		if existing.Package == rollout.Package && existing.State.IsActive() {
+			return nil, errors.Wrapf(ErrAlreadyExists, "active rollout %s of package %s", existing.ID, rollout.Package)
+		}
+	}
+
+	now := time.Now()
+	saved := copyRollout(rollout)
+	saved.ID = newID()
+	saved.Revision = 1
+	saved.CreatedAt = now
+	saved.UpdatedAt = now
+
+	r.rollouts = append(r.rollouts, saved)
+	r.recordAudit(ctx, copyRollout(saved))
+
+	return copyRollout(saved), nil
+}
+
+func (r *MemoryRepository) GetRollout(ctx context.Context, id string) (*Rollout, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rollout, err := r.findRollout(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyRollout(rollout), nil
+}
+
+func (r *MemoryRepository) ListRollouts(ctx context.Context, packageName string) ([]*Rollout, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, err := r.livePackage(packageName); err != nil {
+		return nil, err
+	}
+
+	var rollouts []*Rollout
+	for _, rollout := range r.rollouts {
+		if rollout.Package == packageName {
+			rollouts = append(rollouts, copyRollout(rollout))
+		}
+	}
+
+	sortRollouts(rollouts)
+
+	return rollouts, nil
+}
+
+func (r *MemoryRepository) ListDueRollouts(ctx context.Context, now time.Time) ([]*Rollout, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var rollouts []*Rollout
+	for _, rollout := range r.rollouts {
+		if rollout.State == RolloutRunning && !rollout.NextStepAt.After(now) {
+			rollouts = append(rollouts, copyRollout(rollout))
+		}
+	}
+
+	return rollouts, nil
+}
+
+func (r *MemoryRepository) UpdateRollout(ctx context.Context, rollout *Rollout) (*Rollout, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	saved, err := r.findRollout(rollout.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if saved.Revision != rollout.Revision {
+		return nil, errors.Wrapf(ErrConflict, "rollout %s was changed since revision %d", rollout.ID, rollout.Revision)
+	}
+
+	*saved = *copyRollout(rollout)
+	saved.Revision++
+	saved.UpdatedAt = time.Now()
+	r.recordAudit(ctx, copyRollout(saved))
+
+	return copyRollout(saved), nil
+}
+
+func (r *MemoryRepository) purgeRollouts(packageName string) {
+	rollouts := r.rollouts[:0]
+	for _, rollout := range r.rollouts {
+		if rollout.Package != packageName {
+			rollouts = append(rollouts, rollout)
+		}
+	}
+	r.rollouts = rollouts
+}
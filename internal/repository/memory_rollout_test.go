@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestMemoryRepositoryRollouts(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	mustCreatePackage(t, r, "button", "alice")
+	mustCreateVersion(t, r, "button", "1.0.0", 100)
+	mustCreateVersion(t, r, "button", "2.0.0", 0)
+
+	now := time.Now()
+	rollout, err := r.CreateRollout(ctx, &Rollout{
+		Package:    "button",
+		Version:    "2.0.0",
+		Steps:      []RolloutStep{{Weight: 10}, {Weight: 100, After: time.Hour}},
+		Baseline:   map[string]uint32{"1.0.0": 100, "2.0.0": 0},
+		State:      RolloutRunning,
+		Step:       -1,
+		NextStepAt: now,
+	})
+	if err != nil {
+		t.Fatalf("CreateRollout: %v", err)
+	}
+
+	if rollout.ID == "" || rollout.Revision != 1 {
+		t.Errorf("CreateRollout = %+v, want an id and revision 1", rollout)
+	}
+
+	if _, err := r.CreateRollout(ctx, &Rollout{Package: "button", Version: "1.0.0", State: RolloutRunning}); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("CreateRollout of a second active rollout error = %v, want ErrAlreadyExists", err)
+	}
+
+	due, err := r.ListDueRollouts(ctx, now)
+	if err != nil || len(due) != 1 || due[0].ID != rollout.ID {
+		t.Errorf("ListDueRollouts = %v, %v, want the rollout", due, err)
+	}
+
+	if due, _ := r.ListDueRollouts(ctx, now.Add(-time.Second)); len(due) != 0 {
+		t.Errorf("ListDueRollouts before the next step = %v, want none", due)
+	}
+
+	rollout.State = RolloutPaused
+	paused, err := r.UpdateRollout(ctx, rollout)
+	if err != nil || paused.Revision != 2 || paused.State != RolloutPaused {
+		t.Fatalf("UpdateRollout = %+v, %v", paused, err)
+	}
+
+	// The rollout changed since it was read.
+	rollout.State = RolloutAborted
+	if _, err := r.UpdateRollout(ctx, rollout); !errors.Is(err, ErrConflict) {
+		t.Errorf("UpdateRollout of a stale rollout error = %v, want ErrConflict", err)
+	}
+
+	if got, err := r.GetRollout(ctx, rollout.ID); err != nil || got.State != RolloutPaused || got.Steps[1].After != time.Hour {
+		t.Errorf("GetRollout = %+v, %v", got, err)
+	}
+
+	if _, err := r.GetRollout(ctx, "missing"); !errors.Is(err, ErrRolloutNotFound) {
+		t.Errorf("GetRollout(missing) error = %v, want ErrRolloutNotFound", err)
+	}
+
+	rollouts, err := r.ListRollouts(ctx, "button")
+	if err != nil || len(rollouts) != 1 {
+		t.Errorf("ListRollouts = %v, %v, want the rollout", rollouts, err)
+	}
+}
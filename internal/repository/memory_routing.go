@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func (p *memoryPackage) routingEntries() []RoutingEntry {
+	var entries []RoutingEntry
+	for _, version := range p.versions {
+		if version.deletedAt == nil {
+			entries = append(entries, RoutingEntry{
+				Version:     version.name,
+				ManifestUrl: version.manifestUrl,
+				Weight:      version.weight,
+			})
+		}
+	}
+
+	sortRoutingEntries(entries)
+
+	return entries
+}
+
+func (p *memoryPackage) latestRoutingRevision() *RoutingRevision {
+	if len(p.routingRevisions) == 0 {
+		return nil
+	}
+
+	return p.routingRevisions[len(p.routingRevisions)-1]
+}
+
+// recordRoutingRevision appends the current routing state unless it is the
+// same as the latest revision, and returns the latest revision.
+func (p *memoryPackage) recordRoutingRevision(now time.Time) *RoutingRevision {
+	latest := p.latestRoutingRevision()
+	entries := p.routingEntries()
+
+	if !isRoutingChanged(latest, entries) {
+		return latest
+	}
+
+	revision := &RoutingRevision{
+		Revision:  1,
+		Entries:   entries,
+		CreatedAt: now,
+	}
+	if latest != nil {
+		revision.Revision = latest.Revision + 1
+	}
+
+	p.routingRevisions = append(p.routingRevisions, revision)
+
+	return revision
+}
+
+func (r *MemoryRepository) ListRoutingRevisions(ctx context.Context, packageName string) ([]*RoutingRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pkg, err := r.livePackage(packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]*RoutingRevision, 0, len(pkg.routingRevisions))
+	for i := len(pkg.routingRevisions) - 1; i >= 0; i-- {
+		revision := *pkg.routingRevisions[i]
+		revision.Entries = append([]RoutingEntry(nil), revision.Entries...)
+		revisions = append(revisions, &revision)
+	}
+
+	return revisions, nil
+}
+
+func (r *MemoryRepository) RollbackPackage(ctx context.Context, packageName string, revision int64) (*RoutingRevision, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pkg, err := r.livePackage(packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	var target *RoutingRevision
+	for _, recorded := range pkg.routingRevisions {
+		if recorded.Revision == revision {
+			target = recorded
+		}
+	}
+
+	if target == nil {
+		return nil, errors.Wrapf(ErrPrecondition, "package %s has no routing revision %d", packageName, revision)
+	}
+
+	for _, entry := range target.Entries {
+		if pkg.findLiveVersion(entry.Version) == nil {
+			return nil, errors.Wrapf(ErrPrecondition, "version %s of routing revision %d of package %s is deleted", entry.Version, revision, packageName)
+		}
+	}
+
+	restored := map[string]RoutingEntry{}
+	for _, entry := range target.Entries {
+		restored[entry.Version] = entry
+	}
+
+	return r.applyRouting(ctx, pkg, restored), nil
+}
+
+func (r *MemoryRepository) SetPackageWeights(ctx context.Context, packageName string, weights map[string]uint32) (*RoutingRevision, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pkg, err := r.livePackage(packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := map[string]RoutingEntry{}
+	for name, weight := range weights {
+		version := pkg.findLiveVersion(name)
+		if version == nil {
+			return nil, errors.Wrapf(ErrVersionNotFound, "version %s of package %s", name, packageName)
+		}
+
+		entries[name] = RoutingEntry{
+			Version:     name,
+			ManifestUrl: version.manifestUrl,
+			Weight:      weight,
+		}
+	}
+
+	return r.applyRouting(ctx, pkg, entries), nil
+}
+
+// applyRouting sets the manifest and weight of every live version from
+// entries, versions without an entry get no weight. The routing state before
+// and after is recorded with the events of the change, and a copy of the
+// latest revision is returned.
+func (r *MemoryRepository) applyRouting(ctx context.Context, pkg *memoryPackage, entries map[string]RoutingEntry) *RoutingRevision {
+	now := time.Now()
+	previous := pkg.recordRoutingRevision(now)
+
+	for _, version := range pkg.versions {
+		if version.deletedAt != nil {
+			continue
+		}
+
+		entry, ok := entries[version.name]
+		if !ok {
+			entry = RoutingEntry{ManifestUrl: version.manifestUrl}
+		}
+
+		if version.manifestUrl != entry.ManifestUrl || version.weight != entry.Weight {
+			version.manifestUrl = entry.ManifestUrl
+			version.weight = entry.Weight
+			version.updatedAt = now
+		}
+	}
+
+	latest := pkg.recordRoutingRevision(now)
+	r.recordEvents(newRoutingEvents(ctx, pkg.name, previous, latest, now)...)
+
+	saved := &RoutingRevision{}
+	if latest != nil {
+		*saved = *latest
+		saved.Entries = append([]RoutingEntry(nil), latest.Entries...)
+	}
+
+	r.recordAudit(ctx, saved)
+
+	return saved
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestMemoryRepositoryRollbackPackage(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	mustCreatePackage(t, r, "button", "alice")
+	mustCreateVersion(t, r, "button", "1.0.0", 100)
+	mustCreateVersion(t, r, "button", "2.0.0", 0)
+
+	if _, err := r.UpdateVersion(ctx, "button", "2.0.0", map[string]interface{}{"Weight": uint32(100)}); err != nil {
+		t.Fatalf("UpdateVersion: %v", err)
+	}
+
+	// An update that changes nothing records no revision.
+	if _, err := r.UpdateVersion(ctx, "button", "2.0.0", map[string]interface{}{"Weight": uint32(100)}); err != nil {
+		t.Fatalf("UpdateVersion: %v", err)
+	}
+
+	revisions, err := r.ListRoutingRevisions(ctx, "button")
+	if err != nil {
+		t.Fatalf("ListRoutingRevisions: %v", err)
+	}
+
+	if len(revisions) != 3 || revisions[0].Revision != 3 || revisions[2].Revision != 1 {
+		t.Fatalf("ListRoutingRevisions = %+v, want the revisions 3, 2 and 1", revisions)
+	}
+
+	restored, err := r.RollbackPackage(ctx, "button", 2)
+	if err != nil {
+		t.Fatalf("RollbackPackage: %v", err)
+	}
+
+	if restored.Revision != 4 || !routingEntriesEqual(restored.Entries, revisions[1].Entries) {
+		t.Errorf("RollbackPackage = %+v, want revision 4 with the entries of revision 2", restored)
+	}
+
+	if version, _ := r.GetVersion(ctx, "button", "2.0.0"); version.GetWeight() != 0 {
+		t.Errorf("weight of 2.0.0 after the rollback = %d, want 0", version.GetWeight())
+	}
+
+	// Versions created after the revision get no weight.
+	mustCreateVersion(t, r, "button", "3.0.0", 100)
+	if _, err := r.RollbackPackage(ctx, "button", 1); err != nil {
+		t.Fatalf("RollbackPackage: %v", err)
+	}
+
+	if version, _ := r.GetVersion(ctx, "button", "3.0.0"); version.GetWeight() != 0 {
+		t.Errorf("weight of 3.0.0 after the rollback = %d, want 0", version.GetWeight())
+	}
+
+	if _, err := r.RollbackPackage(ctx, "button", 42); !errors.Is(err, ErrPrecondition) {
+		t.Errorf("RollbackPackage to a missing revision error = %v, want ErrPrecondition", err)
+	}
+
+	if err := r.DeleteVersion(ctx, "button", "2.0.0"); err != nil {
+		t.Fatalf("DeleteVersion: %v", err)
+	}
+
+	if _, err := r.RollbackPackage(ctx, "button", 3); !errors.Is(err, ErrPrecondition) {
+		t.Errorf("RollbackPackage to a revision with a deleted version error = %v, want ErrPrecondition", err)
+	}
+
+	if _, err := r.ListRoutingRevisions(ctx, "card"); !errors.Is(err, ErrPackageNotFound) {
+		t.Errorf("ListRoutingRevisions(card) error = %v, want ErrPackageNotFound", err)
+	}
+}
+
+func TestMemoryRepositorySetPackageWeights(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	mustCreatePackage(t, r, "button", "alice")
+	mustCreateVersion(t, r, "button", "1.0.0", 100)
+	mustCreateVersion(t, r, "button", "2.0.0", 0)
+	mustCreateVersion(t, r, "button", "3.0.0", 0)
+
+	revision, err := r.SetPackageWeights(ctx, "button", map[string]uint32{"1.0.0": 90, "2.0.0": 10})
+	if err != nil {
+		t.Fatalf("SetPackageWeights: %v", err)
+	}
+
+	want := []RoutingEntry{
+		{Version: "1.0.0", ManifestUrl: "https://cdn.example.com/1.0.0.json", Weight: 90},
+		{Version: "2.0.0", ManifestUrl: "https://cdn.example.com/2.0.0.json", Weight: 10},
+		{Version: "3.0.0", ManifestUrl: "https://cdn.example.com/3.0.0.json", Weight: 0},
+	}
+	if !routingEntriesEqual(revision.Entries, want) {
+		t.Errorf("SetPackageWeights = %+v, want %+v", revision.Entries, want)
+	}
+
+	// Versions missing from the weights get no weight.
+	if _, err := r.SetPackageWeights(ctx, "button", map[string]uint32{"3.0.0": 100}); err != nil {
+		t.Fatalf("SetPackageWeights: %v", err)
+	}
+
+	if version, _ := r.GetHeaviestVersion(ctx, "button"); version.GetName() != "3.0.0" {
+		t.Errorf("heaviest version = %v, want 3.0.0", version)
+	}
+
+	// Nothing changes when a version is missing.
+	if _, err := r.SetPackageWeights(ctx, "button", map[string]uint32{"1.0.0": 50, "4.0.0": 50}); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("SetPackageWeights with a missing version error = %v, want ErrVersionNotFound", err)
+	}
+
+	if version, _ := r.GetVersion(ctx, "button", "1.0.0"); version.GetWeight() != 0 {
+		t.Errorf("weight of 1.0.0 = %d, want 0", version.GetWeight())
+	}
+}
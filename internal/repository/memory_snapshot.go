@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+)
+
+func (r *MemoryRepository) GetPackageSnapshots(ctx context.Context, packageNames []string) (map[string]*PackageSnapshot, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	snapshots := map[string]*PackageSnapshot{}
+	for _, packageName := range packageNames {
+		pkg, err := r.livePackage(packageName)
+		if err != nil {
+			continue
+		}
+
+		snapshot := &PackageSnapshot{
+			Package: pkg.toProto(),
+		}
+
+		for _, version := range pkg.versions {
+			if version.deletedAt == nil {
+				snapshot.Versions = append(snapshot.Versions, version.toDetails())
+			}
+		}
+		sortSnapshotVersions(snapshot.Versions)
+
+		for _, channel := range pkg.channels {
+			snapshot.Channels = append(snapshot.Channels, channel.toChannel(pkg))
+		}
+
+		snapshots[packageName] = snapshot
+	}
+
+	return snapshots, nil
+}
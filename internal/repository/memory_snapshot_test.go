@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMemoryRepositoryPackageSnapshots(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	mustCreatePackage(t, r, "button", "alice")
+	mustCreateVersion(t, r, "button", "1.0.0", 10)
+	mustCreateVersion(t, r, "button", "2.0.0", 90)
+	mustCreateVersion(t, r, "button", "3.0.0", 90)
+	mustCreatePackage(t, r, "card", "bob")
+
+	if err := r.DeleteVersion(ctx, "button", "3.0.0"); err != nil {
+		t.Fatalf("DeleteVersion: %v", err)
+	}
+
+	snapshots, err := r.GetPackageSnapshots(ctx, []string{"button", "card", "missing"})
+	if err != nil {
+		t.Fatalf("GetPackageSnapshots: %v", err)
+	}
+
+	// Missing packages have no snapshot.
+	if len(snapshots) != 2 || snapshots["card"] == nil || len(snapshots["card"].Versions) != 0 {
+		t.Fatalf("GetPackageSnapshots = %v, want button and card", snapshots)
+	}
+
+	var names []string
+	for _, version := range snapshots["button"].Versions {
+		names = append(names, version.Version.GetName())
+	}
+
+	if want := []string{"2.0.0", "1.0.0"}; !equalStrings(names, want) {
+		t.Errorf("versions of button = %v, want the live versions heaviest first %v", names, want)
+	}
+}
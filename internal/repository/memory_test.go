@@ -0,0 +1,726 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/labels"
+)
+
+func newTestMemoryRepository(t *testing.T) *MemoryRepository {
+	t.Helper()
+
+	r, err := NewMemoryRepository()
+	if err != nil {
+		t.Fatalf("NewMemoryRepository: %v", err)
+	}
+
+	return r
+}
+
+func mustCreatePackage(t *testing.T, r Repository, name, maintainer string) {
+	t.Helper()
+
+	if _, err := r.CreatePackage(context.Background(), &polvo_v1.Package{Name: name, Maintainer: maintainer}, nil); err != nil {
+		t.Fatalf("CreatePackage(%q): %v", name, err)
+	}
+}
+
+func mustCreateVersion(t *testing.T, r Repository, packageName, versionName string, weight uint32) {
+	t.Helper()
+
+	version := &polvo_v1.Version{Name: versionName, ManifestUrl: "https://cdn.example.com/" + versionName + ".json", Weight: weight}
+	if _, err := r.CreateVersion(context.Background(), packageName, version, nil, nil); err != nil {
+		t.Fatalf("CreateVersion(%q, %q): %v", packageName, versionName, err)
+	}
+}
+
+func versionNames(versions []*polvo_v1.Version) []string {
+	names := make([]string, 0, len(versions))
+	for _, version := range versions {
+		names = append(names, version.GetName())
+	}
+
+	return names
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestNewRepositoryDriver(t *testing.T) {
+	defer os.Unsetenv("REPOSITORY_DRIVER")
+
+	os.Setenv("REPOSITORY_DRIVER", "memory")
+	r, err := NewRepository()
+	if err != nil {
+		t.Fatalf("NewRepository: %v", err)
+	}
+
+	if _, ok := r.(*MemoryRepository); !ok {
+		t.Errorf("NewRepository with the memory driver = %T", r)
+	}
+
+	os.Setenv("REPOSITORY_DRIVER", "postgres")
+	if _, err := NewRepository(); err == nil {
+		t.Error("NewRepository with an unknown driver did not fail")
+	}
+}
+
+func TestMemoryRepositoryPackages(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	mustCreatePackage(t, r, "button", "alice")
+	mustCreatePackage(t, r, "input", "alice")
+
+	pkg, err := r.GetPackage(ctx, "button")
+	if err != nil || pkg.GetMaintainer() != "alice" {
+		t.Errorf("GetPackage = %+v, %v", pkg, err)
+	}
+
+	if _, err := r.CreatePackage(ctx, &polvo_v1.Package{Name: "button"}, nil); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("CreatePackage of an existing name = %v, want ErrAlreadyExists", err)
+	}
+
+	updated, err := r.UpdatePackage(ctx, "button", map[string]interface{}{"Name": "buttons", "Maintainer": "bob"})
+	if err != nil {
+		t.Fatalf("UpdatePackage: %v", err)
+	}
+
+	if updated.GetName() != "buttons" || updated.GetMaintainer() != "bob" {
+		t.Errorf("UpdatePackage = %+v", updated)
+	}
+
+	if _, err := r.GetPackage(ctx, "button"); !errors.Is(err, ErrPackageNotFound) {
+		t.Errorf("GetPackage of the old name = %v, want ErrPackageNotFound", err)
+	}
+
+	if _, err := r.UpdatePackage(ctx, "buttons", map[string]interface{}{"Name": "input"}); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("UpdatePackage to an existing name = %v, want ErrAlreadyExists", err)
+	}
+
+	page, err := r.ListPackages(ctx, ListPackagesOptions{Maintainer: "bob"})
+	if err != nil {
+		t.Fatalf("ListPackages: %v", err)
+	}
+
+	if len(page.Packages) != 1 || page.Packages[0].Package.GetName() != "buttons" {
+		t.Errorf("ListPackages by maintainer = %+v", page.Packages)
+	}
+
+	if err := r.DeletePackage(ctx, "buttons"); err != nil {
+		t.Fatalf("DeletePackage: %v", err)
+	}
+
+	if exists, err := r.IsPackageExists(ctx, "buttons"); err != nil || exists {
+		t.Errorf("IsPackageExists of a deleted package = %v, %v", exists, err)
+	}
+}
+
+func TestMemoryRepositoryPackageMetadata(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	metadata := &PackageMetadata{Description: "Buttons", Tags: []string{"ui"}, Owners: []string{"team-a"}}
+	if _, err := r.CreatePackage(ctx, &polvo_v1.Package{Name: "button", Maintainer: "alice"}, metadata); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+	mustCreatePackage(t, r, "input", "alice")
+
+	// The stored metadata must not share the caller's slices.
+	metadata.Tags[0] = "changed"
+
+	details, err := r.GetPackageDetails(ctx, "button")
+	if err != nil {
+		t.Fatalf("GetPackageDetails: %v", err)
+	}
+
+	if details.Metadata.Description != "Buttons" || !equalStrings(details.Metadata.Tags, []string{"ui"}) || !equalStrings(details.Metadata.Owners, []string{"team-a"}) {
+		t.Errorf("GetPackageDetails metadata = %+v", details.Metadata)
+	}
+
+	// Only the fields found in the update change.
+	if _, err := r.UpdatePackage(ctx, "button", map[string]interface{}{TagsField: []string{"ui", "forms"}, IconUrlField: "https://cdn.example.com/button.svg"}); err != nil {
+		t.Fatalf("UpdatePackage: %v", err)
+	}
+
+	details, err = r.GetPackageDetails(ctx, "button")
+	if err != nil {
+		t.Fatalf("GetPackageDetails: %v", err)
+	}
+
+	if details.Metadata.Description != "Buttons" || details.Metadata.IconUrl == "" || !equalStrings(details.Metadata.Tags, []string{"ui", "forms"}) {
+		t.Errorf("updated metadata = %+v", details.Metadata)
+	}
+
+	for _, test := range []struct {
+		options ListPackagesOptions
+		want    []string
+	}{
+		{ListPackagesOptions{Tag: "forms"}, []string{"button"}},
+		{ListPackagesOptions{Owner: "team-a"}, []string{"button"}},
+		{ListPackagesOptions{Owner: "team-b"}, nil},
+		{ListPackagesOptions{}, []string{"button", "input"}},
+	} {
+		page, err := r.ListPackages(ctx, test.options)
+		if err != nil {
+			t.Fatalf("ListPackages(%+v): %v", test.options, err)
+		}
+
+		var names []string
+		for _, details := range page.Packages {
+			names = append(names, details.Package.GetName())
+		}
+
+		if !equalStrings(names, test.want) {
+			t.Errorf("ListPackages(%+v) = %v, want %v", test.options, names, test.want)
+		}
+	}
+}
+
+func TestMemoryRepositoryListPackagesPages(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	for _, name := range []string{"delta", "alpha", "charlie", "bravo", "echo"} {
+		mustCreatePackage(t, r, name, "alice")
+	}
+
+	var names []string
+	options := ListPackagesOptions{PageSize: 2}
+	for {
+		page, err := r.ListPackages(ctx, options)
+		if err != nil {
+			t.Fatalf("ListPackages: %v", err)
+		}
+
+		for _, pkg := range page.Packages {
+			names = append(names, pkg.Package.GetName())
+		}
+
+		if page.NextPageToken == "" {
+			break
+		}
+
+		options.PageToken = page.NextPageToken
+	}
+
+	if want := []string{"alpha", "bravo", "charlie", "delta", "echo"}; !equalStrings(names, want) {
+		t.Errorf("pages = %v, want %v", names, want)
+	}
+
+	if _, err := r.ListPackages(ctx, ListPackagesOptions{PageToken: "not a token"}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("ListPackages with a malformed token = %v, want ErrInvalidArgument", err)
+	}
+}
+
+func TestMemoryRepositoryVersions(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	mustCreatePackage(t, r, "button", "alice")
+	mustCreateVersion(t, r, "button", "1.0.0", 10)
+	mustCreateVersion(t, r, "button", "1.1.0", 90)
+	mustCreateVersion(t, r, "button", "2.0.0", 0)
+
+	if _, err := r.CreateVersion(ctx, "missing", &polvo_v1.Version{Name: "1.0.0"}, nil, nil); !errors.Is(err, ErrPackageNotFound) {
+		t.Errorf("CreateVersion in a missing package = %v, want ErrPackageNotFound", err)
+	}
+
+	if _, err := r.CreateVersion(ctx, "button", &polvo_v1.Version{Name: "1.0.0"}, nil, nil); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("CreateVersion of an existing name = %v, want ErrAlreadyExists", err)
+	}
+
+	versions, err := r.ListVersions(ctx, "button")
+	if err != nil {
+		t.Fatalf("ListVersions: %v", err)
+	}
+
+	if want := []string{"1.1.0", "1.0.0", "2.0.0"}; !equalStrings(versionNames(versions), want) {
+		t.Errorf("ListVersions = %v, want %v", versionNames(versions), want)
+	}
+
+	heaviest, err := r.GetHeaviestVersion(ctx, "button")
+	if err != nil || heaviest.GetName() != "1.1.0" {
+		t.Errorf("GetHeaviestVersion = %v, %v, want 1.1.0", heaviest, err)
+	}
+
+	if _, err := r.UpdateVersion(ctx, "button", "2.0.0", map[string]interface{}{"Weight": uint32(100)}); err != nil {
+		t.Fatalf("UpdateVersion: %v", err)
+	}
+
+	version, err := r.GetVersion(ctx, "button", "2.0.0")
+	if err != nil || version.GetWeight() != 100 {
+		t.Errorf("GetVersion = %+v, %v, want weight 100", version, err)
+	}
+
+	if _, err := r.UpdateVersion(ctx, "button", "2.0.0", map[string]interface{}{"Name": "1.0.0"}); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("UpdateVersion to an existing name = %v, want ErrAlreadyExists", err)
+	}
+
+	if _, err := r.GetVersion(ctx, "button", "3.0.0"); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("GetVersion of a missing version = %v, want ErrVersionNotFound", err)
+	}
+
+	if err := r.DeleteVersion(ctx, "button", "2.0.0"); err != nil {
+		t.Fatalf("DeleteVersion: %v", err)
+	}
+
+	if exists, err := r.IsVersionExists(ctx, "button", "2.0.0"); err != nil || exists {
+		t.Errorf("IsVersionExists of a deleted version = %v, %v", exists, err)
+	}
+}
+
+func TestMemoryRepositoryVersionLabels(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	mustCreatePackage(t, r, "button", "alice")
+	mustCreateVersion(t, r, "button", "1.0.0", 50)
+
+	versionLabels := map[string]string{"env": "prod", "tier": "web"}
+	if _, err := r.CreateVersion(ctx, "button", &polvo_v1.Version{Name: "2.0.0", Weight: 50}, nil, versionLabels); err != nil {
+		t.Fatalf("CreateVersion: %v", err)
+	}
+
+	// The stored labels must not share the caller's map.
+	versionLabels["env"] = "changed"
+
+	details, err := r.GetVersionDetails(ctx, "button", "2.0.0")
+	if err != nil || details.Labels["env"] != "prod" || details.Labels["tier"] != "web" {
+		t.Fatalf("GetVersionDetails = %+v, %v", details, err)
+	}
+
+	if details, err := r.GetVersionDetails(ctx, "button", "1.0.0"); err != nil || details.Labels != nil {
+		t.Errorf("labels of a version without labels = %v, %v, want nil", details.Labels, err)
+	}
+
+	selected := func(expression string) []string {
+		selector, err := labels.ParseSelector(expression)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q): %v", expression, err)
+		}
+
+		page, err := r.ListVersionDetails(ctx, "button", ListVersionsOptions{OrderBy: OrderByName, LabelSelector: selector})
+		if err != nil {
+			t.Fatalf("ListVersionDetails(%q): %v", expression, err)
+		}
+
+		var names []string
+		for _, details := range page.Versions {
+			names = append(names, details.Version.GetName())
+		}
+
+		return names
+	}
+
+	for expression, want := range map[string][]string{
+		"":                  {"1.0.0", "2.0.0"},
+		"env=prod":          {"2.0.0"},
+		"env!=prod":         {"1.0.0"},
+		"tier in (web,api)": {"2.0.0"},
+		"!env":              {"1.0.0"},
+	} {
+		if got := selected(expression); !equalStrings(got, want) {
+			t.Errorf("versions selected by %q = %v, want %v", expression, got, want)
+		}
+	}
+
+	// LabelsField replaces every label.
+	if _, err := r.UpdateVersion(ctx, "button", "2.0.0", map[string]interface{}{LabelsField: map[string]string{"env": "staging"}}); err != nil {
+		t.Fatalf("UpdateVersion: %v", err)
+	}
+
+	if got := selected("env=staging,!tier"); !equalStrings(got, []string{"2.0.0"}) {
+		t.Errorf("versions selected after the update = %v, want 2.0.0", got)
+	}
+}
+
+func TestMemoryRepositoryPinnedManifest(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	mustCreatePackage(t, r, "button", "alice")
+
+	pin := &ManifestPin{SHA256: "abc", Body: []byte(`{}`)}
+	if _, err := r.CreateVersion(ctx, "button", &polvo_v1.Version{Name: "1.0.0", ManifestUrl: "https://cdn.example.com/a.json"}, pin, nil); err != nil {
+		t.Fatalf("CreateVersion: %v", err)
+	}
+
+	saved, err := r.GetManifestPin(ctx, "button", "1.0.0")
+	if err != nil || saved == nil || saved.SHA256 != "abc" || string(saved.Body) != `{}` {
+		t.Errorf("GetManifestPin = %+v, %v", saved, err)
+	}
+
+	_, err = r.UpdateVersion(ctx, "button", "1.0.0", map[string]interface{}{"ManifestUrl": "https://cdn.example.com/b.json"})
+	if !errors.Is(err, ErrPrecondition) {
+		t.Errorf("UpdateVersion of a pinned manifest URL = %v, want ErrPrecondition", err)
+	}
+}
+
+func TestMemoryRepositorySoftDelete(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	mustCreatePackage(t, r, "button", "alice")
+	mustCreateVersion(t, r, "button", "1.0.0", 10)
+	mustCreateVersion(t, r, "button", "2.0.0", 20)
+
+	if err := r.DeleteVersion(ctx, "button", "2.0.0"); err != nil {
+		t.Fatalf("DeleteVersion: %v", err)
+	}
+
+	if exists, _ := r.IsVersionExists(ctx, "button", "2.0.0"); exists {
+		t.Error("a soft deleted version exists")
+	}
+
+	if _, err := r.CreateVersion(ctx, "button", &polvo_v1.Version{Name: "2.0.0"}, nil, nil); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("CreateVersion with the name of a deleted version = %v, want ErrAlreadyExists", err)
+	}
+
+	if _, err := r.UndeleteVersion(ctx, "button", "2.0.0"); err != nil {
+		t.Fatalf("UndeleteVersion: %v", err)
+	}
+
+	if _, err := r.UndeleteVersion(ctx, "button", "2.0.0"); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("UndeleteVersion of a live version = %v, want ErrVersionNotFound", err)
+	}
+
+	if err := r.DeletePackage(ctx, "button"); err != nil {
+		t.Fatalf("DeletePackage: %v", err)
+	}
+
+	if _, err := r.ListVersions(ctx, "button"); !errors.Is(err, ErrPackageNotFound) {
+		t.Errorf("ListVersions of a deleted package = %v, want ErrPackageNotFound", err)
+	}
+
+	if _, err := r.UndeletePackage(ctx, "button"); err != nil {
+		t.Fatalf("UndeletePackage: %v", err)
+	}
+
+	versions, err := r.ListVersions(ctx, "button")
+	if err != nil || len(versions) != 2 {
+		t.Errorf("ListVersions after UndeletePackage = %v, %v, want both versions back", versionNames(versions), err)
+	}
+}
+
+func TestMemoryRepositoryDeleteTwice(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	mustCreatePackage(t, r, "button", "alice")
+	mustCreateVersion(t, r, "button", "1.0.0", 10)
+
+	if err := r.DeleteVersion(ctx, "button", "1.0.0"); err != nil {
+		t.Fatalf("DeleteVersion: %v", err)
+	}
+
+	if err := r.DeleteVersion(ctx, "button", "1.0.0"); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("DeleteVersion of a deleted version = %v, want ErrVersionNotFound", err)
+	}
+
+	if err := r.DeleteVersion(ctx, "button", "3.0.0"); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("DeleteVersion of a missing version = %v, want ErrVersionNotFound", err)
+	}
+
+	if err := r.DeleteVersion(ctx, "input", "1.0.0"); !errors.Is(err, ErrPackageNotFound) {
+		t.Errorf("DeleteVersion of a missing package = %v, want ErrPackageNotFound", err)
+	}
+
+	if err := r.DeletePackage(ctx, "button"); err != nil {
+		t.Fatalf("DeletePackage: %v", err)
+	}
+
+	if err := r.DeletePackage(ctx, "button"); !errors.Is(err, ErrPackageNotFound) {
+		t.Errorf("DeletePackage of a deleted package = %v, want ErrPackageNotFound", err)
+	}
+
+	if err := r.DeletePackage(ctx, "input"); !errors.Is(err, ErrPackageNotFound) {
+		t.Errorf("DeletePackage of a missing package = %v, want ErrPackageNotFound", err)
+	}
+}
+
+func TestMemoryRepositoryPurgeDeleted(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	mustCreatePackage(t, r, "button", "alice")
+	mustCreatePackage(t, r, "input", "alice")
+	mustCreateVersion(t, r, "input", "1.0.0", 10)
+	mustCreateVersion(t, r, "input", "2.0.0", 20)
+
+	if err := r.DeletePackage(ctx, "button"); err != nil {
+		t.Fatalf("DeletePackage: %v", err)
+	}
+
+	if err := r.DeleteVersion(ctx, "input", "2.0.0"); err != nil {
+		t.Fatalf("DeleteVersion: %v", err)
+	}
+
+	result, err := r.PurgeDeleted(ctx, time.Now().Add(-time.Hour))
+	if err != nil || result.Packages != 0 || result.Versions != 0 {
+		t.Errorf("PurgeDeleted before the deletions = %+v, %v, want nothing purged", result, err)
+	}
+
+	result, err = r.PurgeDeleted(ctx, time.Now().Add(time.Second))
+	if err != nil || result.Packages != 1 || result.Versions != 1 {
+		t.Errorf("PurgeDeleted = %+v, %v, want 1 package and 1 version", result, err)
+	}
+
+	// Purging releases the names.
+	mustCreatePackage(t, r, "button", "bob")
+	mustCreateVersion(t, r, "input", "2.0.0", 0)
+}
+
+func TestMemoryRepositoryTimestamps(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	before := time.Now()
+	mustCreatePackage(t, r, "button", "alice")
+	mustCreateVersion(t, r, "button", "1.0.0", 10)
+
+	pkg, err := r.GetPackageDetails(ctx, "button")
+	if err != nil {
+		t.Fatalf("GetPackageDetails: %v", err)
+	}
+
+	if pkg.CreatedAt.Before(before) || !pkg.UpdatedAt.Equal(pkg.CreatedAt) {
+		t.Errorf("a new package was created at %v and updated at %v", pkg.CreatedAt, pkg.UpdatedAt)
+	}
+
+	time.Sleep(time.Millisecond)
+
+	if _, err := r.UpdateVersion(ctx, "button", "1.0.0", map[string]interface{}{"Weight": uint32(20)}); err != nil {
+		t.Fatalf("UpdateVersion: %v", err)
+	}
+
+	version, err := r.GetVersionDetails(ctx, "button", "1.0.0")
+	if err != nil {
+		t.Fatalf("GetVersionDetails: %v", err)
+	}
+
+	if !version.UpdatedAt.After(version.CreatedAt) || version.Version.GetWeight() != 20 {
+		t.Errorf("an updated version was created at %v and updated at %v", version.CreatedAt, version.UpdatedAt)
+	}
+
+	page, err := r.ListVersionDetails(ctx, "button", ListVersionsOptions{})
+	if err != nil || len(page.Versions) != 1 || !page.Versions[0].UpdatedAt.Equal(version.UpdatedAt) {
+		t.Errorf("ListVersionDetails = %+v, %v", page, err)
+	}
+}
+
+func TestMemoryRepositoryListVersionDetails(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	mustCreatePackage(t, r, "button", "alice")
+	mustCreateVersion(t, r, "button", "1.0.0", 10)
+	mustCreateVersion(t, r, "button", "1.1.0", 0)
+	mustCreateVersion(t, r, "button", "2.0.0", 90)
+	mustCreateVersion(t, r, "button", "2.1.0", 0)
+
+	hasWeight := true
+	tests := []struct {
+		options ListVersionsOptions
+		want    []string
+	}{
+		// Heaviest first, the name breaking ties in the same direction.
+		{ListVersionsOptions{}, []string{"2.0.0", "1.0.0", "2.1.0", "1.1.0"}},
+		{ListVersionsOptions{OrderBy: OrderByName, Descending: true}, []string{"2.1.0", "2.0.0", "1.1.0", "1.0.0"}},
+		{ListVersionsOptions{NamePrefix: "2."}, []string{"2.0.0", "2.1.0"}},
+		{ListVersionsOptions{HasWeight: &hasWeight}, []string{"2.0.0", "1.0.0"}},
+	}
+
+	for _, test := range tests {
+		var names []string
+		options := test.options
+		options.PageSize = 1
+		for {
+			page, err := r.ListVersionDetails(ctx, "button", options)
+			if err != nil {
+				t.Fatalf("ListVersionDetails(%+v): %v", options, err)
+			}
+
+			for _, version := range page.Versions {
+				names = append(names, version.Version.GetName())
+			}
+
+			if page.NextPageToken == "" {
+				break
+			}
+
+			options.PageToken = page.NextPageToken
+		}
+
+		if !equalStrings(names, test.want) {
+			t.Errorf("ListVersionDetails(%+v) = %v, want %v", test.options, names, test.want)
+		}
+	}
+}
+
+func TestMemoryRepositoryOutboxSequence(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	if latest, err := r.LatestOutboxSequence(ctx); err != nil || latest != 0 {
+		t.Errorf("LatestOutboxSequence of an empty outbox = %d, %v", latest, err)
+	}
+
+	if _, err := r.CreatePackage(WithActor(ctx, "alice"), &polvo_v1.Package{Name: "button"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+	mustCreateVersion(t, r, "button", "1.0.0", 10)
+	mustCreateVersion(t, r, "button", "1.1.0", 0)
+
+	events, err := r.ListOutboxEvents(ctx, 0, 0)
+	if err != nil {
+		t.Fatalf("ListOutboxEvents: %v", err)
+	}
+
+	for i, event := range events {
+		if event.Sequence != uint64(i+1) {
+			t.Errorf("event %d has the sequence %d", i, event.Sequence)
+		}
+	}
+
+	if events[0].Actor != "alice" || events[1].Actor != "" {
+		t.Errorf("actors = %q, %q, want alice then anonymous", events[0].Actor, events[1].Actor)
+	}
+
+	latest, err := r.LatestOutboxSequence(ctx)
+	if err != nil || latest != uint64(len(events)) {
+		t.Errorf("LatestOutboxSequence = %d, %v, want %d", latest, err, len(events))
+	}
+
+	// Delivered events are still listed, the watchers do not depend on the
+	// relay.
+	if err := r.MarkOutboxEventsDelivered(ctx, []string{events[0].ID, events[1].ID}, time.Now()); err != nil {
+		t.Fatalf("MarkOutboxEventsDelivered: %v", err)
+	}
+
+	after, err := r.ListOutboxEvents(ctx, 1, 1)
+	if err != nil || len(after) != 1 || after[0].ID != events[1].ID {
+		t.Errorf("ListOutboxEvents after 1 = %+v, %v, want the second event", after, err)
+	}
+}
+
+func TestMemoryRepositoryRecordsTheAuditOfChanges(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	auditCtx := WithAudit(ctx, &Audit{
+		Event: &AuditEvent{Actor: "alice", Method: "CreatePackage", Orn: "packages/button", Package: "button", Time: time.Now()},
+		Complete: func(event *AuditEvent, saved interface{}) {
+			event.After = map[string]interface{}{"name": saved.(*polvo_v1.Package).GetName()}
+		},
+	})
+
+	if _, err := r.CreatePackage(auditCtx, &polvo_v1.Package{Name: "button"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	// A change that fails records nothing.
+	if _, err := r.CreatePackage(auditCtx, &polvo_v1.Package{Name: "button"}, nil); !errors.Is(err, ErrAlreadyExists) {
+		t.Fatalf("CreatePackage of an existing package = %v", err)
+	}
+
+	// Nor does a change made without an audit.
+	mustCreateVersion(t, r, "button", "1.0.0", 10)
+
+	page, err := r.ListAuditEvents(ctx, ListAuditEventsOptions{})
+	if err != nil {
+		t.Fatalf("ListAuditEvents: %v", err)
+	}
+
+	if len(page.Events) != 1 {
+		t.Fatalf("ListAuditEvents = %d events, want the creation of the package", len(page.Events))
+	}
+
+	event := page.Events[0]
+	if event.ID == "" || event.Method != "CreatePackage" || event.After["name"] != "button" {
+		t.Errorf("event = %+v, want the creation of button", event)
+	}
+
+	// Purging nothing is not recorded.
+	if _, err := r.PurgeDeleted(auditCtx, time.Now()); err != nil {
+		t.Fatalf("PurgeDeleted: %v", err)
+	}
+
+	if page, _ := r.ListAuditEvents(ctx, ListAuditEventsOptions{}); len(page.Events) != 1 {
+		t.Errorf("ListAuditEvents after an empty purge = %d events", len(page.Events))
+	}
+}
+
+// seedHostileRepository stores a victim package next to a package, a version
+// and a channel named name.
+func seedHostileRepository(t *testing.T, name string) *MemoryRepository {
+	t.Helper()
+
+	r := newTestMemoryRepository(t)
+	for _, packageName := range []string{"victim", name} {
+		mustCreatePackage(t, r, packageName, "alice")
+		mustCreateVersion(t, r, packageName, "1.0.0", 10)
+
+		if _, err := r.CreateChannel(context.Background(), packageName, &Channel{Name: "stable", Targets: []ChannelTarget{{Version: "1.0.0", Weight: 100}}}); err != nil {
+			t.Fatalf("CreateChannel: %v", err)
+		}
+	}
+
+	mustCreateVersion(t, r, name, name, 20)
+
+	return r
+}
+
+func TestMemoryRepositoryHostileNames(t *testing.T) {
+	ctx := context.Background()
+
+	for _, name := range hostileNames {
+		for _, call := range repositoryCalls {
+			r := seedHostileRepository(t, name)
+
+			_ = call.call(ctx, r, name)
+
+			version, err := r.GetVersion(ctx, "victim", "1.0.0")
+			if err != nil || version.GetWeight() != 10 {
+				t.Errorf("%s(%q) changed the victim version: %v, %v", call.method, name, version, err)
+			}
+
+			if _, err := r.GetChannel(ctx, "victim", "stable"); err != nil {
+				t.Errorf("%s(%q) changed the victim channel: %v", call.method, name, err)
+			}
+		}
+
+		r := seedHostileRepository(t, name)
+
+		pkg, err := r.GetPackage(ctx, name)
+		if err != nil || pkg.GetName() != name {
+			t.Errorf("GetPackage(%q) = %v, %v", name, pkg, err)
+		}
+
+		version, err := r.GetVersion(ctx, name, name)
+		if err != nil || version.GetName() != name {
+			t.Errorf("GetVersion(%q, %q) = %v, %v", name, name, version, err)
+		}
+
+		page, err := r.ListPackages(ctx, ListPackagesOptions{NamePrefix: name})
+		if err != nil || len(page.Packages) != 1 || page.Packages[0].Package.GetName() != name {
+			t.Errorf("ListPackages(NamePrefix: %q) = %+v, %v, want only the package", name, page, err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func (r *MemoryRepository) CreateWebhook(ctx context.Context, webhook *Webhook) (*Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if webhook.Package != "" {
+		if _, err := r.livePackage(webhook.Package); err != nil {
+			return nil, err
+		}
+	}
+
+	saved := copyWebhook(webhook)
+	saved.ID = newID()
+	saved.CreatedAt = time.Now()
+
+	r.webhooks = append(r.webhooks, saved)
+	r.recordAudit(ctx, copyWebhook(saved))
+
+	return copyWebhook(saved), nil
+}
+
+func (r *MemoryRepository) GetWebhook(ctx context.Context, id string) (*Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, webhook := range r.webhooks {
+		if webhook.ID == id {
+			return copyWebhook(webhook), nil
+		}
+	}
+
+	return nil, errors.Wrapf(ErrWebhookNotFound, "webhook %s", id)
+}
+
+func (r *MemoryRepository) ListWebhooks(ctx context.Context) ([]*Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	webhooks := make([]*Webhook, 0, len(r.webhooks))
+	for _, webhook := range r.webhooks {
+		webhooks = append(webhooks, copyWebhook(webhook))
+	}
+
+	sortWebhooks(webhooks)
+
+	return webhooks, nil
+}
+
+func (r *MemoryRepository) DeleteWebhook(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	found := false
+	webhooks := r.webhooks[:0]
+	for _, webhook := range r.webhooks {
+		if webhook.ID == id {
+			found = true
+			continue
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+	r.webhooks = webhooks
+
+	if !found {
+		return errors.Wrapf(ErrWebhookNotFound, "webhook %s", id)
+	}
+
+	deliveries := r.webhookDeliveries[:0]
+	for _, delivery := range r.webhookDeliveries {
+		if delivery.WebhookID != id {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	r.webhookDeliveries = deliveries
+	r.recordAudit(ctx, nil)
+
+	return nil
+}
+
+func (r *MemoryRepository) CreateWebhookDeliveries(ctx context.Context, deliveries []*WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := map[string]bool{}
+	for _, delivery := range r.webhookDeliveries {
+		keys[delivery.IdempotencyKey] = true
+	}
+
+	now := time.Now()
+	for _, delivery := range deliveries {
+		if keys[delivery.IdempotencyKey] {
+			continue
+		}
+		keys[delivery.IdempotencyKey] = true
+
+		delivery.ID = newID()
+		delivery.Revision = 1
+		delivery.CreatedAt = now
+		delivery.UpdatedAt = now
+
+		r.webhookDeliveries = append(r.webhookDeliveries, copyWebhookDelivery(delivery))
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) findWebhookDelivery(id string) (*WebhookDelivery, error) {
+	for _, delivery := range r.webhookDeliveries {
+		if delivery.ID == id {
+			return delivery, nil
+		}
+	}
+
+	return nil, errors.Wrapf(ErrDeliveryNotFound, "webhook delivery %s", id)
+}
+
+func (r *MemoryRepository) GetWebhookDelivery(ctx context.Context, id string) (*WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	delivery, err := r.findWebhookDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyWebhookDelivery(delivery), nil
+}
+
+func (r *MemoryRepository) ListWebhookDeliveries(ctx context.Context, options ListWebhookDeliveriesOptions) (*WebhookDeliveryPage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var deliveries []*WebhookDelivery
+	var cursors []pageCursor
+	for _, delivery := range r.webhookDeliveries {
+		if options.matches(delivery) {
+			deliveries = append(deliveries, delivery)
+			cursors = append(cursors, deliveryCursor(delivery))
+		}
+	}
+
+	indexes, nextPageToken, err := paginate(cursors, options.PageToken, options.PageSize, true)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &WebhookDeliveryPage{
+		Deliveries:    make([]*WebhookDelivery, 0, len(indexes)),
+		NextPageToken: nextPageToken,
+	}
+	for _, i := range indexes {
+		page.Deliveries = append(page.Deliveries, copyWebhookDelivery(deliveries[i]))
+	}
+
+	return page, nil
+}
+
+func (r *MemoryRepository) ListDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var deliveries []*WebhookDelivery
+	for _, delivery := range r.webhookDeliveries {
+		if delivery.State == DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, copyWebhookDelivery(delivery))
+		}
+	}
+
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttemptAt.Before(deliveries[j].NextAttemptAt)
+	})
+
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+func (r *MemoryRepository) UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) (*WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	saved, err := r.findWebhookDelivery(delivery.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if saved.Revision != delivery.Revision {
+		return nil, errors.Wrapf(ErrConflict, "webhook delivery %s was changed since revision %d", delivery.ID, delivery.Revision)
+	}
+
+	*saved = *copyWebhookDelivery(delivery)
+	saved.Revision++
+	saved.UpdatedAt = time.Now()
+	r.recordAudit(ctx, copyWebhookDelivery(saved))
+
+	return copyWebhookDelivery(saved), nil
+}
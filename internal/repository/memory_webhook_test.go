@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWebhookMatches(t *testing.T) {
+	everything := &Webhook{}
+	button := &Webhook{Package: "button", EventTypes: []string{"version_created", "weight_changed"}}
+
+	for _, test := range []struct {
+		webhook   *Webhook
+		pkg       string
+		eventType string
+		want      bool
+	}{
+		{everything, "button", "package_created", true},
+		{everything, "card", "version_deleted", true},
+		{button, "button", "weight_changed", true},
+		{button, "button", "package_created", false},
+		{button, "card", "version_created", false},
+	} {
+		if got := test.webhook.Matches(test.pkg, test.eventType); got != test.want {
+			t.Errorf("%+v.Matches(%q, %q) = %v, want %v", test.webhook, test.pkg, test.eventType, got, test.want)
+		}
+	}
+}
+
+func TestMemoryRepositoryWebhookDeliveries(t *testing.T) {
+	ctx := context.Background()
+	r := newTestMemoryRepository(t)
+
+	webhook, err := r.CreateWebhook(ctx, &Webhook{URL: "https://hooks.example.com/polvo", Secret: "secret"})
+	if err != nil || webhook.ID == "" {
+		t.Fatalf("CreateWebhook = %+v, %v", webhook, err)
+	}
+
+	now := time.Now()
+	later := &WebhookDelivery{WebhookID: webhook.ID, IdempotencyKey: "later", EventType: "version_created", State: DeliveryPending, NextAttemptAt: now.Add(time.Minute)}
+	due := &WebhookDelivery{WebhookID: webhook.ID, IdempotencyKey: "due", EventType: "package_created", State: DeliveryPending, NextAttemptAt: now.Add(-time.Minute)}
+	dead := &WebhookDelivery{WebhookID: webhook.ID, IdempotencyKey: "dead", EventType: "package_deleted", State: DeliveryDead}
+	if err := r.CreateWebhookDeliveries(ctx, []*WebhookDelivery{later, due, dead}); err != nil {
+		t.Fatalf("CreateWebhookDeliveries: %v", err)
+	}
+
+	deliveries, err := r.ListDueWebhookDeliveries(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("ListDueWebhookDeliveries: %v", err)
+	}
+
+	if len(deliveries) != 1 || deliveries[0].ID != due.ID {
+		t.Fatalf("due deliveries = %+v, want the pending one past its attempt", deliveries)
+	}
+
+	claimed := deliveries[0]
+	claimed.Attempts++
+	if claimed, err = r.UpdateWebhookDelivery(ctx, claimed); err != nil || claimed.Revision != 2 {
+		t.Fatalf("UpdateWebhookDelivery = %+v, %v", claimed, err)
+	}
+
+	// Another process read the delivery before the claim.
+	if _, err := r.UpdateWebhookDelivery(ctx, deliveries[0]); !errors.Is(err, ErrConflict) {
+		t.Errorf("UpdateWebhookDelivery of a stale delivery = %v, want ErrConflict", err)
+	}
+
+	page, err := r.ListWebhookDeliveries(ctx, ListWebhookDeliveriesOptions{WebhookID: webhook.ID, State: DeliveryDead})
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+
+	if len(page.Deliveries) != 1 || page.Deliveries[0].ID != dead.ID {
+		t.Errorf("dead deliveries = %+v, want the dead one", page.Deliveries)
+	}
+
+	if _, err := r.GetWebhook(ctx, "missing"); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("GetWebhook of a missing webhook = %v, want ErrWebhookNotFound", err)
+	}
+}
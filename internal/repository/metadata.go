@@ -0,0 +1,76 @@
+package repository
+
+// PackageMetadata describes a package for catalogues. polvo_v1.Package has
+// no room for it, it is read with the PackageDetails of the package.
+type PackageMetadata struct {
+	Description   string
+	RepositoryUrl string
+	HomepageUrl   string
+	IconUrl       string
+	// Tags are indexed, ListPackagesOptions.Tag finds the packages with a tag.
+	Tags []string
+	// Owners are the teams owning the package. They are informative, the
+	// maintainer of the package grants the roles.
+	Owners []string
+}
+
+// The keys of the metadata fields in the updatedFields of UpdatePackage, next
+// to the "Name" and "Maintainer" of polvo_v1.Package. Tags and Owners are
+// []string, the other fields are strings.
+const (
+	DescriptionField   = "Description"
+	RepositoryUrlField = "RepositoryUrl"
+	HomepageUrlField   = "HomepageUrl"
+	IconUrlField       = "IconUrl"
+	TagsField          = "Tags"
+	OwnersField        = "Owners"
+)
+
+func copyPackageMetadata(metadata PackageMetadata) PackageMetadata {
+	metadata.Tags = append([]string(nil), metadata.Tags...)
+	metadata.Owners = append([]string(nil), metadata.Owners...)
+
+	return metadata
+}
+
+// applyMetadataFields sets the metadata fields found in updatedFields.
+// Updated returns a copy of the metadata with the metadata fields of the
+// updatedFields of UpdatePackage applied.
+func (m PackageMetadata) Updated(updatedFields map[string]interface{}) PackageMetadata {
+	updated := copyPackageMetadata(m)
+	applyMetadataFields(&updated, updatedFields)
+
+	return updated
+}
+
+func applyMetadataFields(metadata *PackageMetadata, updatedFields map[string]interface{}) {
+	for key, field := range map[string]*string{
+		DescriptionField:   &metadata.Description,
+		RepositoryUrlField: &metadata.RepositoryUrl,
+		HomepageUrlField:   &metadata.HomepageUrl,
+		IconUrlField:       &metadata.IconUrl,
+	} {
+		if value, ok := updatedFields[key]; ok {
+			*field = value.(string)
+		}
+	}
+
+	for key, field := range map[string]*[]string{
+		TagsField:   &metadata.Tags,
+		OwnersField: &metadata.Owners,
+	} {
+		if value, ok := updatedFields[key]; ok {
+			*field = append([]string(nil), value.([]string)...)
+		}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+)
+
+// The types of the outbox events.
+const (
+	EventPackageCreated   = "package_created"
+	EventPackageUpdated   = "package_updated"
+	EventPackageDeleted   = "package_deleted"
+	EventPackageUndeleted = "package_undeleted"
+	EventVersionCreated   = "version_created"
+	EventVersionUpdated   = "version_updated"
+	EventVersionDeleted   = "version_deleted"
+	EventVersionUndeleted = "version_undeleted"
+	EventWeightChanged    = "weight_changed"
+	EventChannelCreated   = "channel_created"
+	EventChannelUpdated   = "channel_updated"
+)
+
+// OutboxEvent is a change of the registry. It is written in the transaction
+// of the mutation that made it, so that it is published even when the process
+// stops right after the commit.
+type OutboxEvent struct {
+	// ID is set when the event is written.
+	ID string
+	// Sequence is set when the event is written. The events are numbered
+	// from 1 without gaps, in the order of the commits of their changes.
+	Sequence uint64
+	Type     string
+	Package  string
+	// Version is set for the version and weight events, Channel for the
+	// channel events.
+	Version string
+	Channel string
+	// PackageState, VersionState or ChannelState is the changed resource, as
+	// it was before the change for deletions.
+	PackageState *polvo_v1.Package
+	VersionState *polvo_v1.Version
+	ChannelState *Channel
+	// PreviousWeight is the weight before an EventWeightChanged.
+	PreviousWeight uint32
+	// Actor is the subject of the caller given to WithActor, empty when it
+	// is anonymous.
+	Actor     string
+	CreatedAt time.Time
+	// DeliveredAt is zero until the event is marked delivered.
+	DeliveredAt time.Time
+}
+
+func copyOutboxEvent(event *OutboxEvent) *OutboxEvent {
+	copied := *event
+
+	if event.ChannelState != nil {
+		copied.ChannelState = copyChannel(event.ChannelState)
+	}
+
+	return &copied
+}
+
+func copyChannel(channel *Channel) *Channel {
+	copied := *channel
+	copied.Targets = append([]ChannelTarget(nil), channel.Targets...)
+
+	return &copied
+}
+
+type actorKey struct{}
+
+// WithActor returns a context whose changes are recorded as made by actor.
+// The server sets it from the authenticated caller, the changes made without
+// one are anonymous.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+
+	return actor
+}
+
+// newOutboxEvent returns an event of the change made by the actor of ctx.
+func newOutboxEvent(ctx context.Context, eventType, packageName string, now time.Time) *OutboxEvent {
+	return &OutboxEvent{
+		ID:        newID(),
+		Type:      eventType,
+		Package:   packageName,
+		Actor:     actorFromContext(ctx),
+		CreatedAt: now,
+	}
+}
+
+func newPackageEvent(ctx context.Context, eventType string, pkg *polvo_v1.Package, now time.Time) *OutboxEvent {
+	event := newOutboxEvent(ctx, eventType, pkg.GetName(), now)
+	event.PackageState = &polvo_v1.Package{
+		Name:       pkg.GetName(),
+		Maintainer: pkg.GetMaintainer(),
+	}
+
+	return event
+}
+
+func newVersionEvent(ctx context.Context, eventType, packageName string, version *polvo_v1.Version, now time.Time) *OutboxEvent {
+	event := newOutboxEvent(ctx, eventType, packageName, now)
+	event.Version = version.GetName()
+	event.VersionState = &polvo_v1.Version{
+		Name:        version.GetName(),
+		ManifestUrl: version.GetManifestUrl(),
+		Weight:      version.GetWeight(),
+	}
+
+	return event
+}
+
+func newChannelEvent(ctx context.Context, eventType, packageName string, channel *Channel, now time.Time) *OutboxEvent {
+	event := newOutboxEvent(ctx, eventType, packageName, now)
+	event.Channel = channel.Name
+	event.ChannelState = copyChannel(channel)
+
+	return event
+}
+
+// newWeightEvent returns an EventWeightChanged, or nil when the weight of
+// version is previousWeight.
+func newWeightEvent(ctx context.Context, packageName string, version *polvo_v1.Version, previousWeight uint32, now time.Time) *OutboxEvent {
+	if version.GetWeight() == previousWeight {
+		return nil
+	}
+
+	event := newVersionEvent(ctx, EventWeightChanged, packageName, version, now)
+	event.PreviousWeight = previousWeight
+
+	return event
+}
+
+// newRoutingEvents returns the changes between two routing revisions of a
+// package: an EventWeightChanged for every version whose weight changed and an
+// EventVersionUpdated for every version whose manifest changed. previous is
+// nil when the package had no revision yet.
+func newRoutingEvents(ctx context.Context, packageName string, previous, latest *RoutingRevision, now time.Time) []*OutboxEvent {
+	if latest == nil || latest == previous {
+		return nil
+	}
+
+	before := map[string]RoutingEntry{}
+	if previous != nil {
+		for _, entry := range previous.Entries {
+			before[entry.Version] = entry
+		}
+	}
+
+	var events []*OutboxEvent
+	for _, entry := range latest.Entries {
+		version := &polvo_v1.Version{Name: entry.Version, ManifestUrl: entry.ManifestUrl, Weight: entry.Weight}
+
+		previousEntry, ok := before[entry.Version]
+		if ok && previousEntry.ManifestUrl != entry.ManifestUrl {
+			events = append(events, newVersionEvent(ctx, EventVersionUpdated, packageName, version, now))
+		}
+
+		if event := newWeightEvent(ctx, packageName, version, previousEntry.Weight, now); event != nil {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"pkg.aiocean.dev/polvoservice/internal/labels"
+)
+
+// OrderBy names the field a list is ordered by. Ties are broken by name.
+type OrderBy string
+
+const (
+	OrderByName      OrderBy = "name"
+	OrderByCreatedAt OrderBy = "created_at"
+	// OrderByWeight only applies to versions.
+	OrderByWeight OrderBy = "weight"
+)
+
+type ListPackagesOptions struct {
+	// PageSize is the maximum number of packages returned, all of them are
+	// returned when it is 0.
+	PageSize uint
+	// PageToken is the NextPageToken of the previous page, it must be used
+	// with the same filters and ordering.
+	PageToken  string
+	NamePrefix string
+	Maintainer string
+	// Tag and Owner keep the packages whose metadata has the tag or the owner
+	// when they are not empty.
+	Tag          string
+	Owner        string
+	CreatedAfter *time.Time
+	// OrderBy is OrderByName when empty.
+	OrderBy    OrderBy
+	Descending bool
+}
+
+type ListVersionsOptions struct {
+	// PageSize is the maximum number of versions returned, all of them are
+	// returned when it is 0.
+	PageSize uint
+	// PageToken is the NextPageToken of the previous page, it must be used
+	// with the same filters and ordering.
+	PageToken  string
+	NamePrefix string
+	// HasWeight keeps only the versions with a non zero weight when true, and
+	// only the ones without weight when false.
+	HasWeight *bool
+	// LabelSelector keeps the versions whose labels match it when it is not
+	// nil.
+	LabelSelector *labels.Selector
+	CreatedAfter  *time.Time
+	// OrderBy is OrderByWeight, heaviest first, when empty.
+	OrderBy    OrderBy
+	Descending bool
+}
+
+type PackagePage struct {
+	Packages []*PackageDetails
+	// NextPageToken is empty on the last page.
+	NextPageToken string
+}
+
+type VersionPage struct {
+	Versions []*VersionDetails
+	// NextPageToken is empty on the last page.
+	NextPageToken string
+}
+
+func (o ListPackagesOptions) normalize() (ListPackagesOptions, error) {
+	switch o.OrderBy {
+	case "":
+		o.OrderBy = OrderByName
+	case OrderByName, OrderByCreatedAt:
+	default:
+		return o, errors.Wrapf(ErrInvalidArgument, "packages can not be ordered by %q", o.OrderBy)
+	}
+
+	return o, nil
+}
+
+func (o ListVersionsOptions) normalize() (ListVersionsOptions, error) {
+	switch o.OrderBy {
+	case "":
+		o.OrderBy = OrderByWeight
+		o.Descending = true
+	case OrderByName, OrderByCreatedAt, OrderByWeight:
+	default:
+		return o, errors.Wrapf(ErrInvalidArgument, "versions can not be ordered by %q", o.OrderBy)
+	}
+
+	return o, nil
+}
+
+// pageCursor is the position of an item in a list: the value of the field the
+// list is ordered by, and the name that breaks ties.
+type pageCursor struct {
+	Key  string `json:"k"`
+	Name string `json:"n"`
+}
+
+func newPageCursor(orderBy OrderBy, name string, createdAt time.Time, weight uint32) pageCursor {
+	switch orderBy {
+	case OrderByCreatedAt:
+		return pageCursor{Key: createdAt.UTC().Format(time.RFC3339), Name: name}
+	case OrderByWeight:
+		// Zero padded so that the keys compare like the weights.
+		return pageCursor{Key: fmt.Sprintf("%010d", weight), Name: name}
+	default:
+		return pageCursor{Key: name, Name: name}
+	}
+}
+
+func (c pageCursor) less(other pageCursor) bool {
+	if c.Key != other.Key {
+		return c.Key < other.Key
+	}
+
+	return c.Name < other.Name
+}
+
+func (c pageCursor) token() string {
+	data, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parsePageToken(token string) (*pageCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidArgument, "malformed page token")
+	}
+
+	cursor := &pageCursor{}
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return nil, errors.Wrap(ErrInvalidArgument, "malformed page token")
+	}
+
+	return cursor, nil
+}
+
+// paginate sorts the items by their cursors and returns the indexes of the
+// items on the page after token, with the token of the next page.
+func paginate(cursors []pageCursor, token string, pageSize uint, descending bool) ([]int, string, error) {
+	after, err := parsePageToken(token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	before := func(a, b pageCursor) bool {
+		if descending {
+			return b.less(a)
+		}
+
+		return a.less(b)
+	}
+
+	indexes := make([]int, 0, len(cursors))
+	for i, cursor := range cursors {
+		if after == nil || before(*after, cursor) {
+			indexes = append(indexes, i)
+		}
+	}
+
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return before(cursors[indexes[i]], cursors[indexes[j]])
+	})
+
+	if pageSize == 0 || uint(len(indexes)) <= pageSize {
+		return indexes, "", nil
+	}
+
+	indexes = indexes[:pageSize]
+
+	return indexes, cursors[indexes[len(indexes)-1]].token(), nil
+}
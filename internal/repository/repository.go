@@ -2,30 +2,204 @@ package repository
 
 import (
 	"context"
+	"os"
+	"time"
 
+	"github.com/google/wire"
+	"github.com/pkg/errors"
 	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
 )
 
-type ListVersionsOptions struct {
-	Limit *uint
-	OrderByWeight *bool
+// WireSet picks the repository implementation from the REPOSITORY_DRIVER
+// environment variable, so the same binary can run against Dgraph or in memory.
+var WireSet = wire.NewSet(
+	NewRepository,
+)
+
+func NewRepository() (Repository, error) {
+	switch driver := os.Getenv("REPOSITORY_DRIVER"); driver {
+	case "", "dgraph":
+		return NewDgraphRepository()
+	case "memory":
+		return NewMemoryRepository()
+	default:
+		return nil, errors.Errorf("unknown repository driver %q", driver)
+	}
+}
+
+// Channel is a named pointer of a package, like stable or beta, to one
+// version or to a weighted set of versions.
+type Channel struct {
+	Name    string
+	Targets []ChannelTarget
+	// Revision is incremented every time the channel is promoted or rolled
+	// back.
+	Revision  int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type ChannelTarget struct {
+	Version string
+	Weight  uint32
+}
+
+// PackageDetails is a package together with the fields that polvo_v1.Package
+// has no room for.
+type PackageDetails struct {
+	Package   *polvo_v1.Package
+	Metadata  PackageMetadata
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// VersionDetails is a version together with the fields that polvo_v1.Version
+// has no room for.
+type VersionDetails struct {
+	Version   *polvo_v1.Version
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// ManifestSHA256 is the hex SHA-256 of the manifest pinned when the version
+	// was created, empty when it was not pinned.
+	ManifestSHA256 string
+	// Labels are free-form key/value pairs, nil when the version has none.
+	Labels map[string]string
+}
+
+// LabelsField is the key of the labels, a map[string]string replacing all of
+// them, in the updatedFields of UpdateVersion.
+const LabelsField = "Labels"
+
+// ManifestPin is the manifest of a version fetched when it was created. The
+// manifest URL of a pinned version can not change.
+type ManifestPin struct {
+	SHA256 string
+	// Body is the manifest itself, it is only kept when the service is
+	// configured to store manifests.
+	Body []byte
+}
+
+// PurgeResult counts the soft deleted records removed by PurgeDeleted.
+type PurgeResult struct {
+	Packages int
+	Versions int
 }
 
 type Repository interface {
 	GetPackage(ctx context.Context, name string) (*polvo_v1.Package, error)
-	ListPackages(ctx context.Context) ([]*polvo_v1.Package, error)
-	CreatePackage(ctx context.Context, pkg *polvo_v1.Package) (*polvo_v1.Package, error)
+	GetPackageDetails(ctx context.Context, name string) (*PackageDetails, error)
+	ListPackages(ctx context.Context, options ListPackagesOptions) (*PackagePage, error)
+	// CreatePackage stores the package, with its metadata unless metadata is
+	// nil.
+	CreatePackage(ctx context.Context, pkg *polvo_v1.Package, metadata *PackageMetadata) (*polvo_v1.Package, error)
+	// UpdatePackage sets the fields of polvo_v1.Package and PackageMetadata
+	// found in updatedFields, see DescriptionField for the metadata keys.
 	UpdatePackage(ctx context.Context, name string, updatedFields map[string]interface{}) (*polvo_v1.Package, error)
+	// DeletePackage soft deletes a package by setting its deleted_at. Soft
+	// deleted packages, and everything below them, are hidden from every read.
+	// It fails with ErrPackageNotFound when the package is missing or already
+	// deleted.
 	DeletePackage(ctx context.Context, name string) error
+	UndeletePackage(ctx context.Context, name string) (*polvo_v1.Package, error)
 	IsPackageExists(ctx context.Context, name string) (bool, error)
 
-	ListVersions(ctx context.Context, pkdUid string, option ...ListVersionsOptions) ([]*polvo_v1.Version, error)
+	// ListVersions returns every live version of the package, heaviest first.
+	ListVersions(ctx context.Context, packageName string) ([]*polvo_v1.Version, error)
+	ListVersionDetails(ctx context.Context, packageName string, options ListVersionsOptions) (*VersionPage, error)
 	GetVersion(ctx context.Context, packageName, versionName string) (*polvo_v1.Version, error)
+	GetVersionDetails(ctx context.Context, packageName, versionName string) (*VersionDetails, error)
 	GetHeaviestVersion(ctx context.Context, packageName string) (*polvo_v1.Version, error)
-	CreateVersion(ctx context.Context, packageName string, version *polvo_v1.Version) (*polvo_v1.Version, error)
+	// CreateVersion stores the version with its labels, and with its pinned
+	// manifest unless pin is nil.
+	CreateVersion(ctx context.Context, packageName string, version *polvo_v1.Version, pin *ManifestPin, versionLabels map[string]string) (*polvo_v1.Version, error)
+	// UpdateVersion fails with ErrPrecondition when it changes the manifest URL
+	// of a pinned version.
 	UpdateVersion(ctx context.Context, packageName, versionName string, updatedFields map[string]interface{}) (*polvo_v1.Version, error)
+	// GetManifestPin returns the pinned manifest of the version, nil when it
+	// was not pinned.
+	GetManifestPin(ctx context.Context, packageName, versionName string) (*ManifestPin, error)
+	// DeleteVersion soft deletes a version by setting its deleted_at. It fails
+	// with ErrVersionNotFound, or ErrPackageNotFound, when the version or its
+	// package is missing or already deleted.
 	DeleteVersion(ctx context.Context, packageName, versionName string) error
+	UndeleteVersion(ctx context.Context, packageName, versionName string) (*polvo_v1.Version, error)
 	IsVersionExists(ctx context.Context, packageName string, versionName string) (bool, error)
+	// PurgeDeleted permanently removes packages and versions that were soft
+	// deleted before deletedBefore. The audit of ctx is only recorded when
+	// something is removed.
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (*PurgeResult, error)
+
+	ListChannels(ctx context.Context, packageName string) ([]*Channel, error)
+	GetChannel(ctx context.Context, packageName, channelName string) (*Channel, error)
+	CreateChannel(ctx context.Context, packageName string, channel *Channel) (*Channel, error)
+	// PromoteChannel points the channel at new targets and remembers the
+	// current ones so that RollbackChannel can restore them.
+	PromoteChannel(ctx context.Context, packageName, channelName string, targets []ChannelTarget) (*Channel, error)
+	// RollbackChannel swaps the current targets with the ones before the last
+	// promotion.
+	RollbackChannel(ctx context.Context, packageName, channelName string) (*Channel, error)
+
+	// ListRoutingRevisions returns the recorded routing states of the package,
+	// latest first.
+	ListRoutingRevisions(ctx context.Context, packageName string) ([]*RoutingRevision, error)
+	// RollbackPackage restores the manifest and weight of every version to the
+	// given revision in one transaction, and records the result as a new
+	// revision. Versions created after the revision get no weight.
+	RollbackPackage(ctx context.Context, packageName string, revision int64) (*RoutingRevision, error)
+	// SetPackageWeights sets the weight of every version of the package in one
+	// transaction, versions missing from weights get no weight.
+	SetPackageWeights(ctx context.Context, packageName string, weights map[string]uint32) (*RoutingRevision, error)
+
+	// GetPackageSnapshots reads the packages with their live versions and
+	// channels in one round-trip. Packages that do not exist or are soft
+	// deleted are missing from the result.
+	GetPackageSnapshots(ctx context.Context, packageNames []string) (map[string]*PackageSnapshot, error)
+
+	// CreateRollout fails with ErrAlreadyExists when the package already has an
+	// active rollout.
+	CreateRollout(ctx context.Context, rollout *Rollout) (*Rollout, error)
+	GetRollout(ctx context.Context, id string) (*Rollout, error)
+	// ListRollouts returns the rollouts of the package, newest first.
+	ListRollouts(ctx context.Context, packageName string) ([]*Rollout, error)
+	// ListDueRollouts returns the running rollouts whose next step is due at
+	// now.
+	ListDueRollouts(ctx context.Context, now time.Time) ([]*Rollout, error)
+	UpdateRollout(ctx context.Context, rollout *Rollout) (*Rollout, error)
+
+	// AppendAuditEvent records an event on its own. The changes made with a
+	// context from WithAudit record its event in their own transaction.
+	AppendAuditEvent(ctx context.Context, event *AuditEvent) error
+	ListAuditEvents(ctx context.Context, options ListAuditEventsOptions) (*AuditEventPage, error)
+
+	CreateWebhook(ctx context.Context, webhook *Webhook) (*Webhook, error)
+	GetWebhook(ctx context.Context, id string) (*Webhook, error)
+	// ListWebhooks returns every webhook, newest first.
+	ListWebhooks(ctx context.Context) ([]*Webhook, error)
+	// DeleteWebhook removes the webhook and its deliveries.
+	DeleteWebhook(ctx context.Context, id string) error
+	// CreateWebhookDeliveries stores pending deliveries in one transaction,
+	// skipping those whose idempotency key is already stored.
+	CreateWebhookDeliveries(ctx context.Context, deliveries []*WebhookDelivery) error
+	GetWebhookDelivery(ctx context.Context, id string) (*WebhookDelivery, error)
+	ListWebhookDeliveries(ctx context.Context, options ListWebhookDeliveriesOptions) (*WebhookDeliveryPage, error)
+	// ListDueWebhookDeliveries returns the pending deliveries whose next
+	// attempt is due at now, at most limit of them.
+	ListDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) (*WebhookDelivery, error)
+
+	// ListPendingOutboxEvents returns the events that are not marked
+	// delivered, in the order of their sequence, at most limit of them.
+	ListPendingOutboxEvents(ctx context.Context, limit int) ([]*OutboxEvent, error)
+	// ListOutboxEvents returns the events after the sequence afterSequence,
+	// delivered or not, in order, at most limit of them.
+	ListOutboxEvents(ctx context.Context, afterSequence uint64, limit int) ([]*OutboxEvent, error)
+	// LatestOutboxSequence returns the sequence of the latest event written,
+	// 0 when there was none.
+	LatestOutboxSequence(ctx context.Context) (uint64, error)
+	MarkOutboxEventsDelivered(ctx context.Context, ids []string, deliveredAt time.Time) error
+	// PurgeOutboxEvents removes the events delivered before deliveredBefore
+	// and returns how many were removed.
+	PurgeOutboxEvents(ctx context.Context, deliveredBefore time.Time) (int, error)
 }
 
 type UnimplementedRepository struct {
@@ -35,11 +209,15 @@ func (u UnimplementedRepository) GetPackage(ctx context.Context, name string) (*
 	panic("implement me")
 }
 
-func (u UnimplementedRepository) ListPackages(ctx context.Context) ([]*polvo_v1.Package, error) {
+func (u UnimplementedRepository) GetPackageDetails(ctx context.Context, name string) (*PackageDetails, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) ListPackages(ctx context.Context, options ListPackagesOptions) (*PackagePage, error) {
 	panic("implement me")
 }
 
-func (u UnimplementedRepository) CreatePackage(ctx context.Context, pkg *polvo_v1.Package) (*polvo_v1.Package, error) {
+func (u UnimplementedRepository) CreatePackage(ctx context.Context, pkg *polvo_v1.Package, metadata *PackageMetadata) (*polvo_v1.Package, error) {
 	panic("implement me")
 }
 
@@ -55,7 +233,15 @@ func (u UnimplementedRepository) IsPackageExists(ctx context.Context, name strin
 	panic("implement me")
 }
 
-func (u UnimplementedRepository) ListVersions(ctx context.Context, pkdUid string, option ...ListVersionsOptions) ([]*polvo_v1.Version, error) {
+func (u UnimplementedRepository) ListVersions(ctx context.Context, packageName string) ([]*polvo_v1.Version, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) ListVersionDetails(ctx context.Context, packageName string, options ListVersionsOptions) (*VersionPage, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) GetVersionDetails(ctx context.Context, packageName, versionName string) (*VersionDetails, error) {
 	panic("implement me")
 }
 
@@ -67,7 +253,7 @@ func (u UnimplementedRepository) GetHeaviestVersion(ctx context.Context, package
 	panic("implement me")
 }
 
-func (u UnimplementedRepository) CreateVersion(ctx context.Context, packageName string, version *polvo_v1.Version) (*polvo_v1.Version, error) {
+func (u UnimplementedRepository) CreateVersion(ctx context.Context, packageName string, version *polvo_v1.Version, pin *ManifestPin, versionLabels map[string]string) (*polvo_v1.Version, error) {
 	panic("implement me")
 }
 
@@ -83,3 +269,138 @@ func (u UnimplementedRepository) IsVersionExists(ctx context.Context, packageNam
 	panic("implement me")
 }
 
+func (u UnimplementedRepository) UndeletePackage(ctx context.Context, name string) (*polvo_v1.Package, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) UndeleteVersion(ctx context.Context, packageName, versionName string) (*polvo_v1.Version, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (*PurgeResult, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) ListChannels(ctx context.Context, packageName string) ([]*Channel, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) GetChannel(ctx context.Context, packageName, channelName string) (*Channel, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) CreateChannel(ctx context.Context, packageName string, channel *Channel) (*Channel, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) PromoteChannel(ctx context.Context, packageName, channelName string, targets []ChannelTarget) (*Channel, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) RollbackChannel(ctx context.Context, packageName, channelName string) (*Channel, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) ListRoutingRevisions(ctx context.Context, packageName string) ([]*RoutingRevision, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) RollbackPackage(ctx context.Context, packageName string, revision int64) (*RoutingRevision, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) SetPackageWeights(ctx context.Context, packageName string, weights map[string]uint32) (*RoutingRevision, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) GetPackageSnapshots(ctx context.Context, packageNames []string) (map[string]*PackageSnapshot, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) CreateRollout(ctx context.Context, rollout *Rollout) (*Rollout, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) GetRollout(ctx context.Context, id string) (*Rollout, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) ListRollouts(ctx context.Context, packageName string) ([]*Rollout, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) ListDueRollouts(ctx context.Context, now time.Time) ([]*Rollout, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) UpdateRollout(ctx context.Context, rollout *Rollout) (*Rollout, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) GetManifestPin(ctx context.Context, packageName, versionName string) (*ManifestPin, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) AppendAuditEvent(ctx context.Context, event *AuditEvent) error {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) ListAuditEvents(ctx context.Context, options ListAuditEventsOptions) (*AuditEventPage, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) CreateWebhook(ctx context.Context, webhook *Webhook) (*Webhook, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) GetWebhook(ctx context.Context, id string) (*Webhook, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) ListWebhooks(ctx context.Context) ([]*Webhook, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) DeleteWebhook(ctx context.Context, id string) error {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) CreateWebhookDeliveries(ctx context.Context, deliveries []*WebhookDelivery) error {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) GetWebhookDelivery(ctx context.Context, id string) (*WebhookDelivery, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) ListWebhookDeliveries(ctx context.Context, options ListWebhookDeliveriesOptions) (*WebhookDeliveryPage, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) ListDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) (*WebhookDelivery, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) ListPendingOutboxEvents(ctx context.Context, limit int) ([]*OutboxEvent, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) ListOutboxEvents(ctx context.Context, afterSequence uint64, limit int) ([]*OutboxEvent, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) LatestOutboxSequence(ctx context.Context) (uint64, error) {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) MarkOutboxEventsDelivered(ctx context.Context, ids []string, deliveredAt time.Time) error {
+	panic("implement me")
+}
+
+func (u UnimplementedRepository) PurgeOutboxEvents(ctx context.Context, deliveredBefore time.Time) (int, error) {
+	panic("implement me")
+}
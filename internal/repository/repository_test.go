@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/labels"
+)
+
+// hostileNames break out of a DQL string, a function call or a block when
+// they are concatenated into a query instead of being passed as variables.
+var hostileNames = []string{
+	`evil" OR eq(name, "victim`,
+	`evil) OR has(name`,
+	`evil} * { uid`,
+	`evil"), uid(0x1), name("`,
+	"evil\n_:x <name> \"victim\" .",
+}
+
+// repositoryCall runs one Repository method with every user supplied string
+// set to name. Errors are expected, the method only has to keep name out of
+// the query text.
+type repositoryCall struct {
+	method string
+	call   func(ctx context.Context, r Repository, name string) error
+}
+
+func pageTokenOf(name string) string {
+	return pageCursor{Key: name, Name: name}.token()
+}
+
+var repositoryCalls = []repositoryCall{
+	{"GetPackage", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.GetPackage(ctx, name)
+		return err
+	}},
+	{"GetPackageDetails", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.GetPackageDetails(ctx, name)
+		return err
+	}},
+	{"ListPackages", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.ListPackages(ctx, ListPackagesOptions{NamePrefix: name, Maintainer: name, Tag: name, Owner: name, PageToken: pageTokenOf(name), PageSize: 10})
+		return err
+	}},
+	{"ListPackagesByCreation", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.ListPackages(ctx, ListPackagesOptions{OrderBy: OrderByCreatedAt, PageToken: pageTokenOf(name)})
+		return err
+	}},
+	{"CreatePackage", func(ctx context.Context, r Repository, name string) error {
+		metadata := &PackageMetadata{Description: name, RepositoryUrl: name, Tags: []string{name}, Owners: []string{name}}
+		_, err := r.CreatePackage(ctx, &polvo_v1.Package{Name: name, Maintainer: name}, metadata)
+		return err
+	}},
+	{"UpdatePackage", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.UpdatePackage(ctx, name, map[string]interface{}{"Name": name + "2", "Maintainer": name, DescriptionField: name, TagsField: []string{name}})
+		return err
+	}},
+	{"DeletePackage", func(ctx context.Context, r Repository, name string) error {
+		return r.DeletePackage(ctx, name)
+	}},
+	{"UndeletePackage", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.UndeletePackage(ctx, name)
+		return err
+	}},
+	{"IsPackageExists", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.IsPackageExists(ctx, name)
+		return err
+	}},
+	{"ListVersions", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.ListVersions(ctx, name)
+		return err
+	}},
+	{"ListVersionDetails", func(ctx context.Context, r Repository, name string) error {
+		selector, _ := labels.ParseSelector("env in (prod, staging), !canary")
+		token := newPageCursor(OrderByWeight, name, time.Time{}, 10).token()
+		_, err := r.ListVersionDetails(ctx, name, ListVersionsOptions{NamePrefix: name, LabelSelector: selector, PageToken: token, PageSize: 10})
+		return err
+	}},
+	{"ListVersionDetailsByName", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.ListVersionDetails(ctx, name, ListVersionsOptions{OrderBy: OrderByName, PageToken: pageTokenOf(name)})
+		return err
+	}},
+	{"GetVersion", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.GetVersion(ctx, name, name)
+		return err
+	}},
+	{"GetVersionDetails", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.GetVersionDetails(ctx, name, name)
+		return err
+	}},
+	{"GetHeaviestVersion", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.GetHeaviestVersion(ctx, name)
+		return err
+	}},
+	{"CreateVersion", func(ctx context.Context, r Repository, name string) error {
+		version := &polvo_v1.Version{Name: name, ManifestUrl: name, Weight: 10}
+		_, err := r.CreateVersion(ctx, name, version, &ManifestPin{SHA256: name, Body: []byte(name)}, map[string]string{"env": "prod"})
+		return err
+	}},
+	{"UpdateVersion", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.UpdateVersion(ctx, name, name, map[string]interface{}{"Name": name + "2", "ManifestUrl": name, "Weight": uint32(20), LabelsField: map[string]string{"env": "prod"}})
+		return err
+	}},
+	{"DeleteVersion", func(ctx context.Context, r Repository, name string) error {
+		return r.DeleteVersion(ctx, name, name)
+	}},
+	{"UndeleteVersion", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.UndeleteVersion(ctx, name, name)
+		return err
+	}},
+	{"IsVersionExists", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.IsVersionExists(ctx, name, name)
+		return err
+	}},
+	{"ListChannels", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.ListChannels(ctx, name)
+		return err
+	}},
+	{"GetChannel", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.GetChannel(ctx, name, name)
+		return err
+	}},
+	{"CreateChannel", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.CreateChannel(ctx, name, &Channel{Name: name, Targets: []ChannelTarget{{Version: name, Weight: 100}}})
+		return err
+	}},
+	{"PromoteChannel", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.PromoteChannel(ctx, name, name, []ChannelTarget{{Version: name, Weight: 100}})
+		return err
+	}},
+	{"RollbackChannel", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.RollbackChannel(ctx, name, name)
+		return err
+	}},
+	{"AppendAuditEvent", func(ctx context.Context, r Repository, name string) error {
+		return r.AppendAuditEvent(ctx, &AuditEvent{Actor: name, Method: name, Orn: name, Package: name, RequestID: name, Before: map[string]interface{}{name: name}, Time: time.Now()})
+	}},
+	{"ListAuditEvents", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.ListAuditEvents(ctx, ListAuditEventsOptions{Package: name, Actor: name, PageToken: pageTokenOf(name), PageSize: 10})
+		return err
+	}},
+	{"ListRoutingRevisions", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.ListRoutingRevisions(ctx, name)
+		return err
+	}},
+	{"MarkOutboxEventsDelivered", func(ctx context.Context, r Repository, name string) error {
+		return r.MarkOutboxEventsDelivered(ctx, []string{name}, time.Now())
+	}},
+	{"RollbackPackage", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.RollbackPackage(ctx, name, 1)
+		return err
+	}},
+	{"SetPackageWeights", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.SetPackageWeights(ctx, name, map[string]uint32{name: 100})
+		return err
+	}},
+	{"CreateRollout", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.CreateRollout(ctx, &Rollout{Package: name, Version: name, Steps: []RolloutStep{{Weight: 100}}, Baseline: map[string]uint32{name: 100}, State: RolloutRunning, Step: -1})
+		return err
+	}},
+	{"GetRollout", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.GetRollout(ctx, name)
+		return err
+	}},
+	{"ListRollouts", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.ListRollouts(ctx, name)
+		return err
+	}},
+	{"UpdateRollout", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.UpdateRollout(ctx, &Rollout{ID: name, Package: name, Version: name, Baseline: map[string]uint32{name: 100}, State: RolloutPaused})
+		return err
+	}},
+	{"GetManifestPin", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.GetManifestPin(ctx, name, name)
+		return err
+	}},
+	{"GetPackageSnapshots", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.GetPackageSnapshots(ctx, []string{name, "victim"})
+		return err
+	}},
+	{"CreateWebhook", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.CreateWebhook(ctx, &Webhook{Package: name, URL: name, Secret: name, EventTypes: []string{name}, CreatedBy: name})
+		return err
+	}},
+	{"GetWebhook", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.GetWebhook(ctx, name)
+		return err
+	}},
+	{"DeleteWebhook", func(ctx context.Context, r Repository, name string) error {
+		return r.DeleteWebhook(ctx, name)
+	}},
+	{"CreateWebhookDeliveries", func(ctx context.Context, r Repository, name string) error {
+		return r.CreateWebhookDeliveries(ctx, []*WebhookDelivery{{WebhookID: name, Package: name, EventType: name, Payload: []byte(name), State: DeliveryPending}})
+	}},
+	{"GetWebhookDelivery", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.GetWebhookDelivery(ctx, name)
+		return err
+	}},
+	{"ListWebhookDeliveries", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.ListWebhookDeliveries(ctx, ListWebhookDeliveriesOptions{WebhookID: name, State: WebhookDeliveryState(name), PageToken: pageTokenOf(name), PageSize: 10})
+		return err
+	}},
+	{"UpdateWebhookDelivery", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.UpdateWebhookDelivery(ctx, &WebhookDelivery{ID: name, WebhookID: name, State: DeliveryDead, LastError: name})
+		return err
+	}},
+	{"ListOutboxEvents", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.ListOutboxEvents(ctx, 10, 10)
+		return err
+	}},
+	{"LatestOutboxSequence", func(ctx context.Context, r Repository, name string) error {
+		_, err := r.LatestOutboxSequence(ctx)
+		return err
+	}},
+}
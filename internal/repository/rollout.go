@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"sort"
+	"time"
+)
+
+type RolloutState string
+
+const (
+	RolloutRunning   RolloutState = "running"
+	RolloutPaused    RolloutState = "paused"
+	RolloutCompleted RolloutState = "completed"
+	RolloutAborted   RolloutState = "aborted"
+)
+
+// IsActive reports whether the rollout still owns the weights of its package.
+// A package has at most one active rollout.
+func (s RolloutState) IsActive() bool {
+	return s == RolloutRunning || s == RolloutPaused
+}
+
+type RolloutStep struct {
+	// Weight is the percentage of the traffic sent to the version of the
+	// rollout once the step is applied.
+	Weight uint32 `json:"weight"`
+	// After is the time from the start of the rollout to the step. Time spent
+	// paused does not count.
+	After time.Duration `json:"after"`
+}
+
+// Rollout moves traffic to a version of a package in scheduled steps.
+type Rollout struct {
+	// ID is set by CreateRollout.
+	ID      string
+	Package string
+	Version string
+	Steps   []RolloutStep
+	// Baseline holds the weights of the versions of the package before the
+	// rollout started. The other versions share the remaining traffic in the
+	// same proportions, and the baseline is restored when the rollout is
+	// aborted.
+	Baseline map[string]uint32
+	State    RolloutState
+	// Step is the index of the last applied step, -1 before the first one.
+	Step int
+	// NextStepAt is when the next step is due, it is zero unless the rollout
+	// is running.
+	NextStepAt time.Time
+	// PausedAt is when a paused rollout was paused.
+	PausedAt time.Time
+	// Revision is incremented by every UpdateRollout, which fails with
+	// ErrConflict when the rollout was changed since it was read.
+	Revision  int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func copyRollout(rollout *Rollout) *Rollout {
+	copied := *rollout
+	copied.Steps = append([]RolloutStep(nil), rollout.Steps...)
+
+	copied.Baseline = make(map[string]uint32, len(rollout.Baseline))
+	for version, weight := range rollout.Baseline {
+		copied.Baseline[version] = weight
+	}
+
+	return &copied
+}
+
+// sortRollouts orders rollouts newest first.
+func sortRollouts(rollouts []*Rollout) {
+	sort.SliceStable(rollouts, func(i, j int) bool {
+		return rollouts[i].CreatedAt.After(rollouts[j].CreatedAt)
+	})
+}
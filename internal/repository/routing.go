@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"sort"
+	"time"
+)
+
+// RoutingRevision is a snapshot of the routing state of a package: the
+// manifest and weight of every live version. A revision is recorded every time
+// the routing state changes, so that RollbackPackage can restore it.
+type RoutingRevision struct {
+	// Revision starts at 1 and is incremented for every recorded change.
+	Revision  int64
+	Entries   []RoutingEntry
+	CreatedAt time.Time
+}
+
+type RoutingEntry struct {
+	Version     string `json:"version"`
+	ManifestUrl string `json:"manifest_url"`
+	Weight      uint32 `json:"weight"`
+}
+
+// sortRoutingEntries orders entries by version name so that routing states
+// can be compared.
+func sortRoutingEntries(entries []RoutingEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Version < entries[j].Version
+	})
+}
+
+// findRoutingEntry returns the entry of a version in revision, which is nil
+// when the package has no revision.
+func findRoutingEntry(revision *RoutingRevision, versionName string) (RoutingEntry, bool) {
+	if revision != nil {
+		for _, entry := range revision.Entries {
+			if entry.Version == versionName {
+				return entry, true
+			}
+		}
+	}
+
+	return RoutingEntry{}, false
+}
+
+func routingEntriesEqual(a, b []RoutingEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isRoutingChanged reports whether entries have to be recorded as a new
+// revision after latest, which is nil when nothing was recorded yet. An empty
+// routing state is not worth a first revision.
+func isRoutingChanged(latest *RoutingRevision, entries []RoutingEntry) bool {
+	if latest == nil {
+		return len(entries) > 0
+	}
+
+	return !routingEntriesEqual(latest.Entries, entries)
+}
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"sort"
+
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+)
+
+// PackageSnapshot is a package with everything needed to resolve its
+// versions, so that many packages can be resolved from one read.
+type PackageSnapshot struct {
+	Package *polvo_v1.Package
+	// Versions are the live versions, heaviest first like ListVersions.
+	Versions []*VersionDetails
+	Channels []*Channel
+}
+
+// sortSnapshotVersions orders the versions heaviest first, keeping the
+// order of versions with the same weight.
+func sortSnapshotVersions(versions []*VersionDetails) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Version.GetWeight() > versions[j].Version.GetWeight()
+	})
+}
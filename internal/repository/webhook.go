@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"sort"
+	"time"
+)
+
+// Webhook sends the change events of the registry to a URL.
+type Webhook struct {
+	// ID is set by CreateWebhook.
+	ID string
+	// Package limits the webhook to the events of one package, it receives the
+	// events of every package when empty.
+	Package string
+	URL     string
+	// Secret is the key of the HMAC-SHA256 signature of the deliveries.
+	Secret string
+	// EventTypes are the types of the events sent, every type when empty.
+	EventTypes []string
+	CreatedBy  string
+	CreatedAt  time.Time
+}
+
+// Matches reports whether the webhook receives an event of a package.
+func (w *Webhook) Matches(packageName, eventType string) bool {
+	if w.Package != "" && w.Package != packageName {
+		return false
+	}
+
+	if len(w.EventTypes) == 0 {
+		return true
+	}
+
+	for _, t := range w.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+type WebhookDeliveryState string
+
+const (
+	// DeliveryPending deliveries are sent at NextAttemptAt.
+	DeliveryPending   WebhookDeliveryState = "pending"
+	DeliverySucceeded WebhookDeliveryState = "succeeded"
+	// DeliveryDead deliveries failed every attempt. They are kept as a dead
+	// letter list until they are redelivered.
+	DeliveryDead WebhookDeliveryState = "dead"
+)
+
+// WebhookDelivery is one event to send to a webhook, with the outcome of its
+// attempts.
+type WebhookDelivery struct {
+	// ID is set by CreateWebhookDeliveries, it stays empty for a delivery
+	// that was skipped.
+	ID        string
+	WebhookID string
+	// IdempotencyKey identifies the event sent to the webhook.
+	// CreateWebhookDeliveries skips a delivery whose key is already stored,
+	// so that an event relayed again is not sent twice.
+	IdempotencyKey string
+	Package        string
+	EventType      string
+	// Payload is the JSON body of the requests.
+	Payload  []byte
+	State    WebhookDeliveryState
+	Attempts int
+	// NextAttemptAt is when the next attempt is due, it is zero unless the
+	// delivery is pending.
+	NextAttemptAt time.Time
+	// LastStatusCode is the HTTP status of the last attempt, 0 when it got no
+	// response.
+	LastStatusCode int
+	LastError      string
+	// Revision is incremented by every UpdateWebhookDelivery, which fails with
+	// ErrConflict when the delivery was changed since it was read.
+	Revision  int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type ListWebhookDeliveriesOptions struct {
+	// PageSize is the maximum number of deliveries returned, all of them are
+	// returned when it is 0.
+	PageSize  uint
+	PageToken string
+	WebhookID string
+	// State only returns the deliveries in this state when it is set.
+	State WebhookDeliveryState
+}
+
+// WebhookDeliveryPage holds webhook deliveries, newest first.
+type WebhookDeliveryPage struct {
+	Deliveries []*WebhookDelivery
+	// NextPageToken is empty on the last page.
+	NextPageToken string
+}
+
+func copyWebhook(webhook *Webhook) *Webhook {
+	copied := *webhook
+	copied.EventTypes = append([]string(nil), webhook.EventTypes...)
+
+	return &copied
+}
+
+func copyWebhookDelivery(delivery *WebhookDelivery) *WebhookDelivery {
+	copied := *delivery
+	copied.Payload = append([]byte(nil), delivery.Payload...)
+
+	return &copied
+}
+
+// sortWebhooks orders webhooks newest first.
+func sortWebhooks(webhooks []*Webhook) {
+	sort.SliceStable(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.After(webhooks[j].CreatedAt)
+	})
+}
+
+func deliveryCursor(delivery *WebhookDelivery) pageCursor {
+	return pageCursor{Key: delivery.CreatedAt.UTC().Format(auditTimeFormat), Name: delivery.ID}
+}
+
+func (o ListWebhookDeliveriesOptions) matches(delivery *WebhookDelivery) bool {
+	if o.WebhookID != "" && delivery.WebhookID != o.WebhookID {
+		return false
+	}
+
+	return o.State == "" || delivery.State == o.State
+}
@@ -0,0 +1,299 @@
+package semver
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Latest is the selector for the highest stable release.
+const Latest = "latest"
+
+type operator int
+
+const (
+	opEqual operator = iota
+	opGreater
+	opGreaterOrEqual
+	opLess
+	opLessOrEqual
+)
+
+var operators = []struct {
+	token string
+	op    operator
+}{
+	// Longest tokens first so that ">=" is not read as ">".
+	{">=", opGreaterOrEqual},
+	{"<=", opLessOrEqual},
+	{">", opGreater},
+	{"<", opLess},
+	{"=", opEqual},
+}
+
+type comparator struct {
+	op      operator
+	version Version
+}
+
+// Constraint is a set of version ranges joined by "||". A version satisfies
+// the constraint when it satisfies every comparator of at least one range.
+//
+// Pre-releases follow npm semantics: a pre-release version only matches when
+// one of the comparators of the range has a pre-release on the same
+// MAJOR.MINOR.PATCH, so ^1.2.0 never resolves to 1.3.0-beta.1 but
+// >=1.3.0-beta.0 does.
+type Constraint struct {
+	ranges   [][]comparator
+	original string
+}
+
+// ParseConstraint parses expressions like "latest", "*", "1.x", "^1.4",
+// "~2.0.1", ">=1.2 <2", "1.2.3 - 1.4" and "^1 || ^2".
+func ParseConstraint(expression string) (*Constraint, error) {
+	c := &Constraint{original: expression}
+
+	trimmed := strings.TrimSpace(expression)
+	if trimmed == "" || trimmed == Latest {
+		trimmed = "*"
+	}
+
+	for _, alternative := range strings.Split(trimmed, "||") {
+		comparators, err := parseRange(strings.TrimSpace(alternative))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid version range %q", expression)
+		}
+
+		c.ranges = append(c.ranges, comparators)
+	}
+
+	return c, nil
+}
+
+func (c *Constraint) String() string {
+	return c.original
+}
+
+func (c *Constraint) Check(v *Version) bool {
+	for _, comparators := range c.ranges {
+		if satisfies(v, comparators) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Highest returns the highest of the given version names that satisfies the
+// constraint. Names that are not semantic versions are ignored.
+func (c *Constraint) Highest(names []string) (string, bool) {
+	var best *Version
+	bestName := ""
+
+	for _, name := range names {
+		v, err := Parse(name)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+
+		if best == nil || v.Compare(best) > 0 {
+			best, bestName = v, name
+		}
+	}
+
+	return bestName, best != nil
+}
+
+func satisfies(v *Version, comparators []comparator) bool {
+	for _, comparator := range comparators {
+		if !comparator.matches(v) {
+			return false
+		}
+	}
+
+	if !v.IsPrerelease() {
+		return true
+	}
+
+	for _, comparator := range comparators {
+		if comparator.version.IsPrerelease() && comparator.version.sameRelease(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c comparator) matches(v *Version) bool {
+	compared := v.Compare(&c.version)
+
+	switch c.op {
+	case opGreater:
+		return compared > 0
+	case opGreaterOrEqual:
+		return compared >= 0
+	case opLess:
+		return compared < 0
+	case opLessOrEqual:
+		return compared <= 0
+	}
+
+	return compared == 0
+}
+
+func parseRange(expression string) ([]comparator, error) {
+	if expression == "" {
+		return nil, errors.New("empty range")
+	}
+
+	fields := strings.Fields(expression)
+
+	if len(fields) == 3 && fields[1] == "-" {
+		return parseHyphenRange(fields[0], fields[2])
+	}
+
+	var comparators []comparator
+	for i := 0; i < len(fields); i++ {
+		token := fields[i]
+
+		// Allow a space between an operator and its version, as in ">= 1.2".
+		if isOperator(token) && i+1 < len(fields) {
+			i++
+			token += fields[i]
+		}
+
+		expanded, err := expand(token)
+		if err != nil {
+			return nil, err
+		}
+
+		comparators = append(comparators, expanded...)
+	}
+
+	return comparators, nil
+}
+
+func parseHyphenRange(from, to string) ([]comparator, error) {
+	lower, err := parse(from, true)
+	if err != nil {
+		return nil, err
+	}
+
+	upper, err := parse(to, true)
+	if err != nil {
+		return nil, err
+	}
+
+	comparators := []comparator{{opGreaterOrEqual, lower.Version}}
+
+	if upper.hasPatch {
+		return append(comparators, comparator{opLessOrEqual, upper.Version}), nil
+	}
+
+	return append(comparators, comparator{opLess, upper.next()}), nil
+}
+
+func expand(token string) ([]comparator, error) {
+	switch {
+	case strings.HasPrefix(token, "^"):
+		return expandCaret(token[1:])
+	case strings.HasPrefix(token, "~"):
+		return expandTilde(strings.TrimPrefix(token[1:], ">"))
+	}
+
+	op, rest := opEqual, token
+	for _, candidate := range operators {
+		if strings.HasPrefix(token, candidate.token) {
+			op, rest = candidate.op, token[len(candidate.token):]
+			break
+		}
+	}
+
+	p, err := parse(rest, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.hasPatch {
+		return []comparator{{op, p.Version}}, nil
+	}
+
+	// Partial versions describe a range of releases, e.g. 1.2 is 1.2.x.
+	switch op {
+	case opGreater:
+		return []comparator{{opGreaterOrEqual, p.next()}}, nil
+	case opGreaterOrEqual:
+		return []comparator{{opGreaterOrEqual, p.Version}}, nil
+	case opLess:
+		return []comparator{{opLess, p.Version}}, nil
+	case opLessOrEqual:
+		return []comparator{{opLess, p.next()}}, nil
+	}
+
+	if !p.hasMajor {
+		return []comparator{{opGreaterOrEqual, Version{}}}, nil
+	}
+
+	return []comparator{{opGreaterOrEqual, p.Version}, {opLess, p.next()}}, nil
+}
+
+func expandCaret(token string) ([]comparator, error) {
+	p, err := parse(token, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.hasMajor {
+		return []comparator{{opGreaterOrEqual, Version{}}}, nil
+	}
+
+	var upper Version
+	switch {
+	case !p.hasMinor || p.Major > 0:
+		upper = Version{Major: p.Major + 1}
+	case !p.hasPatch || p.Minor > 0:
+		upper = Version{Minor: p.Minor + 1}
+	default:
+		upper = Version{Patch: p.Patch + 1}
+	}
+
+	return []comparator{{opGreaterOrEqual, p.Version}, {opLess, upper}}, nil
+}
+
+func expandTilde(token string) ([]comparator, error) {
+	p, err := parse(token, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.hasMajor {
+		return []comparator{{opGreaterOrEqual, Version{}}}, nil
+	}
+
+	upper := Version{Major: p.Major + 1}
+	if p.hasMinor {
+		upper = Version{Major: p.Major, Minor: p.Minor + 1}
+	}
+
+	return []comparator{{opGreaterOrEqual, p.Version}, {opLess, upper}}, nil
+}
+
+// next returns the first release after the range described by a partial
+// version: 1 -> 2.0.0, 1.2 -> 1.3.0.
+func (p partial) next() Version {
+	if !p.hasMinor {
+		return Version{Major: p.Major + 1}
+	}
+
+	return Version{Major: p.Major, Minor: p.Minor + 1}
+}
+
+func isOperator(token string) bool {
+	for _, candidate := range operators {
+		if token == candidate.token {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,208 @@
+package semver
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "1.2.3", want: "1.2.3"},
+		{name: "v1.2.3", want: "1.2.3"},
+		{name: "0.0.0", want: "0.0.0"},
+		{name: "1.2.3-beta.1", want: "1.2.3-beta.1"},
+		{name: "1.2.3-rc.1+build.5", want: "1.2.3-rc.1+build.5"},
+		{name: "1.2.3+20240101", want: "1.2.3+20240101"},
+		{name: "", wantErr: true},
+		{name: "v", wantErr: true},
+		{name: "1", wantErr: true},
+		{name: "1.2", wantErr: true},
+		{name: "1.2.3.4", wantErr: true},
+		{name: "1.2.x", wantErr: true},
+		{name: "01.2.3", wantErr: true},
+		{name: "1.2.3-", wantErr: true},
+		{name: "1.2.3-beta..1", wantErr: true},
+		{name: "1.2.3-01", wantErr: true},
+		{name: "1.2.3+", wantErr: true},
+		{name: "legacy", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		v, err := Parse(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		// String keeps the name as parsed, the fields give the canonical form.
+		canonical := &Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch, Prerelease: v.Prerelease, Build: v.Build}
+		if canonical.String() != tt.want || v.String() != tt.name {
+			t.Errorf("Parse(%q) = %s (%s), want %s", tt.name, canonical, v, tt.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// Ordered by SemVer precedence, from the SemVer 2.0.0 specification.
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.1.0",
+		"2.0.0",
+		"10.0.0",
+	}
+
+	for i := range ordered {
+		for j := range ordered {
+			a, _ := Parse(ordered[i])
+			b, _ := Parse(ordered[j])
+
+			want := 0
+			switch {
+			case i < j:
+				want = -1
+			case i > j:
+				want = 1
+			}
+
+			if got := a.Compare(b); got != want {
+				t.Errorf("Compare(%s, %s) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+
+	a, _ := Parse("1.0.0+build.1")
+	b, _ := Parse("1.0.0+build.2")
+	if a.Compare(b) != 0 {
+		t.Errorf("Compare(%s, %s) did not ignore the build metadata", a, b)
+	}
+}
+
+func TestConstraintCheck(t *testing.T) {
+	tests := []struct {
+		constraint string
+		match      []string
+		noMatch    []string
+	}{
+		// Caret allows changes that do not modify the left-most non-zero part.
+		{"^1.2.3", []string{"1.2.3", "1.2.4", "1.9.0"}, []string{"1.2.2", "2.0.0", "2.0.0-beta.1"}},
+		{"^1.4", []string{"1.4.0", "1.5.2"}, []string{"1.3.9", "2.0.0"}},
+		{"^1", []string{"1.0.0", "1.99.99"}, []string{"0.9.0", "2.0.0"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0", "0.2.2"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4", "0.1.0"}},
+		{"^0.0", []string{"0.0.0", "0.0.9"}, []string{"0.1.0"}},
+		// Tilde allows patch changes, or minor changes without a minor.
+		{"~2.0.1", []string{"2.0.1", "2.0.9"}, []string{"2.0.0", "2.1.0"}},
+		{"~2.0", []string{"2.0.0", "2.0.9"}, []string{"2.1.0"}},
+		{"~2", []string{"2.0.0", "2.9.9"}, []string{"3.0.0", "1.9.9"}},
+		{"~>2.0.1", []string{"2.0.5"}, []string{"2.1.0"}},
+		// Partial versions and wildcards are ranges of releases.
+		{"1.x", []string{"1.0.0", "1.9.9"}, []string{"2.0.0", "0.9.9"}},
+		{"1.2", []string{"1.2.0", "1.2.9"}, []string{"1.3.0", "1.1.9"}},
+		{"1.2.*", []string{"1.2.0", "1.2.9"}, []string{"1.3.0"}},
+		{"*", []string{"0.0.1", "9.9.9"}, []string{"1.0.0-beta.1"}},
+		{"latest", []string{"1.0.0", "9.9.9"}, []string{"2.0.0-rc.1"}},
+		{"", []string{"1.0.0"}, []string{"2.0.0-rc.1"}},
+		{">1.2", []string{"1.3.0"}, []string{"1.2.9"}},
+		{"<=1.2", []string{"1.2.9"}, []string{"1.3.0"}},
+		{"<1.2", []string{"1.1.9"}, []string{"1.2.0"}},
+		// Comparators, hyphen ranges and alternatives.
+		{">=1.2 <2", []string{"1.2.0", "1.9.9"}, []string{"1.1.9", "2.0.0"}},
+		{">= 1.2 < 2", []string{"1.2.0"}, []string{"2.0.0"}},
+		{"=1.2.3", []string{"1.2.3", "v1.2.3"}, []string{"1.2.4"}},
+		{"1.2.3 - 1.4", []string{"1.2.3", "1.4.9"}, []string{"1.2.2", "1.5.0"}},
+		{"1.2.3 - 1.4.0", []string{"1.4.0"}, []string{"1.4.1"}},
+		{"^1 || ^3", []string{"1.2.0", "3.0.0"}, []string{"2.0.0"}},
+		// A pre-release only matches a range with a pre-release of the same
+		// MAJOR.MINOR.PATCH.
+		{">=1.3.0-beta.0", []string{"1.3.0-beta.1", "1.3.0", "1.4.0"}, []string{"1.4.0-beta.1", "1.3.0-alpha"}},
+		{"^1.2.3-beta.2", []string{"1.2.3-beta.2", "1.2.3-beta.10", "1.2.3", "1.3.0"}, []string{"1.2.3-beta.1", "1.3.0-beta.1"}},
+		{"~1.2.3-rc.1", []string{"1.2.3-rc.2", "1.2.5"}, []string{"1.2.4-rc.1"}},
+		{"1.2.3-rc.1", []string{"1.2.3-rc.1"}, []string{"1.2.3-rc.2", "1.2.3"}},
+		{"^1.2.0", []string{"1.2.0"}, []string{"1.3.0-beta.1", "1.2.1-rc.1"}},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("ParseConstraint(%q): %v", tt.constraint, err)
+			continue
+		}
+
+		for _, name := range tt.match {
+			if v, _ := Parse(name); v == nil || !c.Check(v) {
+				t.Errorf("%q does not match %s", tt.constraint, name)
+			}
+		}
+
+		for _, name := range tt.noMatch {
+			if v, _ := Parse(name); v == nil || c.Check(v) {
+				t.Errorf("%q matches %s", tt.constraint, name)
+			}
+		}
+	}
+}
+
+func TestParseConstraintErrors(t *testing.T) {
+	for _, constraint := range []string{
+		"^",
+		"~",
+		">=",
+		"1.2.3.4",
+		"^1.2.3.4",
+		"1 ||",
+		"|| 1",
+		"1.x-beta.1",
+		"1.2-beta.1",
+		"^a.b",
+		"legacy",
+		"1.2.3 - ",
+		"- 1.2.3",
+	} {
+		if c, err := ParseConstraint(constraint); err == nil {
+			t.Errorf("ParseConstraint(%q) = %v, want an error", constraint, c)
+		}
+	}
+}
+
+func TestConstraintHighest(t *testing.T) {
+	names := []string{"1.0.0", "1.4.2", "legacy", "1.10.0", "2.0.0-rc.1", "2.0.0-beta.3", "v1.9.0"}
+
+	tests := []struct {
+		constraint string
+		want       string
+		wantOK     bool
+	}{
+		{"latest", "1.10.0", true},
+		{"^1.4", "1.10.0", true},
+		{"~1.4", "1.4.2", true},
+		{"<1.10", "v1.9.0", true},
+		{">=2.0.0-beta.0", "2.0.0-rc.1", true},
+		{"^2", "", false},
+		{"^3", "", false},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Fatalf("ParseConstraint(%q): %v", tt.constraint, err)
+		}
+
+		got, ok := c.Highest(names)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("%q.Highest = %q, %v, want %q, %v", tt.constraint, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Package semver parses Semantic Versioning 2.0.0 version names and resolves
+// npm style version ranges such as ^1.4, ~2.0.1 or ">=1.2 <2" against them.
+package semver
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	Prerelease []string
+	Build      string
+
+	original string
+}
+
+// Parse parses a full semantic version. A leading "v" is accepted, so both
+// 1.2.3 and v1.2.3 are valid.
+func Parse(name string) (*Version, error) {
+	v, err := parse(name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	v.original = name
+
+	return &v.Version, nil
+}
+
+// partial is a version that may miss its minor or patch number, or use x/* in
+// their place, as allowed inside range expressions.
+type partial struct {
+	Version
+	hasMajor bool
+	hasMinor bool
+	hasPatch bool
+}
+
+func parse(name string, allowPartial bool) (partial, error) {
+	var p partial
+
+	s := strings.TrimPrefix(name, "v")
+	if s == "" {
+		return p, errors.Errorf("invalid version %q: empty", name)
+	}
+
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		p.Build = s[i+1:]
+		if p.Build == "" || !isIdentifiers(p.Build) {
+			return p, errors.Errorf("invalid version %q: invalid build metadata", name)
+		}
+		s = s[:i]
+	}
+
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		prerelease := s[i+1:]
+		if prerelease == "" || !isIdentifiers(prerelease) {
+			return p, errors.Errorf("invalid version %q: invalid pre-release", name)
+		}
+		p.Prerelease = strings.Split(prerelease, ".")
+		for _, identifier := range p.Prerelease {
+			if isNumeric(identifier) && len(identifier) > 1 && identifier[0] == '0' {
+				return p, errors.Errorf("invalid version %q: numeric pre-release identifier has leading zero", name)
+			}
+		}
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 || (!allowPartial && len(parts) != 3) {
+		return p, errors.Errorf("invalid version %q: expected MAJOR.MINOR.PATCH", name)
+	}
+
+	numbers := []*uint64{&p.Major, &p.Minor, &p.Patch}
+	for i, part := range parts {
+		if allowPartial && isWildcard(part) {
+			if len(p.Prerelease) > 0 {
+				return p, errors.Errorf("invalid version %q: wildcard with pre-release", name)
+			}
+			break
+		}
+
+		n, err := parseNumber(part)
+		if err != nil {
+			return p, errors.Wrapf(err, "invalid version %q", name)
+		}
+
+		*numbers[i] = n
+		p.hasMajor = true
+		p.hasMinor = p.hasMinor || i >= 1
+		p.hasPatch = p.hasPatch || i >= 2
+	}
+
+	if len(p.Prerelease) > 0 && !p.hasPatch {
+		return p, errors.Errorf("invalid version %q: pre-release requires a full version", name)
+	}
+
+	return p, nil
+}
+
+func (v *Version) String() string {
+	if v.original != "" {
+		return v.original
+	}
+
+	s := strconv.FormatUint(v.Major, 10) + "." + strconv.FormatUint(v.Minor, 10) + "." + strconv.FormatUint(v.Patch, 10)
+	if len(v.Prerelease) > 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+
+	return s
+}
+
+func (v *Version) IsPrerelease() bool {
+	return len(v.Prerelease) > 0
+}
+
+// Compare returns -1, 0 or 1 following SemVer precedence. Build metadata is
+// ignored.
+func (v *Version) Compare(o *Version) int {
+	if c := compareUint(v.Major, o.Major); c != 0 {
+		return c
+	}
+
+	if c := compareUint(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+
+	if c := compareUint(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+func (v *Version) sameRelease(o *Version) bool {
+	return v.Major == o.Major && v.Minor == o.Minor && v.Patch == o.Patch
+}
+
+func comparePrerelease(a, b []string) int {
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) == 0:
+		return 1
+	case len(b) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(a) && i < len(b); i++ {
+		aNumeric, bNumeric := isNumeric(a[i]), isNumeric(b[i])
+
+		switch {
+		case aNumeric && bNumeric:
+			an, _ := strconv.ParseUint(a[i], 10, 64)
+			bn, _ := strconv.ParseUint(b[i], 10, 64)
+			if c := compareUint(an, bn); c != 0 {
+				return c
+			}
+		case aNumeric:
+			return -1
+		case bNumeric:
+			return 1
+		default:
+			if c := strings.Compare(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+	}
+
+	return compareUint(uint64(len(a)), uint64(len(b)))
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+func parseNumber(s string) (uint64, error) {
+	if s == "" || !isNumeric(s) {
+		return 0, errors.Errorf("%q is not a number", s)
+	}
+
+	if len(s) > 1 && s[0] == '0' {
+		return 0, errors.Errorf("%q has a leading zero", s)
+	}
+
+	return strconv.ParseUint(s, 10, 64)
+}
+
+func isWildcard(s string) bool {
+	return s == "x" || s == "X" || s == "*"
+}
+
+func isNumeric(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+func isIdentifiers(s string) bool {
+	for _, identifier := range strings.Split(s, ".") {
+		if identifier == "" {
+			return false
+		}
+
+		for _, c := range identifier {
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/orn"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+// requestIDMetadata is the request metadata carrying the id that audit events
+// are recorded with.
+const requestIDMetadata = "x-request-id"
+
+// anonymousActor is recorded as the actor when authentication is disabled.
+const anonymousActor = "anonymous"
+
+type ListAuditEventsRequest struct {
+	// PackageOrn limits the events to one package. Owners of the package can
+	// list its events, admins can list every event.
+	PackageOrn string
+	Actor      string
+	// Since and Until bound the time of the events, Until is exclusive.
+	// Either one is ignored when it is zero.
+	Since time.Time
+	Until time.Time
+	// PageSize is at most maxPageSize. Every event is returned when it is 0.
+	PageSize  uint32
+	PageToken string
+}
+
+func (s *Server) ListAuditEvents(ctx context.Context, request *ListAuditEventsRequest) (*repository.AuditEventPage, error) {
+	pageSize, err := checkPageSize(request.PageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	options := repository.ListAuditEventsOptions{
+		PageSize:  pageSize,
+		PageToken: request.PageToken,
+		Actor:     request.Actor,
+	}
+
+	if !request.Since.IsZero() {
+		options.Since = &request.Since
+	}
+
+	if !request.Until.IsZero() {
+		options.Until = &request.Until
+	}
+
+	if request.PackageOrn == "" {
+		if err := s.auth.AuthorizeAdmin(ctx); err != nil {
+			return nil, s.statusError(err, packageResourceType, "")
+		}
+	} else {
+		packageOrn, err := orn.ParsePackage(request.PackageOrn)
+		if err != nil {
+			return nil, invalidArgument("package_orn", err)
+		}
+
+		if err := s.authorize(ctx, packageOrn.Package, auth.RoleOwner); err != nil {
+			return nil, s.statusError(err, packageResourceType, packageOrn.String())
+		}
+
+		options.Package = packageOrn.Package
+	}
+
+	page, err := s.repo.ListAuditEvents(ctx, options)
+	if err != nil {
+		return nil, s.statusError(err, packageResourceType, request.PackageOrn)
+	}
+
+	return page, nil
+}
+
+// withAudit returns ctx recording the change made with it as method changing
+// resourceOrn. The repository records the event in the transaction of the
+// change, so ctx must only be given to the method making it. after gives
+// the values recorded after the change from the resource the method saved,
+// it can be nil.
+func withAudit(ctx context.Context, method, resourceOrn, packageName string, before map[string]interface{}, after func(saved interface{}) map[string]interface{}) context.Context {
+	audit := &repository.Audit{Event: newAuditEvent(ctx, method, resourceOrn, packageName, before)}
+	if after != nil {
+		audit.Complete = func(event *repository.AuditEvent, saved interface{}) {
+			event.After = after(saved)
+		}
+	}
+
+	return repository.WithAudit(ctx, audit)
+}
+
+func newAuditEvent(ctx context.Context, method, resourceOrn, packageName string, before map[string]interface{}) *repository.AuditEvent {
+	return &repository.AuditEvent{
+		Actor:     actorFromContext(ctx),
+		Method:    method,
+		Orn:       resourceOrn,
+		Package:   packageName,
+		Before:    before,
+		Time:      time.Now(),
+		RequestID: firstMetadataValue(incomingMetadata(ctx), requestIDMetadata),
+	}
+}
+
+func actorFromContext(ctx context.Context) string {
+	if principal, ok := auth.FromContext(ctx); ok {
+		return principal.Subject
+	}
+
+	return anonymousActor
+}
+
+func incomingMetadata(ctx context.Context) metadata.MD {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	return md
+}
+
+// packageFields, versionFields, channelFields and routingFields are the values recorded in
+// audit events, a nil resource is recorded without values. The saved*Fields
+// variants take the resource a repository method saved, for withAudit.
+func packageFields(pkg *polvo_v1.Package) map[string]interface{} {
+	if pkg == nil {
+		return nil
+	}
+
+	return map[string]interface{}{
+		"name":       pkg.GetName(),
+		"maintainer": pkg.GetMaintainer(),
+	}
+}
+
+// packageDetailsFields adds the metadata of the package to its packageFields.
+func packageDetailsFields(details *repository.PackageDetails) map[string]interface{} {
+	if details == nil {
+		return nil
+	}
+
+	fields := packageFields(details.Package)
+	fields["description"] = details.Metadata.Description
+	fields["repository_url"] = details.Metadata.RepositoryUrl
+	fields["homepage_url"] = details.Metadata.HomepageUrl
+	fields["icon_url"] = details.Metadata.IconUrl
+	fields["tags"] = details.Metadata.Tags
+	fields["owners"] = details.Metadata.Owners
+
+	return fields
+}
+
+// updatedPackageDetails is current after the update of updateFields, saved
+// being the package UpdatePackage saved.
+func updatedPackageDetails(current *repository.PackageDetails, saved *polvo_v1.Package, updateFields map[string]interface{}) *repository.PackageDetails {
+	return &repository.PackageDetails{
+		Package:  saved,
+		Metadata: current.Metadata.Updated(updateFields),
+	}
+}
+
+func versionFields(version *polvo_v1.Version) map[string]interface{} {
+	if version == nil {
+		return nil
+	}
+
+	return map[string]interface{}{
+		"name":         version.GetName(),
+		"manifest_url": version.GetManifestUrl(),
+		"weight":       version.GetWeight(),
+	}
+}
+
+// versionDetailsFields adds the labels of the version to its versionFields.
+func versionDetailsFields(details *repository.VersionDetails) map[string]interface{} {
+	if details == nil {
+		return nil
+	}
+
+	fields := versionFields(details.Version)
+	fields["labels"] = details.Labels
+
+	return fields
+}
+
+// updatedVersionDetails is current after the update of updateFields, saved
+// being the version UpdateVersion saved.
+func updatedVersionDetails(current *repository.VersionDetails, saved *polvo_v1.Version, updateFields map[string]interface{}) *repository.VersionDetails {
+	updated := &repository.VersionDetails{Version: saved, Labels: current.Labels}
+	if versionLabels, ok := updateFields[repository.LabelsField]; ok {
+		updated.Labels = versionLabels.(map[string]string)
+	}
+
+	return updated
+}
+
+func channelFields(channel *repository.Channel) map[string]interface{} {
+	if channel == nil {
+		return nil
+	}
+
+	targets := make([]map[string]interface{}, 0, len(channel.Targets))
+	for _, target := range channel.Targets {
+		targets = append(targets, map[string]interface{}{
+			"version": target.Version,
+			"weight":  target.Weight,
+		})
+	}
+
+	return map[string]interface{}{
+		"name":     channel.Name,
+		"targets":  targets,
+		"revision": channel.Revision,
+	}
+}
+
+func routingFields(revision *repository.RoutingRevision) map[string]interface{} {
+	if revision == nil {
+		return nil
+	}
+
+	versions := make([]map[string]interface{}, 0, len(revision.Entries))
+	for _, entry := range revision.Entries {
+		versions = append(versions, map[string]interface{}{
+			"version":      entry.Version,
+			"manifest_url": entry.ManifestUrl,
+			"weight":       entry.Weight,
+		})
+	}
+
+	return map[string]interface{}{
+		"revision": revision.Revision,
+		"versions": versions,
+	}
+}
+
+func savedPackageFields(saved interface{}) map[string]interface{} {
+	pkg, _ := saved.(*polvo_v1.Package)
+
+	return packageFields(pkg)
+}
+
+func savedVersionFields(saved interface{}) map[string]interface{} {
+	version, _ := saved.(*polvo_v1.Version)
+
+	return versionFields(version)
+}
+
+func savedChannelFields(saved interface{}) map[string]interface{} {
+	channel, _ := saved.(*repository.Channel)
+
+	return channelFields(channel)
+}
+
+func savedRoutingFields(saved interface{}) map[string]interface{} {
+	revision, _ := saved.(*repository.RoutingRevision)
+
+	return routingFields(revision)
+}
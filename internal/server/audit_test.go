@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+// unreadableChannels is a repository whose channels can not be read.
+type unreadableChannels struct {
+	*repository.MemoryRepository
+}
+
+func (r unreadableChannels) GetChannel(ctx context.Context, packageName, channelName string) (*repository.Channel, error) {
+	return nil, errors.Wrap(repository.ErrUnavailable, "failed to query data")
+}
+
+func createChannel(t *testing.T, s *Server, repo repository.Repository) {
+	t.Helper()
+
+	ctx := context.Background()
+	createPackages(t, repo, "button")
+
+	for _, name := range []string{"1.0.0", "2.0.0"} {
+		if _, err := repo.CreateVersion(ctx, "button", &polvo_v1.Version{Name: name}, nil, nil); err != nil {
+			t.Fatalf("CreateVersion: %v", err)
+		}
+	}
+
+	if _, err := s.CreateChannel(ctx, &CreateChannelRequest{
+		PackageOrn: "packages/button",
+		Name:       "stable",
+		Targets:    []repository.ChannelTarget{{Version: "1.0.0", Weight: 100}},
+	}); err != nil {
+		t.Fatalf("CreateChannel: %v", err)
+	}
+}
+
+func TestChangesAreAudited(t *testing.T) {
+	s, repo := newTestServer(t)
+	ctx := context.Background()
+
+	createChannel(t, s, repo)
+
+	if _, err := s.PromoteChannel(ctx, &PromoteChannelRequest{
+		Orn:     "packages/button/channels/stable",
+		Targets: []repository.ChannelTarget{{Version: "2.0.0", Weight: 100}},
+	}); err != nil {
+		t.Fatalf("PromoteChannel: %v", err)
+	}
+
+	// A change that fails is not recorded.
+	if _, err := s.PromoteChannel(ctx, &PromoteChannelRequest{
+		Orn:     "packages/button/channels/stable",
+		Targets: []repository.ChannelTarget{{Version: "3.0.0", Weight: 100}},
+	}); err == nil {
+		t.Fatal("PromoteChannel to a missing version succeeded")
+	}
+
+	page, err := repo.ListAuditEvents(ctx, repository.ListAuditEventsOptions{})
+	if err != nil {
+		t.Fatalf("ListAuditEvents: %v", err)
+	}
+
+	if len(page.Events) != 2 {
+		t.Fatalf("ListAuditEvents = %d events, want the creation and the promotion", len(page.Events))
+	}
+
+	promotion, creation := page.Events[0], page.Events[1]
+	if creation.Method != "CreateChannel" || creation.Before != nil || creation.After["revision"] != int64(1) {
+		t.Errorf("creation = %+v", creation)
+	}
+
+	if promotion.Method != "PromoteChannel" || promotion.Orn != "packages/button/channels/stable" || promotion.Actor != anonymousActor {
+		t.Errorf("promotion = %+v", promotion)
+	}
+
+	if promotion.Before["revision"] != int64(1) || promotion.After["revision"] != int64(2) {
+		t.Errorf("promotion went from %v to %v, want revision 1 to 2", promotion.Before, promotion.After)
+	}
+}
+
+func TestChannelChangesFailWhenTheChannelCanNotBeRead(t *testing.T) {
+	s, repo := newTestServer(t)
+	ctx := context.Background()
+
+	createChannel(t, s, repo)
+	s.repo = unreadableChannels{repo}
+
+	_, err := s.PromoteChannel(ctx, &PromoteChannelRequest{
+		Orn:     "packages/button/channels/stable",
+		Targets: []repository.ChannelTarget{{Version: "2.0.0", Weight: 100}},
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("PromoteChannel = %v, want Unavailable", err)
+	}
+
+	if _, err := s.RollbackChannel(ctx, &RollbackChannelRequest{Orn: "packages/button/channels/stable"}); status.Code(err) != codes.Unavailable {
+		t.Errorf("RollbackChannel = %v, want Unavailable", err)
+	}
+
+	channels, err := repo.ListChannels(ctx, "button")
+	if err != nil || len(channels) != 1 || channels[0].Revision != 1 {
+		t.Errorf("the channel was changed without its previous state: %+v, %v", channels, err)
+	}
+}
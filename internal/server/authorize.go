@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+)
+
+// PublicReads reports whether packages can be read without credentials.
+func (s *Server) PublicReads() bool {
+	return s.auth.PublicReads()
+}
+
+// authorize checks that the caller has at least role in the package, whose
+// maintainer field lists the roles. It returns repository or auth errors.
+func (s *Server) authorize(ctx context.Context, packageName string, role auth.Role) error {
+	if s.auth.Disabled() || (role == auth.RoleReader && s.auth.PublicReads()) {
+		return nil
+	}
+
+	pkg, err := s.repo.GetPackage(ctx, packageName)
+	if err != nil {
+		return err
+	}
+
+	return s.auth.Authorize(ctx, pkg.GetMaintainer(), role)
+}
+
+// authorizeNewPackage makes the caller the owner of a package created without
+// maintainer, and otherwise checks that the caller is one of its owners so
+// that nobody can create packages in the name of someone else.
+func (s *Server) authorizeNewPackage(ctx context.Context, pkg *polvo_v1.Package) error {
+	if _, err := auth.ParseMaintainer(pkg.GetMaintainer()); err != nil {
+		return invalidArgument("package.maintainer", err)
+	}
+
+	if s.auth.Disabled() {
+		return nil
+	}
+
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return s.statusError(errors.Wrap(auth.ErrUnauthenticated, "credentials are required"), packageResourceType, "")
+	}
+
+	if pkg.GetMaintainer() == "" {
+		pkg.Maintainer = principal.Subject
+
+		return nil
+	}
+
+	if err := s.auth.Authorize(ctx, pkg.GetMaintainer(), auth.RoleOwner); err != nil {
+		return s.statusError(err, packageResourceType, "")
+	}
+
+	return nil
+}
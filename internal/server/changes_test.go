@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+func TestChangeBusResume(t *testing.T) {
+	bus := newChangeBus()
+
+	if watcher := bus.subscribeLatest(); watcher != nil {
+		t.Fatal("subscribeLatest before the start returned a watcher")
+	}
+
+	bus.start(0)
+
+	events := []*ChangeEvent{
+		{Sequence: 1, Type: ChangePackageCreated, Package: "button"},
+		{Sequence: 2, Type: ChangeVersionCreated, Package: "button"},
+		{Sequence: 3, Type: ChangeWeightChanged, Package: "button"},
+	}
+	for _, event := range events {
+		bus.publish(event)
+	}
+
+	watcher := bus.subscribe(1)
+	if watcher == nil {
+		t.Fatal("subscribe after the first event returned no watcher")
+	}
+	defer bus.unsubscribe(watcher)
+
+	if len(watcher.replay) != 2 || watcher.replay[0] != events[1] || watcher.replay[1] != events[2] {
+		t.Errorf("replay = %v, want the events after the first one", watcher.replay)
+	}
+
+	fresh := bus.subscribeLatest()
+	defer bus.unsubscribe(fresh)
+
+	if fresh.after != 3 || len(fresh.replay) != 0 {
+		t.Errorf("subscribeLatest = %+v, want no replay after the third event", fresh)
+	}
+
+	bus.publish(&ChangeEvent{Sequence: 4, Type: ChangePackageUpdated, Package: "button"})
+	if event := <-fresh.events; event.Sequence != 4 {
+		t.Errorf("next event = %+v, want the fourth one", event)
+	}
+}
+
+func TestChangeBusForgetsEvictedEvents(t *testing.T) {
+	bus := newChangeBus()
+	bus.start(0)
+
+	for i := 0; i < changeEventHistory+1; i++ {
+		bus.publish(&ChangeEvent{Sequence: uint64(i + 1), Type: ChangePackageUpdated, Package: "button"})
+	}
+
+	// The events after the first one are read from the outbox instead.
+	if watcher := bus.subscribe(0); watcher != nil {
+		t.Errorf("subscribe after the history moved on = %+v, want none", watcher)
+	}
+
+	if watcher := bus.subscribe(1); watcher == nil || len(watcher.replay) != changeEventHistory {
+		t.Errorf("subscribe after the evicted event = %+v, want the whole history", watcher)
+	}
+}
+
+func TestWatchPackageSendsItsChanges(t *testing.T) {
+	ctx := context.Background()
+	s := newChannelTestServer(t)
+
+	// The events of the test packages are published before the watch starts.
+	feed := startChangeFeed(t, s)
+
+	latest, err := s.repo.LatestOutboxSequence(ctx)
+	if err != nil {
+		t.Fatalf("LatestOutboxSequence: %v", err)
+	}
+
+	if _, err := s.repo.CreatePackage(ctx, &polvo_v1.Package{Name: "card"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	if _, err := s.CreateChannel(ctx, &CreateChannelRequest{PackageOrn: "packages/button", Name: "stable", Targets: []repository.ChannelTarget{{Version: "1.0.0"}}}); err != nil {
+		t.Fatalf("CreateChannel: %v", err)
+	}
+
+	feed.publishNew(ctx)
+
+	errSent := errors.New("sent")
+
+	var sent *ChangeEvent
+	err = s.WatchPackage(ctx, &WatchPackageRequest{Orn: "packages/button", ResumeToken: newResumeToken(latest)}, func(event *ChangeEvent) error {
+		sent = event
+		return errSent
+	})
+	if err != errSent {
+		t.Fatalf("WatchPackage = %v", err)
+	}
+
+	if sent.Type != ChangeChannelCreated || sent.Orn != "packages/button/channels/stable" || sent.ChannelState == nil {
+		t.Errorf("first event = %+v, want the channel of button", sent)
+	}
+
+	if err := s.WatchPackage(ctx, &WatchPackageRequest{Orn: "button"}, nil); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("WatchPackage with an invalid orn = %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/orn"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+type CreateChannelRequest struct {
+	PackageOrn string
+	Name       string
+	Targets    []repository.ChannelTarget
+}
+
+type ListChannelsRequest struct {
+	PackageOrn string
+}
+
+type GetChannelRequest struct {
+	Orn string
+}
+
+type PromoteChannelRequest struct {
+	Orn     string
+	Targets []repository.ChannelTarget
+}
+
+type RollbackChannelRequest struct {
+	Orn string
+}
+
+func (s *Server) CreateChannel(ctx context.Context, request *CreateChannelRequest) (*repository.Channel, error) {
+	packageOrn, err := orn.ParsePackage(request.PackageOrn)
+	if err != nil {
+		return nil, invalidArgument("package_orn", err)
+	}
+
+	if err := orn.ValidateChannelName(request.Name); err != nil {
+		return nil, invalidArgument("name", err)
+	}
+
+	channelOrn := orn.ChannelORN{Package: packageOrn.Package, Channel: request.Name}
+
+	if err := validateChannelTargets(request.Targets); err != nil {
+		return nil, invalidArgument("targets", err)
+	}
+
+	if err := s.authorize(ctx, packageOrn.Package, auth.RolePublisher); err != nil {
+		return nil, s.statusError(err, channelResourceType, channelOrn.String())
+	}
+
+	auditCtx := withAudit(ctx, "CreateChannel", channelOrn.String(), channelOrn.Package, nil, savedChannelFields)
+	channel, err := s.repo.CreateChannel(auditCtx, packageOrn.Package, &repository.Channel{
+		Name:    request.Name,
+		Targets: request.Targets,
+	})
+	if err != nil {
+		return nil, s.statusError(err, channelResourceType, channelOrn.String())
+	}
+
+	s.wakeOutboxRelay()
+
+	return channel, nil
+}
+
+func (s *Server) ListChannels(ctx context.Context, request *ListChannelsRequest) ([]*repository.Channel, error) {
+	packageOrn, err := orn.ParsePackage(request.PackageOrn)
+	if err != nil {
+		return nil, invalidArgument("package_orn", err)
+	}
+
+	if err := s.authorize(ctx, packageOrn.Package, auth.RoleReader); err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	channels, err := s.repo.ListChannels(ctx, packageOrn.Package)
+	if err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	return channels, nil
+}
+
+func (s *Server) GetChannel(ctx context.Context, request *GetChannelRequest) (*repository.Channel, error) {
+	channelOrn, err := orn.ParseChannel(request.Orn)
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
+
+	if err := s.authorize(ctx, channelOrn.Package, auth.RoleReader); err != nil {
+		return nil, s.statusError(err, channelResourceType, channelOrn.String())
+	}
+
+	channel, err := s.repo.GetChannel(ctx, channelOrn.Package, channelOrn.Channel)
+	if err != nil {
+		return nil, s.statusError(err, channelResourceType, channelOrn.String())
+	}
+
+	return channel, nil
+}
+
+func (s *Server) PromoteChannel(ctx context.Context, request *PromoteChannelRequest) (*repository.Channel, error) {
+	channelOrn, err := orn.ParseChannel(request.Orn)
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
+
+	if err := validateChannelTargets(request.Targets); err != nil {
+		return nil, invalidArgument("targets", err)
+	}
+
+	if err := s.authorize(ctx, channelOrn.Package, auth.RolePublisher); err != nil {
+		return nil, s.statusError(err, channelResourceType, channelOrn.String())
+	}
+
+	current, err := s.repo.GetChannel(ctx, channelOrn.Package, channelOrn.Channel)
+	if err != nil {
+		return nil, s.statusError(err, channelResourceType, channelOrn.String())
+	}
+
+	auditCtx := withAudit(ctx, "PromoteChannel", channelOrn.String(), channelOrn.Package, channelFields(current), savedChannelFields)
+	channel, err := s.repo.PromoteChannel(auditCtx, channelOrn.Package, channelOrn.Channel, request.Targets)
+	if err != nil {
+		return nil, s.statusError(err, channelResourceType, channelOrn.String())
+	}
+
+	s.wakeOutboxRelay()
+
+	return channel, nil
+}
+
+func (s *Server) RollbackChannel(ctx context.Context, request *RollbackChannelRequest) (*repository.Channel, error) {
+	channelOrn, err := orn.ParseChannel(request.Orn)
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
+
+	if err := s.authorize(ctx, channelOrn.Package, auth.RolePublisher); err != nil {
+		return nil, s.statusError(err, channelResourceType, channelOrn.String())
+	}
+
+	current, err := s.repo.GetChannel(ctx, channelOrn.Package, channelOrn.Channel)
+	if err != nil {
+		return nil, s.statusError(err, channelResourceType, channelOrn.String())
+	}
+
+	auditCtx := withAudit(ctx, "RollbackChannel", channelOrn.String(), channelOrn.Package, channelFields(current), savedChannelFields)
+	channel, err := s.repo.RollbackChannel(auditCtx, channelOrn.Package, channelOrn.Channel)
+	if err != nil {
+		return nil, s.statusError(err, channelResourceType, channelOrn.String())
+	}
+
+	s.wakeOutboxRelay()
+
+	return channel, nil
+}
+
+// validateChannelTargets checks that a channel points at distinct versions
+// and, when it splits traffic between several versions, that at least one of
+// them has a weight. The weight of a single target is ignored.
+func validateChannelTargets(targets []repository.ChannelTarget) error {
+	if len(targets) == 0 {
+		return errors.New("a channel needs at least one target version")
+	}
+
+	seen := map[string]bool{}
+	var totalWeight uint64
+	for _, target := range targets {
+		if err := orn.ValidateVersionName(target.Version); err != nil {
+			return err
+		}
+
+		if seen[target.Version] {
+			return errors.Errorf("version %s is listed more than once", target.Version)
+		}
+
+		seen[target.Version] = true
+		totalWeight += uint64(target.Weight)
+	}
+
+	if len(targets) > 1 && totalWeight == 0 {
+		return errors.New("at least one target version needs a weight")
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/orn"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+// newChannelTestServer returns a Server with the button package and its
+// versions 1.0.0 and 2.0.0.
+func newChannelTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	ctx := context.Background()
+	s, repo := newTestServer(t)
+
+	if _, err := repo.CreatePackage(ctx, &polvo_v1.Package{Name: "button", Maintainer: "alice"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	for _, name := range []string{"1.0.0", "2.0.0"} {
+		if _, err := repo.CreateVersion(ctx, "button", &polvo_v1.Version{Name: name, Weight: 50}, nil, nil); err != nil {
+			t.Fatalf("CreateVersion(%q): %v", name, err)
+		}
+	}
+
+	return s
+}
+
+func TestChannelTargetsAreValidated(t *testing.T) {
+	s := newChannelTestServer(t)
+
+	for _, targets := range [][]repository.ChannelTarget{
+		nil,
+		{{Version: "1.0.0", Weight: 50}, {Version: "1.0.0", Weight: 50}},
+		{{Version: "1.0.0"}, {Version: "2.0.0"}},
+		{{Version: "^1"}},
+	} {
+		_, err := s.CreateChannel(context.Background(), &CreateChannelRequest{PackageOrn: "packages/button", Name: "stable", Targets: targets})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("CreateChannel with the targets %v = %v, want InvalidArgument", targets, err)
+		}
+	}
+}
+
+func TestPromoteAndRollbackChannel(t *testing.T) {
+	ctx := context.Background()
+	s := newChannelTestServer(t)
+
+	if _, err := s.CreateChannel(ctx, &CreateChannelRequest{PackageOrn: "packages/button", Name: "stable", Targets: []repository.ChannelTarget{{Version: "1.0.0"}}}); err != nil {
+		t.Fatalf("CreateChannel: %v", err)
+	}
+
+	if _, err := s.RollbackChannel(ctx, &RollbackChannelRequest{Orn: "packages/button/channels/stable"}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("RollbackChannel before a promotion = %v, want FailedPrecondition", err)
+	}
+
+	stable := orn.VersionORN{Package: "button", Version: "stable"}
+	if version, err := s.resolveVersion(ctx, stable, "", nil); err != nil || version.GetName() != "1.0.0" {
+		t.Errorf("resolveVersion(stable) = %v, %v, want 1.0.0", version, err)
+	}
+
+	if _, err := s.PromoteChannel(ctx, &PromoteChannelRequest{Orn: "packages/button/channels/stable", Targets: []repository.ChannelTarget{{Version: "2.0.0"}}}); err != nil {
+		t.Fatalf("PromoteChannel: %v", err)
+	}
+
+	if version, err := s.resolveVersion(ctx, stable, "", nil); err != nil || version.GetName() != "2.0.0" {
+		t.Errorf("resolveVersion(stable) after the promotion = %v, %v, want 2.0.0", version, err)
+	}
+
+	if _, err := s.RollbackChannel(ctx, &RollbackChannelRequest{Orn: "packages/button/channels/stable"}); err != nil {
+		t.Fatalf("RollbackChannel: %v", err)
+	}
+
+	if version, err := s.resolveVersion(ctx, stable, "", nil); err != nil || version.GetName() != "1.0.0" {
+		t.Errorf("resolveVersion(stable) after the rollback = %v, %v, want 1.0.0", version, err)
+	}
+
+	if _, err := s.GetChannel(ctx, &GetChannelRequest{Orn: "packages/button/channels/beta"}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetChannel of a missing channel = %v, want NotFound", err)
+	}
+}
+
+func TestResolveChannelSplitsByChannelWeight(t *testing.T) {
+	ctx := context.Background()
+	s := newChannelTestServer(t)
+
+	// Both versions weigh 50 in the package, the channel sends everyone to 2.0.0.
+	targets := []repository.ChannelTarget{{Version: "1.0.0", Weight: 0}, {Version: "2.0.0", Weight: 100}}
+	if _, err := s.CreateChannel(ctx, &CreateChannelRequest{PackageOrn: "packages/button", Name: "beta", Targets: targets}); err != nil {
+		t.Fatalf("CreateChannel: %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		version, err := s.resolveVersion(ctx, orn.VersionORN{Package: "button", Version: "beta"}, "", nil)
+		if err != nil || version.GetName() != "2.0.0" || version.GetWeight() != 50 {
+			t.Fatalf("resolveVersion(beta) = %v, %v, want 2.0.0 with its own weight", version, err)
+		}
+	}
+}
+
+func TestChannelChangesAreAudited(t *testing.T) {
+	s := newChannelTestServer(t)
+
+	ctx := auth.NewContext(context.Background(), &auth.Principal{Subject: "alice"})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(requestIDMetadata, "request-1"))
+
+	if _, err := s.CreateChannel(ctx, &CreateChannelRequest{PackageOrn: "packages/button", Name: "stable", Targets: []repository.ChannelTarget{{Version: "1.0.0"}}}); err != nil {
+		t.Fatalf("CreateChannel: %v", err)
+	}
+
+	if _, err := s.PromoteChannel(ctx, &PromoteChannelRequest{Orn: "packages/button/channels/stable", Targets: []repository.ChannelTarget{{Version: "2.0.0"}}}); err != nil {
+		t.Fatalf("PromoteChannel: %v", err)
+	}
+
+	page, err := s.ListAuditEvents(ctx, &ListAuditEventsRequest{PackageOrn: "packages/button"})
+	if err != nil {
+		t.Fatalf("ListAuditEvents: %v", err)
+	}
+
+	if len(page.Events) != 2 {
+		t.Fatalf("ListAuditEvents = %d events, want the creation and the promotion", len(page.Events))
+	}
+
+	promotion := page.Events[0]
+	if promotion.Method != "PromoteChannel" || promotion.Actor != "alice" || promotion.RequestID != "request-1" || promotion.Orn != "packages/button/channels/stable" {
+		t.Errorf("promotion = %+v", promotion)
+	}
+
+	if promotion.Before["revision"] != int64(1) || promotion.After["revision"] != int64(2) {
+		t.Errorf("promotion revisions = %v -> %v, want 1 -> 2", promotion.Before["revision"], promotion.After["revision"])
+	}
+}
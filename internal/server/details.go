@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/labels"
+	"pkg.aiocean.dev/polvoservice/internal/orn"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+// The polvo_v1 messages have no timestamp fields, so GetPackage and GetVersion
+// return them in these response headers, formatted as RFC 3339.
+const (
+	createdAtMetadata = "x-polvo-created-at"
+	updatedAtMetadata = "x-polvo-updated-at"
+)
+
+type DescribePackageRequest struct {
+	Orn string
+}
+
+type DescribeVersionRequest struct {
+	// Orn is a version ORN, resolved like GetVersion does.
+	Orn       string
+	StickyKey string
+	// LabelSelector restricts the resolution to the versions it selects.
+	LabelSelector string
+}
+
+func (s *Server) DescribePackage(ctx context.Context, request *DescribePackageRequest) (*repository.PackageDetails, error) {
+	packageOrn, err := orn.ParsePackage(request.Orn)
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
+
+	if err := s.authorize(ctx, packageOrn.Package, auth.RoleReader); err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	details, err := s.repo.GetPackageDetails(ctx, packageOrn.Package)
+	if err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	return details, nil
+}
+
+func (s *Server) DescribeVersion(ctx context.Context, request *DescribeVersionRequest) (*repository.VersionDetails, error) {
+	versionOrn, err := orn.ParseVersion(request.Orn)
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
+
+	selector, err := parseLabelSelector(request.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := s.resolveVersionDetails(ctx, versionOrn, request.StickyKey, selector)
+	if err != nil {
+		return nil, s.statusError(err, versionResourceType, versionOrn.String())
+	}
+
+	return details, nil
+}
+
+// resolveVersionDetails resolves the version with resolveVersion, then reads
+// the details of the version it resolved to.
+func (s *Server) resolveVersionDetails(ctx context.Context, versionOrn orn.VersionORN, stickyKey string, selector *labels.Selector) (*repository.VersionDetails, error) {
+	version, err := s.resolveVersion(ctx, versionOrn, stickyKey, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetVersionDetails(ctx, versionOrn.Package, version.GetName())
+}
+
+// setTimestampHeader sends the timestamps as response headers. It does
+// nothing when ctx does not belong to a gRPC call.
+func setTimestampHeader(ctx context.Context, createdAt, updatedAt time.Time) {
+	md := metadata.MD{}
+
+	if !createdAt.IsZero() {
+		md.Set(createdAtMetadata, createdAt.Format(time.RFC3339))
+	}
+
+	if !updatedAt.IsZero() {
+		md.Set(updatedAtMetadata, updatedAt.Format(time.RFC3339))
+	}
+
+	_ = grpc.SetHeader(ctx, md)
+}
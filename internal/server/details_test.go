@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+)
+
+func TestDescribeVersionResolvesTheVersion(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestServer(t)
+
+	if _, err := repo.CreatePackage(ctx, &polvo_v1.Package{Name: "button", Maintainer: "alice"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	for _, name := range []string{"1.0.0", "1.2.0", "2.0.0"} {
+		if _, err := repo.CreateVersion(ctx, "button", &polvo_v1.Version{Name: name}, nil, nil); err != nil {
+			t.Fatalf("CreateVersion(%q): %v", name, err)
+		}
+	}
+
+	details, err := s.DescribeVersion(ctx, &DescribeVersionRequest{Orn: "packages/button/versions/^1"})
+	if err != nil {
+		t.Fatalf("DescribeVersion: %v", err)
+	}
+
+	if details.Version.GetName() != "1.2.0" || details.CreatedAt.IsZero() || details.UpdatedAt.IsZero() {
+		t.Errorf("DescribeVersion = %+v", details)
+	}
+
+	pkg, err := s.DescribePackage(ctx, &DescribePackageRequest{Orn: "packages/button"})
+	if err != nil || pkg.Package.GetMaintainer() != "alice" || pkg.CreatedAt.IsZero() {
+		t.Errorf("DescribePackage = %+v, %v", pkg, err)
+	}
+
+	if _, err := s.DescribePackage(ctx, &DescribePackageRequest{Orn: "packages/input"}); status.Code(err) != codes.NotFound {
+		t.Errorf("DescribePackage of a missing package = %v, want NotFound", err)
+	}
+}
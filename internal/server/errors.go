@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+const (
+	packageResourceType  = "polvo.aiocean.dev/Package"
+	versionResourceType  = "polvo.aiocean.dev/Version"
+	channelResourceType  = "polvo.aiocean.dev/Channel"
+	rolloutResourceType  = "polvo.aiocean.dev/Rollout"
+	webhookResourceType  = "polvo.aiocean.dev/Webhook"
+	deliveryResourceType = "polvo.aiocean.dev/WebhookDelivery"
+)
+
+// statusError translates an error returned by the repository into a gRPC
+// status error. resourceType and resourceName describe the resource the call
+// was about and are attached as ResourceInfo for not found and conflict errors.
+func statusError(err error, resourceType, resourceName string) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, repository.ErrPackageNotFound):
+		return withResourceInfo(codes.NotFound, err, packageResourceType, resourceName)
+	case errors.Is(err, repository.ErrVersionNotFound):
+		return withResourceInfo(codes.NotFound, err, versionResourceType, resourceName)
+	case errors.Is(err, repository.ErrChannelNotFound):
+		return withResourceInfo(codes.NotFound, err, channelResourceType, resourceName)
+	case errors.Is(err, repository.ErrRolloutNotFound):
+		return withResourceInfo(codes.NotFound, err, rolloutResourceType, resourceName)
+	case errors.Is(err, repository.ErrWebhookNotFound):
+		return withResourceInfo(codes.NotFound, err, webhookResourceType, resourceName)
+	case errors.Is(err, repository.ErrDeliveryNotFound):
+		return withResourceInfo(codes.NotFound, err, deliveryResourceType, resourceName)
+	case errors.Is(err, repository.ErrAlreadyExists):
+		return withResourceInfo(codes.AlreadyExists, err, resourceType, resourceName)
+	case errors.Is(err, repository.ErrConflict):
+		return withResourceInfo(codes.Aborted, err, resourceType, resourceName)
+	case errors.Is(err, repository.ErrPrecondition):
+		return withResourceInfo(codes.FailedPrecondition, err, resourceType, resourceName)
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, auth.ErrPermissionDenied):
+		return withResourceInfo(codes.PermissionDenied, err, resourceType, resourceName)
+	case errors.Is(err, repository.ErrInvalidArgument):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, repository.ErrUnavailable):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
+
+// statusError translates err like the package level statusError, for an RPC
+// of s. Unexpected errors are logged and returned without their message, which
+// can hold details of the storage.
+func (s *Server) statusError(err error, resourceType, resourceName string) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	statusErr := statusError(err, resourceType, resourceName)
+
+	switch status.Code(statusErr) {
+	case codes.Unavailable:
+		s.logger.Warn("storage is unavailable", zap.String("resource", resourceName), zap.Error(err))
+
+		return status.Error(codes.Unavailable, "the registry storage is unavailable, retry later")
+	case codes.Internal:
+		s.logger.Error("internal error", zap.String("resource", resourceName), zap.Error(err))
+
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	return statusErr
+}
+
+// invalidArgument reports a malformed request field as InvalidArgument with a
+// BadRequest detail pointing at the field.
+func invalidArgument(field string, err error) error {
+	st, detailErr := status.New(codes.InvalidArgument, err.Error()).WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{
+				Field:       field,
+				Description: err.Error(),
+			},
+		},
+	})
+	if detailErr != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return st.Err()
+}
+
+func withResourceInfo(code codes.Code, err error, resourceType, resourceName string) error {
+	st, detailErr := status.New(code, err.Error()).WithDetails(&errdetails.ResourceInfo{
+		ResourceType: resourceType,
+		ResourceName: resourceName,
+		Description:  err.Error(),
+	})
+	if detailErr != nil {
+		return status.Error(code, err.Error())
+	}
+
+	return st.Err()
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+func TestStatusError(t *testing.T) {
+	for _, test := range []struct {
+		err          error
+		code         codes.Code
+		resourceType string
+	}{
+		{errors.Wrap(repository.ErrPackageNotFound, "package button"), codes.NotFound, packageResourceType},
+		{errors.Wrap(repository.ErrVersionNotFound, "version 1.0.0"), codes.NotFound, versionResourceType},
+		{errors.Wrap(repository.ErrAlreadyExists, "package button"), codes.AlreadyExists, packageResourceType},
+		{errors.Wrap(repository.ErrConflict, "package button"), codes.Aborted, packageResourceType},
+		{errors.Wrap(repository.ErrUnavailable, "failed to dial"), codes.Unavailable, ""},
+		{errors.Wrap(context.DeadlineExceeded, "failed to query"), codes.DeadlineExceeded, ""},
+		{context.Canceled, codes.Canceled, ""},
+		{status.Error(codes.PermissionDenied, "denied"), codes.PermissionDenied, ""},
+		{errors.Wrap(auth.ErrUnauthenticated, "credentials are required"), codes.Unauthenticated, ""},
+		{errors.Wrap(auth.ErrPermissionDenied, "bob does not have the owner role"), codes.PermissionDenied, packageResourceType},
+	} {
+		st, _ := status.FromError(statusError(test.err, packageResourceType, "packages/button"))
+		if st.Code() != test.code {
+			t.Errorf("statusError(%v) code = %v, want %v", test.err, st.Code(), test.code)
+		}
+
+		var resourceType string
+		for _, detail := range st.Details() {
+			if info, ok := detail.(*errdetails.ResourceInfo); ok {
+				resourceType = info.ResourceType
+			}
+		}
+
+		if resourceType != test.resourceType {
+			t.Errorf("statusError(%v) resource type = %q, want %q", test.err, resourceType, test.resourceType)
+		}
+	}
+
+	if err := statusError(nil, packageResourceType, "packages/button"); err != nil {
+		t.Errorf("statusError(nil) = %v", err)
+	}
+}
+
+func TestInvalidArgument(t *testing.T) {
+	st, _ := status.FromError(invalidArgument("orn", errors.New("orn must not be empty")))
+	if st.Code() != codes.InvalidArgument || len(st.Details()) != 1 {
+		t.Fatalf("invalidArgument = %v", st)
+	}
+
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	if !ok || badRequest.FieldViolations[0].Field != "orn" {
+		t.Errorf("invalidArgument details = %v", st.Details())
+	}
+}
+
+func TestStatusErrorHidesInternalErrors(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	for _, test := range []struct {
+		err  error
+		code codes.Code
+	}{
+		{errors.New("failed to query data: rpc error: dgraph-alpha-0.internal:9080"), codes.Internal},
+		{errors.Wrap(repository.ErrUnavailable, "failed to dial dgraph: dgraph-alpha-0.internal:9080"), codes.Unavailable},
+	} {
+		err := s.statusError(test.err, packageResourceType, "packages/button")
+
+		st, _ := status.FromError(err)
+		if st.Code() != test.code {
+			t.Errorf("statusError(%v) code = %v, want %v", test.err, st.Code(), test.code)
+		}
+
+		if st.Message() == test.err.Error() || len(st.Details()) != 0 {
+			t.Errorf("statusError(%v) returned the internal error: %q", test.err, st.Message())
+		}
+	}
+}
+
+func TestStatusErrorKeepsRepositoryErrors(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	err := s.statusError(errors.Wrap(repository.ErrPackageNotFound, "package button"), packageResourceType, "packages/button")
+
+	st, _ := status.FromError(err)
+	if st.Code() != codes.NotFound || st.Message() != "package button: package not found" {
+		t.Errorf("statusError = %v, want NotFound with the repository message", err)
+	}
+}
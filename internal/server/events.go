@@ -0,0 +1,415 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/orn"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+const (
+	// changeEventHistory is the number of events kept in memory to resume a
+	// watch, older events are read from the outbox.
+	changeEventHistory = 4096
+	// changeEventBuffer is the number of events kept for a slow watcher. A
+	// watcher whose buffer is full is ended, it can resume from its last
+	// event.
+	changeEventBuffer = 256
+)
+
+// ChangeType is the kind of change of a ChangeEvent, the type of the outbox
+// event it was relayed from.
+type ChangeType string
+
+const (
+	ChangePackageCreated   ChangeType = repository.EventPackageCreated
+	ChangePackageUpdated   ChangeType = repository.EventPackageUpdated
+	ChangePackageDeleted   ChangeType = repository.EventPackageDeleted
+	ChangePackageUndeleted ChangeType = repository.EventPackageUndeleted
+	ChangeVersionCreated   ChangeType = repository.EventVersionCreated
+	ChangeVersionUpdated   ChangeType = repository.EventVersionUpdated
+	ChangeVersionDeleted   ChangeType = repository.EventVersionDeleted
+	ChangeVersionUndeleted ChangeType = repository.EventVersionUndeleted
+	ChangeWeightChanged    ChangeType = repository.EventWeightChanged
+	ChangeChannelCreated   ChangeType = repository.EventChannelCreated
+	ChangeChannelUpdated   ChangeType = repository.EventChannelUpdated
+)
+
+// changeTypes are the known change types.
+var changeTypes = map[ChangeType]bool{
+	ChangePackageCreated:   true,
+	ChangePackageUpdated:   true,
+	ChangePackageDeleted:   true,
+	ChangePackageUndeleted: true,
+	ChangeVersionCreated:   true,
+	ChangeVersionUpdated:   true,
+	ChangeVersionDeleted:   true,
+	ChangeVersionUndeleted: true,
+	ChangeWeightChanged:    true,
+	ChangeChannelCreated:   true,
+	ChangeChannelUpdated:   true,
+}
+
+// resumeTokenHeader is the response header with the resume token of the
+// latest event when a watch starts.
+const resumeTokenHeader = "x-polvo-resume-token"
+
+var errResumeTokenExpired = status.Error(codes.OutOfRange, "the events after the resume token were purged, list the packages again and watch without a resume token")
+
+// ChangeEvent reports a change of the registry, read from the outbox.
+type ChangeEvent struct {
+	// Sequence is the sequence of the outbox event, it orders the changes
+	// made by every process.
+	Sequence uint64 `json:"sequence"`
+	// ResumeToken resumes a watch right after this event, on any process.
+	ResumeToken string `json:"resume_token"`
+	// ID identifies the change. An event is relayed at least once, a change
+	// relayed again has the same ID.
+	ID      string     `json:"id"`
+	Type    ChangeType `json:"type"`
+	Package string     `json:"package"`
+	// Orn is the changed package, version or channel.
+	Orn string `json:"orn"`
+	// PackageState, VersionState or ChannelState is the changed resource,
+	// as it was before the change for deletions.
+	PackageState *polvo_v1.Package   `json:"package_state,omitempty"`
+	VersionState *polvo_v1.Version   `json:"version_state,omitempty"`
+	ChannelState *repository.Channel `json:"channel_state,omitempty"`
+	// PreviousWeight is the weight before a ChangeWeightChanged.
+	PreviousWeight uint32    `json:"previous_weight"`
+	Actor          string    `json:"actor"`
+	Time           time.Time `json:"time"`
+}
+
+type WatchPackagesRequest struct {
+	// ResumeToken sends the events after the one with this token first. The
+	// watch starts with the next change when it is empty.
+	ResumeToken string
+}
+
+type WatchPackageRequest struct {
+	Orn         string
+	ResumeToken string
+}
+
+// WatchPackages sends the changes of every package the caller can read, made
+// by any process, in the order of their sequence, until ctx is done.
+func (s *Server) WatchPackages(ctx context.Context, request *WatchPackagesRequest, send func(event *ChangeEvent) error) error {
+	return s.watchChanges(ctx, request.ResumeToken, func(event *ChangeEvent) bool {
+		if s.auth.PublicReads() {
+			return true
+		}
+
+		return s.authorize(ctx, event.Package, auth.RoleReader) == nil
+	}, send)
+}
+
+// WatchPackage sends the changes of a package, its versions and its channels,
+// until ctx is done.
+func (s *Server) WatchPackage(ctx context.Context, request *WatchPackageRequest, send func(event *ChangeEvent) error) error {
+	packageOrn, err := orn.ParsePackage(request.Orn)
+	if err != nil {
+		return invalidArgument("orn", err)
+	}
+
+	if err := s.authorize(ctx, packageOrn.Package, auth.RoleReader); err != nil {
+		return s.statusError(err, packageResourceType, request.Orn)
+	}
+
+	return s.watchChanges(ctx, request.ResumeToken, func(event *ChangeEvent) bool {
+		return event.Package == packageOrn.Package
+	}, send)
+}
+
+// watchChanges sends the events matching match, the ones after resumeToken
+// first. It sends the resume token of the position the watch starts from as
+// the x-polvo-resume-token header, so a client can resume a watch that did not
+// receive any event yet.
+func (s *Server) watchChanges(ctx context.Context, resumeToken string, match func(event *ChangeEvent) bool, send func(event *ChangeEvent) error) error {
+	var watcher *changeWatcher
+	if resumeToken == "" {
+		watcher = s.changes.subscribeLatest()
+	}
+
+	if watcher != nil {
+		_ = grpc.SendHeader(ctx, metadata.Pairs(resumeTokenHeader, newResumeToken(watcher.after)))
+	} else {
+		after, err := s.resumeAfter(ctx, resumeToken)
+		if err != nil {
+			return err
+		}
+
+		_ = grpc.SendHeader(ctx, metadata.Pairs(resumeTokenHeader, newResumeToken(after)))
+
+		// The events the bus does not keep are read from the outbox, until
+		// the bus has the next ones.
+		for watcher = s.changes.subscribe(after); watcher == nil; watcher = s.changes.subscribe(after) {
+			replayed, err := s.replayStoredChanges(ctx, after, match, send)
+			if err != nil {
+				return err
+			}
+
+			// The ChangeFeed did not start yet.
+			if replayed == after {
+				select {
+				case <-ctx.Done():
+					return status.FromContextError(ctx.Err()).Err()
+				case <-time.After(defaultOutboxInterval):
+				}
+			}
+
+			after = replayed
+		}
+	}
+	defer s.changes.unsubscribe(watcher)
+
+	for _, event := range watcher.replay {
+		if !match(event) {
+			continue
+		}
+
+		if err := send(event); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case event, ok := <-watcher.events:
+			if !ok {
+				return status.Error(codes.Aborted, "the watch fell behind, resume it from the last resume token")
+			}
+
+			if event.Sequence <= watcher.after || !match(event) {
+				continue
+			}
+
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// resumeAfter returns the sequence of resumeToken, or the latest one when it
+// is empty.
+func (s *Server) resumeAfter(ctx context.Context, resumeToken string) (uint64, error) {
+	latest, err := s.repo.LatestOutboxSequence(ctx)
+	if err != nil {
+		return 0, s.statusError(err, packageResourceType, "")
+	}
+
+	if resumeToken == "" {
+		return latest, nil
+	}
+
+	after, err := parseResumeToken(resumeToken)
+	if err != nil {
+		return 0, invalidArgument("resume_token", err)
+	}
+
+	if after > latest {
+		return 0, invalidArgument("resume_token", errors.New("the resume token is after the latest event"))
+	}
+
+	return after, nil
+}
+
+// replayStoredChanges sends the events of the outbox after the sequence after
+// that match, up to the latest one, and returns the sequence of the last one.
+// The outbox numbers the events without gaps, a missing event was purged.
+func (s *Server) replayStoredChanges(ctx context.Context, after uint64, match func(event *ChangeEvent) bool, send func(event *ChangeEvent) error) (uint64, error) {
+	for {
+		outboxEvents, err := s.repo.ListOutboxEvents(ctx, after, outboxBatchSize)
+		if err != nil {
+			return 0, s.statusError(err, packageResourceType, "")
+		}
+
+		if len(outboxEvents) == 0 {
+			latest, err := s.repo.LatestOutboxSequence(ctx)
+			if err != nil {
+				return 0, s.statusError(err, packageResourceType, "")
+			}
+
+			if after < latest {
+				return 0, errResumeTokenExpired
+			}
+		}
+
+		for _, outboxEvent := range outboxEvents {
+			if outboxEvent.Sequence != after+1 {
+				return 0, errResumeTokenExpired
+			}
+
+			after = outboxEvent.Sequence
+
+			event := newChangeEvent(outboxEvent)
+			if !match(event) {
+				continue
+			}
+
+			if err := send(event); err != nil {
+				return 0, err
+			}
+		}
+
+		if len(outboxEvents) < outboxBatchSize {
+			return after, nil
+		}
+	}
+}
+
+// changeBus fans the change events read by the ChangeFeed out to the watchers,
+// and keeps the last changeEventHistory events to resume a watch. The resume
+// tokens are the outbox sequences, they are valid on every process and across
+// restarts.
+type changeBus struct {
+	mu      sync.Mutex
+	started bool
+	// sequence is the sequence of the latest event published. The history
+	// has every event published after floor.
+	sequence uint64
+	floor    uint64
+	history  []*ChangeEvent
+	watchers map[chan *ChangeEvent]struct{}
+}
+
+func newChangeBus() *changeBus {
+	return &changeBus{
+		watchers: map[chan *ChangeEvent]struct{}{},
+	}
+}
+
+// changeWatcher is a subscription to the change bus.
+type changeWatcher struct {
+	// after is the sequence the watch starts after. The events up to after
+	// are skipped, the bus may not have reached it yet.
+	after uint64
+	// replay are the events of the history after after.
+	replay []*ChangeEvent
+	// events receives the next events, it is closed when the watcher falls
+	// behind.
+	events chan *ChangeEvent
+}
+
+// subscribeLatest subscribes to the events after the latest one published. It
+// returns nil before the ChangeFeed started.
+func (b *changeBus) subscribeLatest() *changeWatcher {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.started {
+		return nil
+	}
+
+	return b.addWatcher(b.sequence)
+}
+
+// subscribe subscribes to the events after the sequence after. It returns nil
+// when the bus does not have all of them, they are read from the outbox
+// instead.
+func (b *changeBus) subscribe(after uint64) *changeWatcher {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.started || after < b.floor {
+		return nil
+	}
+
+	watcher := b.addWatcher(after)
+	for _, event := range b.history {
+		if event.Sequence > after {
+			watcher.replay = append(watcher.replay, event)
+		}
+	}
+
+	return watcher
+}
+
+func (b *changeBus) addWatcher(after uint64) *changeWatcher {
+	watcher := &changeWatcher{
+		after:  after,
+		events: make(chan *ChangeEvent, changeEventBuffer),
+	}
+
+	b.watchers[watcher.events] = struct{}{}
+
+	return watcher
+}
+
+func (b *changeBus) unsubscribe(watcher *changeWatcher) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.watchers[watcher.events]; ok {
+		delete(b.watchers, watcher.events)
+		close(watcher.events)
+	}
+}
+
+// start has the bus publish the events after sequence, the latest one when
+// the ChangeFeed starts.
+func (b *changeBus) start(sequence uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.started = true
+	b.sequence = sequence
+	b.floor = sequence
+}
+
+// publish sends the next event of the outbox. It never blocks, a watcher
+// whose buffer is full is ended.
+func (b *changeBus) publish(event *ChangeEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sequence = event.Sequence
+
+	b.history = append(b.history, event)
+	if len(b.history) > changeEventHistory {
+		evicted := len(b.history) - changeEventHistory
+		b.floor = b.history[evicted-1].Sequence
+		b.history = append(b.history[:0:0], b.history[evicted:]...)
+	}
+
+	for events := range b.watchers {
+		select {
+		case events <- event:
+		default:
+			delete(b.watchers, events)
+			close(events)
+		}
+	}
+}
+
+func newResumeToken(sequence uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(sequence, 10)))
+}
+
+func parseResumeToken(token string) (uint64, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, errors.New("malformed resume token")
+	}
+
+	sequence, err := strconv.ParseUint(string(decoded), 10, 64)
+	if err != nil {
+		return 0, errors.New("malformed resume token")
+	}
+
+	return sequence, nil
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+// startChangeFeed starts the ChangeFeed of s and returns it.
+func startChangeFeed(t *testing.T, s *Server) *ChangeFeed {
+	t.Helper()
+
+	feed, err := NewChangeFeed(zap.NewNop(), s)
+	if err != nil {
+		t.Fatalf("NewChangeFeed: %v", err)
+	}
+
+	if !feed.start(context.Background()) {
+		t.Fatal("the feed did not start")
+	}
+
+	return feed
+}
+
+// watchPackages watches every package from resumeToken until it received
+// count events, and returns their packages.
+func watchPackages(s *Server, resumeToken string, count int) ([]string, []*ChangeEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var packages []string
+	var events []*ChangeEvent
+	err := s.WatchPackages(ctx, &WatchPackagesRequest{ResumeToken: resumeToken}, func(event *ChangeEvent) error {
+		packages = append(packages, event.Package)
+		events = append(events, event)
+		if len(events) == count {
+			cancel()
+		}
+
+		return nil
+	})
+	if status.Code(err) == codes.Canceled {
+		err = nil
+	}
+
+	return packages, events, err
+}
+
+func createPackages(t *testing.T, repo repository.Repository, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		if _, err := repo.CreatePackage(context.Background(), &polvo_v1.Package{Name: name}, nil); err != nil {
+			t.Fatalf("CreatePackage: %v", err)
+		}
+	}
+}
+
+func TestResumeTokenOfAnotherProcess(t *testing.T) {
+	first, repo := newTestServer(t)
+	feed := startChangeFeed(t, first)
+
+	createPackages(t, repo, "button", "card")
+	feed.publishNew(context.Background())
+
+	_, events, err := watchPackages(first, newResumeToken(0), 2)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("WatchPackages = %d events, %v", len(events), err)
+	}
+	token := events[0].ResumeToken
+
+	createPackages(t, repo, "dialog")
+
+	// A process started after the events, whose bus does not have them.
+	restarted := NewServer(zap.NewNop(), repo, first.auth, first.manifests)
+	startChangeFeed(t, restarted)
+
+	packages, _, err := watchPackages(restarted, token, 2)
+	if err != nil || !equalPackages(packages, []string{"card", "dialog"}) {
+		t.Errorf("WatchPackages from the token of button = %v, %v, want card and dialog", packages, err)
+	}
+}
+
+func TestResumeTokenFromTheHistory(t *testing.T) {
+	s, repo := newTestServer(t)
+	feed := startChangeFeed(t, s)
+
+	createPackages(t, repo, "button", "card", "dialog")
+	feed.publishNew(context.Background())
+
+	packages, _, err := watchPackages(s, newResumeToken(1), 2)
+	if err != nil || !equalPackages(packages, []string{"card", "dialog"}) {
+		t.Errorf("WatchPackages = %v, %v, want card and dialog", packages, err)
+	}
+}
+
+func TestResumeTokenOfPurgedEvents(t *testing.T) {
+	s, repo := newTestServer(t)
+	ctx := context.Background()
+
+	createPackages(t, repo, "button", "card", "dialog")
+	startChangeFeed(t, s)
+
+	events, _ := repo.ListOutboxEvents(ctx, 0, 0)
+	deliveredAt := time.Now()
+	if err := repo.MarkOutboxEventsDelivered(ctx, []string{events[0].ID, events[1].ID}, deliveredAt); err != nil {
+		t.Fatalf("MarkOutboxEventsDelivered: %v", err)
+	}
+
+	if _, err := repo.PurgeOutboxEvents(ctx, deliveredAt.Add(time.Second)); err != nil {
+		t.Fatalf("PurgeOutboxEvents: %v", err)
+	}
+
+	if _, _, err := watchPackages(s, newResumeToken(0), 1); status.Code(err) != codes.OutOfRange {
+		t.Errorf("WatchPackages after purged events = %v, want OutOfRange", err)
+	}
+
+	packages, _, err := watchPackages(s, newResumeToken(2), 1)
+	if err != nil || !equalPackages(packages, []string{"dialog"}) {
+		t.Errorf("WatchPackages after the purged events = %v, %v, want dialog", packages, err)
+	}
+}
+
+func TestInvalidResumeTokens(t *testing.T) {
+	s, repo := newTestServer(t)
+	createPackages(t, repo, "button")
+	startChangeFeed(t, s)
+
+	for _, token := range []string{"not base64!", newResumeToken(0) + "x", newResumeToken(5)} {
+		if _, _, err := watchPackages(s, token, 1); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("WatchPackages(%q) = %v, want InvalidArgument", token, err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ChangeFeed publishes the outbox events to the watchers of this process. It
+// reads every event in the order of their sequence, whichever process made
+// the change or relayed it, so that every process sends the same changes to
+// its watchers. It starts after the latest event, and reads the outbox every
+// OUTBOX_INTERVAL and right after a mutation of this process.
+type ChangeFeed struct {
+	logger   *zap.Logger
+	server   *Server
+	interval time.Duration
+	// sequence is the sequence of the latest event published.
+	sequence uint64
+}
+
+func NewChangeFeed(logger *zap.Logger, server *Server) (*ChangeFeed, error) {
+	feed := &ChangeFeed{
+		logger:   logger,
+		server:   server,
+		interval: defaultOutboxInterval,
+	}
+
+	if env := os.Getenv("OUTBOX_INTERVAL"); env != "" {
+		interval, err := time.ParseDuration(env)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid OUTBOX_INTERVAL")
+		}
+
+		if interval <= 0 {
+			return nil, errors.New("OUTBOX_INTERVAL must be positive")
+		}
+
+		feed.interval = interval
+	}
+
+	return feed, nil
+}
+
+// Run publishes the new events until ctx is done.
+func (f *ChangeFeed) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	started := false
+	for {
+		if started {
+			f.publishNew(ctx)
+		} else {
+			started = f.start(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-f.server.feedChanged:
+		}
+	}
+}
+
+func (f *ChangeFeed) start(ctx context.Context) bool {
+	sequence, err := f.server.repo.LatestOutboxSequence(ctx)
+	if err != nil {
+		f.logger.Error("failed to read the latest outbox sequence", zap.Error(err))
+		return false
+	}
+
+	f.sequence = sequence
+	f.server.changes.start(sequence)
+
+	return true
+}
+
+// publishNew publishes the events after the latest one published, a batch at
+// a time.
+func (f *ChangeFeed) publishNew(ctx context.Context) {
+	for {
+		events, err := f.server.repo.ListOutboxEvents(ctx, f.sequence, outboxBatchSize)
+		if err != nil {
+			f.logger.Error("failed to list outbox events", zap.Error(err))
+			return
+		}
+
+		for _, event := range events {
+			f.server.changes.publish(newChangeEvent(event))
+			f.sequence = event.Sequence
+		}
+
+		if len(events) < outboxBatchSize {
+			return
+		}
+	}
+}
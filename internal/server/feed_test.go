@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+// Two replicas share a repository: the one that relays an event is not the
+// only one whose watchers receive it.
+func TestChangeFeedPublishesTheEventsOfEveryReplica(t *testing.T) {
+	ctx := context.Background()
+	relaying, repo := newTestServer(t)
+	watching := NewServer(zap.NewNop(), repo, relaying.auth, relaying.manifests)
+
+	mustCreatePackage := func(name string) {
+		if _, err := repo.CreatePackage(repository.WithActor(ctx, "alice"), &polvo_v1.Package{Name: name}, nil); err != nil {
+			t.Fatalf("CreatePackage: %v", err)
+		}
+	}
+
+	// The events before the feed starts are not sent.
+	mustCreatePackage("before")
+
+	feeds := map[*Server]*ChangeFeed{}
+	watchers := map[*Server]*changeWatcher{}
+	for _, s := range []*Server{relaying, watching} {
+		feed, err := NewChangeFeed(zap.NewNop(), s)
+		if err != nil {
+			t.Fatalf("NewChangeFeed: %v", err)
+		}
+
+		if !feed.start(ctx) {
+			t.Fatal("the feed did not start")
+		}
+		feeds[s] = feed
+
+		watchers[s] = s.changes.subscribeLatest()
+	}
+
+	mustCreatePackage("button")
+	mustCreatePackage("card")
+
+	relay, err := NewOutboxRelay(zap.NewNop(), relaying)
+	if err != nil {
+		t.Fatalf("NewOutboxRelay: %v", err)
+	}
+	relay.relayPending(ctx)
+
+	if pending, _ := repo.ListPendingOutboxEvents(ctx, 0); len(pending) != 0 {
+		t.Fatalf("%d events are still pending", len(pending))
+	}
+
+	for s, feed := range feeds {
+		feed.publishNew(ctx)
+
+		var packages []string
+		var sequences []uint64
+		for len(watchers[s].events) > 0 {
+			event := <-watchers[s].events
+			packages = append(packages, event.Package)
+			sequences = append(sequences, event.Sequence)
+
+			if event.Actor != "alice" {
+				t.Errorf("the actor of %s is %q", event.Package, event.Actor)
+			}
+		}
+
+		if !equalPackages(packages, []string{"button", "card"}) || sequences[0] != 2 || sequences[1] != 3 {
+			t.Errorf("the watcher received %v with the sequences %v, want button then card", packages, sequences)
+		}
+	}
+}
+
+func equalPackages(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/pkg/errors"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/labels"
+	"pkg.aiocean.dev/polvoservice/internal/orn"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+// maxImportSpecs caps the number of packages of an import map.
+const maxImportSpecs = 200
+
+// ImportSpec selects the version of a package to put in an import map.
+type ImportSpec struct {
+	Package string
+	// Version is a version selector, see resolveVersion. It is "any" when
+	// empty.
+	Version string
+	// Specifier is the key of the import map entry, the package name when
+	// empty.
+	Specifier string
+	// Scope puts the entry in the scope with this URL prefix instead of the
+	// top level imports.
+	Scope string
+	// LabelSelector restricts the resolution to the versions it selects.
+	LabelSelector string
+}
+
+type GenerateImportMapRequest struct {
+	Specs []ImportSpec
+	// StickyKey pins the caller to a version when resolving "any", like the
+	// x-polvo-sticky-key metadata of GetVersion.
+	StickyKey string
+	// Integrity adds the SRI hash of the pinned manifests, see
+	// CheckManifestIntegrity.
+	Integrity bool
+}
+
+// ImportMap is a browser import map, mapping specifiers to manifest URLs.
+type ImportMap struct {
+	Imports   map[string]string            `json:"imports"`
+	Scopes    map[string]map[string]string `json:"scopes,omitempty"`
+	Integrity map[string]string            `json:"integrity,omitempty"`
+}
+
+// GenerateImportMap resolves every spec like GetVersion does, reading all the
+// packages from the repository at once.
+func (s *Server) GenerateImportMap(ctx context.Context, request *GenerateImportMapRequest) (*ImportMap, error) {
+	if len(request.Specs) == 0 {
+		return nil, invalidArgument("specs", errors.New("at least one spec is required"))
+	}
+
+	if len(request.Specs) > maxImportSpecs {
+		return nil, invalidArgument("specs", errors.Errorf("at most %d specs are allowed", maxImportSpecs))
+	}
+
+	versionOrns := make([]orn.VersionORN, 0, len(request.Specs))
+	selectors := make([]*labels.Selector, 0, len(request.Specs))
+	packageNames := make([]string, 0, len(request.Specs))
+	packages := map[string]bool{}
+	specifiers := map[[2]string]bool{}
+
+	for i, spec := range request.Specs {
+		field := fmt.Sprintf("specs[%d]", i)
+
+		if err := orn.ValidatePackageName(spec.Package); err != nil {
+			return nil, invalidArgument(field+".package", err)
+		}
+
+		version := spec.Version
+		if version == "" {
+			version = defaultVersions["any"]
+		}
+
+		if err := orn.ValidateVersionSelector(version); err != nil {
+			return nil, invalidArgument(field+".version", err)
+		}
+
+		selector, err := labels.ParseSelector(spec.LabelSelector)
+		if err != nil {
+			return nil, invalidArgument(field+".label_selector", err)
+		}
+		selectors = append(selectors, selector)
+
+		key := [2]string{spec.Scope, spec.specifier()}
+		if specifiers[key] {
+			return nil, invalidArgument(field+".specifier", errors.Errorf("specifier %q is mapped twice", spec.specifier()))
+		}
+		specifiers[key] = true
+
+		versionOrns = append(versionOrns, orn.VersionORN{Package: spec.Package, Version: version})
+		if !packages[spec.Package] {
+			packages[spec.Package] = true
+			packageNames = append(packageNames, spec.Package)
+		}
+	}
+
+	snapshots, err := s.repo.GetPackageSnapshots(ctx, packageNames)
+	if err != nil {
+		return nil, s.statusError(err, packageResourceType, "")
+	}
+
+	importMap := &ImportMap{
+		Imports: map[string]string{},
+	}
+
+	for i, spec := range request.Specs {
+		versionOrn := versionOrns[i]
+
+		snapshot, ok := snapshots[spec.Package]
+		if !ok {
+			return nil, s.statusError(errors.Wrapf(repository.ErrPackageNotFound, "package %s", spec.Package), packageResourceType, versionOrn.PackageORN().String())
+		}
+
+		if !s.auth.PublicReads() {
+			if err := s.auth.Authorize(ctx, snapshot.Package.GetMaintainer(), auth.RoleReader); err != nil {
+				return nil, s.statusError(err, packageResourceType, versionOrn.PackageORN().String())
+			}
+		}
+
+		version, err := s.resolveVersionFrom(ctx, snapshotSource(snapshots), versionOrn, request.StickyKey, selectors[i])
+		if err != nil {
+			return nil, s.statusError(err, versionResourceType, versionOrn.String())
+		}
+
+		manifestUrl := version.GetManifestUrl()
+
+		if spec.Scope == "" {
+			importMap.Imports[spec.specifier()] = manifestUrl
+		} else {
+			if importMap.Scopes == nil {
+				importMap.Scopes = map[string]map[string]string{}
+			}
+			if importMap.Scopes[spec.Scope] == nil {
+				importMap.Scopes[spec.Scope] = map[string]string{}
+			}
+			importMap.Scopes[spec.Scope][spec.specifier()] = manifestUrl
+		}
+
+		if request.Integrity {
+			if integrity := snapshotIntegrity(snapshot, version.GetName()); integrity != "" {
+				if importMap.Integrity == nil {
+					importMap.Integrity = map[string]string{}
+				}
+				importMap.Integrity[manifestUrl] = integrity
+			}
+		}
+	}
+
+	return importMap, nil
+}
+
+func (spec ImportSpec) specifier() string {
+	if spec.Specifier != "" {
+		return spec.Specifier
+	}
+
+	return spec.Package
+}
+
+// snapshotIntegrity returns the SRI hash of the pinned manifest of a version,
+// empty when it is not pinned.
+func snapshotIntegrity(snapshot *repository.PackageSnapshot, versionName string) string {
+	for _, version := range snapshot.Versions {
+		if version.Version.GetName() != versionName || version.ManifestSHA256 == "" {
+			continue
+		}
+
+		sum, err := hex.DecodeString(version.ManifestSHA256)
+		if err != nil {
+			return ""
+		}
+
+		return "sha256-" + base64.StdEncoding.EncodeToString(sum)
+	}
+
+	return ""
+}
+
+// snapshotSource resolves versions from package snapshots, failing with the
+// same errors as the repository.
+type snapshotSource map[string]*repository.PackageSnapshot
+
+func (s snapshotSource) snapshot(packageName string) (*repository.PackageSnapshot, error) {
+	snapshot, ok := s[packageName]
+	if !ok {
+		return nil, errors.Wrapf(repository.ErrPackageNotFound, "package %s", packageName)
+	}
+
+	return snapshot, nil
+}
+
+func (s snapshotSource) GetVersion(ctx context.Context, packageName, versionName string) (*polvo_v1.Version, error) {
+	snapshot, err := s.snapshot(packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, version := range snapshot.Versions {
+		if version.Version.GetName() == versionName {
+			return version.Version, nil
+		}
+	}
+
+	return nil, errors.Wrapf(repository.ErrVersionNotFound, "version %s of package %s", versionName, packageName)
+}
+
+func (s snapshotSource) ListVersions(ctx context.Context, packageName string) ([]*polvo_v1.Version, error) {
+	snapshot, err := s.snapshot(packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]*polvo_v1.Version, 0, len(snapshot.Versions))
+	for _, version := range snapshot.Versions {
+		versions = append(versions, version.Version)
+	}
+
+	return versions, nil
+}
+
+func (s snapshotSource) GetHeaviestVersion(ctx context.Context, packageName string) (*polvo_v1.Version, error) {
+	snapshot, err := s.snapshot(packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(snapshot.Versions) == 0 {
+		return nil, errors.Wrapf(repository.ErrVersionNotFound, "package %s has no version", packageName)
+	}
+
+	return snapshot.Versions[0].Version, nil
+}
+
+func (s snapshotSource) ListMatchingVersions(ctx context.Context, packageName string, selector *labels.Selector) ([]*polvo_v1.Version, error) {
+	snapshot, err := s.snapshot(packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []*polvo_v1.Version
+	for _, version := range snapshot.Versions {
+		if selector.Matches(version.Labels) {
+			versions = append(versions, version.Version)
+		}
+	}
+
+	return versions, nil
+}
+
+func (s snapshotSource) GetChannel(ctx context.Context, packageName, channelName string) (*repository.Channel, error) {
+	snapshot, err := s.snapshot(packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, channel := range snapshot.Channels {
+		if channel.Name == channelName {
+			return channel, nil
+		}
+	}
+
+	return nil, errors.Wrapf(repository.ErrChannelNotFound, "channel %s of package %s", channelName, packageName)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/manifest"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+func TestCheckManifestIntegrity(t *testing.T) {
+	body := `{"name": "button"}`
+	manifestServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer manifestServer.Close()
+
+	s, repo := newTestServer(t)
+	s.manifests = manifest.New(manifest.Options{
+		Schemes: []string{"http"},
+		Client:  manifestServer.Client(),
+	})
+
+	ctx := context.Background()
+	if _, err := repo.CreatePackage(ctx, &polvo_v1.Package{Name: "button"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	pin := &repository.ManifestPin{SHA256: manifest.Digest([]byte(body))}
+	if _, err := repo.CreateVersion(ctx, "button", &polvo_v1.Version{Name: "1.0.0", ManifestUrl: manifestServer.URL + "/manifest.json"}, pin, nil); err != nil {
+		t.Fatalf("CreateVersion: %v", err)
+	}
+
+	if _, err := repo.CreateVersion(ctx, "button", &polvo_v1.Version{Name: "2.0.0", ManifestUrl: manifestServer.URL + "/manifest.json"}, nil, nil); err != nil {
+		t.Fatalf("CreateVersion: %v", err)
+	}
+
+	request := &CheckManifestIntegrityRequest{Orn: "packages/button/versions/1.0.0"}
+	integrity, err := s.CheckManifestIntegrity(ctx, request)
+	if err != nil || integrity.Drifted || integrity.CurrentSHA256 != pin.SHA256 {
+		t.Errorf("CheckManifestIntegrity = %+v, %v, want no drift", integrity, err)
+	}
+
+	body = `{"name": "button", "entry": "evil.js"}`
+	integrity, err = s.CheckManifestIntegrity(ctx, request)
+	if err != nil || !integrity.Drifted || integrity.PinnedSHA256 != pin.SHA256 {
+		t.Errorf("CheckManifestIntegrity of a changed manifest = %+v, %v, want a drift", integrity, err)
+	}
+
+	if _, err := s.CheckManifestIntegrity(ctx, &CheckManifestIntegrityRequest{Orn: "packages/button/versions/2.0.0"}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("CheckManifestIntegrity of a version without pin = %v, want FailedPrecondition", err)
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/labels"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+// polvo_v1.Version has no labels field, so CreateVersion and UpdateVersion
+// read the labels from this request metadata key, as "key=value,key=value",
+// and GetVersion returns them in the same response header.
+const labelsMetadata = "x-polvo-labels"
+
+// labelSelectorMetadata is the request metadata carrying the label selector
+// of ListVersions, and of GetVersion and GetManifestUrl which only resolve to
+// the versions it selects.
+const labelSelectorMetadata = "x-polvo-label-selector"
+
+// labelsFieldPath is the field mask path of UpdateVersion that replaces the
+// labels. It is not a field of polvo_v1.Version.
+const labelsFieldPath = "version.labels"
+
+func versionLabelsFromContext(ctx context.Context) (map[string]string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	versionLabels, err := labels.Parse(firstMetadataValue(md, labelsMetadata))
+	if err != nil {
+		return nil, invalidArgument("version.labels", err)
+	}
+
+	return versionLabels, nil
+}
+
+func labelSelectorFromContext(ctx context.Context) (*labels.Selector, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	return parseLabelSelector(firstMetadataValue(md, labelSelectorMetadata))
+}
+
+func parseLabelSelector(expression string) (*labels.Selector, error) {
+	selector, err := labels.ParseSelector(expression)
+	if err != nil {
+		return nil, invalidArgument("label_selector", err)
+	}
+
+	return selector, nil
+}
+
+// setLabelsHeader sends the labels as a response header. It does nothing when
+// ctx does not belong to a gRPC call.
+func setLabelsHeader(ctx context.Context, versionLabels map[string]string) {
+	if len(versionLabels) == 0 {
+		return
+	}
+
+	_ = grpc.SetHeader(ctx, metadata.Pairs(labelsMetadata, labels.String(versionLabels)))
+}
+
+// repositorySource is the versionSource of the repository.
+type repositorySource struct {
+	repository.Repository
+}
+
+func (s repositorySource) ListMatchingVersions(ctx context.Context, packageName string, selector *labels.Selector) ([]*polvo_v1.Version, error) {
+	page, err := s.ListVersionDetails(ctx, packageName, repository.ListVersionsOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]*polvo_v1.Version, 0, len(page.Versions))
+	for _, version := range page.Versions {
+		versions = append(versions, version.Version)
+	}
+
+	return versions, nil
+}
+
+// selectedSource restricts a versionSource to the versions of one package
+// whose labels match a selector, so that resolution only finds them.
+type selectedSource struct {
+	versionSource
+	selector *labels.Selector
+	// versions are the matching versions, heaviest first.
+	versions []*polvo_v1.Version
+}
+
+// selectVersions returns source when selector is empty.
+func selectVersions(ctx context.Context, source versionSource, packageName string, selector *labels.Selector) (versionSource, error) {
+	if selector.Empty() {
+		return source, nil
+	}
+
+	versions, err := source.ListMatchingVersions(ctx, packageName, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	return selectedSource{versionSource: source, selector: selector, versions: versions}, nil
+}
+
+func (s selectedSource) GetVersion(ctx context.Context, packageName, versionName string) (*polvo_v1.Version, error) {
+	for _, version := range s.versions {
+		if version.GetName() == versionName {
+			return version, nil
+		}
+	}
+
+	return nil, errors.Wrapf(repository.ErrVersionNotFound, "version %s of package %s matching %q", versionName, packageName, s.selector)
+}
+
+func (s selectedSource) ListVersions(ctx context.Context, packageName string) ([]*polvo_v1.Version, error) {
+	return s.versions, nil
+}
+
+func (s selectedSource) GetHeaviestVersion(ctx context.Context, packageName string) (*polvo_v1.Version, error) {
+	if len(s.versions) == 0 {
+		return nil, errors.Wrapf(repository.ErrVersionNotFound, "no version of package %s matches %q", packageName, s.selector)
+	}
+
+	return s.versions[0], nil
+}
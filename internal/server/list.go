@@ -0,0 +1,315 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/orn"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+// maxPageSize caps the page size a client can ask for.
+const maxPageSize = 1000
+
+// ListPackagesRequest and ListVersionsRequest of polvo_v1 have no paging
+// fields, so the streaming RPCs read the list options from these request
+// metadata keys and return the token of the next page in the
+// x-polvo-next-page-token trailer.
+const (
+	pageSizeMetadata      = "x-polvo-page-size"
+	pageTokenMetadata     = "x-polvo-page-token"
+	namePrefixMetadata    = "x-polvo-name-prefix"
+	maintainerMetadata    = "x-polvo-maintainer"
+	hasWeightMetadata     = "x-polvo-has-weight"
+	createdAfterMetadata  = "x-polvo-created-after"
+	orderByMetadata       = "x-polvo-order-by"
+	nextPageTokenMetadata = "x-polvo-next-page-token"
+)
+
+type ListPackageDetailsRequest struct {
+	// PageSize is at most maxPageSize. Every package is returned when it is 0.
+	PageSize   uint32
+	PageToken  string
+	NamePrefix string
+	Maintainer string
+	// Tag and Owner keep the packages with the tag or the owner in their
+	// metadata.
+	Tag   string
+	Owner string
+	// CreatedAfter is ignored when it is zero.
+	CreatedAfter time.Time
+	// OrderBy is "name" (the default) or "created_at", followed by " desc" to
+	// reverse the order.
+	OrderBy string
+}
+
+type ListVersionDetailsRequest struct {
+	Orn string
+	// PageSize is at most maxPageSize. Every version is returned when it is 0.
+	PageSize   uint32
+	PageToken  string
+	NamePrefix string
+	HasWeight  *bool
+	// LabelSelector keeps the versions whose labels it selects, like
+	// "env=prod,tier in (web, api)".
+	LabelSelector string
+	// CreatedAfter is ignored when it is zero.
+	CreatedAfter time.Time
+	// OrderBy is "weight", "name" or "created_at", followed by " desc" to
+	// reverse the order. Versions are ordered by weight, heaviest first, when
+	// it is empty.
+	OrderBy string
+}
+
+func (s *Server) ListPackageDetails(ctx context.Context, request *ListPackageDetailsRequest) (*repository.PackagePage, error) {
+	options, err := request.options()
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := s.repo.ListPackages(ctx, options)
+	if err != nil {
+		return nil, s.statusError(err, packageResourceType, "")
+	}
+
+	if !s.auth.PublicReads() {
+		// Packages the caller can not read are dropped, so a page can be
+		// shorter than the page size.
+		readable := page.Packages[:0]
+		for _, pkg := range page.Packages {
+			if s.auth.Authorize(ctx, pkg.Package.GetMaintainer(), auth.RoleReader) == nil {
+				readable = append(readable, pkg)
+			}
+		}
+		page.Packages = readable
+	}
+
+	return page, nil
+}
+
+func (s *Server) ListVersionDetails(ctx context.Context, request *ListVersionDetailsRequest) (*repository.VersionPage, error) {
+	packageOrn, err := orn.ParsePackage(request.Orn)
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
+
+	options, err := request.options()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authorize(ctx, packageOrn.Package, auth.RoleReader); err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	page, err := s.repo.ListVersionDetails(ctx, packageOrn.Package, options)
+	if err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	return page, nil
+}
+
+func (r *ListPackageDetailsRequest) options() (repository.ListPackagesOptions, error) {
+	options := repository.ListPackagesOptions{
+		PageToken:  r.PageToken,
+		NamePrefix: r.NamePrefix,
+		Maintainer: r.Maintainer,
+		Tag:        strings.ToLower(r.Tag),
+		Owner:      r.Owner,
+	}
+
+	pageSize, err := checkPageSize(r.PageSize)
+	if err != nil {
+		return options, err
+	}
+	options.PageSize = pageSize
+
+	if !r.CreatedAfter.IsZero() {
+		options.CreatedAfter = &r.CreatedAfter
+	}
+
+	options.OrderBy, options.Descending, err = parseOrderBy(r.OrderBy, repository.OrderByName, repository.OrderByCreatedAt)
+	if err != nil {
+		return options, err
+	}
+
+	return options, nil
+}
+
+func (r *ListVersionDetailsRequest) options() (repository.ListVersionsOptions, error) {
+	options := repository.ListVersionsOptions{
+		PageToken:  r.PageToken,
+		NamePrefix: r.NamePrefix,
+		HasWeight:  r.HasWeight,
+	}
+
+	pageSize, err := checkPageSize(r.PageSize)
+	if err != nil {
+		return options, err
+	}
+	options.PageSize = pageSize
+
+	options.LabelSelector, err = parseLabelSelector(r.LabelSelector)
+	if err != nil {
+		return options, err
+	}
+
+	if !r.CreatedAfter.IsZero() {
+		options.CreatedAfter = &r.CreatedAfter
+	}
+
+	options.OrderBy, options.Descending, err = parseOrderBy(r.OrderBy, repository.OrderByWeight, repository.OrderByName, repository.OrderByCreatedAt)
+	if err != nil {
+		return options, err
+	}
+
+	return options, nil
+}
+
+func checkPageSize(pageSize uint32) (uint, error) {
+	if pageSize > maxPageSize {
+		return 0, invalidArgument("page_size", errors.Errorf("page size must be at most %d", maxPageSize))
+	}
+
+	return uint(pageSize), nil
+}
+
+// parseOrderBy parses "field" or "field desc". An empty value leaves the
+// default order of the repository.
+func parseOrderBy(value string, allowed ...repository.OrderBy) (repository.OrderBy, bool, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return "", false, nil
+	}
+
+	descending := false
+	if len(fields) == 2 && (fields[1] == "desc" || fields[1] == "asc") {
+		descending = fields[1] == "desc"
+	} else if len(fields) != 1 {
+		return "", false, invalidArgument("order_by", errors.Errorf("invalid order %q", value))
+	}
+
+	for _, orderBy := range allowed {
+		if fields[0] == string(orderBy) {
+			return orderBy, descending, nil
+		}
+	}
+
+	return "", false, invalidArgument("order_by", errors.Errorf("can not order by %q", fields[0]))
+}
+
+// listPackagesRequestFromContext reads the list options of the ListPackages
+// RPC from the request metadata.
+func listPackagesRequestFromContext(ctx context.Context) (*ListPackageDetailsRequest, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	pageSize, err := pageSizeFromMetadata(md)
+	if err != nil {
+		return nil, err
+	}
+
+	createdAfter, err := createdAfterFromMetadata(md)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListPackageDetailsRequest{
+		PageSize:     pageSize,
+		PageToken:    firstMetadataValue(md, pageTokenMetadata),
+		NamePrefix:   firstMetadataValue(md, namePrefixMetadata),
+		Maintainer:   firstMetadataValue(md, maintainerMetadata),
+		Tag:          firstMetadataValue(md, tagMetadata),
+		Owner:        firstMetadataValue(md, ownerMetadata),
+		CreatedAfter: createdAfter,
+		OrderBy:      firstMetadataValue(md, orderByMetadata),
+	}, nil
+}
+
+// listVersionsRequestFromContext reads the list options of the ListVersions
+// RPC from the request metadata.
+func listVersionsRequestFromContext(ctx context.Context, versionsOrn string) (*ListVersionDetailsRequest, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	pageSize, err := pageSizeFromMetadata(md)
+	if err != nil {
+		return nil, err
+	}
+
+	createdAfter, err := createdAfterFromMetadata(md)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &ListVersionDetailsRequest{
+		Orn:           versionsOrn,
+		PageSize:      pageSize,
+		PageToken:     firstMetadataValue(md, pageTokenMetadata),
+		NamePrefix:    firstMetadataValue(md, namePrefixMetadata),
+		LabelSelector: firstMetadataValue(md, labelSelectorMetadata),
+		CreatedAfter:  createdAfter,
+		OrderBy:       firstMetadataValue(md, orderByMetadata),
+	}
+
+	if value := firstMetadataValue(md, hasWeightMetadata); value != "" {
+		hasWeight, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, invalidArgument(hasWeightMetadata, err)
+		}
+
+		request.HasWeight = &hasWeight
+	}
+
+	return request, nil
+}
+
+func firstMetadataValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+func pageSizeFromMetadata(md metadata.MD) (uint32, error) {
+	value := firstMetadataValue(md, pageSizeMetadata)
+	if value == "" {
+		return 0, nil
+	}
+
+	pageSize, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, invalidArgument(pageSizeMetadata, err)
+	}
+
+	return uint32(pageSize), nil
+}
+
+func createdAfterFromMetadata(md metadata.MD) (time.Time, error) {
+	value := firstMetadataValue(md, createdAfterMetadata)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	createdAfter, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, invalidArgument(createdAfterMetadata, err)
+	}
+
+	return createdAfter, nil
+}
+
+// setNextPageTokenTrailer is a no-op on the last page.
+func setNextPageTokenTrailer(stream grpc.ServerStream, nextPageToken string) {
+	if nextPageToken == "" {
+		return
+	}
+
+	stream.SetTrailer(metadata.Pairs(nextPageTokenMetadata, nextPageToken))
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+func TestParseOrderBy(t *testing.T) {
+	allowed := []repository.OrderBy{repository.OrderByWeight, repository.OrderByName}
+
+	tests := []struct {
+		value          string
+		wantOrderBy    repository.OrderBy
+		wantDescending bool
+		wantErr        bool
+	}{
+		{value: ""},
+		{value: "name", wantOrderBy: repository.OrderByName},
+		{value: "weight desc", wantOrderBy: repository.OrderByWeight, wantDescending: true},
+		{value: " name  asc ", wantOrderBy: repository.OrderByName},
+		{value: "created_at", wantErr: true},
+		{value: "name down", wantErr: true},
+		{value: "name desc asc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		orderBy, descending, err := parseOrderBy(tt.value, allowed...)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseOrderBy(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+
+		if err != nil {
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("parseOrderBy(%q) = %v, want InvalidArgument", tt.value, err)
+			}
+			continue
+		}
+
+		if orderBy != tt.wantOrderBy || descending != tt.wantDescending {
+			t.Errorf("parseOrderBy(%q) = %q, %v", tt.value, orderBy, descending)
+		}
+	}
+}
+
+func TestListVersionsRequestFromContext(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		pageSizeMetadata, "20",
+		pageTokenMetadata, "token",
+		hasWeightMetadata, "true",
+		orderByMetadata, "name desc",
+		createdAfterMetadata, "2021-06-01T00:00:00Z",
+	))
+
+	request, err := listVersionsRequestFromContext(ctx, "packages/button")
+	if err != nil {
+		t.Fatalf("listVersionsRequestFromContext: %v", err)
+	}
+
+	if request.PageSize != 20 || request.PageToken != "token" || request.HasWeight == nil || !*request.HasWeight || request.OrderBy != "name desc" || request.CreatedAfter.Year() != 2021 {
+		t.Errorf("listVersionsRequestFromContext = %+v", request)
+	}
+
+	for _, pairs := range [][]string{
+		{pageSizeMetadata, "many"},
+		{hasWeightMetadata, "maybe"},
+		{createdAfterMetadata, "yesterday"},
+	} {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+		if _, err := listVersionsRequestFromContext(ctx, "packages/button"); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("listVersionsRequestFromContext(%v) = %v, want InvalidArgument", pairs, err)
+		}
+	}
+}
+
+func TestListPackageDetailsChecksThePageSize(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	if _, err := s.ListPackageDetails(context.Background(), &ListPackageDetailsRequest{PageSize: maxPageSize + 1}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ListPackageDetails with a page size over the maximum = %v, want InvalidArgument", err)
+	}
+
+	if _, err := s.ListPackageDetails(context.Background(), &ListPackageDetailsRequest{PageToken: "not a token"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ListPackageDetails with a malformed token = %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/manifest"
+	"pkg.aiocean.dev/polvoservice/internal/orn"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+// manifestValidationMetadata lists the manifest validation stages, in order,
+// as "<stage>: <message>", or "<stage>: failed: <message>" for the stage that
+// failed. polvo_v1.CreateVersionResponse only carries the created version, so
+// the progress is sent as metadata: the header goes out as soon as the URL
+// stage is done, before the manifest is fetched, and the trailer lists every
+// stage, including when the validation fails.
+const manifestValidationMetadata = "x-polvo-manifest-validation"
+
+// manifestSHA256Metadata is the response header of GetVersion carrying the
+// pinned SHA-256 of the manifest, when the version has one.
+const manifestSHA256Metadata = "x-polvo-manifest-sha256"
+
+type CheckManifestIntegrityRequest struct {
+	Orn string
+}
+
+type GetPinnedManifestRequest struct {
+	Orn string
+}
+
+// ManifestIntegrity compares the pinned manifest of a version with the one
+// currently served at its manifest URL.
+type ManifestIntegrity struct {
+	Orn           string `json:"orn"`
+	ManifestUrl   string `json:"manifest_url"`
+	PinnedSHA256  string `json:"pinned_sha256"`
+	CurrentSHA256 string `json:"current_sha256"`
+	// FetchError is set when the manifest could not be fetched, which is
+	// reported as a drift.
+	FetchError string    `json:"fetch_error,omitempty"`
+	Drifted    bool      `json:"drifted"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// validateManifest checks the manifest of a new version when manifest
+// validation is enabled, and streams its stages as manifestValidationMetadata.
+// It returns the fetched manifest, or nil when validation is disabled.
+func (s *Server) validateManifest(stream grpc.ServerStream, manifestUrl string) ([]byte, error) {
+	if !s.manifests.Enabled() {
+		return nil, nil
+	}
+
+	stages := metadata.MD{}
+	headerSent := false
+	body, err := s.manifests.Validate(stream.Context(), manifestUrl, func(progress manifest.Progress) {
+		line := string(progress.Stage) + ": " + progress.Message
+		if progress.Failed {
+			line = string(progress.Stage) + ": failed: " + progress.Message
+		}
+
+		stages.Append(manifestValidationMetadata, line)
+
+		if !headerSent {
+			headerSent = true
+			if err := stream.SendHeader(metadata.Pairs(manifestValidationMetadata, line)); err != nil {
+				s.logger.Debug("failed to send the manifest validation header", zap.Error(err))
+			}
+		}
+	})
+	stream.SetTrailer(stages)
+
+	if err != nil {
+		if errors.Is(err, manifest.ErrInvalidManifest) {
+			return nil, invalidArgument("version.manifest_url", err)
+		}
+
+		return nil, s.statusError(err, versionResourceType, "")
+	}
+
+	return body, nil
+}
+
+// pinManifest returns the pin of the manifest of a new version when manifest
+// pinning is enabled. body is the manifest fetched by the validation, if any.
+func (s *Server) pinManifest(ctx context.Context, manifestUrl string, body []byte) (*repository.ManifestPin, error) {
+	if !s.manifests.Pinning() {
+		return nil, nil
+	}
+
+	if body == nil {
+		fetched, err := s.manifests.Fetch(ctx, manifestUrl)
+		if err != nil {
+			if errors.Is(err, manifest.ErrInvalidManifest) {
+				return nil, invalidArgument("version.manifest_url", err)
+			}
+
+			return nil, s.statusError(err, versionResourceType, "")
+		}
+
+		body = fetched
+	}
+
+	pin := &repository.ManifestPin{
+		SHA256: manifest.Digest(body),
+	}
+
+	if s.manifests.StoreBody() {
+		pin.Body = body
+	}
+
+	return pin, nil
+}
+
+// setManifestHeader sends the pinned SHA-256 of a manifest as a response
+// header. It does nothing when the version is not pinned or ctx does not
+// belong to a gRPC call.
+func setManifestHeader(ctx context.Context, sha256 string) {
+	if sha256 == "" {
+		return
+	}
+
+	_ = grpc.SetHeader(ctx, metadata.Pairs(manifestSHA256Metadata, sha256))
+}
+
+// CheckManifestIntegrity fetches the manifest of a pinned version again and
+// reports whether it drifted from the pinned SHA-256.
+func (s *Server) CheckManifestIntegrity(ctx context.Context, request *CheckManifestIntegrityRequest) (*ManifestIntegrity, error) {
+	versionOrn, err := orn.ParseVersion(request.Orn)
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
+
+	if err := s.authorize(ctx, versionOrn.Package, auth.RoleReader); err != nil {
+		return nil, s.statusError(err, versionResourceType, versionOrn.String())
+	}
+
+	version, err := s.repo.GetVersion(ctx, versionOrn.Package, versionOrn.Version)
+	if err != nil {
+		return nil, s.statusError(err, versionResourceType, versionOrn.String())
+	}
+
+	pin, err := s.pinnedManifest(ctx, versionOrn)
+	if err != nil {
+		return nil, err
+	}
+
+	integrity := &ManifestIntegrity{
+		Orn:          versionOrn.String(),
+		ManifestUrl:  version.GetManifestUrl(),
+		PinnedSHA256: pin.SHA256,
+	}
+
+	body, err := s.manifests.Fetch(ctx, version.GetManifestUrl())
+	switch {
+	case errors.Is(err, manifest.ErrInvalidManifest):
+		integrity.FetchError = err.Error()
+		integrity.Drifted = true
+	case err != nil:
+		return nil, s.statusError(err, versionResourceType, versionOrn.String())
+	default:
+		integrity.CurrentSHA256 = manifest.Digest(body)
+		integrity.Drifted = integrity.CurrentSHA256 != pin.SHA256
+	}
+
+	integrity.CheckedAt = time.Now().UTC()
+
+	return integrity, nil
+}
+
+// GetPinnedManifest returns the pin of a version, with the manifest when it
+// was stored at creation.
+func (s *Server) GetPinnedManifest(ctx context.Context, request *GetPinnedManifestRequest) (*repository.ManifestPin, error) {
+	versionOrn, err := orn.ParseVersion(request.Orn)
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
+
+	if err := s.authorize(ctx, versionOrn.Package, auth.RoleReader); err != nil {
+		return nil, s.statusError(err, versionResourceType, versionOrn.String())
+	}
+
+	return s.pinnedManifest(ctx, versionOrn)
+}
+
+func (s *Server) pinnedManifest(ctx context.Context, versionOrn orn.VersionORN) (*repository.ManifestPin, error) {
+	pin, err := s.repo.GetManifestPin(ctx, versionOrn.Package, versionOrn.Version)
+	if err != nil {
+		return nil, s.statusError(err, versionResourceType, versionOrn.String())
+	}
+
+	if pin == nil {
+		err := errors.Wrapf(repository.ErrPrecondition, "manifest of version %s of package %s is not pinned", versionOrn.Version, versionOrn.Package)
+
+		return nil, s.statusError(err, versionResourceType, versionOrn.String())
+	}
+
+	return pin, nil
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/manifest"
+)
+
+type createVersionStream struct {
+	testStream
+	header   []metadata.MD
+	trailer  metadata.MD
+	versions []*polvo_v1.Version
+}
+
+func (s *createVersionStream) SendHeader(md metadata.MD) error {
+	s.header = append(s.header, md)
+
+	return nil
+}
+
+func (s *createVersionStream) SetTrailer(md metadata.MD) {
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+func (s *createVersionStream) Send(response *polvo_v1.CreateVersionResponse) error {
+	s.versions = append(s.versions, response.GetVersion())
+
+	return nil
+}
+
+func TestCreateVersionStreamsManifestValidation(t *testing.T) {
+	manifestServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.json" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"name": "button"}`))
+	}))
+	defer manifestServer.Close()
+
+	tests := []struct {
+		path   string
+		code   codes.Code
+		stages []string
+	}{
+		{"/manifest.json", codes.OK, []string{"url: ", "fetch: ", "content: "}},
+		{"/missing.json", codes.InvalidArgument, []string{"url: ", "fetch: failed: "}},
+	}
+
+	for _, test := range tests {
+		s, repo := newTestServer(t)
+		s.manifests = manifest.New(manifest.Options{
+			Schemes:      []string{"http"},
+			Hosts:        []string{"127.0.0.1"},
+			RequiredKeys: []string{"name"},
+			Client:       manifestServer.Client(),
+		})
+
+		ctx := context.Background()
+		if _, err := repo.CreatePackage(ctx, &polvo_v1.Package{Name: "button"}, nil); err != nil {
+			t.Fatalf("CreatePackage: %v", err)
+		}
+
+		stream := &createVersionStream{testStream: testStream{ctx: ctx}}
+		err := s.CreateVersion(&polvo_v1.CreateVersionRequest{
+			PackageOrn: "packages/button",
+			Version:    &polvo_v1.Version{Name: "1.0.0", ManifestUrl: manifestServer.URL + test.path},
+		}, stream)
+
+		if status.Code(err) != test.code {
+			t.Errorf("CreateVersion(%s) = %v, want %s", test.path, err, test.code)
+		}
+
+		if len(stream.header) != 1 || !strings.HasPrefix(strings.Join(stream.header[0].Get(manifestValidationMetadata), ""), "url: ") {
+			t.Errorf("CreateVersion(%s) sent the headers %v, want the URL stage", test.path, stream.header)
+		}
+
+		stages := stream.trailer.Get(manifestValidationMetadata)
+		if len(stages) != len(test.stages) {
+			t.Errorf("CreateVersion(%s) trailer = %q, want %q", test.path, stages, test.stages)
+			continue
+		}
+
+		for i, prefix := range test.stages {
+			if !strings.HasPrefix(stages[i], prefix) {
+				t.Errorf("CreateVersion(%s) stage %d = %q, want %q", test.path, i, stages[i], prefix)
+			}
+		}
+
+		exists, _ := repo.IsVersionExists(ctx, "button", "1.0.0")
+		if exists != (test.code == codes.OK) || len(stream.versions) != map[bool]int{true: 1}[exists] {
+			t.Errorf("CreateVersion(%s) created %v, sent %d versions", test.path, exists, len(stream.versions))
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+// polvo_v1.Package has no room for the catalogue metadata of a package, so
+// CreatePackage and UpdatePackage read it from these request metadata keys
+// and GetPackage returns it in the same response headers. The description is
+// percent-encoded, tags and owners are comma separated or repeated.
+const (
+	descriptionMetadata   = "x-polvo-description"
+	repositoryUrlMetadata = "x-polvo-repository-url"
+	homepageUrlMetadata   = "x-polvo-homepage-url"
+	iconUrlMetadata       = "x-polvo-icon-url"
+	tagsMetadata          = "x-polvo-tags"
+	ownersMetadata        = "x-polvo-owners"
+	// tagMetadata and ownerMetadata filter the ListPackages RPC.
+	tagMetadata   = "x-polvo-tag"
+	ownerMetadata = "x-polvo-owner"
+)
+
+const (
+	maxDescriptionLength = 1024
+	maxTags              = 20
+	maxTagLength         = 32
+	maxOwners            = 20
+	maxOwnerLength       = 128
+)
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// metadataFieldPaths maps the field mask paths of UpdatePackage that are not
+// fields of polvo_v1.Package to their keys in the updated fields.
+var metadataFieldPaths = map[string]string{
+	"package.description":    repository.DescriptionField,
+	"package.repository_url": repository.RepositoryUrlField,
+	"package.homepage_url":   repository.HomepageUrlField,
+	"package.icon_url":       repository.IconUrlField,
+	"package.tags":           repository.TagsField,
+	"package.owners":         repository.OwnersField,
+}
+
+// packageMetadataFromContext reads and validates the package metadata of the
+// request metadata. Missing keys leave their field empty.
+func packageMetadataFromContext(ctx context.Context) (repository.PackageMetadata, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	description, err := url.PathUnescape(firstMetadataValue(md, descriptionMetadata))
+	if err != nil {
+		return repository.PackageMetadata{}, invalidArgument("package.description", err)
+	}
+
+	packageMetadata := repository.PackageMetadata{
+		Description:   strings.TrimSpace(description),
+		RepositoryUrl: strings.TrimSpace(firstMetadataValue(md, repositoryUrlMetadata)),
+		HomepageUrl:   strings.TrimSpace(firstMetadataValue(md, homepageUrlMetadata)),
+		IconUrl:       strings.TrimSpace(firstMetadataValue(md, iconUrlMetadata)),
+		Tags:          listMetadataValues(md, tagsMetadata),
+		Owners:        listMetadataValues(md, ownersMetadata),
+	}
+
+	if err := normalizePackageMetadata(&packageMetadata); err != nil {
+		return repository.PackageMetadata{}, err
+	}
+
+	return packageMetadata, nil
+}
+
+// normalizePackageMetadata validates the metadata, lower cases the tags and
+// sorts the tags and owners without duplicates.
+func normalizePackageMetadata(packageMetadata *repository.PackageMetadata) error {
+	if utf8.RuneCountInString(packageMetadata.Description) > maxDescriptionLength {
+		return invalidArgument("package.description", errors.Errorf("the description must be at most %d characters", maxDescriptionLength))
+	}
+
+	for field, value := range map[string]string{
+		"package.repository_url": packageMetadata.RepositoryUrl,
+		"package.homepage_url":   packageMetadata.HomepageUrl,
+		"package.icon_url":       packageMetadata.IconUrl,
+	} {
+		if value == "" {
+			continue
+		}
+
+		if err := validateHTTPURL(value); err != nil {
+			return invalidArgument(field, err)
+		}
+	}
+
+	for i, tag := range packageMetadata.Tags {
+		tag = strings.ToLower(tag)
+		if len(tag) > maxTagLength || !tagPattern.MatchString(tag) {
+			return invalidArgument("package.tags", errors.Errorf("invalid tag %q, tags are at most %d lower case letters, digits and dashes", tag, maxTagLength))
+		}
+
+		packageMetadata.Tags[i] = tag
+	}
+
+	for _, owner := range packageMetadata.Owners {
+		if len(owner) > maxOwnerLength {
+			return invalidArgument("package.owners", errors.Errorf("owners must be at most %d characters", maxOwnerLength))
+		}
+	}
+
+	packageMetadata.Tags = sortedUnique(packageMetadata.Tags)
+	packageMetadata.Owners = sortedUnique(packageMetadata.Owners)
+
+	if len(packageMetadata.Tags) > maxTags {
+		return invalidArgument("package.tags", errors.Errorf("a package has at most %d tags", maxTags))
+	}
+
+	if len(packageMetadata.Owners) > maxOwners {
+		return invalidArgument("package.owners", errors.Errorf("a package has at most %d owners", maxOwners))
+	}
+
+	return nil
+}
+
+// splitMetadataPaths removes the metadata paths from the field mask paths,
+// and returns the metadata fields they select.
+func splitMetadataPaths(paths []string, packageMetadata repository.PackageMetadata) ([]string, map[string]interface{}) {
+	values := map[string]interface{}{
+		repository.DescriptionField:   packageMetadata.Description,
+		repository.RepositoryUrlField: packageMetadata.RepositoryUrl,
+		repository.HomepageUrlField:   packageMetadata.HomepageUrl,
+		repository.IconUrlField:       packageMetadata.IconUrl,
+		repository.TagsField:          packageMetadata.Tags,
+		repository.OwnersField:        packageMetadata.Owners,
+	}
+
+	var protoPaths []string
+	fields := map[string]interface{}{}
+	for _, path := range paths {
+		key, ok := metadataFieldPaths[path]
+		if !ok {
+			protoPaths = append(protoPaths, path)
+			continue
+		}
+
+		fields[key] = values[key]
+	}
+
+	return protoPaths, fields
+}
+
+// listMetadataValues reads a list sent as repeated or comma separated values,
+// without the empty ones.
+func listMetadataValues(md metadata.MD, key string) []string {
+	var values []string
+	for _, value := range md.Get(key) {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+
+	return values
+}
+
+func sortedUnique(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	sort.Strings(values)
+
+	unique := values[:1]
+	for _, value := range values[1:] {
+		if value != unique[len(unique)-1] {
+			unique = append(unique, value)
+		}
+	}
+
+	return unique
+}
+
+// setPackageMetadataHeader sends the non empty metadata fields as response
+// headers. It does nothing when ctx does not belong to a gRPC call.
+func setPackageMetadataHeader(ctx context.Context, packageMetadata repository.PackageMetadata) {
+	md := metadata.MD{}
+
+	for key, value := range map[string]string{
+		descriptionMetadata:   url.PathEscape(packageMetadata.Description),
+		repositoryUrlMetadata: packageMetadata.RepositoryUrl,
+		homepageUrlMetadata:   packageMetadata.HomepageUrl,
+		iconUrlMetadata:       packageMetadata.IconUrl,
+		tagsMetadata:          strings.Join(packageMetadata.Tags, ","),
+		ownersMetadata:        strings.Join(packageMetadata.Owners, ","),
+	} {
+		if value != "" {
+			md.Set(key, value)
+		}
+	}
+
+	_ = grpc.SetHeader(ctx, md)
+}
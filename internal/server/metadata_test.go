@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+func TestPackageMetadataFromContext(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{
+		descriptionMetadata:   {"Buttons%2C%20big%20and%20small"},
+		repositoryUrlMetadata: {" https://github.com/aiocean/button "},
+		tagsMetadata:          {"UI, forms", "ui"},
+		ownersMetadata:        {"team-b,team-a"},
+	})
+
+	got, err := packageMetadataFromContext(ctx)
+	if err != nil {
+		t.Fatalf("packageMetadataFromContext: %v", err)
+	}
+
+	if got.Description != "Buttons, big and small" || got.RepositoryUrl != "https://github.com/aiocean/button" {
+		t.Errorf("metadata = %+v", got)
+	}
+
+	// Tags are lower cased, tags and owners sorted without duplicates.
+	if strings.Join(got.Tags, ",") != "forms,ui" || strings.Join(got.Owners, ",") != "team-a,team-b" {
+		t.Errorf("tags = %v, owners = %v", got.Tags, got.Owners)
+	}
+
+	if empty, err := packageMetadataFromContext(context.Background()); err != nil || empty.Description != "" || empty.Tags != nil {
+		t.Errorf("metadata without request metadata = %+v, %v", empty, err)
+	}
+}
+
+func TestPackageMetadataIsValidated(t *testing.T) {
+	tooManyTags := make([]string, maxTags+1)
+	for i := range tooManyTags {
+		tooManyTags[i] = "tag-" + strconv.Itoa(i)
+	}
+
+	for _, md := range []metadata.MD{
+		{descriptionMetadata: {"%zz"}},
+		{descriptionMetadata: {strings.Repeat("a", maxDescriptionLength+1)}},
+		{homepageUrlMetadata: {"ftp://example.com"}},
+		{iconUrlMetadata: {"icon.svg"}},
+		{tagsMetadata: {"ui kit"}},
+		{tagsMetadata: {"-ui"}},
+		{tagsMetadata: {strings.Repeat("a", maxTagLength+1)}},
+		{tagsMetadata: tooManyTags},
+		{ownersMetadata: {strings.Repeat("a", maxOwnerLength+1)}},
+	} {
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+		if _, err := packageMetadataFromContext(ctx); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("packageMetadataFromContext(%v) = %v, want InvalidArgument", md, err)
+		}
+	}
+}
+
+func TestUpdatePackageMetadata(t *testing.T) {
+	s, repo := newTestServer(t)
+
+	metadataBefore := &repository.PackageMetadata{Description: "Buttons", Tags: []string{"ui"}}
+	if _, err := repo.CreatePackage(context.Background(), &polvo_v1.Package{Name: "button", Maintainer: "alice"}, metadataBefore); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	// Only the metadata in the field mask is updated.
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{
+		descriptionMetadata: {"ignored"},
+		tagsMetadata:        {"Forms,ui"},
+	})
+	request := &polvo_v1.UpdatePackageRequest{
+		Orn:       "packages/button",
+		FieldMask: &fieldmaskpb.FieldMask{Paths: []string{"package.tags"}},
+	}
+	if _, err := s.UpdatePackage(ctx, request); err != nil {
+		t.Fatalf("UpdatePackage: %v", err)
+	}
+
+	details, err := repo.GetPackageDetails(context.Background(), "button")
+	if err != nil {
+		t.Fatalf("GetPackageDetails: %v", err)
+	}
+
+	if details.Metadata.Description != "Buttons" || strings.Join(details.Metadata.Tags, ",") != "forms,ui" {
+		t.Errorf("metadata after the update = %+v", details.Metadata)
+	}
+}
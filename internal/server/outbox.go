@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"pkg.aiocean.dev/polvoservice/internal/orn"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+const (
+	defaultOutboxInterval  = time.Second
+	defaultOutboxRetention = 24 * time.Hour
+	// outboxBatchSize bounds the events relayed at once.
+	outboxBatchSize = 100
+	// outboxPurgeInterval is how often the delivered events older than the
+	// retention are removed.
+	outboxPurgeInterval = time.Hour
+)
+
+// OutboxRelay queues the webhook deliveries of the events the repository
+// writes in the transaction of every mutation. An event is marked delivered
+// once its deliveries are queued, so an event whose relay was interrupted is
+// relayed again, with the same ID. Every process runs one, an event can be
+// relayed by more than one process when they read it at the same time. The
+// watchers do not depend on it, the ChangeFeed of every process reads the
+// outbox by sequence. It is configured from the environment:
+//
+//  OUTBOX_INTERVAL    how often pending events are relayed, "1s" by default.
+//                     A mutation made by this process is relayed right away.
+//  OUTBOX_RETENTION   how long delivered events are kept, "24h" by default.
+type OutboxRelay struct {
+	logger    *zap.Logger
+	server    *Server
+	interval  time.Duration
+	retention time.Duration
+}
+
+func NewOutboxRelay(logger *zap.Logger, server *Server) (*OutboxRelay, error) {
+	relay := &OutboxRelay{
+		logger:    logger,
+		server:    server,
+		interval:  defaultOutboxInterval,
+		retention: defaultOutboxRetention,
+	}
+
+	for name, value := range map[string]*time.Duration{
+		"OUTBOX_INTERVAL":  &relay.interval,
+		"OUTBOX_RETENTION": &relay.retention,
+	} {
+		if env := os.Getenv(name); env != "" {
+			duration, err := time.ParseDuration(env)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid %s", name)
+			}
+
+			if duration <= 0 {
+				return nil, errors.Errorf("%s must be positive", name)
+			}
+
+			*value = duration
+		}
+	}
+
+	return relay, nil
+}
+
+// Run relays the pending events on every interval, and after every mutation
+// of this process, until ctx is done.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	purgeTicker := time.NewTicker(outboxPurgeInterval)
+	defer purgeTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.relayPending(ctx)
+		case <-r.server.outboxChanged:
+			r.relayPending(ctx)
+		case <-purgeTicker.C:
+			r.purge(ctx)
+		}
+	}
+}
+
+// relayPending publishes the pending events in order, a batch at a time. It
+// stops at the first event that fails, so that the events of a package are
+// not relayed out of order.
+func (r *OutboxRelay) relayPending(ctx context.Context) {
+	for {
+		events, err := r.server.repo.ListPendingOutboxEvents(ctx, outboxBatchSize)
+		if err != nil {
+			r.logger.Error("failed to list pending outbox events", zap.Error(err))
+			return
+		}
+
+		var delivered []string
+		for _, event := range events {
+			if err := r.server.relay(ctx, event); err != nil {
+				r.logger.Error("failed to relay outbox event", zap.String("event", event.ID), zap.String("type", event.Type), zap.Error(err))
+				break
+			}
+
+			delivered = append(delivered, event.ID)
+		}
+
+		if len(delivered) == 0 {
+			return
+		}
+
+		if err := r.server.repo.MarkOutboxEventsDelivered(ctx, delivered, time.Now()); err != nil {
+			r.logger.Error("failed to mark outbox events delivered", zap.Error(err))
+			return
+		}
+
+		if len(delivered) < outboxBatchSize {
+			return
+		}
+	}
+}
+
+func (r *OutboxRelay) purge(ctx context.Context) {
+	purged, err := r.server.repo.PurgeOutboxEvents(ctx, time.Now().Add(-r.retention))
+	if err != nil {
+		r.logger.Error("failed to purge outbox events", zap.Error(err))
+		return
+	}
+
+	if purged > 0 {
+		r.logger.Info("purged delivered outbox events", zap.Int("events", purged))
+	}
+}
+
+// wakeOutboxRelay has the OutboxRelay and the ChangeFeed read the events of a
+// mutation without waiting for their interval.
+func (s *Server) wakeOutboxRelay() {
+	for _, changed := range []chan struct{}{s.outboxChanged, s.feedChanged} {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// relay queues the webhook deliveries of an outbox event.
+func (s *Server) relay(ctx context.Context, outboxEvent *repository.OutboxEvent) error {
+	return s.enqueueWebhooks(ctx, newChangeEvent(outboxEvent))
+}
+
+func newChangeEvent(outboxEvent *repository.OutboxEvent) *ChangeEvent {
+	event := &ChangeEvent{
+		Sequence:       outboxEvent.Sequence,
+		ResumeToken:    newResumeToken(outboxEvent.Sequence),
+		ID:             outboxEvent.ID,
+		Type:           ChangeType(outboxEvent.Type),
+		Package:        outboxEvent.Package,
+		Orn:            outboxEventOrn(outboxEvent),
+		PackageState:   outboxEvent.PackageState,
+		VersionState:   outboxEvent.VersionState,
+		ChannelState:   outboxEvent.ChannelState,
+		PreviousWeight: outboxEvent.PreviousWeight,
+		Actor:          outboxEvent.Actor,
+		Time:           outboxEvent.CreatedAt,
+	}
+
+	if event.Actor == "" {
+		event.Actor = anonymousActor
+	}
+
+	return event
+}
+
+func outboxEventOrn(event *repository.OutboxEvent) string {
+	switch {
+	case event.Version != "":
+		return orn.VersionORN{Package: event.Package, Version: event.Version}.String()
+	case event.Channel != "":
+		return orn.ChannelORN{Package: event.Package, Channel: event.Channel}.String()
+	default:
+		return orn.PackageORN{Package: event.Package}.String()
+	}
+}
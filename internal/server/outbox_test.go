@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+func TestOutboxRelayQueuesTheDeliveries(t *testing.T) {
+	s := newChannelTestServer(t)
+	ctx := auth.NewContext(context.Background(), &auth.Principal{Subject: "alice"})
+
+	// Relays the events of the test packages first.
+	relay, err := NewOutboxRelay(zap.NewNop(), s)
+	if err != nil {
+		t.Fatalf("NewOutboxRelay: %v", err)
+	}
+	relay.relayPending(ctx)
+
+	webhook, err := s.repo.CreateWebhook(ctx, &repository.Webhook{URL: "https://hooks.example.com/polvo", Secret: "secret"})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	if _, err := s.CreateChannel(ctx, &CreateChannelRequest{PackageOrn: "packages/button", Name: "stable", Targets: []repository.ChannelTarget{{Version: "1.0.0"}}}); err != nil {
+		t.Fatalf("CreateChannel: %v", err)
+	}
+
+	relay.relayPending(ctx)
+
+	if pending, _ := s.repo.ListPendingOutboxEvents(ctx, 0); len(pending) != 0 {
+		t.Errorf("pending events after the relay = %+v, want none", pending)
+	}
+
+	page, err := s.repo.ListWebhookDeliveries(ctx, repository.ListWebhookDeliveriesOptions{WebhookID: webhook.ID})
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+
+	if len(page.Deliveries) != 1 || page.Deliveries[0].EventType != string(ChangeChannelCreated) {
+		t.Errorf("deliveries = %+v, want the channel event", page.Deliveries)
+	}
+}
+
+// failingWebhooks fails to list the webhooks, so that no event can be relayed.
+type failingWebhooks struct {
+	repository.Repository
+}
+
+func (failingWebhooks) ListWebhooks(ctx context.Context) ([]*repository.Webhook, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestOutboxEventsStayPendingUntilRelayed(t *testing.T) {
+	s := newChannelTestServer(t)
+	ctx := context.Background()
+
+	pending, err := s.repo.ListPendingOutboxEvents(ctx, 0)
+	if err != nil || len(pending) == 0 {
+		t.Fatalf("ListPendingOutboxEvents = %d events, %v", len(pending), err)
+	}
+
+	repo := s.repo
+	s.repo = failingWebhooks{repo}
+
+	relay, err := NewOutboxRelay(zap.NewNop(), s)
+	if err != nil {
+		t.Fatalf("NewOutboxRelay: %v", err)
+	}
+	relay.relayPending(ctx)
+
+	if after, _ := repo.ListPendingOutboxEvents(ctx, 0); len(after) != len(pending) {
+		t.Errorf("%d events are pending after a failed relay, want %d", len(after), len(pending))
+	}
+
+	// They are relayed on the next attempt.
+	s.repo = repo
+	relay.relayPending(ctx)
+
+	if after, _ := repo.ListPendingOutboxEvents(ctx, 0); len(after) != 0 {
+		t.Errorf("%d events are pending after the relay, want none", len(after))
+	}
+}
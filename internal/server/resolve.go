@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/labels"
+	"pkg.aiocean.dev/polvoservice/internal/orn"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+	"pkg.aiocean.dev/polvoservice/internal/semver"
+	"pkg.aiocean.dev/polvoservice/internal/traffic"
+)
+
+// stickyKeyMetadata is the request metadata carrying the user or session id
+// used to pin a caller to one version when resolving "any".
+const stickyKeyMetadata = "x-polvo-sticky-key"
+
+// versionSource is the part of the repository versions are resolved from, so
+// that they can also be resolved from a snapshot, see snapshotSource.
+type versionSource interface {
+	GetVersion(ctx context.Context, packageName, versionName string) (*polvo_v1.Version, error)
+	ListVersions(ctx context.Context, packageName string) ([]*polvo_v1.Version, error)
+	GetHeaviestVersion(ctx context.Context, packageName string) (*polvo_v1.Version, error)
+	GetChannel(ctx context.Context, packageName, channelName string) (*repository.Channel, error)
+	// ListMatchingVersions returns the versions whose labels match selector,
+	// heaviest first.
+	ListMatchingVersions(ctx context.Context, packageName string, selector *labels.Selector) ([]*polvo_v1.Version, error)
+}
+
+func stickyKeyFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	if values := md.Get(stickyKeyMetadata); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// resolveVersion finds the version addressed by a version ORN. The version
+// segment is looked up in this order:
+//
+//  1. "any" picks a version proportionally to the weights, see pickVersion.
+//  2. An existing version with exactly that name, so non-SemVer names such as
+//     "legacy" or "2021-06-build" keep working.
+//  3. A release channel of the package, such as "stable" or "beta".
+//  4. A SemVer range ("latest", "^1.4", "~2.0.1", ">=1.2 <2", ...) resolves to
+//     the highest matching release. Version names that are not SemVer are
+//     skipped, and pre-releases only match ranges that mention a pre-release
+//     of the same MAJOR.MINOR.PATCH.
+//
+// A non empty selector hides the versions whose labels it does not select,
+// in every step.
+func (s *Server) resolveVersion(ctx context.Context, versionOrn orn.VersionORN, stickyKey string, selector *labels.Selector) (*polvo_v1.Version, error) {
+	if err := s.authorize(ctx, versionOrn.Package, auth.RoleReader); err != nil {
+		return nil, err
+	}
+
+	return s.resolveVersionFrom(ctx, repositorySource{s.repo}, versionOrn, stickyKey, selector)
+}
+
+// resolveVersionFrom is resolveVersion without the authorization, reading
+// from source.
+func (s *Server) resolveVersionFrom(ctx context.Context, source versionSource, versionOrn orn.VersionORN, stickyKey string, selector *labels.Selector) (*polvo_v1.Version, error) {
+	source, err := selectVersions(ctx, source, versionOrn.Package, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	if versionOrn.Version == defaultVersions["any"] {
+		return s.pickVersion(ctx, source, versionOrn.Package, stickyKey)
+	}
+
+	version, err := source.GetVersion(ctx, versionOrn.Package, versionOrn.Version)
+	if err == nil || !errors.Is(err, repository.ErrVersionNotFound) {
+		return version, err
+	}
+
+	if orn.ValidateChannelName(versionOrn.Version) == nil {
+		version, channelErr := s.resolveChannel(ctx, source, versionOrn.Package, versionOrn.Version, stickyKey)
+		if channelErr == nil || !errors.Is(channelErr, repository.ErrChannelNotFound) {
+			return version, channelErr
+		}
+	}
+
+	constraint, parseErr := semver.ParseConstraint(versionOrn.Version)
+	if parseErr != nil {
+		return nil, err
+	}
+
+	versions, err := source.ListVersions(ctx, versionOrn.Package)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(versions))
+	for _, candidate := range versions {
+		names = append(names, candidate.GetName())
+	}
+
+	resolvedName, ok := constraint.Highest(names)
+	if !ok {
+		return nil, errors.Wrapf(repository.ErrVersionNotFound, "no version of package %s matches %q", versionOrn.Package, versionOrn.Version)
+	}
+
+	for _, candidate := range versions {
+		if candidate.GetName() == resolvedName {
+			return candidate, nil
+		}
+	}
+
+	return nil, errors.Wrapf(repository.ErrVersionNotFound, "version %s of package %s", resolvedName, versionOrn.Package)
+}
+
+// pickVersion splits traffic between the versions of a package by weight. A
+// non empty stickyKey always lands on the same version for the same weights.
+// When no version has a weight it falls back to the heaviest version.
+func (s *Server) pickVersion(ctx context.Context, source versionSource, packageName, stickyKey string) (*polvo_v1.Version, error) {
+	versions, err := source.ListVersions(ctx, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	var picked *polvo_v1.Version
+	if stickyKey != "" {
+		picked = traffic.Sticky(versions, packageName+"/"+stickyKey)
+	} else {
+		picked = s.splitter.Pick(versions)
+	}
+
+	if picked == nil {
+		return source.GetHeaviestVersion(ctx, packageName)
+	}
+
+	return picked, nil
+}
+
+// resolveChannel returns the version a channel points at. When the channel
+// splits traffic between several versions, one is picked by weight like for
+// "any".
+func (s *Server) resolveChannel(ctx context.Context, source versionSource, packageName, channelName, stickyKey string) (*polvo_v1.Version, error) {
+	channel, err := source.GetChannel(ctx, packageName, channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(channel.Targets) {
+	case 0:
+		return nil, errors.Wrapf(repository.ErrVersionNotFound, "channel %s of package %s has no version", channelName, packageName)
+	case 1:
+		return source.GetVersion(ctx, packageName, channel.Targets[0].Version)
+	}
+
+	versions, err := source.ListVersions(ctx, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	weights := map[string]uint32{}
+	for _, target := range channel.Targets {
+		weights[target.Version] = target.Weight
+	}
+
+	var candidates []*polvo_v1.Version
+	for _, version := range versions {
+		weight, ok := weights[version.GetName()]
+		if !ok {
+			continue
+		}
+
+		// The channel weight replaces the package weight while picking, the
+		// returned version keeps its own.
+		candidates = append(candidates, &polvo_v1.Version{
+			Name:   version.GetName(),
+			Weight: weight,
+		})
+	}
+
+	var picked *polvo_v1.Version
+	if stickyKey != "" {
+		picked = traffic.Sticky(candidates, packageName+"/"+channelName+"/"+stickyKey)
+	} else {
+		picked = s.splitter.Pick(candidates)
+	}
+
+	if picked == nil {
+		return nil, errors.Wrapf(repository.ErrVersionNotFound, "channel %s of package %s has no version", channelName, packageName)
+	}
+
+	for _, version := range versions {
+		if version.GetName() == picked.GetName() {
+			return version, nil
+		}
+	}
+
+	return nil, errors.Wrapf(repository.ErrVersionNotFound, "version %s of package %s", picked.GetName(), packageName)
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/orn"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+func TestResolveVersion(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestServer(t)
+
+	if _, err := repo.CreatePackage(ctx, &polvo_v1.Package{Name: "button", Maintainer: "alice"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	for name, weight := range map[string]uint32{"1.0.0": 0, "1.4.2": 0, "1.5.0": 100, "2.0.0-beta.1": 0, "legacy": 0, "^2": 0} {
+		if _, err := repo.CreateVersion(ctx, "button", &polvo_v1.Version{Name: name, Weight: weight}, nil, nil); err != nil {
+			t.Fatalf("CreateVersion(%q): %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		{"any", "1.5.0"},
+		{"legacy", "legacy"},
+		{"1.4.2", "1.4.2"},
+		{"latest", "1.5.0"},
+		{"~1.4", "1.4.2"},
+		{"<1.4", "1.0.0"},
+		{">=2.0.0-beta.0", "2.0.0-beta.1"},
+		// A version named like a range is found before the range is resolved.
+		{"^2", "^2"},
+	}
+
+	for _, tt := range tests {
+		version, err := s.resolveVersion(ctx, orn.VersionORN{Package: "button", Version: tt.selector}, "", nil)
+		if err != nil || version.GetName() != tt.want {
+			t.Errorf("resolveVersion(%q) = %v, %v, want %s", tt.selector, version, err, tt.want)
+		}
+	}
+
+	for _, selector := range []string{"^3", "1.0.1", "nightly"} {
+		if _, err := s.resolveVersion(ctx, orn.VersionORN{Package: "button", Version: selector}, "", nil); !errors.Is(err, repository.ErrVersionNotFound) {
+			t.Errorf("resolveVersion(%q) = %v, want ErrVersionNotFound", selector, err)
+		}
+	}
+}
+
+func TestResolveAnySplitsByWeight(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestServer(t)
+
+	if _, err := repo.CreatePackage(ctx, &polvo_v1.Package{Name: "button", Maintainer: "alice"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	for name, weight := range map[string]uint32{"1.0.0": 50, "2.0.0": 50} {
+		if _, err := repo.CreateVersion(ctx, "button", &polvo_v1.Version{Name: name, Weight: weight}, nil, nil); err != nil {
+			t.Fatalf("CreateVersion(%q): %v", name, err)
+		}
+	}
+
+	anyVersion := orn.VersionORN{Package: "button", Version: "any"}
+
+	picked := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		version, err := s.resolveVersion(ctx, anyVersion, "", nil)
+		if err != nil {
+			t.Fatalf("resolveVersion: %v", err)
+		}
+
+		picked[version.GetName()] = true
+	}
+
+	if len(picked) != 2 {
+		t.Errorf("resolveVersion without sticky key picked %v, want both versions", picked)
+	}
+
+	first, _ := s.resolveVersion(ctx, anyVersion, "user-1", nil)
+	for i := 0; i < 20; i++ {
+		if version, _ := s.resolveVersion(ctx, anyVersion, "user-1", nil); version.GetName() != first.GetName() {
+			t.Fatalf("resolveVersion with a sticky key picked %s then %s", first.GetName(), version.GetName())
+		}
+	}
+
+	// Without weights, any falls back to the heaviest version.
+	for _, name := range []string{"1.0.0", "2.0.0"} {
+		if _, err := repo.UpdateVersion(ctx, "button", name, map[string]interface{}{"Weight": uint32(0)}); err != nil {
+			t.Fatalf("UpdateVersion: %v", err)
+		}
+	}
+
+	if version, err := s.resolveVersion(ctx, anyVersion, "user-1", nil); err != nil || version == nil {
+		t.Errorf("resolveVersion without weights = %v, %v", version, err)
+	}
+}
+
+func TestResolveVersionWithLabelSelector(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestServer(t)
+
+	if _, err := repo.CreatePackage(ctx, &polvo_v1.Package{Name: "button", Maintainer: "alice"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	for _, version := range []struct {
+		name   string
+		weight uint32
+		labels map[string]string
+	}{
+		{"1.0.0", 0, map[string]string{"env": "prod"}},
+		{"1.1.0", 100, map[string]string{"env": "staging"}},
+		{"1.2.0", 0, map[string]string{"env": "staging", "canary": ""}},
+	} {
+		if _, err := repo.CreateVersion(ctx, "button", &polvo_v1.Version{Name: version.name, Weight: version.weight}, nil, version.labels); err != nil {
+			t.Fatalf("CreateVersion(%q): %v", version.name, err)
+		}
+	}
+
+	tests := []struct {
+		version  string
+		selector string
+		want     string
+	}{
+		{"latest", "", "1.2.0"},
+		{"latest", "!canary", "1.1.0"},
+		{"latest", "env=prod", "1.0.0"},
+		{"any", "", "1.1.0"},
+		// The heaviest selected version, even without weight.
+		{"any", "env=prod", "1.0.0"},
+		{"1.1.0", "env in (staging, prod)", "1.1.0"},
+	}
+
+	for _, tt := range tests {
+		selector, err := parseLabelSelector(tt.selector)
+		if err != nil {
+			t.Fatalf("parseLabelSelector(%q): %v", tt.selector, err)
+		}
+
+		version, err := s.resolveVersion(ctx, orn.VersionORN{Package: "button", Version: tt.version}, "", selector)
+		if err != nil || version.GetName() != tt.want {
+			t.Errorf("resolveVersion(%q, %q) = %v, %v, want %s", tt.version, tt.selector, version, err, tt.want)
+		}
+	}
+
+	// The selector hides the versions it does not select, even by name.
+	selector, _ := parseLabelSelector("env=prod")
+	if _, err := s.resolveVersion(ctx, orn.VersionORN{Package: "button", Version: "1.1.0"}, "", selector); !errors.Is(err, repository.ErrVersionNotFound) {
+		t.Errorf("resolveVersion of a version the selector hides = %v, want ErrVersionNotFound", err)
+	}
+
+	if _, err := parseLabelSelector("env in (prod"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("parseLabelSelector of a malformed selector = %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,500 @@
+package server
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/orn"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+const (
+	// maxRolloutSteps bounds the size of a rollout plan.
+	maxRolloutSteps = 100
+	// rolloutSchedulerSubject is the actor of the audit events of the steps
+	// applied by the RolloutScheduler.
+	rolloutSchedulerSubject = "rollout-scheduler"
+	defaultRolloutInterval  = 10 * time.Second
+)
+
+type StartRolloutRequest struct {
+	PackageOrn string
+	Version    string
+	// Steps are applied in order, e.g. 5% now, 25% after 30m, 50% after 2h
+	// and 100% after 24h.
+	Steps []repository.RolloutStep
+}
+
+type GetRolloutRequest struct {
+	ID string
+}
+
+type ListRolloutsRequest struct {
+	PackageOrn string
+}
+
+type PauseRolloutRequest struct {
+	ID string
+}
+
+type ResumeRolloutRequest struct {
+	ID string
+}
+
+type AbortRolloutRequest struct {
+	ID string
+}
+
+// StartRollout starts moving traffic to a version according to a plan. The
+// steps are applied by the RolloutScheduler, a step that is due right away is
+// applied before StartRollout returns.
+func (s *Server) StartRollout(ctx context.Context, request *StartRolloutRequest) (*repository.Rollout, error) {
+	packageOrn, err := orn.ParsePackage(request.PackageOrn)
+	if err != nil {
+		return nil, invalidArgument("package_orn", err)
+	}
+
+	versionOrn, err := orn.NewVersionORN(packageOrn.Package, request.Version)
+	if err != nil {
+		return nil, invalidArgument("version", err)
+	}
+
+	if err := validateRolloutSteps(request.Steps); err != nil {
+		return nil, invalidArgument("steps", err)
+	}
+
+	if err := s.authorize(ctx, packageOrn.Package, auth.RolePublisher); err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	versions, err := s.repo.ListVersions(ctx, packageOrn.Package)
+	if err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	baseline := map[string]uint32{}
+	for _, version := range versions {
+		baseline[version.GetName()] = version.GetWeight()
+	}
+
+	if _, ok := baseline[versionOrn.Version]; !ok {
+		return nil, s.statusError(errors.Wrapf(repository.ErrVersionNotFound, "version %s of package %s", versionOrn.Version, versionOrn.Package), versionResourceType, versionOrn.String())
+	}
+
+	auditCtx := withAudit(ctx, "StartRollout", versionOrn.String(), packageOrn.Package, nil, savedRolloutFields)
+	rollout, err := s.repo.CreateRollout(auditCtx, &repository.Rollout{
+		Package:    packageOrn.Package,
+		Version:    versionOrn.Version,
+		Steps:      request.Steps,
+		Baseline:   baseline,
+		State:      repository.RolloutRunning,
+		Step:       -1,
+		NextStepAt: time.Now().Add(request.Steps[0].After),
+	})
+	if err != nil {
+		return nil, s.statusError(err, rolloutResourceType, versionOrn.String())
+	}
+
+	s.rolloutWatchers.publish(&RolloutEvent{Rollout: rollout, Time: rollout.CreatedAt})
+
+	if !rollout.NextStepAt.After(time.Now()) {
+		return s.advanceRollout(ctx, rollout)
+	}
+
+	return rollout, nil
+}
+
+func (s *Server) GetRollout(ctx context.Context, request *GetRolloutRequest) (*repository.Rollout, error) {
+	rollout, err := s.repo.GetRollout(ctx, request.ID)
+	if err != nil {
+		return nil, s.statusError(err, rolloutResourceType, request.ID)
+	}
+
+	if err := s.authorize(ctx, rollout.Package, auth.RoleReader); err != nil {
+		return nil, s.statusError(err, rolloutResourceType, request.ID)
+	}
+
+	return rollout, nil
+}
+
+func (s *Server) ListRollouts(ctx context.Context, request *ListRolloutsRequest) ([]*repository.Rollout, error) {
+	packageOrn, err := orn.ParsePackage(request.PackageOrn)
+	if err != nil {
+		return nil, invalidArgument("package_orn", err)
+	}
+
+	if err := s.authorize(ctx, packageOrn.Package, auth.RoleReader); err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	rollouts, err := s.repo.ListRollouts(ctx, packageOrn.Package)
+	if err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	return rollouts, nil
+}
+
+// PauseRollout stops a running rollout from advancing. The weights of the
+// applied steps stay in place.
+func (s *Server) PauseRollout(ctx context.Context, request *PauseRolloutRequest) (*repository.Rollout, error) {
+	rollout, err := s.changeRollout(ctx, "PauseRollout", request.ID, func(rollout *repository.Rollout) error {
+		if rollout.State != repository.RolloutRunning {
+			return errors.Wrapf(repository.ErrPrecondition, "rollout %s is %s, not running", rollout.ID, rollout.State)
+		}
+
+		rollout.State = repository.RolloutPaused
+		rollout.PausedAt = time.Now()
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.rolloutWatchers.publish(&RolloutEvent{Rollout: rollout, Time: rollout.UpdatedAt})
+
+	return rollout, nil
+}
+
+// ResumeRollout continues a paused rollout. The time spent paused is added to
+// the schedule of the remaining steps.
+func (s *Server) ResumeRollout(ctx context.Context, request *ResumeRolloutRequest) (*repository.Rollout, error) {
+	rollout, err := s.changeRollout(ctx, "ResumeRollout", request.ID, func(rollout *repository.Rollout) error {
+		if rollout.State != repository.RolloutPaused {
+			return errors.Wrapf(repository.ErrPrecondition, "rollout %s is %s, not paused", rollout.ID, rollout.State)
+		}
+
+		rollout.State = repository.RolloutRunning
+		rollout.NextStepAt = rollout.NextStepAt.Add(time.Since(rollout.PausedAt))
+		rollout.PausedAt = time.Time{}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.rolloutWatchers.publish(&RolloutEvent{Rollout: rollout, Time: rollout.UpdatedAt})
+
+	if !rollout.NextStepAt.After(time.Now()) {
+		return s.advanceRollout(ctx, rollout)
+	}
+
+	return rollout, nil
+}
+
+// AbortRollout stops an active rollout and restores the weights the versions
+// had before it started.
+func (s *Server) AbortRollout(ctx context.Context, request *AbortRolloutRequest) (*repository.Rollout, error) {
+	rollout, err := s.changeRollout(ctx, "AbortRollout", request.ID, func(rollout *repository.Rollout) error {
+		if !rollout.State.IsActive() {
+			return errors.Wrapf(repository.ErrPrecondition, "rollout %s is already %s", rollout.ID, rollout.State)
+		}
+
+		rollout.State = repository.RolloutAborted
+		rollout.NextStepAt = time.Time{}
+		rollout.PausedAt = time.Time{}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := s.repo.ListVersions(ctx, rollout.Package)
+	if err != nil {
+		return nil, s.statusError(err, rolloutResourceType, rollout.ID)
+	}
+
+	weights := map[string]uint32{}
+	for _, version := range versions {
+		weights[version.GetName()] = rollout.Baseline[version.GetName()]
+	}
+
+	if _, err := s.repo.SetPackageWeights(ctx, rollout.Package, weights); err != nil {
+		s.rolloutWatchers.publish(&RolloutEvent{Rollout: rollout, Time: rollout.UpdatedAt})
+
+		return nil, s.statusError(err, rolloutResourceType, rollout.ID)
+	}
+
+	// The event carries the restored weights, a watcher ignores a second
+	// event of the same revision.
+	s.rolloutWatchers.publish(&RolloutEvent{Rollout: rollout, Weights: weights, Time: time.Now()})
+	s.wakeOutboxRelay()
+
+	return rollout, nil
+}
+
+// changeRollout applies change to a rollout after checking that the caller
+// can publish to its package, and records the result. The caller publishes
+// the event of the change.
+func (s *Server) changeRollout(ctx context.Context, method, id string, change func(rollout *repository.Rollout) error) (*repository.Rollout, error) {
+	rollout, err := s.repo.GetRollout(ctx, id)
+	if err != nil {
+		return nil, s.statusError(err, rolloutResourceType, id)
+	}
+
+	if err := s.authorize(ctx, rollout.Package, auth.RolePublisher); err != nil {
+		return nil, s.statusError(err, rolloutResourceType, id)
+	}
+
+	before := rolloutFields(rollout)
+
+	if err := change(rollout); err != nil {
+		return nil, s.statusError(err, rolloutResourceType, id)
+	}
+
+	auditCtx := withAudit(ctx, method, rolloutOrn(rollout), rollout.Package, before, savedRolloutFields)
+	rollout, err = s.repo.UpdateRollout(auditCtx, rollout)
+	if err != nil {
+		return nil, s.statusError(err, rolloutResourceType, id)
+	}
+
+	return rollout, nil
+}
+
+// advanceRollout applies the next step of a due rollout. The rollout is
+// updated before the weights, so that a rollout paused or aborted in the
+// meantime makes the update fail with a conflict instead of applying a stale
+// step. When the weights can not be applied, the rollout is paused at the
+// previous step.
+func (s *Server) advanceRollout(ctx context.Context, rollout *repository.Rollout) (*repository.Rollout, error) {
+	before := rolloutFields(rollout)
+	next := rollout.Step + 1
+
+	weights, err := s.rolloutWeights(ctx, rollout, rollout.Steps[next].Weight)
+	if err != nil {
+		return nil, s.statusError(err, rolloutResourceType, rollout.ID)
+	}
+
+	advanced := *rollout
+	advanced.Step = next
+	if next == len(rollout.Steps)-1 {
+		advanced.State = repository.RolloutCompleted
+		advanced.NextStepAt = time.Time{}
+	} else {
+		advanced.NextStepAt = rollout.NextStepAt.Add(rollout.Steps[next+1].After - rollout.Steps[next].After)
+	}
+
+	saved, err := s.repo.UpdateRollout(ctx, &advanced)
+	if err != nil {
+		return nil, s.statusError(err, rolloutResourceType, rollout.ID)
+	}
+
+	// The step is recorded with its weights, since it is undone when they can
+	// not be applied.
+	auditCtx := withAudit(ctx, "AdvanceRollout", rolloutOrn(saved), saved.Package, before, func(interface{}) map[string]interface{} {
+		return rolloutFields(saved)
+	})
+
+	if _, err := s.repo.SetPackageWeights(auditCtx, rollout.Package, weights); err != nil {
+		saved.State = repository.RolloutPaused
+		saved.Step = rollout.Step
+		saved.NextStepAt = rollout.NextStepAt
+		saved.PausedAt = time.Now()
+
+		if paused, pauseErr := s.repo.UpdateRollout(ctx, saved); pauseErr == nil {
+			s.rolloutWatchers.publish(&RolloutEvent{Rollout: paused, Time: paused.UpdatedAt})
+		}
+
+		return nil, s.statusError(err, rolloutResourceType, rollout.ID)
+	}
+
+	s.rolloutWatchers.publish(&RolloutEvent{Rollout: saved, Weights: weights, Time: saved.UpdatedAt})
+	s.wakeOutboxRelay()
+
+	return saved, nil
+}
+
+// advanceDueRollouts applies the next step of every running rollout that is
+// due. Errors are logged so that one broken rollout does not hold back the
+// others.
+func (s *Server) advanceDueRollouts(ctx context.Context) {
+	rollouts, err := s.repo.ListDueRollouts(ctx, time.Now())
+	if err != nil {
+		s.logger.Error("failed to list due rollouts", zap.Error(err))
+		return
+	}
+
+	for _, rollout := range rollouts {
+		if _, err := s.advanceRollout(ctx, rollout); err != nil {
+			s.logger.Error("failed to advance rollout", zap.String("rollout", rollout.ID), zap.Error(err))
+		}
+	}
+}
+
+// rolloutWeights gives weight percent of the traffic to the version of the
+// rollout, and shares the rest between the other live versions in the
+// proportions of their baseline weights. When none of them had a weight, the
+// traffic went to the heaviest version, which keeps the rest of it.
+func (s *Server) rolloutWeights(ctx context.Context, rollout *repository.Rollout, weight uint32) (map[string]uint32, error) {
+	versions, err := s.repo.ListVersions(ctx, rollout.Package)
+	if err != nil {
+		return nil, err
+	}
+
+	weights := map[string]uint32{}
+	var others []string
+	var baselineSum uint64
+	for _, version := range versions {
+		name := version.GetName()
+		if name == rollout.Version {
+			weights[name] = weight
+			continue
+		}
+
+		weights[name] = 0
+		others = append(others, name)
+		baselineSum += uint64(rollout.Baseline[name])
+	}
+
+	if _, ok := weights[rollout.Version]; !ok {
+		return nil, errors.Wrapf(repository.ErrVersionNotFound, "version %s of package %s", rollout.Version, rollout.Package)
+	}
+
+	if baselineSum == 0 {
+		// versions are heaviest first.
+		if len(others) > 0 {
+			weights[others[0]] = 100 - weight
+		}
+
+		return weights, nil
+	}
+
+	// Largest remainder method, so that the shares add up to exactly the
+	// remaining traffic.
+	remaining := uint64(100 - weight)
+	remainders := map[string]uint64{}
+	var assigned uint64
+	for _, name := range others {
+		share := remaining * uint64(rollout.Baseline[name])
+		weights[name] = uint32(share / baselineSum)
+		remainders[name] = share % baselineSum
+		assigned += share / baselineSum
+	}
+
+	sort.SliceStable(others, func(i, j int) bool {
+		if remainders[others[i]] != remainders[others[j]] {
+			return remainders[others[i]] > remainders[others[j]]
+		}
+
+		return others[i] < others[j]
+	})
+
+	for i := 0; assigned < remaining; i++ {
+		weights[others[i]]++
+		assigned++
+	}
+
+	return weights, nil
+}
+
+func validateRolloutSteps(steps []repository.RolloutStep) error {
+	if len(steps) == 0 {
+		return errors.New("a rollout needs at least one step")
+	}
+
+	if len(steps) > maxRolloutSteps {
+		return errors.Errorf("a rollout has at most %d steps", maxRolloutSteps)
+	}
+
+	for i, step := range steps {
+		if step.Weight > 100 {
+			return errors.Errorf("step %d: weight %d is more than 100%%", i, step.Weight)
+		}
+
+		if step.After < 0 {
+			return errors.Errorf("step %d: after must not be negative", i)
+		}
+
+		if i > 0 && step.After < steps[i-1].After {
+			return errors.Errorf("step %d: steps must be in the order of their time", i)
+		}
+	}
+
+	return nil
+}
+
+func rolloutOrn(rollout *repository.Rollout) string {
+	return orn.VersionORN{Package: rollout.Package, Version: rollout.Version}.String()
+}
+
+func savedRolloutFields(saved interface{}) map[string]interface{} {
+	rollout, _ := saved.(*repository.Rollout)
+
+	return rolloutFields(rollout)
+}
+
+func rolloutFields(rollout *repository.Rollout) map[string]interface{} {
+	if rollout == nil {
+		return nil
+	}
+
+	fields := map[string]interface{}{
+		"id":      rollout.ID,
+		"version": rollout.Version,
+		"state":   string(rollout.State),
+		"step":    rollout.Step,
+	}
+
+	if rollout.Step >= 0 && rollout.Step < len(rollout.Steps) {
+		fields["weight"] = rollout.Steps[rollout.Step].Weight
+	}
+
+	return fields
+}
+
+// RolloutScheduler applies the due steps of running rollouts every
+// ROLLOUT_INTERVAL, ten seconds by default. Every process runs one, the
+// revision of a rollout keeps a step from being applied twice.
+type RolloutScheduler struct {
+	logger   *zap.Logger
+	server   *Server
+	interval time.Duration
+}
+
+func NewRolloutScheduler(logger *zap.Logger, server *Server) (*RolloutScheduler, error) {
+	scheduler := &RolloutScheduler{
+		logger:   logger,
+		server:   server,
+		interval: defaultRolloutInterval,
+	}
+
+	if value := os.Getenv("ROLLOUT_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid ROLLOUT_INTERVAL")
+		}
+
+		if interval <= 0 {
+			return nil, errors.New("ROLLOUT_INTERVAL must be positive")
+		}
+
+		scheduler.interval = interval
+	}
+
+	return scheduler, nil
+}
+
+// Run advances the due rollouts on every interval until ctx is done.
+func (r *RolloutScheduler) Run(ctx context.Context) {
+	ctx = auth.NewContext(ctx, &auth.Principal{Subject: rolloutSchedulerSubject})
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.server.advanceDueRollouts(ctx)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+const (
+	// rolloutWatchPoll is how often WatchRollout reads the rollout, to notice
+	// the changes made by other processes.
+	rolloutWatchPoll = 5 * time.Second
+	// rolloutEventBuffer is the number of events kept for a slow watcher,
+	// later events are dropped until it catches up with the next poll.
+	rolloutEventBuffer = 16
+)
+
+// RolloutEvent reports a change of a rollout.
+type RolloutEvent struct {
+	Rollout *repository.Rollout
+	// Weights are the version weights applied with the change, nil when the
+	// weights did not change.
+	Weights map[string]uint32
+	Time    time.Time
+}
+
+type WatchRolloutRequest struct {
+	ID string
+}
+
+// WatchRollout sends the current state of a rollout and then an event for
+// every change, until the rollout is completed or aborted or ctx is done.
+func (s *Server) WatchRollout(ctx context.Context, request *WatchRolloutRequest, send func(event *RolloutEvent) error) error {
+	events, unsubscribe := s.rolloutWatchers.subscribe(request.ID)
+	defer unsubscribe()
+
+	rollout, err := s.GetRollout(ctx, &GetRolloutRequest{ID: request.ID})
+	if err != nil {
+		return err
+	}
+
+	if err := send(&RolloutEvent{Rollout: rollout, Time: time.Now()}); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(rolloutWatchPoll)
+	defer ticker.Stop()
+
+	revision := rollout.Revision
+	for rollout.State.IsActive() {
+		var event *RolloutEvent
+
+		select {
+		case <-ctx.Done():
+			return s.statusError(ctx.Err(), rolloutResourceType, request.ID)
+		case event = <-events:
+		case <-ticker.C:
+			polled, err := s.repo.GetRollout(ctx, request.ID)
+			if err != nil {
+				return s.statusError(err, rolloutResourceType, request.ID)
+			}
+
+			event = &RolloutEvent{Rollout: polled, Time: time.Now()}
+		}
+
+		if event.Rollout.Revision <= revision {
+			continue
+		}
+
+		if err := send(event); err != nil {
+			return err
+		}
+
+		rollout, revision = event.Rollout, event.Rollout.Revision
+	}
+
+	return nil
+}
+
+// rolloutWatchers fans the events of rollouts out to the WatchRollout calls of
+// this process.
+type rolloutWatchers struct {
+	mu       sync.Mutex
+	watchers map[string]map[chan *RolloutEvent]struct{}
+}
+
+func newRolloutWatchers() *rolloutWatchers {
+	return &rolloutWatchers{
+		watchers: map[string]map[chan *RolloutEvent]struct{}{},
+	}
+}
+
+func (w *rolloutWatchers) subscribe(id string) (<-chan *RolloutEvent, func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	events := make(chan *RolloutEvent, rolloutEventBuffer)
+	if w.watchers[id] == nil {
+		w.watchers[id] = map[chan *RolloutEvent]struct{}{}
+	}
+	w.watchers[id][events] = struct{}{}
+
+	return events, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		delete(w.watchers[id], events)
+		if len(w.watchers[id]) == 0 {
+			delete(w.watchers, id)
+		}
+	}
+}
+
+// publish never blocks, an event is dropped for a watcher whose buffer is full.
+func (w *rolloutWatchers) publish(event *RolloutEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for events := range w.watchers[event.Rollout.ID] {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
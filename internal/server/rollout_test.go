@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+func TestRolloutWeights(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions map[string]uint32
+		baseline map[string]uint32
+		weight   uint32
+		want     map[string]uint32
+	}{
+		{
+			name:     "baseline proportions",
+			versions: map[string]uint32{"1.0.0": 60, "1.1.0": 30, "2.0.0": 0},
+			baseline: map[string]uint32{"1.0.0": 60, "1.1.0": 30, "2.0.0": 0},
+			weight:   25,
+			want:     map[string]uint32{"1.0.0": 50, "1.1.0": 25, "2.0.0": 25},
+		},
+		{
+			name:     "remainders add up to 100",
+			versions: map[string]uint32{"1.0.0": 1, "1.1.0": 1, "1.2.0": 1, "2.0.0": 0},
+			baseline: map[string]uint32{"1.0.0": 1, "1.1.0": 1, "1.2.0": 1, "2.0.0": 0},
+			weight:   0,
+			want:     map[string]uint32{"1.0.0": 34, "1.1.0": 33, "1.2.0": 33, "2.0.0": 0},
+		},
+		{
+			name:     "no baseline weight",
+			versions: map[string]uint32{"1.0.0": 0, "1.1.0": 0, "2.0.0": 0},
+			baseline: map[string]uint32{"1.0.0": 0, "1.1.0": 0, "2.0.0": 0},
+			weight:   10,
+			want:     map[string]uint32{"1.0.0": 90, "1.1.0": 0, "2.0.0": 10},
+		},
+		{
+			name:     "no baseline weight, heaviest now",
+			versions: map[string]uint32{"1.0.0": 0, "1.1.0": 5, "2.0.0": 0},
+			baseline: map[string]uint32{"1.0.0": 0, "1.1.0": 0, "2.0.0": 0},
+			weight:   40,
+			want:     map[string]uint32{"1.0.0": 0, "1.1.0": 60, "2.0.0": 40},
+		},
+		{
+			name:     "only the rollout version",
+			versions: map[string]uint32{"2.0.0": 0},
+			baseline: map[string]uint32{"2.0.0": 0},
+			weight:   10,
+			want:     map[string]uint32{"2.0.0": 10},
+		},
+	}
+
+	for _, test := range tests {
+		s, repo := newTestServer(t)
+		ctx := context.Background()
+
+		if _, err := repo.CreatePackage(ctx, &polvo_v1.Package{Name: "button"}, nil); err != nil {
+			t.Fatalf("CreatePackage: %v", err)
+		}
+
+		// Versions are created in name order, the oldest wins ties.
+		for _, name := range []string{"1.0.0", "1.1.0", "1.2.0", "2.0.0"} {
+			weight, ok := test.versions[name]
+			if !ok {
+				continue
+			}
+
+			if _, err := repo.CreateVersion(ctx, "button", &polvo_v1.Version{Name: name, Weight: weight}, nil, nil); err != nil {
+				t.Fatalf("CreateVersion: %v", err)
+			}
+		}
+
+		rollout := &repository.Rollout{Package: "button", Version: "2.0.0", Baseline: test.baseline}
+		weights, err := s.rolloutWeights(ctx, rollout, test.weight)
+		if err != nil {
+			t.Fatalf("%s: rolloutWeights: %v", test.name, err)
+		}
+
+		if len(weights) != len(test.want) {
+			t.Errorf("%s: rolloutWeights = %v, want %v", test.name, weights, test.want)
+			continue
+		}
+
+		for name, weight := range test.want {
+			if weights[name] != weight {
+				t.Errorf("%s: rolloutWeights = %v, want %v", test.name, weights, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestRolloutLifecycle(t *testing.T) {
+	s, repo := newTestServer(t)
+	ctx := context.Background()
+
+	if _, err := repo.CreatePackage(ctx, &polvo_v1.Package{Name: "button"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	for name, weight := range map[string]uint32{"1.0.0": 100, "2.0.0": 0} {
+		if _, err := repo.CreateVersion(ctx, "button", &polvo_v1.Version{Name: name, Weight: weight}, nil, nil); err != nil {
+			t.Fatalf("CreateVersion: %v", err)
+		}
+	}
+
+	for _, steps := range [][]repository.RolloutStep{
+		nil,
+		{{Weight: 101}},
+		{{Weight: 10, After: -time.Second}},
+		{{Weight: 10, After: time.Hour}, {Weight: 20, After: time.Minute}},
+	} {
+		if _, err := s.StartRollout(ctx, &StartRolloutRequest{PackageOrn: "packages/button", Version: "2.0.0", Steps: steps}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("StartRollout with the steps %v = %v, want InvalidArgument", steps, err)
+		}
+	}
+
+	// A first step due at once is applied by StartRollout.
+	rollout, err := s.StartRollout(ctx, &StartRolloutRequest{
+		PackageOrn: "packages/button",
+		Version:    "2.0.0",
+		Steps:      []repository.RolloutStep{{Weight: 10}, {Weight: 100, After: time.Hour}},
+	})
+	if err != nil {
+		t.Fatalf("StartRollout: %v", err)
+	}
+
+	if rollout.Step != 0 || rollout.State != repository.RolloutRunning {
+		t.Errorf("StartRollout = %+v, want the first step applied", rollout)
+	}
+
+	if version, _ := repo.GetVersion(ctx, "button", "2.0.0"); version.GetWeight() != 10 {
+		t.Errorf("weight of 2.0.0 = %d, want 10", version.GetWeight())
+	}
+
+	if _, err := s.StartRollout(ctx, &StartRolloutRequest{PackageOrn: "packages/button", Version: "1.0.0", Steps: []repository.RolloutStep{{Weight: 10}}}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("StartRollout of a second rollout = %v, want AlreadyExists", err)
+	}
+
+	if _, err := s.ResumeRollout(ctx, &ResumeRolloutRequest{ID: rollout.ID}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("ResumeRollout of a running rollout = %v, want FailedPrecondition", err)
+	}
+
+	if paused, err := s.PauseRollout(ctx, &PauseRolloutRequest{ID: rollout.ID}); err != nil || paused.State != repository.RolloutPaused {
+		t.Fatalf("PauseRollout = %+v, %v", paused, err)
+	}
+
+	if resumed, err := s.ResumeRollout(ctx, &ResumeRolloutRequest{ID: rollout.ID}); err != nil || resumed.State != repository.RolloutRunning {
+		t.Fatalf("ResumeRollout = %+v, %v", resumed, err)
+	}
+
+	aborted, err := s.AbortRollout(ctx, &AbortRolloutRequest{ID: rollout.ID})
+	if err != nil || aborted.State != repository.RolloutAborted {
+		t.Fatalf("AbortRollout = %+v, %v", aborted, err)
+	}
+
+	for name, weight := range map[string]uint32{"1.0.0": 100, "2.0.0": 0} {
+		if version, _ := repo.GetVersion(ctx, "button", name); version.GetWeight() != weight {
+			t.Errorf("weight of %s after the abort = %d, want %d", name, version.GetWeight(), weight)
+		}
+	}
+
+	if _, err := s.GetRollout(ctx, &GetRolloutRequest{ID: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetRollout(missing) = %v, want NotFound", err)
+	}
+}
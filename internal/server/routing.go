@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/orn"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+type ListRoutingRevisionsRequest struct {
+	Orn string
+}
+
+type RollbackPackageRequest struct {
+	Orn string
+	// Revision is the routing revision to restore, as returned by
+	// ListRoutingRevisions.
+	Revision int64
+}
+
+func (s *Server) ListRoutingRevisions(ctx context.Context, request *ListRoutingRevisionsRequest) ([]*repository.RoutingRevision, error) {
+	packageOrn, err := orn.ParsePackage(request.Orn)
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
+
+	if err := s.authorize(ctx, packageOrn.Package, auth.RoleReader); err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	revisions, err := s.repo.ListRoutingRevisions(ctx, packageOrn.Package)
+	if err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	return revisions, nil
+}
+
+// RollbackPackage restores the manifest and weight of every version of the
+// package to a routing revision. The restored state is recorded as a new
+// revision, so a rollback can itself be rolled back.
+func (s *Server) RollbackPackage(ctx context.Context, request *RollbackPackageRequest) (*repository.RoutingRevision, error) {
+	packageOrn, err := orn.ParsePackage(request.Orn)
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
+
+	if request.Revision < 1 {
+		return nil, invalidArgument("revision", errors.New("revision must be positive"))
+	}
+
+	if err := s.authorize(ctx, packageOrn.Package, auth.RolePublisher); err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	previous, err := s.latestRoutingRevision(ctx, packageOrn.Package)
+	if err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	auditCtx := withAudit(ctx, "RollbackPackage", packageOrn.String(), packageOrn.Package, routingFields(previous), func(saved interface{}) map[string]interface{} {
+		after := savedRoutingFields(saved)
+		after["restored_revision"] = request.Revision
+
+		return after
+	})
+
+	revision, err := s.repo.RollbackPackage(auditCtx, packageOrn.Package, request.Revision)
+	if err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	s.wakeOutboxRelay()
+
+	return revision, nil
+}
+
+type SetPackageWeightsRequest struct {
+	Orn string
+	// Weights maps version names to their new weight. Versions of the package
+	// that are not in the map get no weight.
+	Weights map[string]uint32
+	// Percentage requires the weights to sum to 100.
+	Percentage bool
+}
+
+// SetPackageWeights replaces the weights of all versions of a package at once,
+// so traffic never goes through a mix of old and new weights.
+func (s *Server) SetPackageWeights(ctx context.Context, request *SetPackageWeightsRequest) (*repository.RoutingRevision, error) {
+	packageOrn, err := orn.ParsePackage(request.Orn)
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
+
+	if err := validateWeights(request.Weights, request.Percentage); err != nil {
+		return nil, invalidArgument("weights", err)
+	}
+
+	if err := s.authorize(ctx, packageOrn.Package, auth.RolePublisher); err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	previous, err := s.latestRoutingRevision(ctx, packageOrn.Package)
+	if err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	auditCtx := withAudit(ctx, "SetPackageWeights", packageOrn.String(), packageOrn.Package, routingFields(previous), savedRoutingFields)
+	revision, err := s.repo.SetPackageWeights(auditCtx, packageOrn.Package, request.Weights)
+	if err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	s.wakeOutboxRelay()
+
+	return revision, nil
+}
+
+func validateWeights(weights map[string]uint32, percentage bool) error {
+	if len(weights) == 0 {
+		return errors.New("at least one version needs a weight")
+	}
+
+	var sum uint64
+	for name, weight := range weights {
+		if err := orn.ValidateVersionName(name); err != nil {
+			return errors.Wrapf(err, "version %s", name)
+		}
+
+		sum += uint64(weight)
+	}
+
+	if percentage && sum != 100 {
+		return errors.Errorf("weights sum to %d instead of 100", sum)
+	}
+
+	return nil
+}
+
+// latestRoutingRevision reads the latest routing revision of a package, nil
+// when it has none.
+func (s *Server) latestRoutingRevision(ctx context.Context, packageName string) (*repository.RoutingRevision, error) {
+	revisions, err := s.repo.ListRoutingRevisions(ctx, packageName)
+	if err != nil || len(revisions) == 0 {
+		return nil, err
+	}
+
+	return revisions[0], nil
+}
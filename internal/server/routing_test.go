@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+)
+
+func TestRollbackPackage(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestServer(t)
+
+	if _, err := repo.CreatePackage(ctx, &polvo_v1.Package{Name: "button"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	for name, weight := range map[string]uint32{"1.0.0": 100, "2.0.0": 0} {
+		if _, err := repo.CreateVersion(ctx, "button", &polvo_v1.Version{Name: name, Weight: weight}, nil, nil); err != nil {
+			t.Fatalf("CreateVersion(%q): %v", name, err)
+		}
+	}
+
+	for _, request := range []*RollbackPackageRequest{
+		{Orn: "packages/button", Revision: 0},
+		{Orn: "packages/button/versions/1.0.0", Revision: 1},
+	} {
+		if _, err := s.RollbackPackage(ctx, request); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("RollbackPackage(%+v) = %v, want InvalidArgument", request, err)
+		}
+	}
+
+	if _, err := s.RollbackPackage(ctx, &RollbackPackageRequest{Orn: "packages/button", Revision: 42}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("RollbackPackage to a missing revision = %v, want FailedPrecondition", err)
+	}
+
+	revision, err := s.RollbackPackage(ctx, &RollbackPackageRequest{Orn: "packages/button", Revision: 1})
+	if err != nil {
+		t.Fatalf("RollbackPackage: %v", err)
+	}
+
+	if len(revision.Entries) != 2 || revision.Entries[1].Version != "2.0.0" || revision.Entries[1].Weight != 0 {
+		t.Errorf("RollbackPackage = %+v, want 2.0.0 without weight", revision)
+	}
+
+	page, err := s.ListAuditEvents(ctx, &ListAuditEventsRequest{PackageOrn: "packages/button"})
+	if err != nil || len(page.Events) != 1 || page.Events[0].After["restored_revision"] != int64(1) {
+		t.Errorf("audit events = %+v, %v, want the rollback", page, err)
+	}
+}
+
+func TestSetPackageWeightsValidatesTheWeights(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestServer(t)
+
+	if _, err := repo.CreatePackage(ctx, &polvo_v1.Package{Name: "button"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	for _, name := range []string{"1.0.0", "2.0.0"} {
+		if _, err := repo.CreateVersion(ctx, "button", &polvo_v1.Version{Name: name}, nil, nil); err != nil {
+			t.Fatalf("CreateVersion(%q): %v", name, err)
+		}
+	}
+
+	for _, request := range []*SetPackageWeightsRequest{
+		{Orn: "packages/button"},
+		{Orn: "packages/button", Weights: map[string]uint32{"1.0.0/x": 100}},
+		{Orn: "packages/button", Weights: map[string]uint32{"1.0.0": 60, "2.0.0": 60}, Percentage: true},
+	} {
+		if _, err := s.SetPackageWeights(ctx, request); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("SetPackageWeights(%v) = %v, want InvalidArgument", request.Weights, err)
+		}
+	}
+
+	if _, err := s.SetPackageWeights(ctx, &SetPackageWeightsRequest{Orn: "packages/button", Weights: map[string]uint32{"3.0.0": 100}}); status.Code(err) != codes.NotFound {
+		t.Errorf("SetPackageWeights of a missing version = %v, want NotFound", err)
+	}
+
+	revision, err := s.SetPackageWeights(ctx, &SetPackageWeightsRequest{Orn: "packages/button", Weights: map[string]uint32{"1.0.0": 40, "2.0.0": 60}, Percentage: true})
+	if err != nil {
+		t.Fatalf("SetPackageWeights: %v", err)
+	}
+
+	if revision.Entries[0].Weight != 40 || revision.Entries[1].Weight != 60 {
+		t.Errorf("SetPackageWeights = %+v", revision.Entries)
+	}
+}
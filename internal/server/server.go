@@ -2,7 +2,6 @@ package server
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/google/wire"
 	fieldmask_utils "github.com/mennanov/fieldmask-utils"
@@ -11,10 +10,12 @@ import (
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/manifest"
+	"pkg.aiocean.dev/polvoservice/internal/orn"
 	"pkg.aiocean.dev/polvoservice/internal/repository"
+	"pkg.aiocean.dev/polvoservice/internal/traffic"
 	"pkg.aiocean.dev/serviceutil/handler"
 )
 
@@ -28,15 +29,34 @@ var defaultVersions = map[string]string{
 }
 
 type Server struct {
-	logger *zap.Logger
-	repo   repository.Repository
+	logger    *zap.Logger
+	repo      repository.Repository
+	auth      *auth.Authenticator
+	manifests *manifest.Validator
+	splitter  *traffic.Splitter
+	// rolloutWatchers receives the rollout events of this process.
+	rolloutWatchers *rolloutWatchers
+	// changes receives the change events read from the outbox by the
+	// ChangeFeed of this process.
+	changes *changeBus
+	// outboxChanged wakes the OutboxRelay after a mutation, feedChanged the
+	// ChangeFeed.
+	outboxChanged chan struct{}
+	feedChanged   chan struct{}
 	polvo_v1.UnimplementedPolvoServiceServer
 }
 
-func NewServer(logger *zap.Logger, repo repository.Repository) *Server {
+func NewServer(logger *zap.Logger, repo repository.Repository, authenticator *auth.Authenticator, manifests *manifest.Validator) *Server {
 	return &Server{
-		logger: logger,
-		repo:   repo,
+		logger:          logger,
+		repo:            repo,
+		auth:            authenticator,
+		manifests:       manifests,
+		splitter:        traffic.NewSplitter(),
+		rolloutWatchers: newRolloutWatchers(),
+		changes:         newChangeBus(),
+		outboxChanged:   make(chan struct{}, 1),
+		feedChanged:     make(chan struct{}, 1),
 	}
 }
 
@@ -47,26 +67,46 @@ func (s *Server) Register(grpcServer *grpc.Server) {
 
 func (s *Server) CreatePackage(request *polvo_v1.CreatePackageRequest, stream polvo_v1.PolvoService_CreatePackageServer) error {
 
-	isPackageExist, err := s.repo.IsPackageExists(stream.Context(), request.GetPackage().GetName())
+	packageOrn, err := orn.NewPackageORN(request.GetPackage().GetName())
 	if err != nil {
-		return errors.New("Can not check of package")
+		return invalidArgument("package.name", err)
+	}
+
+	packageMetadata, err := packageMetadataFromContext(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	isPackageExist, err := s.repo.IsPackageExists(stream.Context(), packageOrn.Package)
+	if err != nil {
+		return s.statusError(err, packageResourceType, packageOrn.String())
 	}
 
 	if isPackageExist {
-		return status.Error(codes.AlreadyExists, "package is already exists")
+		return s.statusError(errors.Wrapf(repository.ErrAlreadyExists, "package %s", packageOrn.Package), packageResourceType, packageOrn.String())
+	}
+
+	if err := s.authorizeNewPackage(stream.Context(), request.GetPackage()); err != nil {
+		return err
 	}
 
-	savedPackage, err := s.repo.CreatePackage(stream.Context(), request.GetPackage())
+	auditCtx := withAudit(stream.Context(), "CreatePackage", packageOrn.String(), packageOrn.Package, nil, func(saved interface{}) map[string]interface{} {
+		return packageDetailsFields(&repository.PackageDetails{Package: saved.(*polvo_v1.Package), Metadata: packageMetadata})
+	})
+
+	savedPackage, err := s.repo.CreatePackage(auditCtx, request.GetPackage(), &packageMetadata)
 	if  err != nil {
-		return errors.Wrap(err, "failed to get package")
+		return s.statusError(err, packageResourceType, packageOrn.String())
 	}
 
+	s.wakeOutboxRelay()
+
 	response := &polvo_v1.CreatePackageResponse{
 		Package: savedPackage,
 	}
 
 	if err := stream.Send(response); err != nil {
-		return errors.Wrap(err, "failed to send response")
+		return err
 	}
 
 	return nil
@@ -74,27 +114,40 @@ func (s *Server) CreatePackage(request *polvo_v1.CreatePackageRequest, stream po
 
 func (s *Server) DeletePackage(request *polvo_v1.DeletePackageRequest, stream polvo_v1.PolvoService_DeletePackageServer) error {
 
-	packageName := parsePackageOrn(request.GetOrn())
+	packageOrn, err := orn.ParsePackage(request.GetOrn())
+	if err != nil {
+		return invalidArgument("orn", err)
+	}
+
+	packageName := packageOrn.Package
 
 	isPackageExists, err := s.repo.IsPackageExists(stream.Context(), packageName)
 	if err != nil {
-		return err
+		return s.statusError(err, packageResourceType, packageOrn.String())
 	}
 
 	if !isPackageExists {
-		if err := stream.Send(&polvo_v1.DeletePackageResponse{
-			Message: "Package is not exists",
-		}); err != nil {
-			return err
-		}
+		return s.statusError(errors.Wrapf(repository.ErrPackageNotFound, "package %s", packageName), packageResourceType, packageOrn.String())
 	}
 
-	if err := s.repo.DeletePackage(stream.Context(), packageName); err != nil {
-		return status.Errorf(codes.Internal, "failed to delete package", err.Error())
+	if err := s.authorize(stream.Context(), packageName, auth.RoleOwner); err != nil {
+		return s.statusError(err, packageResourceType, packageOrn.String())
 	}
 
+	current, err := s.repo.GetPackageDetails(stream.Context(), packageName)
+	if err != nil {
+		return s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	auditCtx := withAudit(stream.Context(), "DeletePackage", packageOrn.String(), packageName, packageDetailsFields(current), nil)
+	if err := s.repo.DeletePackage(auditCtx, packageName); err != nil {
+		return s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	s.wakeOutboxRelay()
+
 	if err := stream.Send(&polvo_v1.DeletePackageResponse{
-		Message: "Package and its version are deleted",
+		Message: "Package and its version are deleted, they can be restored until they are purged",
 	}); err != nil {
 		return err
 	}
@@ -103,40 +156,96 @@ func (s *Server) DeletePackage(request *polvo_v1.DeletePackageRequest, stream po
 }
 
 func (s *Server) UpdatePackage(ctx context.Context, request *polvo_v1.UpdatePackageRequest) (*polvo_v1.UpdatePackageResponse, error) {
-	packageName := parsePackageOrn(request.GetOrn())
+	packageOrn, err := orn.ParsePackage(request.GetOrn())
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
+
+	packageName := packageOrn.Package
 
 	isPackageExists, err := s.repo.IsPackageExists(ctx, packageName)
 	if err != nil {
-		return nil, err
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
 	}
 
 	if !isPackageExists {
-		return nil, status.Error(codes.NotFound, "package not found")
+		return nil, s.statusError(errors.Wrapf(repository.ErrPackageNotFound, "package %s", packageName), packageResourceType, packageOrn.String())
 	}
 
-	request.GetFieldMask().Normalize()
-	if !request.GetFieldMask().IsValid(request) {
-		return nil, errors.New("update mask is invalid")
+	if err := s.authorize(ctx, packageName, auth.RoleOwner); err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
 	}
 
-	filteredRequest := map[string]interface{}{}
-
-	mask, err := fieldmask_utils.MaskFromProtoFieldMask(request.GetFieldMask(), toSnakeCase.ToSnakeCase)
+	packageMetadata, err := packageMetadataFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := fieldmask_utils.StructToMap(mask, request, filteredRequest); err != nil {
-		return nil, err
+	// The metadata paths are not fields of polvo_v1.Package, their values
+	// come from the request metadata.
+	paths, metadataFields := splitMetadataPaths(request.GetFieldMask().GetPaths(), packageMetadata)
+
+	updateFields := map[string]interface{}{}
+	if len(paths) > 0 || len(metadataFields) == 0 {
+		if request.GetFieldMask() != nil {
+			request.FieldMask.Paths = paths
+		}
+
+		request.GetFieldMask().Normalize()
+		if !request.GetFieldMask().IsValid(request) {
+			return nil, invalidArgument("field_mask", errors.New("update mask is invalid"))
+		}
+
+		filteredRequest := map[string]interface{}{}
+
+		mask, err := fieldmask_utils.MaskFromProtoFieldMask(request.GetFieldMask(), toSnakeCase.ToSnakeCase)
+		if err != nil {
+			return nil, invalidArgument("field_mask", err)
+		}
+
+		if err := fieldmask_utils.StructToMap(mask, request, filteredRequest); err != nil {
+			return nil, invalidArgument("field_mask", err)
+		}
+
+		fields, ok := filteredRequest[string(request.GetPackage().ProtoReflect().Descriptor().Name())].(map[string]interface{})
+		if !ok {
+			return nil, invalidArgument("field_mask", errors.New("failed to parse field mask"))
+		}
+		updateFields = fields
+	}
+
+	for key, value := range metadataFields {
+		updateFields[key] = value
+	}
+
+	if newPackageName, ok := updateFields["Name"]; ok {
+		if err := orn.ValidatePackageName(newPackageName.(string)); err != nil {
+			return nil, invalidArgument("package.name", err)
+		}
+	}
+
+	if maintainer, ok := updateFields["Maintainer"]; ok {
+		if _, err := auth.ParseMaintainer(maintainer.(string)); err != nil {
+			return nil, invalidArgument("package.maintainer", err)
+		}
+	}
+
+	current, err := s.repo.GetPackageDetails(ctx, packageName)
+	if err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
 	}
 
-	updateFields := filteredRequest[string(request.GetPackage().ProtoReflect().Descriptor().Name())].(map[string]interface{})
+	auditCtx := withAudit(ctx, "UpdatePackage", packageOrn.String(), packageName, packageDetailsFields(current), func(saved interface{}) map[string]interface{} {
+		return packageDetailsFields(updatedPackageDetails(current, saved.(*polvo_v1.Package), updateFields))
+	})
 
-	savedPackage, err := s.repo.UpdatePackage(ctx, packageName,updateFields)
+	savedPackage, err := s.repo.UpdatePackage(auditCtx, packageName, updateFields)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get package")
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
 	}
 
+	s.wakeOutboxRelay()
+
 	return &polvo_v1.UpdatePackageResponse{
 		Package: savedPackage,
 	}, nil
@@ -144,48 +253,99 @@ func (s *Server) UpdatePackage(ctx context.Context, request *polvo_v1.UpdatePack
 
 func (s *Server)UpdateVersion(request *polvo_v1.UpdateVersionRequest, stream polvo_v1.PolvoService_UpdateVersionServer) error {
 
-	packageName, versionName := parseVersionOrn(request.GetOrn())
+	versionOrn, err := orn.ParseVersion(request.GetOrn())
+	if err != nil {
+		return invalidArgument("orn", err)
+	}
+
+	packageName, versionName := versionOrn.Package, versionOrn.Version
 
 	isVersionExists, err := s.repo.IsVersionExists(stream.Context(), packageName, versionName)
 	if err != nil {
-		return err
+		return s.statusError(err, versionResourceType, versionOrn.String())
 	}
 
 	if !isVersionExists {
-		return status.Error(codes.NotFound, "version not found")
+		return s.statusError(errors.Wrapf(repository.ErrVersionNotFound, "version %s of package %s", versionName, packageName), versionResourceType, versionOrn.String())
 	}
 
-	request.GetFieldMask().Normalize()
-	if !request.GetFieldMask().IsValid(request) {
-		return errors.New("update mask is invalid")
+	if err := s.authorize(stream.Context(), packageName, auth.RolePublisher); err != nil {
+		return s.statusError(err, versionResourceType, versionOrn.String())
 	}
 
-	mask, err := fieldmask_utils.MaskFromProtoFieldMask(request.GetFieldMask(), toCamelCase.ToCamelCase)
-	if err != nil {
-		return err
+	// The labels are not a field of polvo_v1.Version, their values come from
+	// the request metadata.
+	var paths []string
+	updateLabels := false
+	for _, path := range request.GetFieldMask().GetPaths() {
+		if path == labelsFieldPath {
+			updateLabels = true
+			continue
+		}
+
+		paths = append(paths, path)
 	}
 
-	filteredRequest := make(map[string]interface{})
+	updateFields := map[string]interface{}{}
+	if len(paths) > 0 || !updateLabels {
+		if request.GetFieldMask() != nil {
+			request.FieldMask.Paths = paths
+		}
+
+		request.GetFieldMask().Normalize()
+		if !request.GetFieldMask().IsValid(request) {
+			return invalidArgument("field_mask", errors.New("update mask is invalid"))
+		}
 
-	if err := fieldmask_utils.StructToMap(mask, request, filteredRequest); err != nil {
-		return err
+		mask, err := fieldmask_utils.MaskFromProtoFieldMask(request.GetFieldMask(), toCamelCase.ToCamelCase)
+		if err != nil {
+			return invalidArgument("field_mask", err)
+		}
+
+		filteredRequest := make(map[string]interface{})
+
+		if err := fieldmask_utils.StructToMap(mask, request, filteredRequest); err != nil {
+			return invalidArgument("field_mask", err)
+		}
+
+		if fields, ok := filteredRequest["Version"]; ok {
+			updateFields = fields.(map[string]interface{})
+		} else {
+			return invalidArgument("field_mask", errors.New("failed to parse field mask"))
+		}
 	}
 
-	var updateFields map[string]interface{}
+	if updateLabels {
+		versionLabels, err := versionLabelsFromContext(stream.Context())
+		if err != nil {
+			return err
+		}
 
-	if fields, ok := filteredRequest["Version"]; ok {
-		updateFields = fields.(map[string]interface{})
-	} else {
-		return status.Error(codes.InvalidArgument, "failed to parse field mask")
+		updateFields[repository.LabelsField] = versionLabels
 	}
 
-	fmt.Println(updateFields)
+	if newVersionName, ok := updateFields["Name"]; ok {
+		if err := orn.ValidateVersionName(newVersionName.(string)); err != nil {
+			return invalidArgument("version.name", err)
+		}
+	}
 
-	updatedVersion, err := s.repo.UpdateVersion(stream.Context(), packageName, versionName, updateFields)
+	current, err := s.repo.GetVersionDetails(stream.Context(), packageName, versionName)
 	if err != nil {
-		return err
+		return s.statusError(err, versionResourceType, versionOrn.String())
+	}
+
+	auditCtx := withAudit(stream.Context(), "UpdateVersion", versionOrn.String(), packageName, versionDetailsFields(current), func(saved interface{}) map[string]interface{} {
+		return versionDetailsFields(updatedVersionDetails(current, saved.(*polvo_v1.Version), updateFields))
+	})
+
+	updatedVersion, err := s.repo.UpdateVersion(auditCtx, packageName, versionName, updateFields)
+	if err != nil {
+		return s.statusError(err, versionResourceType, versionOrn.String())
 	}
 
+	s.wakeOutboxRelay()
+
 	if err := stream.Send(&polvo_v1.UpdateVersionResponse{
 		Version: updatedVersion,
 	}); err != nil {
@@ -196,57 +356,77 @@ func (s *Server)UpdateVersion(request *polvo_v1.UpdateVersionRequest, stream pol
 }
 
 func (s *Server) GetPackage(ctx context.Context, request *polvo_v1.GetPackageRequest) (*polvo_v1.GetPackageResponse, error) {
-	packageName := parsePackageOrn(request.GetOrn())
+	packageOrn, err := orn.ParsePackage(request.GetOrn())
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
+
+	packageName := packageOrn.Package
 
-	foundPackage, err := s.repo.GetPackage(ctx, packageName)
+	if err := s.authorize(ctx, packageName, auth.RoleReader); err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	details, err := s.repo.GetPackageDetails(ctx, packageName)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get package")
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
 	}
 
+	setTimestampHeader(ctx, details.CreatedAt, details.UpdatedAt)
+	setPackageMetadataHeader(ctx, details.Metadata)
+
 	return &polvo_v1.GetPackageResponse{
-		Package: foundPackage,
+		Package: details.Package,
 	}, nil
 }
 
 func (s *Server) GetVersion(ctx context.Context, request *polvo_v1.GetVersionRequest) (*polvo_v1.GetVersionResponse, error) {
-	packageName, versionName := parseVersionOrn(request.GetOrn())
-
-	if versionName != defaultVersions["any"] {
-		foundPackage, err := s.repo.GetVersion(ctx, packageName, versionName)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to get package")
-		}
+	versionOrn, err := orn.ParseVersion(request.GetOrn())
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
 
-		return &polvo_v1.GetVersionResponse{
-			Version: foundPackage,
-		}, nil
+	selector, err := labelSelectorFromContext(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	foundPackage, err := s.repo.GetHeaviestVersion(ctx, packageName)
+	details, err := s.resolveVersionDetails(ctx, versionOrn, stickyKeyFromContext(ctx), selector)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get package")
+		return nil, s.statusError(err, versionResourceType, versionOrn.String())
 	}
 
+	setTimestampHeader(ctx, details.CreatedAt, details.UpdatedAt)
+	setManifestHeader(ctx, details.ManifestSHA256)
+	setLabelsHeader(ctx, details.Labels)
+
 	return &polvo_v1.GetVersionResponse{
-		Version: foundPackage,
+		Version: details.Version,
 	}, nil
 }
 
 func (s *Server) ListPackages(request *polvo_v1.ListPackagesRequest, stream polvo_v1.PolvoService_ListPackagesServer) error {
-	packages, err := s.repo.ListPackages(stream.Context())
+	listRequest, err := listPackagesRequestFromContext(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	page, err := s.ListPackageDetails(stream.Context(), listRequest)
 	if err != nil {
-		return errors.Wrap(err, "failed to get package")
+		return err
 	}
 
-	for _, pkg := range packages {
+	setNextPageTokenTrailer(stream, page.NextPageToken)
+
+	for _, pkg := range page.Packages {
 		resp := polvo_v1.ListPackagesResponse{
 			Packages: []*polvo_v1.Package{
-				pkg,
+				pkg.Package,
 			},
 		}
 
 		if err := stream.Send(&resp); err != nil {
-			return errors.Wrap(err, "failed to send to downstream")
+			return err
 		}
 	}
 
@@ -255,13 +435,21 @@ func (s *Server) ListPackages(request *polvo_v1.ListPackagesRequest, stream polv
 
 func (s *Server) GetManifestUrl(ctx context.Context, request *polvo_v1.GetManifestUrlRequest) (*polvo_v1.GetManifestUrlResponse, error) {
 
-	packageName, versionName := parseVersionOrn(request.GetOrn())
+	versionOrn, err := orn.ParseVersion(request.GetOrn())
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
 
-	version, err := s.repo.GetVersion(ctx, packageName, versionName)
+	selector, err := labelSelectorFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	version, err := s.resolveVersion(ctx, versionOrn, stickyKeyFromContext(ctx), selector)
+	if err != nil {
+		return nil, s.statusError(err, versionResourceType, versionOrn.String())
+	}
+
 	response := &polvo_v1.GetManifestUrlResponse{
 		ManifestUrl: version.GetManifestUrl(),
 	}
@@ -270,22 +458,27 @@ func (s *Server) GetManifestUrl(ctx context.Context, request *polvo_v1.GetManife
 }
 
 func (s *Server)ListVersions(request *polvo_v1.ListVersionsRequest, stream polvo_v1.PolvoService_ListVersionsServer) error {
-	packageName := parsePackageOrn(request.GetOrn())
+	listRequest, err := listVersionsRequestFromContext(stream.Context(), request.GetOrn())
+	if err != nil {
+		return err
+	}
 
-	versions, err := s.repo.ListVersions(stream.Context(), packageName)
+	page, err := s.ListVersionDetails(stream.Context(), listRequest)
 	if err != nil {
-		return errors.Wrap(err, "failed to get package")
+		return err
 	}
 
-	for _, version := range versions {
+	setNextPageTokenTrailer(stream, page.NextPageToken)
+
+	for _, version := range page.Versions {
 		resp := polvo_v1.ListVersionsResponse{
 			Versions: []*polvo_v1.Version{
-				version,
+				version.Version,
 			},
 		}
 
 		if err := stream.Send(&resp); err != nil {
-			return errors.Wrap(err, "failed to send to downstream")
+			return err
 		}
 	}
 
@@ -293,32 +486,65 @@ func (s *Server)ListVersions(request *polvo_v1.ListVersionsRequest, stream polvo
 }
 
 func (s *Server) CreateVersion(request *polvo_v1.CreateVersionRequest, stream polvo_v1.PolvoService_CreateVersionServer) error {
-	packageName := parsePackageOrn(request.GetPackageOrn())
+	packageOrn, err := orn.ParsePackage(request.GetPackageOrn())
+	if err != nil {
+		return invalidArgument("package_orn", err)
+	}
+
+	version := request.GetVersion()
+
+	versionOrn, err := orn.NewVersionORN(packageOrn.Package, version.GetName())
+	if err != nil {
+		return invalidArgument("version.name", err)
+	}
+
+	if version.GetName() == defaultVersions["any"] {
+		return invalidArgument("version.name", errors.New("can not create version: any"))
+	}
 
-	isVersionExists, err := s.repo.IsVersionExists(stream.Context(), packageName, request.GetVersion().GetName())
+	versionLabels, err := versionLabelsFromContext(stream.Context())
 	if err != nil {
 		return err
 	}
 
+	if err := s.authorize(stream.Context(), versionOrn.Package, auth.RolePublisher); err != nil {
+		return s.statusError(err, versionResourceType, versionOrn.String())
+	}
+
+	isVersionExists, err := s.repo.IsVersionExists(stream.Context(), versionOrn.Package, versionOrn.Version)
+	if err != nil {
+		return s.statusError(err, versionResourceType, versionOrn.String())
+	}
+
 	if isVersionExists {
-		return status.Error(codes.NotFound, "Version is exists")
+		return s.statusError(errors.Wrapf(repository.ErrAlreadyExists, "version %s of package %s", versionOrn.Version, versionOrn.Package), versionResourceType, versionOrn.String())
 	}
 
-	version := request.GetVersion()
+	manifestBody, err := s.validateManifest(stream, version.GetManifestUrl())
+	if err != nil {
+		return err
+	}
 
-	if version.GetName() == defaultVersions["any"] {
-		return status.Errorf(codes.Aborted, "can not create version: any")
+	pin, err := s.pinManifest(stream.Context(), version.GetManifestUrl(), manifestBody)
+	if err != nil {
+		return err
 	}
 
-	createdVersion, err := s.repo.CreateVersion(stream.Context(), packageName, version)
+	auditCtx := withAudit(stream.Context(), "CreateVersion", versionOrn.String(), versionOrn.Package, nil, func(saved interface{}) map[string]interface{} {
+		return versionDetailsFields(&repository.VersionDetails{Version: saved.(*polvo_v1.Version), Labels: versionLabels})
+	})
+
+	createdVersion, err := s.repo.CreateVersion(auditCtx, versionOrn.Package, version, pin, versionLabels)
 	if err != nil {
-		return status.Errorf(codes.Internal, "failed to create version: %s", err)
+		return s.statusError(err, versionResourceType, versionOrn.String())
 	}
 
+	s.wakeOutboxRelay()
+
 	if err := stream.Send(&polvo_v1.CreateVersionResponse{
 		Version: createdVersion,
 	}); err != nil {
-		return status.Errorf(codes.Internal, "failed to send response to client: %s", err)
+		return err
 	}
 
 	return nil
@@ -326,32 +552,38 @@ func (s *Server) CreateVersion(request *polvo_v1.CreateVersionRequest, stream po
 
 func (s *Server)DeleteVersion(request *polvo_v1.DeleteVersionRequest, stream polvo_v1.PolvoService_DeleteVersionServer) error {
 
-	packageName, versionName := parseVersionOrn(request.GetOrn())
+	versionOrn, err := orn.ParseVersion(request.GetOrn())
+	if err != nil {
+		return invalidArgument("orn", err)
+	}
 
-	if err := stream.Send(&polvo_v1.DeleteVersionResponse{
-		Message: "Version is being detached from package",
-	}); err != nil {
-		return err
+	packageName, versionName := versionOrn.Package, versionOrn.Version
+
+	if err := s.authorize(stream.Context(), packageName, auth.RoleOwner); err != nil {
+		return s.statusError(err, versionResourceType, versionOrn.String())
 	}
 
-	if err := stream.Send(&polvo_v1.DeleteVersionResponse{
-		Message: "Version is detached from package",
-	}); err != nil {
-		return err
+	current, err := s.repo.GetVersionDetails(stream.Context(), packageName, versionName)
+	if err != nil {
+		return s.statusError(err, versionResourceType, versionOrn.String())
 	}
 
+	auditCtx := withAudit(stream.Context(), "DeleteVersion", versionOrn.String(), packageName, versionDetailsFields(current), nil)
+
 	if err := stream.Send(&polvo_v1.DeleteVersionResponse{
 		Message: "Version is being deleted",
 	}); err != nil {
 		return err
 	}
 
-	if err := s.repo.DeleteVersion(stream.Context(), packageName, versionName); err != nil {
-		return err
+	if err := s.repo.DeleteVersion(auditCtx, packageName, versionName); err != nil {
+		return s.statusError(err, versionResourceType, versionOrn.String())
 	}
 
+	s.wakeOutboxRelay()
+
 	if err := stream.Send(&polvo_v1.DeleteVersionResponse{
-		Message: "Version is deleted",
+		Message: "Version is deleted, it can be restored until it is purged",
 	}); err != nil {
 		return err
 	}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/manifest"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+// newTestServer returns a Server on a memory repository, with authentication
+// disabled and manifests not validated.
+func newTestServer(t *testing.T) (*Server, *repository.MemoryRepository) {
+	t.Helper()
+
+	os.Setenv("AUTH_DISABLED", "true")
+	t.Cleanup(func() { os.Unsetenv("AUTH_DISABLED") })
+
+	authenticator, err := auth.NewAuthenticator()
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+
+	manifests, err := manifest.NewValidator()
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+
+	repo, err := repository.NewMemoryRepository()
+	if err != nil {
+		t.Fatalf("NewMemoryRepository: %v", err)
+	}
+
+	return NewServer(zap.NewNop(), repo, authenticator, manifests), repo
+}
+
+// testStream is the grpc.ServerStream of the server streaming RPCs in tests.
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s testStream) Context() context.Context {
+	return s.ctx
+}
+
+type deleteVersionStream struct {
+	testStream
+	messages []string
+}
+
+func (s *deleteVersionStream) Send(response *polvo_v1.DeleteVersionResponse) error {
+	s.messages = append(s.messages, response.GetMessage())
+
+	return nil
+}
+
+func TestDeleteVersionOfMissingVersion(t *testing.T) {
+	s, repo := newTestServer(t)
+	ctx := context.Background()
+
+	if _, err := repo.CreatePackage(ctx, &polvo_v1.Package{Name: "button"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	stream := &deleteVersionStream{testStream: testStream{ctx: ctx}}
+	err := s.DeleteVersion(&polvo_v1.DeleteVersionRequest{Orn: "packages/button/versions/1.0.0"}, stream)
+
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("DeleteVersion = %v, want NotFound", err)
+	}
+
+	if len(stream.messages) != 0 {
+		t.Errorf("DeleteVersion sent %q before finding the version", stream.messages)
+	}
+}
+
+func TestDeleteVersion(t *testing.T) {
+	s, repo := newTestServer(t)
+	ctx := context.Background()
+
+	if _, err := repo.CreatePackage(ctx, &polvo_v1.Package{Name: "button"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	if _, err := repo.CreateVersion(ctx, "button", &polvo_v1.Version{Name: "1.0.0"}, nil, nil); err != nil {
+		t.Fatalf("CreateVersion: %v", err)
+	}
+
+	stream := &deleteVersionStream{testStream: testStream{ctx: ctx}}
+	if err := s.DeleteVersion(&polvo_v1.DeleteVersionRequest{Orn: "packages/button/versions/1.0.0"}, stream); err != nil {
+		t.Fatalf("DeleteVersion: %v", err)
+	}
+
+	if len(stream.messages) != 2 {
+		t.Errorf("DeleteVersion sent %q, want the progress and the result", stream.messages)
+	}
+
+	if exists, _ := repo.IsVersionExists(ctx, "button", "1.0.0"); exists {
+		t.Error("the version still exists")
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/orn"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+const defaultPurgeInterval = time.Hour
+
+type UndeletePackageRequest struct {
+	Orn string
+}
+
+type UndeleteVersionRequest struct {
+	Orn string
+}
+
+type PurgeDeletedRequest struct {
+	// Retention is how long soft deleted records are kept before they are
+	// purged.
+	Retention time.Duration
+}
+
+func (s *Server) UndeletePackage(ctx context.Context, request *UndeletePackageRequest) (*polvo_v1.Package, error) {
+	packageOrn, err := orn.ParsePackage(request.Orn)
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
+
+	if err := s.auth.AuthorizeAdmin(ctx); err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	auditCtx := withAudit(ctx, "UndeletePackage", packageOrn.String(), packageOrn.Package, nil, savedPackageFields)
+	pkg, err := s.repo.UndeletePackage(auditCtx, packageOrn.Package)
+	if err != nil {
+		return nil, s.statusError(err, packageResourceType, packageOrn.String())
+	}
+
+	s.wakeOutboxRelay()
+
+	return pkg, nil
+}
+
+func (s *Server) UndeleteVersion(ctx context.Context, request *UndeleteVersionRequest) (*polvo_v1.Version, error) {
+	versionOrn, err := orn.ParseVersion(request.Orn)
+	if err != nil {
+		return nil, invalidArgument("orn", err)
+	}
+
+	if err := s.authorize(ctx, versionOrn.Package, auth.RoleOwner); err != nil {
+		return nil, s.statusError(err, versionResourceType, versionOrn.String())
+	}
+
+	auditCtx := withAudit(ctx, "UndeleteVersion", versionOrn.String(), versionOrn.Package, nil, savedVersionFields)
+	version, err := s.repo.UndeleteVersion(auditCtx, versionOrn.Package, versionOrn.Version)
+	if err != nil {
+		return nil, s.statusError(err, versionResourceType, versionOrn.String())
+	}
+
+	s.wakeOutboxRelay()
+
+	return version, nil
+}
+
+func (s *Server) PurgeDeleted(ctx context.Context, request *PurgeDeletedRequest) (*repository.PurgeResult, error) {
+	if request.Retention < 0 {
+		return nil, invalidArgument("retention", errors.New("retention must not be negative"))
+	}
+
+	if err := s.auth.AuthorizeAdmin(ctx); err != nil {
+		return nil, s.statusError(err, packageResourceType, "")
+	}
+
+	return s.purgeDeleted(ctx, request.Retention)
+}
+
+// purgeDeleted is PurgeDeleted without the caller check, for the Purger.
+func (s *Server) purgeDeleted(ctx context.Context, retention time.Duration) (*repository.PurgeResult, error) {
+	// The repository records the purge only when it removed something.
+	auditCtx := withAudit(ctx, "PurgeDeleted", "", "", nil, func(saved interface{}) map[string]interface{} {
+		result := saved.(*repository.PurgeResult)
+
+		return map[string]interface{}{
+			"packages": result.Packages,
+			"versions": result.Versions,
+		}
+	})
+
+	result, err := s.repo.PurgeDeleted(auditCtx, time.Now().Add(-retention))
+	if err != nil {
+		return nil, s.statusError(err, packageResourceType, "")
+	}
+
+	return result, nil
+}
+
+// Purger periodically purges soft deleted records older than the retention
+// period set by PURGE_RETENTION, e.g. "720h". Purging is disabled when it is
+// not set. PURGE_INTERVAL controls how often it runs, one hour by default.
+type Purger struct {
+	logger    *zap.Logger
+	server    *Server
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewPurger(logger *zap.Logger, server *Server) (*Purger, error) {
+	purger := &Purger{
+		logger:   logger,
+		server:   server,
+		interval: defaultPurgeInterval,
+	}
+
+	if value := os.Getenv("PURGE_RETENTION"); value != "" {
+		retention, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid PURGE_RETENTION")
+		}
+
+		purger.retention = retention
+	}
+
+	if value := os.Getenv("PURGE_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid PURGE_INTERVAL")
+		}
+
+		if interval <= 0 {
+			return nil, errors.New("PURGE_INTERVAL must be positive")
+		}
+
+		purger.interval = interval
+	}
+
+	return purger, nil
+}
+
+// Run purges on every interval until ctx is done.
+func (p *Purger) Run(ctx context.Context) {
+	if p.retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := p.server.purgeDeleted(ctx, p.retention)
+		if err != nil {
+			p.logger.Error("failed to purge deleted records", zap.Error(err))
+		} else if result.Packages > 0 || result.Versions > 0 {
+			p.logger.Info("purged deleted records", zap.Int("packages", result.Packages), zap.Int("versions", result.Versions))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
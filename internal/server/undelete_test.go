@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+)
+
+func TestUndeleteVersion(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestServer(t)
+
+	if _, err := repo.CreatePackage(ctx, &polvo_v1.Package{Name: "button", Maintainer: "alice"}, nil); err != nil {
+		t.Fatalf("CreatePackage: %v", err)
+	}
+
+	if _, err := repo.CreateVersion(ctx, "button", &polvo_v1.Version{Name: "1.0.0", Weight: 100}, nil, nil); err != nil {
+		t.Fatalf("CreateVersion: %v", err)
+	}
+
+	if err := repo.DeleteVersion(ctx, "button", "1.0.0"); err != nil {
+		t.Fatalf("DeleteVersion: %v", err)
+	}
+
+	version, err := s.UndeleteVersion(ctx, &UndeleteVersionRequest{Orn: "packages/button/versions/1.0.0"})
+	if err != nil || version.GetName() != "1.0.0" || version.GetWeight() != 100 {
+		t.Fatalf("UndeleteVersion = %v, %v", version, err)
+	}
+
+	if _, err := s.UndeleteVersion(ctx, &UndeleteVersionRequest{Orn: "packages/button/versions/1.0.0"}); status.Code(err) != codes.NotFound {
+		t.Errorf("UndeleteVersion of a live version = %v, want NotFound", err)
+	}
+
+	if _, err := s.UndeletePackage(ctx, &UndeletePackageRequest{Orn: "packages/button/versions/1.0.0"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("UndeletePackage of a version ORN = %v, want InvalidArgument", err)
+	}
+}
+
+func TestPurgeDeletedRejectsANegativeRetention(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	if _, err := s.PurgeDeleted(context.Background(), &PurgeDeletedRequest{Retention: -time.Hour}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("PurgeDeleted = %v, want InvalidArgument", err)
+	}
+}
+
+func TestNewPurger(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	for _, test := range []struct {
+		retention string
+		interval  string
+		wantErr   bool
+	}{
+		{retention: "", interval: ""},
+		{retention: "720h", interval: "10m"},
+		{retention: "a month", wantErr: true},
+		{retention: "720h", interval: "0s", wantErr: true},
+		{retention: "720h", interval: "-1h", wantErr: true},
+	} {
+		os.Setenv("PURGE_RETENTION", test.retention)
+		os.Setenv("PURGE_INTERVAL", test.interval)
+
+		if _, err := NewPurger(nil, s); (err != nil) != test.wantErr {
+			t.Errorf("NewPurger(PURGE_RETENTION=%q, PURGE_INTERVAL=%q) = %v, wantErr %v", test.retention, test.interval, err, test.wantErr)
+		}
+	}
+
+	os.Unsetenv("PURGE_RETENTION")
+	os.Unsetenv("PURGE_INTERVAL")
+}
@@ -0,0 +1,677 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"pkg.aiocean.dev/polvoservice/internal/auth"
+	"pkg.aiocean.dev/polvoservice/internal/orn"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+const (
+	defaultWebhookInterval = 5 * time.Second
+	defaultWebhookTimeout  = 10 * time.Second
+	defaultWebhookBackoff  = 30 * time.Second
+	defaultWebhookAttempts = 8
+	// maxWebhookBackoff caps the exponential backoff between attempts.
+	maxWebhookBackoff = time.Hour
+	// webhookBatchSize bounds the deliveries attempted on every interval.
+	webhookBatchSize = 100
+	// webhookConcurrency is the number of deliveries sent at the same time.
+	webhookConcurrency = 8
+)
+
+// Headers of the webhook requests. The signature is the hex HMAC-SHA256 of
+// "{timestamp}.{body}" keyed with the secret of the webhook, see
+// SignWebhookPayload.
+const (
+	webhookEventHeader       = "X-Polvo-Event"
+	webhookDeliveryHeader    = "X-Polvo-Delivery"
+	webhookIdempotencyHeader = "X-Polvo-Idempotency-Key"
+	webhookAttemptHeader     = "X-Polvo-Delivery-Attempt"
+	webhookTimestampHeader   = "X-Polvo-Timestamp"
+	webhookSignatureHeader   = "X-Polvo-Signature"
+)
+
+type CreateWebhookRequest struct {
+	// PackageOrn limits the webhook to one package and requires the owner
+	// role. A webhook without package receives every event and requires an
+	// admin.
+	PackageOrn string
+	URL        string
+	// Secret signs the deliveries, a random one is generated when it is empty.
+	Secret string
+	// EventTypes filters the events by type, every event is sent when it is
+	// empty.
+	EventTypes []ChangeType
+}
+
+type GetWebhookRequest struct {
+	ID string
+}
+
+type ListWebhooksRequest struct {
+	// PackageOrn lists the webhooks of one package. Admins can list every
+	// webhook by leaving it empty.
+	PackageOrn string
+}
+
+type DeleteWebhookRequest struct {
+	ID string
+}
+
+type ListWebhookDeliveriesRequest struct {
+	// WebhookID lists the deliveries of one webhook. Admins can list every
+	// delivery by leaving it empty.
+	WebhookID string
+	// State filters the deliveries, e.g. "dead" for the dead letter list.
+	State repository.WebhookDeliveryState
+	// PageSize is at most maxPageSize. Every delivery is returned when it is 0.
+	PageSize  uint32
+	PageToken string
+}
+
+type RedeliverWebhookDeliveryRequest struct {
+	ID string
+}
+
+// CreateWebhook subscribes a URL to the change events. The secret is only
+// returned by CreateWebhook.
+func (s *Server) CreateWebhook(ctx context.Context, request *CreateWebhookRequest) (*repository.Webhook, error) {
+	webhook := &repository.Webhook{
+		URL:       request.URL,
+		Secret:    request.Secret,
+		CreatedBy: actorFromContext(ctx),
+	}
+
+	if request.PackageOrn != "" {
+		packageOrn, err := orn.ParsePackage(request.PackageOrn)
+		if err != nil {
+			return nil, invalidArgument("package_orn", err)
+		}
+
+		webhook.Package = packageOrn.Package
+	}
+
+	if err := validateHTTPURL(request.URL); err != nil {
+		return nil, invalidArgument("url", err)
+	}
+
+	for _, eventType := range request.EventTypes {
+		if !changeTypes[eventType] {
+			return nil, invalidArgument("event_types", errors.Errorf("unknown event type %q", eventType))
+		}
+
+		webhook.EventTypes = append(webhook.EventTypes, string(eventType))
+	}
+
+	if webhook.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, s.statusError(errors.Wrap(err, "failed to generate a secret"), webhookResourceType, "")
+		}
+
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+
+	if err := s.authorizeWebhook(ctx, webhook); err != nil {
+		return nil, s.statusError(err, webhookResourceType, "")
+	}
+
+	// The orn of the webhook is known once the repository gives it an id.
+	auditCtx := repository.WithAudit(ctx, &repository.Audit{
+		Event: newAuditEvent(ctx, "CreateWebhook", "", webhook.Package, nil),
+		Complete: func(event *repository.AuditEvent, saved interface{}) {
+			created := saved.(*repository.Webhook)
+			event.Orn = webhookOrn(created)
+			event.After = webhookFields(created)
+		},
+	})
+
+	created, err := s.repo.CreateWebhook(auditCtx, webhook)
+	if err != nil {
+		return nil, s.statusError(err, webhookResourceType, "")
+	}
+
+	return created, nil
+}
+
+// GetWebhook returns a webhook without its secret.
+func (s *Server) GetWebhook(ctx context.Context, request *GetWebhookRequest) (*repository.Webhook, error) {
+	webhook, err := s.getWebhook(ctx, request.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return redactWebhook(webhook), nil
+}
+
+// ListWebhooks returns webhooks without their secret, newest first.
+func (s *Server) ListWebhooks(ctx context.Context, request *ListWebhooksRequest) ([]*repository.Webhook, error) {
+	packageName := ""
+	if request.PackageOrn == "" {
+		if err := s.auth.AuthorizeAdmin(ctx); err != nil {
+			return nil, s.statusError(err, webhookResourceType, "")
+		}
+	} else {
+		packageOrn, err := orn.ParsePackage(request.PackageOrn)
+		if err != nil {
+			return nil, invalidArgument("package_orn", err)
+		}
+
+		if err := s.authorize(ctx, packageOrn.Package, auth.RoleOwner); err != nil {
+			return nil, s.statusError(err, packageResourceType, packageOrn.String())
+		}
+
+		packageName = packageOrn.Package
+	}
+
+	webhooks, err := s.repo.ListWebhooks(ctx)
+	if err != nil {
+		return nil, s.statusError(err, webhookResourceType, "")
+	}
+
+	var listed []*repository.Webhook
+	for _, webhook := range webhooks {
+		if packageName == "" || webhook.Package == packageName {
+			listed = append(listed, redactWebhook(webhook))
+		}
+	}
+
+	return listed, nil
+}
+
+// DeleteWebhook removes a webhook together with its deliveries.
+func (s *Server) DeleteWebhook(ctx context.Context, request *DeleteWebhookRequest) error {
+	webhook, err := s.getWebhook(ctx, request.ID)
+	if err != nil {
+		return err
+	}
+
+	auditCtx := withAudit(ctx, "DeleteWebhook", webhookOrn(webhook), webhook.Package, webhookFields(webhook), nil)
+	if err := s.repo.DeleteWebhook(auditCtx, webhook.ID); err != nil {
+		return s.statusError(err, webhookResourceType, request.ID)
+	}
+
+	return nil
+}
+
+// ListWebhookDeliveries returns the delivery log, newest first.
+func (s *Server) ListWebhookDeliveries(ctx context.Context, request *ListWebhookDeliveriesRequest) (*repository.WebhookDeliveryPage, error) {
+	pageSize, err := checkPageSize(request.PageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	switch request.State {
+	case "", repository.DeliveryPending, repository.DeliverySucceeded, repository.DeliveryDead:
+	default:
+		return nil, invalidArgument("state", errors.Errorf("unknown delivery state %q", request.State))
+	}
+
+	if request.WebhookID == "" {
+		if err := s.auth.AuthorizeAdmin(ctx); err != nil {
+			return nil, s.statusError(err, deliveryResourceType, "")
+		}
+	} else if _, err := s.getWebhook(ctx, request.WebhookID); err != nil {
+		return nil, err
+	}
+
+	page, err := s.repo.ListWebhookDeliveries(ctx, repository.ListWebhookDeliveriesOptions{
+		PageSize:  pageSize,
+		PageToken: request.PageToken,
+		WebhookID: request.WebhookID,
+		State:     request.State,
+	})
+	if err != nil {
+		return nil, s.statusError(err, deliveryResourceType, "")
+	}
+
+	return page, nil
+}
+
+// RedeliverWebhookDelivery queues a delivery again with a fresh set of
+// attempts, typically one from the dead letter list.
+func (s *Server) RedeliverWebhookDelivery(ctx context.Context, request *RedeliverWebhookDeliveryRequest) (*repository.WebhookDelivery, error) {
+	delivery, err := s.repo.GetWebhookDelivery(ctx, request.ID)
+	if err != nil {
+		return nil, s.statusError(err, deliveryResourceType, request.ID)
+	}
+
+	webhook, err := s.getWebhook(ctx, delivery.WebhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	if delivery.State == repository.DeliveryPending {
+		return nil, s.statusError(errors.Wrapf(repository.ErrPrecondition, "webhook delivery %s is already pending", delivery.ID), deliveryResourceType, delivery.ID)
+	}
+
+	before := deliveryFields(delivery)
+
+	delivery.State = repository.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+
+	auditCtx := withAudit(ctx, "RedeliverWebhookDelivery", webhookOrn(webhook)+"/deliveries/"+delivery.ID, webhook.Package, before, func(saved interface{}) map[string]interface{} {
+		return deliveryFields(saved.(*repository.WebhookDelivery))
+	})
+
+	saved, err := s.repo.UpdateWebhookDelivery(auditCtx, delivery)
+	if err != nil {
+		return nil, s.statusError(err, deliveryResourceType, delivery.ID)
+	}
+
+	return saved, nil
+}
+
+// getWebhook reads a webhook after checking that the caller can manage it.
+func (s *Server) getWebhook(ctx context.Context, id string) (*repository.Webhook, error) {
+	webhook, err := s.repo.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, s.statusError(err, webhookResourceType, id)
+	}
+
+	if err := s.authorizeWebhook(ctx, webhook); err != nil {
+		return nil, s.statusError(err, webhookResourceType, id)
+	}
+
+	return webhook, nil
+}
+
+// authorizeWebhook checks that the caller owns the package of a webhook, or
+// is an admin for a webhook of every package.
+func (s *Server) authorizeWebhook(ctx context.Context, webhook *repository.Webhook) error {
+	if webhook.Package == "" {
+		return s.auth.AuthorizeAdmin(ctx)
+	}
+
+	return s.authorize(ctx, webhook.Package, auth.RoleOwner)
+}
+
+// enqueueWebhooks stores a pending delivery of event for every webhook that
+// receives it. The deliveries of an event relayed again are skipped, their
+// idempotency key is the webhook and the event.
+func (s *Server) enqueueWebhooks(ctx context.Context, event *ChangeEvent) error {
+	webhooks, err := s.repo.ListWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	var deliveries []*repository.WebhookDelivery
+	for _, webhook := range webhooks {
+		if !webhook.Matches(event.Package, string(event.Type)) {
+			continue
+		}
+
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				return errors.Wrap(err, "failed to encode webhook payload")
+			}
+		}
+
+		deliveries = append(deliveries, &repository.WebhookDelivery{
+			WebhookID:      webhook.ID,
+			IdempotencyKey: webhook.ID + "/" + event.ID,
+			Package:        event.Package,
+			EventType:      string(event.Type),
+			Payload:        payload,
+			State:          repository.DeliveryPending,
+			NextAttemptAt:  time.Now(),
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	return s.repo.CreateWebhookDeliveries(ctx, deliveries)
+}
+
+func validateHTTPURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return errors.Wrap(err, "invalid URL")
+	}
+
+	if parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return errors.New("the URL must be http or https")
+	}
+
+	if parsed.Host == "" {
+		return errors.New("the URL must have a host")
+	}
+
+	return nil
+}
+
+// SignWebhookPayload returns the signature sent in the X-Polvo-Signature
+// header, for receivers to compare with hmac.Equal.
+func SignWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookOrn(webhook *repository.Webhook) string {
+	return "webhooks/" + webhook.ID
+}
+
+func redactWebhook(webhook *repository.Webhook) *repository.Webhook {
+	redacted := *webhook
+	redacted.Secret = ""
+
+	return &redacted
+}
+
+func webhookFields(webhook *repository.Webhook) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          webhook.ID,
+		"package":     webhook.Package,
+		"url":         webhook.URL,
+		"event_types": webhook.EventTypes,
+	}
+}
+
+func deliveryFields(delivery *repository.WebhookDelivery) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          delivery.ID,
+		"webhook_id":  delivery.WebhookID,
+		"event_type":  delivery.EventType,
+		"state":       string(delivery.State),
+		"attempts":    delivery.Attempts,
+		"last_status": delivery.LastStatusCode,
+		"last_error":  delivery.LastError,
+	}
+}
+
+// WebhookDispatcher sends the due webhook deliveries every WEBHOOK_INTERVAL.
+// A failed attempt is retried after WEBHOOK_RETRY_BACKOFF, doubled on every
+// attempt up to an hour, and the delivery goes to the dead letter list after
+// WEBHOOK_MAX_ATTEMPTS attempts. Every process runs one, the revision of a
+// delivery keeps two processes from sending it at the same time. It is
+// configured from the environment:
+//
+//  WEBHOOK_INTERVAL                how often due deliveries are sent, "5s" by
+//                                  default.
+//  WEBHOOK_TIMEOUT                 timeout of a request, "10s" by default.
+//  WEBHOOK_RETRY_BACKOFF           delay before the first retry, "30s" by
+//                                  default.
+//  WEBHOOK_MAX_ATTEMPTS            attempts before a delivery is dead, 8 by
+//                                  default.
+//  WEBHOOK_ALLOW_PRIVATE_NETWORKS  "true" lets webhooks reach loopback,
+//                                  link-local and private addresses.
+type WebhookDispatcher struct {
+	logger      *zap.Logger
+	server      *Server
+	client      *http.Client
+	interval    time.Duration
+	timeout     time.Duration
+	backoff     time.Duration
+	maxAttempts int
+}
+
+func NewWebhookDispatcher(logger *zap.Logger, server *Server) (*WebhookDispatcher, error) {
+	dispatcher := &WebhookDispatcher{
+		logger:      logger,
+		server:      server,
+		interval:    defaultWebhookInterval,
+		timeout:     defaultWebhookTimeout,
+		backoff:     defaultWebhookBackoff,
+		maxAttempts: defaultWebhookAttempts,
+	}
+
+	for name, value := range map[string]*time.Duration{
+		"WEBHOOK_INTERVAL":      &dispatcher.interval,
+		"WEBHOOK_TIMEOUT":       &dispatcher.timeout,
+		"WEBHOOK_RETRY_BACKOFF": &dispatcher.backoff,
+	} {
+		if env := os.Getenv(name); env != "" {
+			duration, err := time.ParseDuration(env)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid %s", name)
+			}
+
+			if duration <= 0 {
+				return nil, errors.Errorf("%s must be positive", name)
+			}
+
+			*value = duration
+		}
+	}
+
+	if env := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); env != "" {
+		attempts, err := strconv.Atoi(env)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid WEBHOOK_MAX_ATTEMPTS")
+		}
+
+		if attempts <= 0 {
+			return nil, errors.New("WEBHOOK_MAX_ATTEMPTS must be positive")
+		}
+
+		dispatcher.maxAttempts = attempts
+	}
+
+	dialer := &net.Dialer{Timeout: dispatcher.timeout, KeepAlive: 30 * time.Second}
+	if os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") != "true" {
+		dialer.Control = checkWebhookAddress
+	}
+
+	// Without proxy, the dialer sees the address of the webhook itself.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	dispatcher.client = &http.Client{
+		Transport: transport,
+		Timeout:   dispatcher.timeout,
+		// A redirect is a failed attempt, the webhook URL has to be fixed.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return dispatcher, nil
+}
+
+// Run sends the due deliveries on every interval until ctx is done.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.dispatchDue(ctx)
+		}
+	}
+}
+
+// dispatchDue sends the due deliveries, webhookConcurrency at a time. Errors
+// are logged so that one broken webhook does not hold back the others.
+func (d *WebhookDispatcher) dispatchDue(ctx context.Context) {
+	deliveries, err := d.server.repo.ListDueWebhookDeliveries(ctx, time.Now(), webhookBatchSize)
+	if err != nil {
+		d.logger.Error("failed to list due webhook deliveries", zap.Error(err))
+		return
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, webhookConcurrency)
+
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(delivery *repository.WebhookDelivery) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			if err := d.dispatch(ctx, delivery); err != nil && !errors.Is(err, repository.ErrConflict) {
+				d.logger.Error("failed to deliver webhook", zap.String("delivery", delivery.ID), zap.String("webhook", delivery.WebhookID), zap.Error(err))
+			}
+		}(delivery)
+	}
+
+	wg.Wait()
+}
+
+// dispatch claims a delivery by counting the attempt and pushing its next
+// attempt past the request timeout, so that the attempt is retried if the
+// process stops while sending it, then records the outcome.
+func (d *WebhookDispatcher) dispatch(ctx context.Context, delivery *repository.WebhookDelivery) error {
+	webhook, err := d.server.repo.GetWebhook(ctx, delivery.WebhookID)
+	if errors.Is(err, repository.ErrWebhookNotFound) {
+		// The webhook was deleted after the delivery was enqueued, the
+		// delivery can never be sent.
+		delivery.State = repository.DeliveryDead
+		delivery.NextAttemptAt = time.Time{}
+		delivery.LastError = "the webhook was deleted"
+
+		_, err = d.server.repo.UpdateWebhookDelivery(ctx, delivery)
+
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	delivery.Attempts++
+	delivery.NextAttemptAt = time.Now().Add(2 * d.timeout)
+
+	claimed, err := d.server.repo.UpdateWebhookDelivery(ctx, delivery)
+	if err != nil {
+		return err
+	}
+
+	statusCode, sendErr := d.send(ctx, webhook, claimed)
+
+	claimed.LastStatusCode = statusCode
+	claimed.LastError = ""
+	switch {
+	case sendErr == nil:
+		claimed.State = repository.DeliverySucceeded
+		claimed.NextAttemptAt = time.Time{}
+	case claimed.Attempts >= d.maxAttempts:
+		claimed.LastError = sendErr.Error()
+		claimed.State = repository.DeliveryDead
+		claimed.NextAttemptAt = time.Time{}
+	default:
+		claimed.LastError = sendErr.Error()
+		claimed.NextAttemptAt = time.Now().Add(d.retryDelay(claimed.Attempts))
+	}
+
+	_, err = d.server.repo.UpdateWebhookDelivery(ctx, claimed)
+
+	return err
+}
+
+// send posts the payload of a delivery, any 2xx response is a success.
+func (d *WebhookDispatcher) send(ctx context.Context, webhook *repository.Webhook, delivery *repository.WebhookDelivery) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "polvo-webhook")
+	request.Header.Set(webhookEventHeader, delivery.EventType)
+	request.Header.Set(webhookDeliveryHeader, delivery.ID)
+	request.Header.Set(webhookIdempotencyHeader, delivery.IdempotencyKey)
+	request.Header.Set(webhookAttemptHeader, strconv.Itoa(delivery.Attempts))
+	request.Header.Set(webhookTimestampHeader, timestamp)
+	request.Header.Set(webhookSignatureHeader, SignWebhookPayload(webhook.Secret, timestamp, delivery.Payload))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	// Reads a bit of the body so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, errors.Errorf("unexpected status %s", response.Status)
+	}
+
+	return response.StatusCode, nil
+}
+
+// privateNetworks are the IPv4 and IPv6 ranges of private networks.
+var privateNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+
+	return networks
+}()
+
+// checkWebhookAddress is the net.Dialer Control of the webhook client. It runs
+// on the resolved address of every connection, so that a webhook cannot reach
+// the internal network through its URL or a DNS answer.
+func checkWebhookAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errors.Errorf("webhook address %s is not an IP", address)
+	}
+
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return errors.Errorf("webhook address %s is not allowed", ip)
+	}
+
+	for _, private := range privateNetworks {
+		if private.Contains(ip) {
+			return errors.Errorf("webhook address %s is not allowed", ip)
+		}
+	}
+
+	return nil
+}
+
+// retryDelay is the backoff doubled for every attempt after the first one.
+func (d *WebhookDispatcher) retryDelay(attempts int) time.Duration {
+	delay := d.backoff
+	for i := 1; i < attempts && delay < maxWebhookBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > maxWebhookBackoff {
+		return maxWebhookBackoff
+	}
+
+	return delay
+}
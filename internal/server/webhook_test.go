@@ -0,0 +1,331 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"pkg.aiocean.dev/polvoservice/internal/repository"
+)
+
+// webhookReceiver is a webhook URL answering with status and keeping the
+// requests it got.
+type webhookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newWebhookReceiver(t *testing.T, status int) *webhookReceiver {
+	t.Helper()
+
+	receiver := &webhookReceiver{status: status}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+
+		receiver.requests = append(receiver.requests, r)
+		receiver.bodies = append(receiver.bodies, body)
+		w.WriteHeader(receiver.status)
+	}))
+	t.Cleanup(receiver.Close)
+
+	return receiver
+}
+
+func (r *webhookReceiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.requests)
+}
+
+// newTestDispatcher returns a WebhookDispatcher of s configured with env. It
+// reaches the receivers on loopback unless env sets
+// WEBHOOK_ALLOW_PRIVATE_NETWORKS.
+func newTestDispatcher(t *testing.T, s *Server, env map[string]string) *WebhookDispatcher {
+	t.Helper()
+
+	if _, ok := env["WEBHOOK_ALLOW_PRIVATE_NETWORKS"]; !ok {
+		os.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+		t.Cleanup(func() { os.Unsetenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") })
+	}
+
+	for name, value := range env {
+		os.Setenv(name, value)
+		name := name
+		t.Cleanup(func() { os.Unsetenv(name) })
+	}
+
+	dispatcher, err := NewWebhookDispatcher(zap.NewNop(), s)
+	if err != nil {
+		t.Fatalf("NewWebhookDispatcher: %v", err)
+	}
+
+	return dispatcher
+}
+
+func createWebhook(t *testing.T, repo repository.Repository, url string) *repository.Webhook {
+	t.Helper()
+
+	webhook, err := repo.CreateWebhook(context.Background(), &repository.Webhook{URL: url, Secret: "secret"})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	return webhook
+}
+
+func listDeliveries(t *testing.T, repo repository.Repository) []*repository.WebhookDelivery {
+	t.Helper()
+
+	page, err := repo.ListWebhookDeliveries(context.Background(), repository.ListWebhookDeliveriesOptions{})
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+
+	return page.Deliveries
+}
+
+var testChangeEvent = &ChangeEvent{ID: "event", Sequence: 1, Type: ChangeVersionCreated, Package: "button"}
+
+func TestWebhookDeliveriesAreSigned(t *testing.T) {
+	s, repo := newTestServer(t)
+	ctx := context.Background()
+
+	receiver := newWebhookReceiver(t, http.StatusNoContent)
+	webhook := createWebhook(t, repo, receiver.URL)
+
+	if err := s.enqueueWebhooks(ctx, testChangeEvent); err != nil {
+		t.Fatalf("enqueueWebhooks: %v", err)
+	}
+
+	newTestDispatcher(t, s, nil).dispatchDue(ctx)
+
+	if receiver.count() != 1 {
+		t.Fatalf("the webhook got %d requests, want 1", receiver.count())
+	}
+
+	request, body := receiver.requests[0], receiver.bodies[0]
+	signature := SignWebhookPayload("secret", request.Header.Get(webhookTimestampHeader), body)
+	if !hmac.Equal([]byte(request.Header.Get(webhookSignatureHeader)), []byte(signature)) {
+		t.Errorf("signature = %q, want %q", request.Header.Get(webhookSignatureHeader), signature)
+	}
+
+	if key := request.Header.Get(webhookIdempotencyHeader); key != webhook.ID+"/event" {
+		t.Errorf("idempotency key = %q, want the webhook and the event", key)
+	}
+
+	if request.Header.Get(webhookEventHeader) != string(ChangeVersionCreated) || request.Header.Get(webhookAttemptHeader) != "1" {
+		t.Errorf("headers = %v", request.Header)
+	}
+
+	deliveries := listDeliveries(t, repo)
+	if len(deliveries) != 1 || deliveries[0].State != repository.DeliverySucceeded || deliveries[0].LastStatusCode != http.StatusNoContent {
+		t.Errorf("deliveries = %+v, want one that succeeded", deliveries)
+	}
+}
+
+func TestEventsRelayedAgainAreDeliveredOnce(t *testing.T) {
+	s, repo := newTestServer(t)
+	ctx := context.Background()
+
+	createWebhook(t, repo, "http://example.com/hook")
+
+	for i := 0; i < 2; i++ {
+		if err := s.enqueueWebhooks(ctx, testChangeEvent); err != nil {
+			t.Fatalf("enqueueWebhooks: %v", err)
+		}
+	}
+
+	if deliveries := listDeliveries(t, repo); len(deliveries) != 1 {
+		t.Errorf("the event has %d deliveries, want 1", len(deliveries))
+	}
+}
+
+func TestFailedWebhookDeliveriesAreRetriedThenDead(t *testing.T) {
+	s, repo := newTestServer(t)
+	ctx := context.Background()
+
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError)
+	createWebhook(t, repo, receiver.URL)
+
+	if err := s.enqueueWebhooks(ctx, testChangeEvent); err != nil {
+		t.Fatalf("enqueueWebhooks: %v", err)
+	}
+
+	dispatcher := newTestDispatcher(t, s, map[string]string{
+		"WEBHOOK_RETRY_BACKOFF": "1m",
+		"WEBHOOK_MAX_ATTEMPTS":  "3",
+	})
+
+	// The backoff doubles on every attempt.
+	for attempt, delay := range []time.Duration{time.Minute, 2 * time.Minute} {
+		delivery := listDeliveries(t, repo)[0]
+
+		started := time.Now()
+		if err := dispatcher.dispatch(ctx, delivery); err != nil {
+			t.Fatalf("dispatch: %v", err)
+		}
+
+		retried := listDeliveries(t, repo)[0]
+		if retried.State != repository.DeliveryPending || retried.Attempts != attempt+1 || retried.LastStatusCode != http.StatusInternalServerError {
+			t.Fatalf("delivery after attempt %d = %+v", attempt+1, retried)
+		}
+
+		if wait := retried.NextAttemptAt.Sub(started); wait < delay || wait > delay+time.Minute/2 {
+			t.Errorf("attempt %d is retried after %s, want %s", attempt+1, wait, delay)
+		}
+
+		// It is not due before then.
+		dispatcher.dispatchDue(ctx)
+		if receiver.count() != attempt+1 {
+			t.Fatalf("the webhook got %d requests after attempt %d", receiver.count(), attempt+1)
+		}
+	}
+
+	if err := dispatcher.dispatch(ctx, listDeliveries(t, repo)[0]); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+
+	dead := listDeliveries(t, repo)[0]
+	if dead.State != repository.DeliveryDead || dead.Attempts != 3 || !dead.NextAttemptAt.IsZero() || dead.LastError == "" {
+		t.Errorf("delivery after the last attempt = %+v, want it dead", dead)
+	}
+
+	if delay := dispatcher.retryDelay(20); delay != maxWebhookBackoff {
+		t.Errorf("retryDelay(20) = %s, want it capped at %s", delay, maxWebhookBackoff)
+	}
+}
+
+func TestDeliveriesOfDeletedWebhooksAreDead(t *testing.T) {
+	s, repo := newTestServer(t)
+	ctx := context.Background()
+
+	receiver := newWebhookReceiver(t, http.StatusOK)
+	webhook := createWebhook(t, repo, receiver.URL)
+
+	// The webhook is deleted after the event was matched with it.
+	if err := repo.DeleteWebhook(ctx, webhook.ID); err != nil {
+		t.Fatalf("DeleteWebhook: %v", err)
+	}
+
+	if err := repo.CreateWebhookDeliveries(ctx, []*repository.WebhookDelivery{{
+		WebhookID:      webhook.ID,
+		IdempotencyKey: webhook.ID + "/event",
+		EventType:      string(ChangeVersionCreated),
+		State:          repository.DeliveryPending,
+		NextAttemptAt:  time.Now(),
+	}}); err != nil {
+		t.Fatalf("CreateWebhookDeliveries: %v", err)
+	}
+
+	dispatcher := newTestDispatcher(t, s, nil)
+	dispatcher.dispatchDue(ctx)
+
+	deliveries := listDeliveries(t, repo)
+	if len(deliveries) != 1 || deliveries[0].State != repository.DeliveryDead || deliveries[0].LastError == "" {
+		t.Fatalf("deliveries = %+v, want a dead one", deliveries)
+	}
+
+	// It is not due anymore.
+	if due, _ := repo.ListDueWebhookDeliveries(ctx, time.Now(), 0); len(due) != 0 {
+		t.Errorf("due deliveries = %+v", due)
+	}
+
+	if receiver.count() != 0 {
+		t.Errorf("the deleted webhook got %d requests", receiver.count())
+	}
+}
+
+func TestCreateWebhookValidatesTheRequest(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+
+	for _, request := range []*CreateWebhookRequest{
+		{URL: "ftp://hooks.example.com/polvo"},
+		{URL: "https:///polvo"},
+		{URL: "https://hooks.example.com/polvo", EventTypes: []ChangeType{"version_renamed"}},
+		{URL: "https://hooks.example.com/polvo", PackageOrn: "button"},
+	} {
+		if _, err := s.CreateWebhook(ctx, request); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("CreateWebhook(%+v) = %v, want InvalidArgument", request, err)
+		}
+	}
+
+	created, err := s.CreateWebhook(ctx, &CreateWebhookRequest{URL: "https://hooks.example.com/polvo"})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	if len(created.Secret) != 64 {
+		t.Errorf("generated secret = %q, want 32 random bytes", created.Secret)
+	}
+
+	webhook, err := s.GetWebhook(ctx, &GetWebhookRequest{ID: created.ID})
+	if err != nil || webhook.Secret != "" {
+		t.Errorf("GetWebhook = %+v, %v, want the webhook without its secret", webhook, err)
+	}
+}
+
+func TestWebhooksDoNotReachPrivateAddresses(t *testing.T) {
+	s, repo := newTestServer(t)
+	ctx := context.Background()
+
+	receiver := newWebhookReceiver(t, http.StatusOK)
+	createWebhook(t, repo, receiver.URL)
+
+	if err := s.enqueueWebhooks(ctx, testChangeEvent); err != nil {
+		t.Fatalf("enqueueWebhooks: %v", err)
+	}
+
+	newTestDispatcher(t, s, map[string]string{"WEBHOOK_ALLOW_PRIVATE_NETWORKS": "false"}).dispatchDue(ctx)
+
+	if receiver.count() != 0 {
+		t.Errorf("the webhook on loopback got %d requests", receiver.count())
+	}
+
+	delivery := listDeliveries(t, repo)[0]
+	if delivery.State != repository.DeliveryPending || delivery.LastStatusCode != 0 || !strings.Contains(delivery.LastError, "not allowed") {
+		t.Errorf("delivery = %+v, want a failed attempt without status", delivery)
+	}
+}
+
+func TestCheckWebhookAddress(t *testing.T) {
+	for address, allowed := range map[string]bool{
+		"93.184.216.34:443":         true,
+		"[2606:4700::1111]:443":     true,
+		"127.0.0.1:80":              false,
+		"[::1]:80":                  false,
+		"0.0.0.0:80":                false,
+		"10.1.2.3:80":               false,
+		"172.16.0.1:80":             false,
+		"172.32.0.1:80":             true,
+		"192.168.1.1:80":            false,
+		"100.64.0.1:80":             false,
+		"169.254.169.254:80":        false,
+		"[fe80::1]:80":              false,
+		"[fd00::1]:80":              false,
+		"[::ffff:10.0.0.1]:80":      false,
+		"[::ffff:93.184.216.34]:80": true,
+	} {
+		if err := checkWebhookAddress("tcp", address, nil); (err == nil) != allowed {
+			t.Errorf("checkWebhookAddress(%s) = %v, want allowed %v", address, err, allowed)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Package traffic splits requests between the versions of a package
+// proportionally to the weight facet of each version.
+package traffic
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+)
+
+type Splitter struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func NewSplitter() *Splitter {
+	return &Splitter{
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Pick selects a version at random, proportionally to the weights. It returns
+// nil when no version has a positive weight.
+func (s *Splitter) Pick(versions []*polvo_v1.Version) *polvo_v1.Version {
+	buckets, total := layout(versions)
+	if total == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	point := uint64(s.rand.Int63n(int64(total)))
+	s.mu.Unlock()
+
+	return locate(buckets, point)
+}
+
+// Sticky selects a version deterministically for key, so the same user or
+// session keeps getting the same version while the weights do not change.
+//
+// It uses weighted rendezvous hashing: every version scores the key with a
+// hash of the key and the version name scaled by its weight, and the highest
+// score wins. A version wins a share of the keys equal to its share of the
+// weights, and a weight change only moves keys to or from the changed
+// version. Raising a version from 10% to 20% moves about 10% of the keys, all
+// of them onto that version, and adding or removing a version only moves the
+// keys it gains or loses.
+func Sticky(versions []*polvo_v1.Version, key string) *polvo_v1.Version {
+	var picked *polvo_v1.Version
+	var best float64
+
+	for _, version := range versions {
+		if version.GetWeight() == 0 {
+			continue
+		}
+
+		score := rendezvousScore(key, version)
+		if picked == nil || score > best || (score == best && version.GetName() < picked.GetName()) {
+			picked, best = version, score
+		}
+	}
+
+	return picked
+}
+
+// rendezvousScore is -weight / ln(u), u being the hash of key and the version
+// name mapped to (0, 1). The highest score among versions is distributed like
+// the weights.
+func rendezvousScore(key string, version *polvo_v1.Version) float64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(key))
+	_, _ = hash.Write([]byte{0})
+	_, _ = hash.Write([]byte(version.GetName()))
+
+	// The top 53 bits fit a float64 exactly, the half keeps u away from 0.
+	u := (float64(mix(hash.Sum64())>>11) + 0.5) / (1 << 53)
+
+	return -float64(version.GetWeight()) / math.Log(u)
+}
+
+// mix is the finalizer of MurmurHash3. FNV barely changes its high bits for
+// keys that only differ at the end, like "user-1" and "user-2".
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+
+	return h
+}
+
+type bucket struct {
+	version *polvo_v1.Version
+	// end is the exclusive upper bound of the bucket.
+	end uint64
+}
+
+func layout(versions []*polvo_v1.Version) ([]bucket, uint64) {
+	weighted := make([]*polvo_v1.Version, 0, len(versions))
+	for _, version := range versions {
+		if version.GetWeight() > 0 {
+			weighted = append(weighted, version)
+		}
+	}
+
+	sort.Slice(weighted, func(i, j int) bool {
+		return weighted[i].GetName() < weighted[j].GetName()
+	})
+
+	buckets := make([]bucket, 0, len(weighted))
+	var total uint64
+	for _, version := range weighted {
+		total += uint64(version.GetWeight())
+		buckets = append(buckets, bucket{version: version, end: total})
+	}
+
+	return buckets, total
+}
+
+func locate(buckets []bucket, point uint64) *polvo_v1.Version {
+	i := sort.Search(len(buckets), func(i int) bool {
+		return point < buckets[i].end
+	})
+
+	return buckets[i].version
+}
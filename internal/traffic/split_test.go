@@ -0,0 +1,154 @@
+package traffic
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	polvo_v1 "pkg.aiocean.dev/polvogo/aiocean/polvo/v1"
+)
+
+const testKeys = 20000
+
+func testVersions(weights map[string]uint32) []*polvo_v1.Version {
+	var versions []*polvo_v1.Version
+	for name, weight := range weights {
+		versions = append(versions, &polvo_v1.Version{Name: name, Weight: weight})
+	}
+
+	return versions
+}
+
+func stickyAssignments(weights map[string]uint32) []string {
+	versions := testVersions(weights)
+
+	assignments := make([]string, testKeys)
+	for i := range assignments {
+		if version := Sticky(versions, fmt.Sprintf("user-%d", i)); version != nil {
+			assignments[i] = version.GetName()
+		}
+	}
+
+	return assignments
+}
+
+func TestStickyFollowsWeights(t *testing.T) {
+	weights := map[string]uint32{"1.0.0": 70, "1.1.0": 20, "2.0.0": 10}
+
+	counts := map[string]int{}
+	for _, name := range stickyAssignments(weights) {
+		counts[name]++
+	}
+
+	for name, weight := range weights {
+		share := float64(counts[name]) / testKeys
+		if want := float64(weight) / 100; math.Abs(share-want) > 0.02 {
+			t.Errorf("%s got %.3f of the keys, want %.2f", name, share, want)
+		}
+	}
+}
+
+func TestStickyIsStable(t *testing.T) {
+	versions := testVersions(map[string]uint32{"1.0.0": 50, "2.0.0": 50})
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		if Sticky(versions, key) != Sticky(versions, key) {
+			t.Fatalf("Sticky(%q) changed between calls", key)
+		}
+	}
+}
+
+func TestStickyWithoutWeight(t *testing.T) {
+	if version := Sticky(testVersions(map[string]uint32{"1.0.0": 0}), "user"); version != nil {
+		t.Errorf("Sticky = %v, want nil", version)
+	}
+}
+
+func TestPickFollowsWeights(t *testing.T) {
+	weights := map[string]uint32{"1.0.0": 70, "1.1.0": 20, "2.0.0": 10, "3.0.0": 0}
+	versions := testVersions(weights)
+	splitter := NewSplitter()
+
+	counts := map[string]int{}
+	for i := 0; i < testKeys; i++ {
+		counts[splitter.Pick(versions).GetName()]++
+	}
+
+	for name, weight := range weights {
+		share := float64(counts[name]) / testKeys
+		if want := float64(weight) / 100; math.Abs(share-want) > 0.02 {
+			t.Errorf("%s got %.3f of the picks, want %.2f", name, share, want)
+		}
+	}
+}
+
+func TestPickWithoutWeight(t *testing.T) {
+	if version := NewSplitter().Pick(testVersions(map[string]uint32{"1.0.0": 0, "2.0.0": 0})); version != nil {
+		t.Errorf("Pick = %v, want nil", version)
+	}
+}
+
+// TestStickyMovesFewKeys measures the keys that change version when the
+// weights change. Only the shifted share may move, and only towards the
+// version that gained weight.
+func TestStickyMovesFewKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   map[string]uint32
+		after    map[string]uint32
+		gainer   string
+		maxMoved float64
+		minMoved float64
+	}{
+		{
+			name:     "canary from 10 to 20",
+			before:   map[string]uint32{"1.0.0": 90, "2.0.0": 10},
+			after:    map[string]uint32{"1.0.0": 80, "2.0.0": 20},
+			gainer:   "2.0.0",
+			minMoved: 0.08,
+			maxMoved: 0.12,
+		},
+		{
+			name:     "new version with 10",
+			before:   map[string]uint32{"1.0.0": 60, "1.1.0": 30},
+			after:    map[string]uint32{"1.0.0": 60, "1.1.0": 30, "2.0.0": 10},
+			gainer:   "2.0.0",
+			minMoved: 0.08,
+			maxMoved: 0.12,
+		},
+		{
+			name:     "version removed",
+			before:   map[string]uint32{"1.0.0": 50, "1.1.0": 40, "2.0.0": 10},
+			after:    map[string]uint32{"1.0.0": 50, "1.1.0": 40},
+			minMoved: 0.08,
+			maxMoved: 0.12,
+		},
+	}
+
+	for _, test := range tests {
+		before, after := stickyAssignments(test.before), stickyAssignments(test.after)
+
+		moved := 0
+		for i := range before {
+			if before[i] == after[i] {
+				continue
+			}
+
+			moved++
+
+			if test.gainer != "" && after[i] != test.gainer {
+				t.Errorf("%s: key %d moved from %s to %s, not to %s", test.name, i, before[i], after[i], test.gainer)
+			}
+
+			if test.gainer == "" && before[i] != "2.0.0" {
+				t.Errorf("%s: key %d of %s moved to %s", test.name, i, before[i], after[i])
+			}
+		}
+
+		share := float64(moved) / testKeys
+		if share < test.minMoved || share > test.maxMoved {
+			t.Errorf("%s moved %.3f of the keys, want between %.2f and %.2f", test.name, share, test.minMoved, test.maxMoved)
+		}
+	}
+}